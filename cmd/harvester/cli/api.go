@@ -2,6 +2,9 @@ package cli
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/HewlettPackard/galadriel/pkg/harvester"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/config"
@@ -10,7 +13,10 @@ import (
 
 const defaultConfigPath = "conf/harvester/harvester.conf"
 
-var configPath string
+var (
+	configPath    string
+	joinTokenFile string
+)
 
 func NewRunCmd() *cobra.Command {
 	return &cobra.Command{
@@ -23,7 +29,12 @@ func NewRunCmd() *cobra.Command {
 				return err
 			}
 
-			err = HarvesterCmd.runHarvesterAPI(configPath)
+			joinTokenFile, err := cmd.Flags().GetString("joinTokenFile")
+			if err != nil {
+				return err
+			}
+
+			err = HarvesterCmd.runHarvesterAPI(configPath, joinTokenFile)
 			if err != nil {
 				return err
 			}
@@ -33,22 +44,51 @@ func NewRunCmd() *cobra.Command {
 	}
 }
 
-func (hc *HarvesterCLI) runHarvesterAPI(configPath string) error {
+func (hc *HarvesterCLI) runHarvesterAPI(configPath, joinTokenFile string) error {
 	cfg, err := config.LoadFromDisk(configPath)
 	if err != nil {
 		hc.logger.Error("Error loading Harvester config:", err)
 		return err
 	}
 
+	if joinTokenFile != "" {
+		joinToken, err := readJoinToken(joinTokenFile)
+		if err != nil {
+			hc.logger.Error("Error loading join token:", err)
+			return err
+		}
+		cfg.HarvesterConfigSection.JoinToken = joinToken
+	}
+
 	ctx := context.Background()
-	harvester.NewHarvesterManager().Start(ctx, *cfg)
+	if err := harvester.NewHarvesterManager().Start(ctx, *cfg); err != nil {
+		hc.logger.Error("Harvester failed:", err)
+		return err
+	}
 
 	return nil
 }
 
+// readJoinToken reads the join token from the given file. Unlike a command
+// line argument, the file is not exposed to the other users of the host.
+func readJoinToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read join token file: %v", err)
+	}
+
+	joinToken := strings.TrimSpace(string(b))
+	if joinToken == "" {
+		return "", fmt.Errorf("join token file %q is empty", path)
+	}
+
+	return joinToken, nil
+}
+
 func init() {
 	runCmd := NewRunCmd()
 	runCmd.PersistentFlags().StringVarP(&configPath, "config", "c", defaultConfigPath, "config file")
+	runCmd.PersistentFlags().StringVar(&joinTokenFile, "joinTokenFile", "", "file holding the join token used to onboard with the Galadriel Server, overriding the one of the config file")
 
 	RootCmd.AddCommand(runCmd)
 }
@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewRunCmd(t *testing.T) {
@@ -18,7 +21,12 @@ func TestNewRunCmd(t *testing.T) {
 				return err
 			}
 
-			err = HarvesterCmd.runHarvesterAPI(configPath)
+			joinTokenFile, err := cmd.Flags().GetString("joinTokenFile")
+			if err != nil {
+				return err
+			}
+
+			err = HarvesterCmd.runHarvesterAPI(configPath, joinTokenFile)
 			if err != nil {
 				return err
 			}
@@ -28,3 +36,21 @@ func TestNewRunCmd(t *testing.T) {
 	}
 	assert.ObjectsAreEqual(expected, NewRunCmd())
 }
+
+func TestReadJoinToken(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "join_token")
+	require.NoError(t, os.WriteFile(path, []byte("token\n"), 0600))
+
+	joinToken, err := readJoinToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "token", joinToken)
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0600))
+	_, err = readJoinToken(empty)
+	assert.EqualError(t, err, "join token file \""+empty+"\" is empty")
+
+	_, err = readJoinToken(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "failed to read join token file")
+}
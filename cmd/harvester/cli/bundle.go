@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+func NewBundleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "bundle",
+		Short: "Inspect trust bundles",
+		Long:  "Run this command to inspect the trust bundles of the SPIRE Server managed by the harvester",
+	}
+}
+
+func NewBundleShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show the trust bundle of the SPIRE Server",
+		Long:  "Run this command to show the trust bundle of the SPIRE Server managed by the harvester",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bundle, err := adminClient(cmd).GetBundle(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			return printOutput(cmd, bundle, func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, bundle.Bundle)
+				return err
+			})
+		},
+	}
+}
+
+func NewBundleListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List federated trust bundles",
+		Long:  "Run this command to list the trust bundles of the trust domains federated with the SPIRE Server managed by the harvester",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bundles, err := adminClient(cmd).ListFederatedBundles(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if bundles == nil {
+				bundles = []common.TrustBundle{}
+			}
+
+			return printOutput(cmd, bundles, func(w io.Writer) error {
+				return printBundlesTable(w, bundles)
+			})
+		},
+	}
+}
+
+func printBundlesTable(w io.Writer, bundles []common.TrustBundle) error {
+	if len(bundles) == 0 {
+		_, err := fmt.Fprintln(w, "No federated trust bundles found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRUST DOMAIN\tBUNDLE")
+	for _, b := range bundles {
+		fmt.Fprintf(tw, "%s\t%s\n", valueOrDash(b.TrustDomain), b.Bundle)
+	}
+
+	return tw.Flush()
+}
+
+// newBundleCmdTree returns the bundle command with its subcommands and flags.
+func newBundleCmdTree() *cobra.Command {
+	bundleCmd := NewBundleCmd()
+	addAdminFlags(bundleCmd)
+
+	bundleCmd.AddCommand(
+		NewBundleShowCmd(),
+		NewBundleListCmd(),
+	)
+
+	return bundleCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newBundleCmdTree())
+}
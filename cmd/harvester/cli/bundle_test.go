@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleCmd(t *testing.T) {
+	socketPath := serveAdminSocket(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "show",
+			args:     []string{"show"},
+			expected: "{\"keys\":[]}\n",
+		},
+		{
+			name: "show_json",
+			args: []string{"show", "-o", "json"},
+			expected: `{
+  "bundle": "{\"keys\":[]}",
+  "id": 0,
+  "trustDomain": "example.org"
+}
+`,
+		},
+		{
+			name: "list",
+			args: []string{"list"},
+			expected: "TRUST DOMAIN  BUNDLE\n" +
+				"other.org     {\"keys\":[]}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeAdminCmd(newBundleCmdTree(), socketPath, tt.args...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
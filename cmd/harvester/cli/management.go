@@ -1,9 +1,23 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/api/admin"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/config"
 	"github.com/spf13/cobra"
 )
 
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
 func NewFederationtCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "federation",
@@ -12,7 +26,216 @@ func NewFederationtCmd() *cobra.Command {
 	}
 }
 
+func NewFederationListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List federation relationships",
+		Long:  "Run this command to list the federation relationships of the trust domain of the harvester",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := cmd.Flags().GetString("status")
+			if err != nil {
+				return err
+			}
+			federationGroupID, err := cmd.Flags().GetInt64("federationGroupId")
+			if err != nil {
+				return err
+			}
+
+			relationships, err := adminClient(cmd).ListRelationships(cmd.Context(), status, federationGroupID)
+			if err != nil {
+				return err
+			}
+
+			return printRelationships(cmd, relationships)
+		},
+	}
+	cmd.Flags().String("status", "", "filter relationships by status <invited|active|inactive>")
+	cmd.Flags().Int64("federationGroupId", 0, "filter relationships by federation group")
+
+	return cmd
+}
+
+func NewFederationShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a federation relationship",
+		Long:  "Run this command to show a federation relationship of the trust domain of the harvester",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseRelationshipID(args[0])
+			if err != nil {
+				return err
+			}
+
+			relationship, err := adminClient(cmd).GetRelationship(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return printRelationship(cmd, relationship)
+		},
+	}
+}
+
+func NewFederationApproveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "approve <id>",
+		Short: "Approve a federation relationship",
+		Long:  "Run this command to give the consent of the trust domain of the harvester to a federation relationship",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseRelationshipID(args[0])
+			if err != nil {
+				return err
+			}
+
+			relationship, err := adminClient(cmd).ApproveRelationship(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return printRelationship(cmd, relationship)
+		},
+	}
+}
+
+func NewFederationDenyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deny <id>",
+		Short: "Deny a federation relationship",
+		Long:  "Run this command to deny, or revoke, the consent of the trust domain of the harvester to a federation relationship",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseRelationshipID(args[0])
+			if err != nil {
+				return err
+			}
+
+			relationship, err := adminClient(cmd).DenyRelationship(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return printRelationship(cmd, relationship)
+		},
+	}
+}
+
+// addAdminFlags adds the flags of the commands using the admin API of the
+// harvester to cmd and its subcommands.
+func addAdminFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("socketPath", config.DefaultAdminSocketPath, "path of the admin socket of the harvester")
+	cmd.PersistentFlags().StringP("output", "o", outputTable, "output format <table|json>")
+}
+
+// adminClient returns a client of the admin API of the harvester listening on
+// the socket of the command flags.
+func adminClient(cmd *cobra.Command) *admin.Client {
+	socketPath, _ := cmd.Flags().GetString("socketPath")
+	return admin.NewClient(socketPath)
+}
+
+func parseRelationshipID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid federation relationship id %q", arg)
+	}
+
+	return id, nil
+}
+
+// printRelationships prints the relationships in the output format of the
+// command flags.
+func printRelationships(cmd *cobra.Command, relationships []common.FederationRelationship) error {
+	if relationships == nil {
+		relationships = []common.FederationRelationship{}
+	}
+
+	return printOutput(cmd, relationships, func(w io.Writer) error {
+		return printRelationshipsTable(w, relationships)
+	})
+}
+
+// printRelationship prints the relationship in the output format of the
+// command flags.
+func printRelationship(cmd *cobra.Command, relationship *common.FederationRelationship) error {
+	return printOutput(cmd, relationship, func(w io.Writer) error {
+		return printRelationshipsTable(w, []common.FederationRelationship{*relationship})
+	})
+}
+
+// printOutput prints v as JSON, or as a table with printTable, depending on
+// the output format of the command flags.
+func printOutput(cmd *cobra.Command, v interface{}, printTable func(io.Writer) error) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case outputJSON:
+		return printJSON(cmd.OutOrStdout(), v)
+	case outputTable:
+		return printTable(cmd.OutOrStdout())
+	}
+
+	return fmt.Errorf("invalid output format %q: must be %s or %s", output, outputTable, outputJSON)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printRelationshipsTable(w io.Writer, relationships []common.FederationRelationship) error {
+	if len(relationships) == 0 {
+		_, err := fmt.Fprintln(w, "No federation relationships found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tGROUP\tSPIRE SERVER\tCONSENT\tFEDERATED WITH\tCONSENT\tSTATUS")
+	for _, r := range relationships {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			r.Id,
+			r.FederationGroupId,
+			r.SpireServer,
+			valueOrDash(r.SpireServerConsent),
+			r.SpireServerFederatedWith,
+			valueOrDash(r.SpireServerFederatedWithConsent),
+			valueOrDash((*string)(r.Status)),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func valueOrDash(s *string) string {
+	if s == nil || *s == "" {
+		return "-"
+	}
+
+	return *s
+}
+
+// newFederationCmdTree returns the federation command with its subcommands
+// and flags.
+func newFederationCmdTree() *cobra.Command {
+	federationCmd := NewFederationtCmd()
+	addAdminFlags(federationCmd)
+
+	federationCmd.AddCommand(
+		NewFederationListCmd(),
+		NewFederationShowCmd(),
+		NewFederationApproveCmd(),
+		NewFederationDenyCmd(),
+	)
+
+	return federationCmd
+}
+
 func init() {
-	runCmd := NewFederationtCmd()
-	RootCmd.AddCommand(runCmd)
+	RootCmd.AddCommand(newFederationCmdTree())
 }
@@ -1,10 +1,19 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/api/admin"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewFederationtCmd(t *testing.T) {
@@ -15,3 +24,169 @@ func TestNewFederationtCmd(t *testing.T) {
 	}
 	assert.ObjectsAreEqual(expected, NewFederationtCmd())
 }
+
+// serveAdminSocket serves canned admin API responses on a unix domain socket,
+// and returns its path.
+func serveAdminSocket(t *testing.T) string {
+	invited := common.FederationRelationshipStatusInvited
+	consent := common.ConsentPending
+	relationship := common.FederationRelationship{
+		Id:                              1,
+		FederationGroupId:               2,
+		SpireServer:                     "example.org",
+		SpireServerConsent:              &consent,
+		SpireServerFederatedWith:        "other.org",
+		SpireServerFederatedWithConsent: &consent,
+		Status:                          &invited,
+	}
+	accepted := relationship
+	acceptedConsent := common.ConsentAccepted
+	accepted.SpireServerConsent = &acceptedConsent
+
+	writeJSON := func(w http.ResponseWriter, code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/federation/relationships", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("status") == "active" {
+			writeJSON(w, http.StatusOK, []common.FederationRelationship{})
+			return
+		}
+		writeJSON(w, http.StatusOK, []common.FederationRelationship{relationship})
+	})
+	mux.HandleFunc("/federation/relationships/1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, relationship)
+	})
+	mux.HandleFunc("/federation/relationships/1/approve", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, accepted)
+	})
+	mux.HandleFunc("/federation/relationships/1/deny", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusConflict, common.Error{Code: http.StatusConflict, Message: "relationship is inactive"})
+	})
+
+	trustDomain, otherTrustDomain := "example.org", "other.org"
+	mux.HandleFunc("/bundle", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, common.TrustBundle{TrustDomain: &trustDomain, Bundle: `{"keys":[]}`})
+	})
+	mux.HandleFunc("/bundles/federated", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []common.TrustBundle{{TrustDomain: &otherTrustDomain, Bundle: `{"keys":[]}`}})
+	})
+
+	lastSync := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	lastError := "galadriel server is down"
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		status := admin.SyncStatus{
+			LastSync:              &lastSync,
+			LastSuccess:           &lastSync,
+			FederatedTrustDomains: []string{otherTrustDomain},
+			ManagedRelationships:  []string{},
+		}
+		if r.Method == http.MethodPost {
+			status.LastError = &lastError
+			status.LastSuccess = nil
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+
+	return socketPath
+}
+
+func TestFederationCmd(t *testing.T) {
+	socketPath := serveAdminSocket(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name: "list",
+			args: []string{"list"},
+			expected: "ID  GROUP  SPIRE SERVER  CONSENT  FEDERATED WITH  CONSENT  STATUS\n" +
+				"1   2      example.org   pending  other.org       pending  invited\n",
+		},
+		{
+			name:     "list_empty",
+			args:     []string{"list", "--status", "active"},
+			expected: "No federation relationships found\n",
+		},
+		{
+			name:     "list_json",
+			args:     []string{"list", "--status", "active", "-o", "json"},
+			expected: "[]\n",
+		},
+		{
+			name: "show_json",
+			args: []string{"show", "1", "--output", "json"},
+			expected: `{
+  "federationGroupId": 2,
+  "id": 1,
+  "spireServer": "example.org",
+  "spireServerConsent": "pending",
+  "spireServerFederatedWith": "other.org",
+  "spireServerFederatedWithConsent": "pending",
+  "status": "invited"
+}
+`,
+		},
+		{
+			name: "approve",
+			args: []string{"approve", "1"},
+			expected: "ID  GROUP  SPIRE SERVER  CONSENT   FEDERATED WITH  CONSENT  STATUS\n" +
+				"1   2      example.org   accepted  other.org       pending  invited\n",
+		},
+		{
+			name: "deny_error",
+			args: []string{"deny", "1"},
+			err:  "relationship is inactive (status 409)",
+		},
+		{
+			name: "invalid_id",
+			args: []string{"show", "one"},
+			err:  `invalid federation relationship id "one"`,
+		},
+		{
+			name: "invalid_output",
+			args: []string{"list", "-o", "yaml"},
+			err:  `invalid output format "yaml": must be table or json`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := executeAdminCmd(newFederationCmdTree(), socketPath, tt.args...)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+// executeAdminCmd executes cmd with the given arguments against the admin
+// API served on socketPath, and returns its output.
+func executeAdminCmd(cmd *cobra.Command, socketPath string, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append(args, "--socketPath", socketPath))
+
+	err := cmd.Execute()
+	return out.String(), err
+}
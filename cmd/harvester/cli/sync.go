@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/harvester/api/admin"
+	"github.com/spf13/cobra"
+)
+
+func NewSyncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Manage the synchronization with the Galadriel Server",
+		Long:  "Run this command to inspect and trigger the synchronization of the harvester with the Galadriel Server",
+	}
+}
+
+func NewSyncStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the sync status",
+		Long:  "Run this command to show the status of the synchronizations of the harvester with the Galadriel Server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := adminClient(cmd).GetSyncStatus(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			return printSyncStatus(cmd, status)
+		},
+	}
+}
+
+func NewSyncRunCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "Synchronize right away",
+		Long:  "Run this command to synchronize the harvester with the Galadriel Server without waiting for the sync interval",
+		Args:  cobra.NoArgs,
+		// A failed sync is not a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := adminClient(cmd).Resync(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if err := printSyncStatus(cmd, status); err != nil {
+				return err
+			}
+			if status.LastError != nil {
+				return fmt.Errorf("sync failed: %s", *status.LastError)
+			}
+
+			return nil
+		},
+	}
+}
+
+func printSyncStatus(cmd *cobra.Command, status *admin.SyncStatus) error {
+	return printOutput(cmd, status, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Last sync:\t%s\n", timeOrDash(status.LastSync))
+		fmt.Fprintf(tw, "Last success:\t%s\n", timeOrDash(status.LastSuccess))
+		fmt.Fprintf(tw, "Last error:\t%s\n", valueOrDash(status.LastError))
+		fmt.Fprintf(tw, "Federated trust domains:\t%s\n", listOrDash(status.FederatedTrustDomains))
+		fmt.Fprintf(tw, "Managed relationships:\t%s\n", listOrDash(status.ManagedRelationships))
+		return tw.Flush()
+	})
+}
+
+func timeOrDash(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func listOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// newSyncCmdTree returns the sync command with its subcommands and flags.
+func newSyncCmdTree() *cobra.Command {
+	syncCmd := NewSyncCmd()
+	addAdminFlags(syncCmd)
+
+	syncCmd.AddCommand(
+		NewSyncStatusCmd(),
+		NewSyncRunCmd(),
+	)
+
+	return syncCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newSyncCmdTree())
+}
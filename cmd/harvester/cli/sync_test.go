@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCmd(t *testing.T) {
+	socketPath := serveAdminSocket(t)
+
+	out, err := executeAdminCmd(newSyncCmdTree(), socketPath, "status")
+	require.NoError(t, err)
+	assert.Equal(t, "Last sync:                2022-09-01T10:00:00Z\n"+
+		"Last success:             2022-09-01T10:00:00Z\n"+
+		"Last error:               -\n"+
+		"Federated trust domains:  other.org\n"+
+		"Managed relationships:    -\n", out)
+
+	// The status is printed even if the sync failed
+	out, err = executeAdminCmd(newSyncCmdTree(), socketPath, "run", "-o", "json")
+	assert.EqualError(t, err, "sync failed: galadriel server is down")
+	assert.JSONEq(t, `{
+		"lastSync": "2022-09-01T10:00:00Z",
+		"lastError": "galadriel server is down",
+		"federatedTrustDomains": ["other.org"],
+		"managedRelationships": []
+	}`, out)
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/spf13/cobra"
+)
+
+func NewFederationGroupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "federation-group",
+		Short: "Manage federation groups",
+		Long:  "Run this command to create, list and delete federation groups",
+	}
+}
+
+func NewFederationGroupCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a federation group",
+		Long:  "Run this command to create a federation group in an organization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			orgID, err := cmd.Flags().GetInt64("orgId")
+			if err != nil {
+				return err
+			}
+
+			group, err := managementClient(cmd).CreateFederationGroup(cmd.Context(), orgID, args[0])
+			if err != nil {
+				return err
+			}
+
+			return printFederationGroups(cmd, group, []management.FederationGroup{*group})
+		},
+	}
+	cmd.Flags().Int64("orgId", 0, "id of the organization of the federation group")
+	_ = cmd.MarkFlagRequired("orgId")
+
+	return cmd
+}
+
+func NewFederationGroupListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List federation groups",
+		Long:  "Run this command to list the federation groups",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			orgID, err := cmd.Flags().GetInt64("orgId")
+			if err != nil {
+				return err
+			}
+			orgName, err := cmd.Flags().GetString("orgName")
+			if err != nil {
+				return err
+			}
+			name, err := cmd.Flags().GetString("name")
+			if err != nil {
+				return err
+			}
+
+			params := management.GetFederationGroupsParams{Orgname: &orgName, Name: &name}
+			if orgID != 0 {
+				id := strconv.FormatInt(orgID, 10)
+				params.OrgId = &id
+			}
+
+			groups, err := managementClient(cmd).ListFederationGroups(cmd.Context(), params)
+			if err != nil {
+				return err
+			}
+			if groups == nil {
+				groups = []management.FederationGroup{}
+			}
+
+			return printFederationGroups(cmd, groups, groups)
+		},
+	}
+	cmd.Flags().Int64("orgId", 0, "filter federation groups by organization id")
+	cmd.Flags().String("orgName", "", "filter federation groups by organization name")
+	cmd.Flags().String("name", "", "filter federation groups by name")
+
+	return cmd
+}
+
+func NewFederationGroupDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a federation group",
+		Long:  "Run this command to delete a federation group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("federation group", args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := managementClient(cmd).DeleteFederationGroup(cmd.Context(), id); err != nil {
+				return err
+			}
+
+			return printDeleted(cmd, "federation group", id)
+		},
+	}
+}
+
+// printFederationGroups prints v as JSON, or the groups as a table.
+func printFederationGroups(cmd *cobra.Command, v interface{}, groups []management.FederationGroup) error {
+	return printOutput(cmd, v, func(w io.Writer) error {
+		if len(groups) == 0 {
+			_, err := fmt.Fprintln(w, "No federation groups found")
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tORGANIZATION\tNAME\tSTATUS")
+		for _, group := range groups {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", group.Id, group.Orgid, group.Name, valueOrDash((*string)(group.Status)))
+		}
+
+		return tw.Flush()
+	})
+}
+
+// newFederationGroupCmdTree returns the federation-group command with its
+// subcommands and flags.
+func newFederationGroupCmdTree() *cobra.Command {
+	federationGroupCmd := NewFederationGroupCmd()
+	addManagementFlags(federationGroupCmd)
+
+	federationGroupCmd.AddCommand(
+		NewFederationGroupCreateCmd(),
+		NewFederationGroupListCmd(),
+		NewFederationGroupDeleteCmd(),
+	)
+
+	return federationGroupCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newFederationGroupCmdTree())
+}
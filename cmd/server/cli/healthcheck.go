@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"github.com/HewlettPackard/galadriel/pkg/common/health"
+	"github.com/spf13/cobra"
+)
+
+// defaultHealthChecksAddress is the default health checks listen address of
+// the server.
+const defaultHealthChecksAddress = "localhost:8082"
+
+func NewHealthcheckCmd() *cobra.Command {
+	return health.NewHealthcheckCmd("server", defaultHealthChecksAddress)
+}
+
+func init() {
+	RootCmd.AddCommand(NewHealthcheckCmd())
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+
+	// defaultManagementAddress is the default management listen address of
+	// the server.
+	defaultManagementAddress = "localhost:8081"
+)
+
+// addManagementFlags adds the flags of the commands using the management API
+// of the server to cmd and its subcommands.
+func addManagementFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("address", defaultManagementAddress, "address of the management API of the server")
+	cmd.PersistentFlags().StringP("output", "o", outputTable, "output format <table|json>")
+}
+
+// managementClient returns a client of the management API listening on the
+// address of the command flags.
+func managementClient(cmd *cobra.Command) *management.Client {
+	address, _ := cmd.Flags().GetString("address")
+	return management.NewClient(address)
+}
+
+func parseID(kind, arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s id %q", kind, arg)
+	}
+
+	return id, nil
+}
+
+// outputFormat returns the output format of the command flags.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+
+	switch output {
+	case outputTable, outputJSON:
+		return output, nil
+	}
+
+	return "", fmt.Errorf("invalid output format %q: must be %s or %s", output, outputTable, outputJSON)
+}
+
+// printOutput prints v as JSON, or as a table with printTable, depending on
+// the output format of the command flags.
+func printOutput(cmd *cobra.Command, v interface{}, printTable func(io.Writer) error) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	return printTable(cmd.OutOrStdout())
+}
+
+// printDeleted confirms the deletion of a resource. Nothing is printed in the
+// JSON output format, so that scripts only rely on the exit code.
+func printDeleted(cmd *cobra.Command, kind string, id int64) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	if output == outputTable {
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s %d\n", kind, id)
+	}
+
+	return err
+}
+
+func valueOrDash(s *string) string {
+	if s == nil || *s == "" {
+		return "-"
+	}
+
+	return *s
+}
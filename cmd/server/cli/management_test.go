@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveManagementAPI serves the management API backed by a new datastore, and
+// returns its address.
+func serveManagementAPI(t *testing.T) string {
+	ds, err := datastore.NewSQLDatastore(context.Background(), datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	router := echo.New()
+	management.RegisterHandlers(router, management.NewHandler(ds))
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return u.Host
+}
+
+// executeManagementCmd executes cmd with the given arguments against the
+// management API served on address, and returns its output.
+func executeManagementCmd(cmd *cobra.Command, address string, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append(args, "--address", address))
+
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestManagementCmds(t *testing.T) {
+	address := serveManagementAPI(t)
+
+	// Every step runs against the state left by the previous ones
+	steps := []struct {
+		name     string
+		cmd      func() *cobra.Command
+		args     []string
+		expected string
+		err      string
+	}{
+		{
+			name: "create_organization",
+			cmd:  newOrganizationCmdTree,
+			args: []string{"create", "org"},
+			expected: "ID  NAME\n" +
+				"1   org\n",
+		},
+		{
+			name: "create_duplicated_organization",
+			cmd:  newOrganizationCmdTree,
+			args: []string{"create", "org"},
+			err:  "failed to create organization: already exists (status 409)",
+		},
+		{
+			name:     "list_organizations_json",
+			cmd:      newOrganizationCmdTree,
+			args:     []string{"list", "-o", "json"},
+			expected: "[\n  {\n    \"id\": 1,\n    \"name\": \"org\"\n  }\n]\n",
+		},
+		{
+			name: "create_federation_group",
+			cmd:  newFederationGroupCmdTree,
+			args: []string{"create", "group", "--orgId", "1"},
+			expected: "ID  ORGANIZATION  NAME   STATUS\n" +
+				"1   1             group  active\n",
+		},
+		{
+			name:     "list_federation_groups_empty",
+			cmd:      newFederationGroupCmdTree,
+			args:     []string{"list", "--name", "other"},
+			expected: "No federation groups found\n",
+		},
+		{
+			name: "register_spire_server",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"register", "example.org"},
+			expected: "ID  TRUST DOMAIN  STATUS   BUNDLE ENDPOINT  PROFILE  DESCRIPTION\n" +
+				"1   example.org   invited  -                -        -\n",
+		},
+		{
+			name: "register_spire_server_with_bundle_endpoint",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"register", "other.org", "--bundleEndpointUrl", "https://other.org/bundle", "--bundleEndpointProfile", "https_web"},
+			expected: "ID  TRUST DOMAIN  STATUS   BUNDLE ENDPOINT           PROFILE    DESCRIPTION\n" +
+				"2   other.org     invited  https://other.org/bundle  https_web  -\n",
+		},
+		{
+			name: "update_spire_server",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"update", "1", "--description", "example"},
+			expected: "ID  TRUST DOMAIN  STATUS   BUNDLE ENDPOINT  PROFILE  DESCRIPTION\n" +
+				"1   example.org   invited  -                -        example\n",
+		},
+		{
+			name: "show_spire_server",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"show", "1"},
+			expected: "ID  TRUST DOMAIN  STATUS   BUNDLE ENDPOINT  PROFILE  DESCRIPTION\n" +
+				"1   example.org   invited  -                -        example\n",
+		},
+		{
+			name: "update_missing_spire_server",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"update", "3", "--description", "example"},
+			err:  "spire server: not found (status 404)",
+		},
+		{
+			name: "join_token_missing_spire_server",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"join-token", "3"},
+			err:  "spire server: not found (status 404)",
+		},
+		{
+			name: "join_token_invalid_ttl",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"join-token", "1", "--ttl", "200h"},
+			err:  "ttl must be between 1 and 604800 seconds (status 400)",
+		},
+		{
+			name: "list_spire_servers",
+			cmd:  newSpireServerCmdTree,
+			args: []string{"list", "--trustDomain", "other.org"},
+			expected: "ID  TRUST DOMAIN  STATUS   BUNDLE ENDPOINT           PROFILE    DESCRIPTION\n" +
+				"2   other.org     invited  https://other.org/bundle  https_web  -\n",
+		},
+		{
+			name: "add_membership",
+			cmd:  newMembershipCmdTree,
+			args: []string{"add", "--spireServerId", "1", "--federationGroupId", "1"},
+			expected: "ID  SPIRE SERVER  FEDERATION GROUP  STATUS\n" +
+				"1   1             1                 active\n",
+		},
+		{
+			name:     "add_membership_json",
+			cmd:      newMembershipCmdTree,
+			args:     []string{"add", "--spireServerId", "2", "--federationGroupId", "1", "-o", "json"},
+			expected: "{\n  \"federationGroupId\": 1,\n  \"id\": 2,\n  \"spireServerId\": 2,\n  \"status\": \"active\"\n}\n",
+		},
+		{
+			name: "create_relationship",
+			cmd:  newRelationshipCmdTree,
+			args: []string{"create", "--federationGroupId", "1", "--spireServer", "example.org", "--federatedWith", "other.org"},
+			expected: "ID  GROUP  SPIRE SERVER  CONSENT  FEDERATED WITH  CONSENT  STATUS\n" +
+				"1   1      example.org   pending  other.org       pending  invited\n",
+		},
+		{
+			name: "list_relationships",
+			cmd:  newRelationshipCmdTree,
+			args: []string{"list", "--status", "invited"},
+			expected: "ID  GROUP  SPIRE SERVER  CONSENT  FEDERATED WITH  CONSENT  STATUS\n" +
+				"1   1      example.org   pending  other.org       pending  invited\n",
+		},
+		{
+			name:     "list_relationships_empty",
+			cmd:      newRelationshipCmdTree,
+			args:     []string{"list", "--status", "active"},
+			expected: "No federation relationships found\n",
+		},
+		{
+			name: "show_missing_relationship",
+			cmd:  newRelationshipCmdTree,
+			args: []string{"show", "2"},
+			err:  "relationship: not found (status 404)",
+		},
+		{
+			name: "show_invalid_relationship_id",
+			cmd:  newRelationshipCmdTree,
+			args: []string{"show", "one"},
+			err:  `invalid federation relationship id "one"`,
+		},
+		{
+			name:     "remove_membership",
+			cmd:      newMembershipCmdTree,
+			args:     []string{"remove", "2"},
+			expected: "Deleted membership 2\n",
+		},
+		{
+			name: "delete_organization_json",
+			cmd:  newOrganizationCmdTree,
+			args: []string{"delete", "2", "-o", "json"},
+			err:  "organization: not found (status 404)",
+		},
+		{
+			name: "invalid_output",
+			cmd:  newOrganizationCmdTree,
+			args: []string{"list", "-o", "yaml"},
+			err:  `invalid output format "yaml": must be table or json`,
+		},
+	}
+
+	for _, step := range steps {
+		out, err := executeManagementCmd(step.cmd(), address, step.args...)
+		if step.err != "" {
+			assert.EqualError(t, err, step.err, step.name)
+			continue
+		}
+
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.expected, out, step.name)
+	}
+}
+
+func TestSpireServerJoinTokenCmd(t *testing.T) {
+	address := serveManagementAPI(t)
+	_, err := executeManagementCmd(newSpireServerCmdTree(), address, "register", "example.org")
+	require.NoError(t, err)
+
+	out, err := executeManagementCmd(newSpireServerCmdTree(), address, "join-token", "1", "--ttl", "24h", "-o", "json")
+	require.NoError(t, err)
+
+	var token management.JoinToken
+	require.NoError(t, json.Unmarshal([]byte(out), &token))
+	assert.NotEmpty(t, token.Token)
+	assert.Equal(t, int64(1), token.SpireServerId)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), token.ExpiresAt, time.Minute)
+
+	out, err = executeManagementCmd(newSpireServerCmdTree(), address, "join-token", "1")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^TOKEN\s+SPIRE SERVER\s+EXPIRES AT$`, lines[0])
+	assert.Regexp(t, `^\S+\s+1\s+\S+$`, lines[1])
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func NewMembershipCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "membership",
+		Short: "Manage federation group memberships",
+		Long:  "Run this command to add SPIRE servers to federation groups, and remove them",
+	}
+}
+
+func NewMembershipAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a SPIRE server to a federation group",
+		Long:  "Run this command to add a SPIRE server to a federation group",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			spireServerID, err := cmd.Flags().GetInt64("spireServerId")
+			if err != nil {
+				return err
+			}
+			federationGroupID, err := cmd.Flags().GetInt64("federationGroupId")
+			if err != nil {
+				return err
+			}
+
+			membership, err := managementClient(cmd).CreateMembership(cmd.Context(), spireServerID, federationGroupID)
+			if err != nil {
+				return err
+			}
+
+			return printOutput(cmd, membership, func(w io.Writer) error {
+				tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "ID\tSPIRE SERVER\tFEDERATION GROUP\tSTATUS")
+				fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", int64Value(membership.Id), membership.SpireServerId, membership.FederationGroupId, membership.Status)
+				return tw.Flush()
+			})
+		},
+	}
+	cmd.Flags().Int64("spireServerId", 0, "id of the SPIRE server to add")
+	cmd.Flags().Int64("federationGroupId", 0, "id of the federation group")
+	_ = cmd.MarkFlagRequired("spireServerId")
+	_ = cmd.MarkFlagRequired("federationGroupId")
+
+	return cmd
+}
+
+func NewMembershipRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove a SPIRE server from a federation group",
+		Long:  "Run this command to delete a federation group membership",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("membership", args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := managementClient(cmd).DeleteMembership(cmd.Context(), id); err != nil {
+				return err
+			}
+
+			return printDeleted(cmd, "membership", id)
+		},
+	}
+}
+
+func int64Value(i *int64) int64 {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
+
+// newMembershipCmdTree returns the membership command with its subcommands
+// and flags.
+func newMembershipCmdTree() *cobra.Command {
+	membershipCmd := NewMembershipCmd()
+	addManagementFlags(membershipCmd)
+
+	membershipCmd.AddCommand(
+		NewMembershipAddCmd(),
+		NewMembershipRemoveCmd(),
+	)
+
+	return membershipCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newMembershipCmdTree())
+}
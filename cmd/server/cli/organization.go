@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/spf13/cobra"
+)
+
+func NewOrganizationCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "organization",
+		Short: "Manage organizations",
+		Long:  "Run this command to create, list and delete organizations",
+	}
+}
+
+func NewOrganizationCreateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an organization",
+		Long:  "Run this command to create an organization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			org, err := managementClient(cmd).CreateOrganization(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			return printOrganizations(cmd, org, []management.Organization{*org})
+		},
+	}
+}
+
+func NewOrganizationListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List organizations",
+		Long:  "Run this command to list the organizations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, err := cmd.Flags().GetString("name")
+			if err != nil {
+				return err
+			}
+
+			orgs, err := managementClient(cmd).ListOrganizations(cmd.Context(), name)
+			if err != nil {
+				return err
+			}
+			if orgs == nil {
+				orgs = []management.Organization{}
+			}
+
+			return printOrganizations(cmd, orgs, orgs)
+		},
+	}
+	cmd.Flags().String("name", "", "filter organizations by name")
+
+	return cmd
+}
+
+func NewOrganizationDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete an organization",
+		Long:  "Run this command to delete an organization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("organization", args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := managementClient(cmd).DeleteOrganization(cmd.Context(), id); err != nil {
+				return err
+			}
+
+			return printDeleted(cmd, "organization", id)
+		},
+	}
+}
+
+// printOrganizations prints v as JSON, or the organizations as a table.
+func printOrganizations(cmd *cobra.Command, v interface{}, orgs []management.Organization) error {
+	return printOutput(cmd, v, func(w io.Writer) error {
+		if len(orgs) == 0 {
+			_, err := fmt.Fprintln(w, "No organizations found")
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME")
+		for _, org := range orgs {
+			fmt.Fprintf(tw, "%d\t%s\n", org.Id, org.Name)
+		}
+
+		return tw.Flush()
+	})
+}
+
+// newOrganizationCmdTree returns the organization command with its
+// subcommands and flags.
+func newOrganizationCmdTree() *cobra.Command {
+	organizationCmd := NewOrganizationCmd()
+	addManagementFlags(organizationCmd)
+
+	organizationCmd.AddCommand(
+		NewOrganizationCreateCmd(),
+		NewOrganizationListCmd(),
+		NewOrganizationDeleteCmd(),
+	)
+
+	return organizationCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newOrganizationCmdTree())
+}
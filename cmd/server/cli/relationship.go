@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/spf13/cobra"
+)
+
+func NewRelationshipCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "relationship",
+		Short: "Manage federation relationships",
+		Long:  "Run this command to propose and inspect federation relationships",
+	}
+}
+
+func NewRelationshipCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Propose a federation relationship",
+		Long:  "Run this command to propose a federation relationship between two SPIRE servers of a federation group. The relationship is active once the harvesters of both sides approve it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			federationGroupID, err := cmd.Flags().GetInt64("federationGroupId")
+			if err != nil {
+				return err
+			}
+			spireServer, err := cmd.Flags().GetString("spireServer")
+			if err != nil {
+				return err
+			}
+			federatedWith, err := cmd.Flags().GetString("federatedWith")
+			if err != nil {
+				return err
+			}
+
+			relationship, err := managementClient(cmd).CreateRelationship(cmd.Context(), federationGroupID, spireServer, federatedWith)
+			if err != nil {
+				return err
+			}
+
+			return printRelationships(cmd, relationship, []common.FederationRelationship{*relationship})
+		},
+	}
+	cmd.Flags().Int64("federationGroupId", 0, "id of the federation group of the relationship")
+	cmd.Flags().String("spireServer", "", "trust domain of the SPIRE server of one side")
+	cmd.Flags().String("federatedWith", "", "trust domain of the SPIRE server of the other side")
+	_ = cmd.MarkFlagRequired("federationGroupId")
+	_ = cmd.MarkFlagRequired("spireServer")
+	_ = cmd.MarkFlagRequired("federatedWith")
+
+	return cmd
+}
+
+func NewRelationshipListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List federation relationships",
+		Long:  "Run this command to list the federation relationships",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trustDomain, err := cmd.Flags().GetString("trustDomain")
+			if err != nil {
+				return err
+			}
+			orgName, err := cmd.Flags().GetString("orgName")
+			if err != nil {
+				return err
+			}
+			status, err := cmd.Flags().GetString("status")
+			if err != nil {
+				return err
+			}
+
+			params := management.GetFederationRelationshipsParams{TrustDomain: &trustDomain, Orgname: &orgName}
+			if status != "" {
+				paramsStatus := management.GetFederationRelationshipsParamsStatus(status)
+				params.Status = &paramsStatus
+			}
+
+			relationships, err := managementClient(cmd).ListRelationships(cmd.Context(), params)
+			if err != nil {
+				return err
+			}
+			if relationships == nil {
+				relationships = []common.FederationRelationship{}
+			}
+
+			return printRelationships(cmd, relationships, relationships)
+		},
+	}
+	cmd.Flags().String("trustDomain", "", "filter relationships by the trust domain of either side")
+	cmd.Flags().String("orgName", "", "filter relationships by organization name")
+	cmd.Flags().String("status", "", "filter relationships by status <invited|active|inactive>")
+
+	return cmd
+}
+
+func NewRelationshipShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a federation relationship",
+		Long:  "Run this command to show a federation relationship",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("federation relationship", args[0])
+			if err != nil {
+				return err
+			}
+
+			relationship, err := managementClient(cmd).GetRelationship(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return printRelationships(cmd, relationship, []common.FederationRelationship{*relationship})
+		},
+	}
+}
+
+// printRelationships prints v as JSON, or the relationships as a table.
+func printRelationships(cmd *cobra.Command, v interface{}, relationships []common.FederationRelationship) error {
+	return printOutput(cmd, v, func(w io.Writer) error {
+		if len(relationships) == 0 {
+			_, err := fmt.Fprintln(w, "No federation relationships found")
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tGROUP\tSPIRE SERVER\tCONSENT\tFEDERATED WITH\tCONSENT\tSTATUS")
+		for _, r := range relationships {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				r.Id,
+				r.FederationGroupId,
+				r.SpireServer,
+				valueOrDash(r.SpireServerConsent),
+				r.SpireServerFederatedWith,
+				valueOrDash(r.SpireServerFederatedWithConsent),
+				valueOrDash((*string)(r.Status)),
+			)
+		}
+
+		return tw.Flush()
+	})
+}
+
+// newRelationshipCmdTree returns the relationship command with its
+// subcommands and flags.
+func newRelationshipCmdTree() *cobra.Command {
+	relationshipCmd := NewRelationshipCmd()
+	addManagementFlags(relationshipCmd)
+
+	relationshipCmd.AddCommand(
+		NewRelationshipCreateCmd(),
+		NewRelationshipListCmd(),
+		NewRelationshipShowCmd(),
+	)
+
+	return relationshipCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newRelationshipCmdTree())
+}
@@ -0,0 +1,279 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/spf13/cobra"
+)
+
+func NewSpireServerCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "spire-server",
+		Short: "Manage SPIRE servers",
+		Long:  "Run this command to register, list, show, update and delete the SPIRE servers of the bridge, and to create the join tokens their harvesters onboard with",
+	}
+}
+
+func NewSpireServerRegisterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "register <trustDomain>",
+		Short: "Register a SPIRE server",
+		Long:  "Run this command to register the SPIRE server of a trust domain. The SPIRE server is invited until its harvester onboards",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trustDomain := args[0]
+			server := management.SpireServer{TrustDomain: &trustDomain}
+			applySpireServerFlags(cmd, &server)
+
+			created, err := managementClient(cmd).CreateSpireServer(cmd.Context(), server)
+			if err != nil {
+				return err
+			}
+
+			return printSpireServers(cmd, created, []management.SpireServer{*created})
+		},
+	}
+	addSpireServerFlags(cmd)
+
+	return cmd
+}
+
+func NewSpireServerListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List SPIRE servers",
+		Long:  "Run this command to list the SPIRE servers of the bridge",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trustDomain, err := cmd.Flags().GetString("trustDomain")
+			if err != nil {
+				return err
+			}
+			status, err := cmd.Flags().GetString("status")
+			if err != nil {
+				return err
+			}
+
+			params := management.GetSpireServersParams{TrustDomain: &trustDomain}
+			if status != "" {
+				paramsStatus := management.GetSpireServersParamsStatus(status)
+				params.Status = &paramsStatus
+			}
+
+			servers, err := managementClient(cmd).ListSpireServers(cmd.Context(), params)
+			if err != nil {
+				return err
+			}
+			if servers == nil {
+				servers = []management.SpireServer{}
+			}
+
+			return printSpireServers(cmd, servers, servers)
+		},
+	}
+	cmd.Flags().String("trustDomain", "", "filter SPIRE servers by trust domain")
+	cmd.Flags().String("status", "", "filter SPIRE servers by status <invited|active|inactive>")
+
+	return cmd
+}
+
+func NewSpireServerShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a SPIRE server",
+		Long:  "Run this command to show a SPIRE server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("spire server", args[0])
+			if err != nil {
+				return err
+			}
+
+			server, err := managementClient(cmd).GetSpireServer(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return printSpireServers(cmd, server, []management.SpireServer{*server})
+		},
+	}
+}
+
+func NewSpireServerUpdateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update <id>",
+		Short: "Update a SPIRE server",
+		Long:  "Run this command to update the description, status or bundle endpoint of a SPIRE server. Only the given flags are updated",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("spire server", args[0])
+			if err != nil {
+				return err
+			}
+
+			client := managementClient(cmd)
+
+			// The whole SPIRE server is updated, so the flags are applied on
+			// top of its current values
+			server, err := client.GetSpireServer(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			applySpireServerFlags(cmd, server)
+
+			updated, err := client.UpdateSpireServer(cmd.Context(), id, *server)
+			if err != nil {
+				return err
+			}
+
+			return printSpireServers(cmd, updated, []management.SpireServer{*updated})
+		},
+	}
+	addSpireServerFlags(cmd)
+	cmd.Flags().String("status", "", "set to inactive to deactivate the SPIRE server, it is activated when its harvester onboards")
+
+	return cmd
+}
+
+func NewSpireServerDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a SPIRE server",
+		Long:  "Run this command to delete a SPIRE server from the bridge",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("spire server", args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := managementClient(cmd).DeleteSpireServer(cmd.Context(), id); err != nil {
+				return err
+			}
+
+			return printDeleted(cmd, "spire server", id)
+		},
+	}
+}
+
+func NewSpireServerJoinTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "join-token <id>",
+		Short: "Create a join token for a SPIRE server",
+		Long:  "Run this command to create a single-use join token that the harvester of a SPIRE server onboards with",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID("spire server", args[0])
+			if err != nil {
+				return err
+			}
+			ttl, err := cmd.Flags().GetDuration("ttl")
+			if err != nil {
+				return err
+			}
+
+			token, err := managementClient(cmd).CreateJoinToken(cmd.Context(), id, ttl)
+			if err != nil {
+				return err
+			}
+
+			return printOutput(cmd, token, func(w io.Writer) error {
+				tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "TOKEN\tSPIRE SERVER\tEXPIRES AT")
+				fmt.Fprintf(tw, "%s\t%d\t%s\n", token.Token, token.SpireServerId, token.ExpiresAt.Format(time.RFC3339))
+				return tw.Flush()
+			})
+		},
+	}
+	cmd.Flags().Duration("ttl", 0, "time to live of the join token, up to 168h (default 1h)")
+
+	return cmd
+}
+
+func addSpireServerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("description", "", "description of the SPIRE server")
+	cmd.Flags().String("bundleEndpointUrl", "", "https URL of the SPIFFE bundle endpoint of the SPIRE server")
+	cmd.Flags().String("bundleEndpointProfile", "", "profile of the bundle endpoint <https_web|https_spiffe>")
+	cmd.Flags().String("bundleEndpointSpiffeId", "", "SPIFFE ID of the bundle endpoint server, required by the https_spiffe profile")
+}
+
+// applySpireServerFlags sets the fields of the SPIRE server whose flags were
+// given.
+func applySpireServerFlags(cmd *cobra.Command, server *management.SpireServer) {
+	flags := cmd.Flags()
+	value := func(name string) *string {
+		if !flags.Changed(name) {
+			return nil
+		}
+		v, _ := flags.GetString(name)
+		return &v
+	}
+
+	if description := value("description"); description != nil {
+		server.Description = *description
+	}
+	if status := value("status"); status != nil {
+		server.Status = management.SpireServerStatus(*status)
+	}
+	if url := value("bundleEndpointUrl"); url != nil {
+		server.BundleEndpointUrl = url
+	}
+	if profile := value("bundleEndpointProfile"); profile != nil {
+		server.BundleEndpointProfile = (*management.SpireServerBundleEndpointProfile)(profile)
+	}
+	if spiffeID := value("bundleEndpointSpiffeId"); spiffeID != nil {
+		server.BundleEndpointSpiffeId = spiffeID
+	}
+}
+
+// printSpireServers prints v as JSON, or the SPIRE servers as a table.
+func printSpireServers(cmd *cobra.Command, v interface{}, servers []management.SpireServer) error {
+	return printOutput(cmd, v, func(w io.Writer) error {
+		if len(servers) == 0 {
+			_, err := fmt.Fprintln(w, "No SPIRE servers found")
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTRUST DOMAIN\tSTATUS\tBUNDLE ENDPOINT\tPROFILE\tDESCRIPTION")
+		for _, server := range servers {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				server.Id,
+				valueOrDash(server.TrustDomain),
+				server.Status,
+				valueOrDash(server.BundleEndpointUrl),
+				valueOrDash((*string)(server.BundleEndpointProfile)),
+				valueOrDash(&server.Description),
+			)
+		}
+
+		return tw.Flush()
+	})
+}
+
+// newSpireServerCmdTree returns the spire-server command with its
+// subcommands and flags.
+func newSpireServerCmdTree() *cobra.Command {
+	spireServerCmd := NewSpireServerCmd()
+	addManagementFlags(spireServerCmd)
+
+	spireServerCmd.AddCommand(
+		NewSpireServerRegisterCmd(),
+		NewSpireServerListCmd(),
+		NewSpireServerShowCmd(),
+		NewSpireServerUpdateCmd(),
+		NewSpireServerJoinTokenCmd(),
+		NewSpireServerDeleteCmd(),
+	)
+
+	return spireServerCmd
+}
+
+func init() {
+	RootCmd.AddCommand(newSpireServerCmdTree())
+}
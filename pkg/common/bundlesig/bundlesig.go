@@ -0,0 +1,114 @@
+// Package bundlesig signs the trust bundles uploaded by the harvesters, and
+// verifies them on the receiving side, so that the Galadriel Server can only
+// relay the trust bundles and not forge them.
+package bundlesig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+const certificateBlockType = "CERTIFICATE"
+
+// Sign signs the trust bundle bytes with the private key of the X509-SVID. It
+// returns the base64 encoded signature, and the PEM encoded certificate chain
+// of the X509-SVID to verify it with.
+func Sign(bundle []byte, svid *x509svid.SVID) (signature string, certificates string, err error) {
+	if svid == nil || len(svid.Certificates) == 0 {
+		return "", "", errors.New("no X509-SVID to sign with")
+	}
+
+	digest := sha256.Sum256(bundle)
+	sig, err := svid.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign trust bundle: %v", err)
+	}
+
+	var chain []byte
+	for _, cert := range svid.Certificates {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: certificateBlockType, Bytes: cert.Raw})...)
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), string(chain), nil
+}
+
+// Verify verifies that the trust bundle bytes of the given trust domain were
+// signed by an X509-SVID of that trust domain, valid according to the trusted
+// bundles. It returns the SPIFFE ID of the signer.
+func Verify(td spiffeid.TrustDomain, bundle []byte, signature, certificates string, trusted x509bundle.Source) (spiffeid.ID, error) {
+	if signature == "" || certificates == "" {
+		return spiffeid.ID{}, errors.New("trust bundle is not signed")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return spiffeid.ID{}, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+
+	certs, err := parseCertificates([]byte(certificates))
+	if err != nil {
+		return spiffeid.ID{}, err
+	}
+
+	id, _, err := x509svid.Verify(certs, trusted)
+	if err != nil {
+		return spiffeid.ID{}, fmt.Errorf("invalid signing X509-SVID: %v", err)
+	}
+	if id.TrustDomain() != td {
+		return spiffeid.ID{}, fmt.Errorf("trust bundle of %q signed by %q", td, id)
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch certs[0].PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	default:
+		return spiffeid.ID{}, fmt.Errorf("unsupported signing key type %T", certs[0].PublicKey)
+	}
+
+	if err := certs[0].CheckSignature(algorithm, bundle, sig); err != nil {
+		return spiffeid.ID{}, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	return id, nil
+}
+
+func parseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != certificateBlockType {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no signing certificate found")
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,166 @@
+package bundlesig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, td spiffeid.TrustDomain) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		URIs:                  []*url.URL{td.ID().URL()},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) mint(t *testing.T, id spiffeid.ID, key crypto.Signer) *x509svid.SVID {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		URIs:         []*url.URL{id.URL()},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &x509svid.SVID{ID: id, Certificates: []*x509.Certificate{cert}, PrivateKey: key}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("td1.org")
+	otherTD := spiffeid.RequireTrustDomainFromString("td2.org")
+	ca := newTestCA(t, td)
+	otherCA := newTestCA(t, otherTD)
+	trusted := x509bundle.NewSet(
+		x509bundle.FromX509Authorities(td, []*x509.Certificate{ca.cert}),
+		x509bundle.FromX509Authorities(otherTD, []*x509.Certificate{otherCA.cert}),
+	)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	harvesterID := spiffeid.RequireFromPath(td, "/galadriel/harvester")
+	bundle := []byte(`{"keys":[]}`)
+
+	tests := []struct {
+		name   string
+		svid   *x509svid.SVID
+		td     spiffeid.TrustDomain
+		bundle []byte
+		err    string
+
+		errContains bool
+	}{
+		{
+			name:   "ecdsa",
+			svid:   ca.mint(t, harvesterID, ecKey),
+			td:     td,
+			bundle: bundle,
+		},
+		{
+			name:   "rsa",
+			svid:   ca.mint(t, harvesterID, rsaKey),
+			td:     td,
+			bundle: bundle,
+		},
+		{
+			name:   "err_tampered_bundle",
+			svid:   ca.mint(t, harvesterID, ecKey),
+			td:     td,
+			bundle: []byte(`{"keys":[{}]}`),
+			err:    "invalid signature: x509: ECDSA verification failure",
+		},
+		{
+			name:   "err_other_trust_domain",
+			svid:   otherCA.mint(t, spiffeid.RequireFromPath(otherTD, "/galadriel/harvester"), ecKey),
+			td:     td,
+			bundle: bundle,
+			err:    `trust bundle of "td1.org" signed by "spiffe://td2.org/galadriel/harvester"`,
+		},
+		{
+			name:   "err_untrusted_signer",
+			svid:   newTestCA(t, td).mint(t, harvesterID, ecKey),
+			td:     td,
+			bundle: bundle,
+			err:    "invalid signing X509-SVID: x509svid: could not verify leaf certificate: x509: certificate signed by unknown authority",
+			// The error also mentions the candidate authority that failed
+			errContains: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			signature, certificates, err := Sign(bundle, tt.svid)
+			require.NoError(t, err)
+
+			id, err := Verify(tt.td, tt.bundle, signature, certificates, trusted)
+			switch {
+			case tt.errContains:
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			case tt.err != "":
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.svid.ID, id)
+		})
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("td1.org")
+	trusted := x509bundle.NewSet()
+
+	_, err := Verify(td, nil, "", "", trusted)
+	assert.EqualError(t, err, "trust bundle is not signed")
+
+	_, err = Verify(td, nil, "not base64!", "certificates", trusted)
+	assert.EqualError(t, err, "invalid signature encoding: illegal base64 data at input byte 3")
+
+	_, err = Verify(td, nil, "c2lnbmF0dXJl", "not pem", trusted)
+	assert.EqualError(t, err, "no signing certificate found")
+
+	_, _, err = Sign(nil, nil)
+	assert.EqualError(t, err, "no X509-SVID to sign with")
+}
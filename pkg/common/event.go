@@ -0,0 +1,8 @@
+package common
+
+import "errors"
+
+// ErrEventsExpired is returned when the events after a given one are asked
+// for, but some of the events that followed it are no longer retained. The
+// caller must resync instead of resuming after it.
+var ErrEventsExpired = errors.New("cursor expired, resync")
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// NewHealthcheckCmd returns the healthcheck command of the named component,
+// probing its health checks at the given address by default.
+func NewHealthcheckCmd(name, defaultAddress string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "healthcheck",
+		Short: fmt.Sprintf("Check the health of the %s", name),
+		Long:  fmt.Sprintf("Run this command to check that a running %s is ready, or only live with --shallow, e.g. in container probes", name),
+		Args:  cobra.NoArgs,
+		// An unhealthy component is not a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address, err := cmd.Flags().GetString("address")
+			if err != nil {
+				return err
+			}
+			shallow, err := cmd.Flags().GetBool("shallow")
+			if err != nil {
+				return err
+			}
+			verbose, err := cmd.Flags().GetBool("verbose")
+			if err != nil {
+				return err
+			}
+
+			path := ReadyPath
+			if shallow {
+				path = LivePath
+			}
+
+			status, err := Probe(cmd.Context(), address, path)
+			if verbose && status != nil {
+				printChecks(cmd.OutOrStdout(), status)
+			}
+			if err != nil {
+				return fmt.Errorf("%s is unhealthy: %v", name, err)
+			}
+
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s%s is healthy.\n", strings.ToUpper(name[:1]), name[1:])
+			return err
+		},
+	}
+
+	cmd.Flags().String("address", defaultAddress, fmt.Sprintf("address of the health checks of the %s", name))
+	cmd.Flags().Bool("shallow", false, fmt.Sprintf("only check that the %s is live, not that it is ready", name))
+	cmd.Flags().Bool("verbose", false, "print the result of every check")
+
+	return cmd
+}
+
+func printChecks(w io.Writer, status *Status) {
+	names := make([]string, 0, len(status.Checks))
+	for name := range status.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%s: %s\n", name, status.Checks[name])
+	}
+}
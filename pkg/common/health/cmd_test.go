@@ -0,0 +1,52 @@
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthcheckCmd(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, code := Status{Status: "live"}, http.StatusOK
+		if r.URL.Path == ReadyPath {
+			status = Status{Status: "not_ready", Checks: map[string]string{
+				"spire_server": "ok",
+				"sync":         "no successful sync yet",
+			}}
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	t.Cleanup(server.Close)
+	address := server.Listener.Addr().String()
+
+	execute := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		cmd := NewHealthcheckCmd("harvester", address)
+		cmd.SetOut(&out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := execute("--shallow")
+	require.NoError(t, err)
+	assert.Equal(t, "Harvester is healthy.\n", out)
+
+	out, err = execute("--verbose")
+	assert.EqualError(t, err, "harvester is unhealthy: not_ready: sync: no successful sync yet")
+	assert.Equal(t, "spire_server: ok\nsync: no successful sync yet\n", out)
+
+	_, err = execute("--address", "localhost:1")
+	assert.ErrorContains(t, err, "harvester is unhealthy: failed to probe /ready")
+}
@@ -0,0 +1,178 @@
+// Package health serves the liveness and readiness endpoints of the Galadriel
+// Server and Harvester, used by orchestrators and by the healthcheck commands.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// LivePath is the path of the liveness endpoint.
+	LivePath = "/live"
+	// ReadyPath is the path of the readiness endpoint.
+	ReadyPath = "/ready"
+
+	// checkTimeout bounds the time the readiness checks are given to
+	// complete, so that a hung dependency fails the probe instead of
+	// blocking it.
+	checkTimeout = 5 * time.Second
+)
+
+// Check reports why a component is not ready, or nil if it is.
+type Check func(ctx context.Context) error
+
+// Status is the body of the responses of the health endpoints.
+type Status struct {
+	// Status is "live" for the liveness endpoint, and "ready" or "not_ready"
+	// for the readiness endpoint.
+	Status string `json:"status"`
+	// Checks are the results of the readiness checks by name: "ok", or the
+	// reason the component is not ready.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Server serves the health endpoints.
+type Server struct {
+	address string
+	checks  map[string]Check
+	logger  common.Logger
+}
+
+// NewServer returns a server of the health endpoints on the given address.
+// It is ready when all the checks pass.
+func NewServer(address string, checks map[string]Check) *Server {
+	return &Server{
+		address: address,
+		checks:  checks,
+		logger:  *common.NewLogger(telemetry.HealthChecks),
+	}
+}
+
+// Run serves the health endpoints until the context is done.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on health checks address: %v", err)
+	}
+
+	server := &http.Server{Handler: s.newRouter()}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- server.Serve(listener)
+	}()
+	s.logger.Info("Serving health checks on", listener.Addr())
+
+	select {
+	case err = <-errch:
+	case <-ctx.Done():
+		err = server.Shutdown(context.Background())
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	return err
+}
+
+func (s *Server) newRouter() *echo.Echo {
+	router := echo.New()
+	router.HideBanner = true
+	router.HidePort = true
+	router.GET(LivePath, s.live)
+	router.GET(ReadyPath, s.ready)
+
+	return router
+}
+
+func (s *Server) live(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, Status{Status: "live"})
+}
+
+func (s *Server) ready(ctx echo.Context) error {
+	checkCtx, cancel := context.WithTimeout(ctx.Request().Context(), checkTimeout)
+	defer cancel()
+
+	status := Status{Status: "ready", Checks: make(map[string]string, len(s.checks))}
+	code := http.StatusOK
+	for name, check := range s.checks {
+		if err := check(checkCtx); err != nil {
+			status.Status = "not_ready"
+			status.Checks[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[name] = "ok"
+	}
+
+	return ctx.JSON(code, status)
+}
+
+// Probe checks the health endpoint at the given path of the server listening
+// on the given address, and returns the status it reported. It fails if the
+// server is not live, or not ready for the readiness endpoint.
+func Probe(ctx context.Context, address, path string) (*Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*checkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var status Status
+	if err := json.Unmarshal(body, &status); err != nil || status.Status == "" {
+		return nil, fmt.Errorf("invalid response from %s: %s", path, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if reasons := failedChecks(status); reasons != "" {
+			return &status, fmt.Errorf("%s: %s", status.Status, reasons)
+		}
+		return &status, errors.New(status.Status)
+	}
+
+	return &status, nil
+}
+
+// failedChecks returns the reasons of the failed checks of the status.
+func failedChecks(status Status) string {
+	var names []string
+	for name, result := range status.Checks {
+		if result != "ok" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var msg string
+	for i, name := range names {
+		if i > 0 {
+			msg += "; "
+		}
+		msg += name + ": " + status.Checks[name]
+	}
+
+	return msg
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe(t *testing.T) {
+	var datastoreErr error
+	s := NewServer("", map[string]Check{
+		"datastore": func(context.Context) error { return datastoreErr },
+		"listeners": func(context.Context) error { return nil },
+	})
+	server := httptest.NewServer(s.newRouter())
+	t.Cleanup(server.Close)
+	address := server.Listener.Addr().String()
+
+	status, err := Probe(context.Background(), address, LivePath)
+	require.NoError(t, err)
+	assert.Equal(t, &Status{Status: "live"}, status)
+
+	status, err = Probe(context.Background(), address, ReadyPath)
+	require.NoError(t, err)
+	assert.Equal(t, &Status{Status: "ready", Checks: map[string]string{"datastore": "ok", "listeners": "ok"}}, status)
+
+	// The server is still live when it is not ready
+	datastoreErr = errors.New("database is locked")
+	_, err = Probe(context.Background(), address, LivePath)
+	require.NoError(t, err)
+
+	status, err = Probe(context.Background(), address, ReadyPath)
+	require.EqualError(t, err, "not_ready: datastore: database is locked")
+	assert.Equal(t, &Status{Status: "not_ready", Checks: map[string]string{"datastore": "database is locked", "listeners": "ok"}}, status)
+
+	_, err = Probe(context.Background(), address, "/unknown")
+	require.EqualError(t, err, "invalid response from /unknown: 404 Not Found")
+}
+
+func TestRun(t *testing.T) {
+	s := NewServer("localhost:0", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- s.Run(ctx) }()
+	cancel()
+	require.NoError(t, <-errch)
+
+	// A failure to listen is returned
+	s = NewServer("invalid:address:0", nil)
+	require.Error(t, s.Run(context.Background()))
+}
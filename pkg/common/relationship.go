@@ -0,0 +1,84 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Values of the consent fields of a FederationRelationship.
+const (
+	ConsentPending  = "pending"
+	ConsentAccepted = "accepted"
+	ConsentDenied   = "denied"
+)
+
+// ErrInvalidTransition is returned when a change of the consent or status of
+// a federation relationship is not allowed in its current state.
+var ErrInvalidTransition = errors.New("invalid federation relationship transition")
+
+// Federation relationships follow a two-party consent workflow. An admin
+// proposes a relationship, which is invited until the SPIRE servers of both
+// sides give their consent:
+//
+//	invited --(both sides accept)--> active
+//	invited --(either side denies)--> inactive
+//	active  --(either side revokes)--> inactive
+//	inactive --(admin proposes again)--> invited
+//
+// A side revokes its consent by denying it. Admins may deactivate a
+// relationship at any time, but only the consent of both sides activates it.
+
+// RelationshipStatus returns the status of a relationship with the given
+// consent of each side.
+func RelationshipStatus(spireServerConsent, spireServerFederatedWithConsent string) FederationRelationshipStatus {
+	switch {
+	case spireServerConsent == ConsentDenied || spireServerFederatedWithConsent == ConsentDenied:
+		return FederationRelationshipStatusInactive
+	case spireServerConsent == ConsentAccepted && spireServerFederatedWithConsent == ConsentAccepted:
+		return FederationRelationshipStatusActive
+	}
+
+	return FederationRelationshipStatusInvited
+}
+
+// ValidateConsentTransition checks that the consent of one side of a
+// relationship with the given status can change from current to next.
+func ValidateConsentTransition(status FederationRelationshipStatus, current, next string) error {
+	switch next {
+	case ConsentAccepted, ConsentDenied:
+	default:
+		return fmt.Errorf("invalid consent %q", next)
+	}
+
+	switch {
+	case status == FederationRelationshipStatusInactive:
+		return fmt.Errorf("relationship is inactive and must be proposed again: %w", ErrInvalidTransition)
+	case current == next:
+		return fmt.Errorf("consent is already %s: %w", current, ErrInvalidTransition)
+	case current == ConsentDenied:
+		return fmt.Errorf("denied consent cannot be %s: %w", next, ErrInvalidTransition)
+	}
+
+	return nil
+}
+
+// ValidateStatusTransition checks that an admin can change the status of a
+// relationship from current to next.
+func ValidateStatusTransition(current, next FederationRelationshipStatus) error {
+	switch next {
+	case FederationRelationshipStatusInvited, FederationRelationshipStatusActive, FederationRelationshipStatusInactive:
+	default:
+		return fmt.Errorf("invalid federation relationship status %q", next)
+	}
+
+	switch {
+	case current == next:
+		return fmt.Errorf("relationship is already %s: %w", current, ErrInvalidTransition)
+	case next == FederationRelationshipStatusActive:
+		return fmt.Errorf("relationship only becomes active when both sides consent: %w", ErrInvalidTransition)
+	case next == FederationRelationshipStatusInvited && current != FederationRelationshipStatusInactive:
+		return fmt.Errorf("only inactive relationships can be proposed again: %w", ErrInvalidTransition)
+	}
+
+	return nil
+}
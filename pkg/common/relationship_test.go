@@ -0,0 +1,119 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelationshipStatus(t *testing.T) {
+	assert.Equal(t, FederationRelationshipStatusInvited, RelationshipStatus(ConsentPending, ConsentPending))
+	assert.Equal(t, FederationRelationshipStatusInvited, RelationshipStatus(ConsentAccepted, ConsentPending))
+	assert.Equal(t, FederationRelationshipStatusActive, RelationshipStatus(ConsentAccepted, ConsentAccepted))
+	assert.Equal(t, FederationRelationshipStatusInactive, RelationshipStatus(ConsentPending, ConsentDenied))
+	assert.Equal(t, FederationRelationshipStatusInactive, RelationshipStatus(ConsentAccepted, ConsentDenied))
+}
+
+func TestValidateConsentTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  FederationRelationshipStatus
+		current string
+		next    string
+		err     string
+	}{
+		{name: "accept", status: FederationRelationshipStatusInvited, current: ConsentPending, next: ConsentAccepted},
+		{name: "deny", status: FederationRelationshipStatusInvited, current: ConsentPending, next: ConsentDenied},
+		{name: "withdraw", status: FederationRelationshipStatusInvited, current: ConsentAccepted, next: ConsentDenied},
+		{name: "revoke", status: FederationRelationshipStatusActive, current: ConsentAccepted, next: ConsentDenied},
+		{
+			name:    "invalid_consent",
+			status:  FederationRelationshipStatusInvited,
+			current: ConsentPending,
+			next:    ConsentPending,
+			err:     `invalid consent "pending"`,
+		},
+		{
+			name:    "already_accepted",
+			status:  FederationRelationshipStatusActive,
+			current: ConsentAccepted,
+			next:    ConsentAccepted,
+			err:     "consent is already accepted: invalid federation relationship transition",
+		},
+		{
+			name:    "inactive",
+			status:  FederationRelationshipStatusInactive,
+			current: ConsentPending,
+			next:    ConsentAccepted,
+			err:     "relationship is inactive and must be proposed again: invalid federation relationship transition",
+		},
+		{
+			name:    "denied",
+			status:  FederationRelationshipStatusInvited,
+			current: ConsentDenied,
+			next:    ConsentAccepted,
+			err:     "denied consent cannot be accepted: invalid federation relationship transition",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConsentTransition(tt.status, tt.current, tt.next)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateStatusTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		current FederationRelationshipStatus
+		next    FederationRelationshipStatus
+		err     string
+	}{
+		{name: "deactivate_invited", current: FederationRelationshipStatusInvited, next: FederationRelationshipStatusInactive},
+		{name: "deactivate_active", current: FederationRelationshipStatusActive, next: FederationRelationshipStatusInactive},
+		{name: "propose_again", current: FederationRelationshipStatusInactive, next: FederationRelationshipStatusInvited},
+		{
+			name:    "invalid_status",
+			current: FederationRelationshipStatusInvited,
+			next:    "unknown",
+			err:     `invalid federation relationship status "unknown"`,
+		},
+		{
+			name:    "activate",
+			current: FederationRelationshipStatusInvited,
+			next:    FederationRelationshipStatusActive,
+			err:     "relationship only becomes active when both sides consent: invalid federation relationship transition",
+		},
+		{
+			name:    "same_status",
+			current: FederationRelationshipStatusInactive,
+			next:    FederationRelationshipStatusInactive,
+			err:     "relationship is already inactive: invalid federation relationship transition",
+		},
+		{
+			name:    "propose_active",
+			current: FederationRelationshipStatusActive,
+			next:    FederationRelationshipStatusInvited,
+			err:     "only inactive relationships can be proposed again: invalid federation relationship transition",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStatusTransition(tt.current, tt.next)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -3,6 +3,25 @@
 // Code generated by github.com/deepmap/oapi-codegen version v1.11.0 DO NOT EDIT.
 package common
 
+import (
+	"time"
+)
+
+// Defines values for BundleEndpointProfile.
+const (
+	HttpsSpiffe BundleEndpointProfile = "https_spiffe"
+	HttpsWeb    BundleEndpointProfile = "https_web"
+)
+
+// Defines values for EventType.
+const (
+	RelationshipUpdated EventType = "relationship_updated"
+	TrustBundleDeleted  EventType = "trust_bundle_deleted"
+	TrustBundlePruned   EventType = "trust_bundle_pruned"
+	TrustBundleToDelete EventType = "trust_bundle_to_delete"
+	TrustBundleUpdated  EventType = "trust_bundle_updated"
+)
+
 // Defines values for FederationRelationshipStatus.
 const (
 	FederationRelationshipStatusActive   FederationRelationshipStatus = "active"
@@ -17,32 +36,71 @@ const (
 	TrustBundleStatusToDelete TrustBundleStatus = "to_delete"
 )
 
+// BundleEndpoint defines model for BundleEndpoint.
+type BundleEndpoint struct {
+	Profile  BundleEndpointProfile `json:"profile"`
+	SpiffeId *string               `json:"spiffeId,omitempty"`
+	Url      string                `json:"url"`
+}
+
+// BundleEndpointProfile defines model for BundleEndpoint.Profile.
+type BundleEndpointProfile string
+
 // Error defines model for Error.
 type Error struct {
 	Code    int32  `json:"code"`
 	Message string `json:"message"`
 }
 
+// Event defines model for Event.
+type Event struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	Id          int64     `json:"id"`
+	Message     *string   `json:"message,omitempty"`
+	TrustDomain string    `json:"trustDomain"`
+	Type        EventType `json:"type"`
+}
+
+// EventType defines model for Event.Type.
+type EventType string
+
 // FederationRelationship defines model for FederationRelationship.
 type FederationRelationship struct {
-	FederationGroupId               int64                         `json:"federationGroupId"`
-	Id                              int64                         `json:"id"`
-	SpireServer                     string                        `json:"spireServer"`
-	SpireServerConsent              *string                       `json:"spireServerConsent,omitempty"`
-	SpireServerFederatedWith        string                        `json:"spireServerFederatedWith"`
-	SpireServerFederatedWithConsent *string                       `json:"spireServerFederatedWithConsent,omitempty"`
-	Status                          *FederationRelationshipStatus `json:"status,omitempty"`
+	FederationGroupId                      int64                         `json:"federationGroupId"`
+	Id                                     int64                         `json:"id"`
+	SpireServer                            string                        `json:"spireServer"`
+	SpireServerBundleEndpoint              *BundleEndpoint               `json:"spireServerBundleEndpoint,omitempty"`
+	SpireServerConsent                     *string                       `json:"spireServerConsent,omitempty"`
+	SpireServerFederatedWith               string                        `json:"spireServerFederatedWith"`
+	SpireServerFederatedWithBundleEndpoint *BundleEndpoint               `json:"spireServerFederatedWithBundleEndpoint,omitempty"`
+	SpireServerFederatedWithConsent        *string                       `json:"spireServerFederatedWithConsent,omitempty"`
+	Status                                 *FederationRelationshipStatus `json:"status,omitempty"`
 }
 
 // FederationRelationshipStatus defines model for FederationRelationship.Status.
 type FederationRelationshipStatus string
 
+// OnboardRequest defines model for OnboardRequest.
+type OnboardRequest struct {
+	JoinToken string `json:"joinToken"`
+}
+
+// OnboardResponse defines model for OnboardResponse.
+type OnboardResponse struct {
+	Credential  string `json:"credential"`
+	TrustDomain string `json:"trustDomain"`
+}
+
 // TrustBundle defines model for TrustBundle.
 type TrustBundle struct {
-	Bundle      string             `json:"bundle"`
-	Id          int64              `json:"id"`
-	Status      *TrustBundleStatus `json:"status,omitempty"`
-	TrustDomain *string            `json:"trustDomain,omitempty"`
+	Bundle             string             `json:"bundle"`
+	Id                 int64              `json:"id"`
+	RefreshHint        *int64             `json:"refreshHint,omitempty"`
+	SequenceNumber     *uint64            `json:"sequenceNumber,omitempty"`
+	Signature          *string            `json:"signature,omitempty"`
+	SigningCertificate *string            `json:"signingCertificate,omitempty"`
+	Status             *TrustBundleStatus `json:"status,omitempty"`
+	TrustDomain        *string            `json:"trustDomain,omitempty"`
 }
 
 // TrustBundleStatus defines model for TrustBundle.Status.
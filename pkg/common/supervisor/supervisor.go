@@ -0,0 +1,169 @@
+// Package supervisor runs the plugins of the Galadriel Server and Harvester,
+// stopping all of them when one of them fails.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+)
+
+// Plugin is a plugin run by the supervisor.
+type Plugin struct {
+	// Name identifies the plugin in the logs and errors.
+	Name string
+	// Plugin is run until the context is done.
+	Plugin common.RunnablePlugin
+	// Restart, if set, restarts the plugin when it fails, instead of
+	// stopping the other plugins.
+	Restart *RestartPolicy
+}
+
+// RestartPolicy is the policy for restarting a failed plugin.
+type RestartPolicy struct {
+	// MaxRestarts is the number of consecutive restarts after which the
+	// failure of the plugin stops the other plugins. Zero means no limit.
+	MaxRestarts int
+	// InitialBackoff is the time waited before restarting the plugin. It
+	// doubles on every consecutive restart, up to MaxBackoff. A plugin that
+	// ran for longer than MaxBackoff before failing is restarted after
+	// InitialBackoff again.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (p *RestartPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.InitialBackoff <= 0 {
+		return errors.New("initial backoff must be positive")
+	}
+
+	return nil
+}
+
+// Errors holds the errors of the plugins that failed.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Run runs the plugins until the context is done or one of them fails, in
+// which case the others are stopped. It returns once all the plugins
+// returned, with the errors of those that failed, if any. A plugin that
+// returns without error before the context is done does not stop the others.
+// No plugin is run if a restart policy is invalid.
+func Run(ctx context.Context, plugins ...Plugin) error {
+	for _, plugin := range plugins {
+		if err := plugin.Restart.validate(); err != nil {
+			return fmt.Errorf("invalid restart policy of %s: %v", plugin.Name, err)
+		}
+	}
+
+	logger := common.NewLogger(telemetry.Supervisor)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errch := make(chan error, len(plugins))
+	for _, plugin := range plugins {
+		plugin := plugin
+		go func() {
+			errch <- supervise(ctx, logger, plugin)
+		}()
+	}
+
+	var errs Errors
+	for range plugins {
+		err := <-errch
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() == nil {
+			logger.Error(err)
+			logger.Info("Stopping the other plugins")
+			cancel()
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// supervise runs the plugin, restarting it according to its restart policy,
+// and returns the error it failed with.
+func supervise(ctx context.Context, logger *common.Logger, plugin Plugin) error {
+	var backoff time.Duration
+	var restarts int
+	if plugin.Restart != nil {
+		backoff = plugin.Restart.InitialBackoff
+	}
+
+	for {
+		start := time.Now()
+		err := runPlugin(ctx, plugin.Plugin)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			return nil
+		case ctx.Err() != nil:
+			return fmt.Errorf("%s failed to stop: %w", plugin.Name, err)
+		case plugin.Restart == nil:
+			return fmt.Errorf("%s failed: %w", plugin.Name, err)
+		}
+
+		policy := plugin.Restart
+		if time.Since(start) > policy.MaxBackoff {
+			backoff = policy.InitialBackoff
+			restarts = 0
+		}
+		if policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts {
+			return fmt.Errorf("%s failed after %d restarts: %w", plugin.Name, restarts, err)
+		}
+		restarts++
+
+		logger.Warn(plugin.Name, "failed, restarting in", backoff, "-", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// runPlugin runs the plugin, turning a panic into an error.
+func runPlugin(ctx context.Context, plugin common.RunnablePlugin) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, string(debug.Stack()))
+		}
+	}()
+
+	return plugin.Run(ctx)
+}
@@ -0,0 +1,146 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePlugin fails with the errors it is given, one per run, and otherwise
+// runs until the context is done.
+type fakePlugin struct {
+	errs    []error
+	runs    int32
+	stopErr error
+}
+
+func (p *fakePlugin) Run(ctx context.Context) error {
+	run := int(atomic.AddInt32(&p.runs, 1))
+	if run <= len(p.errs) {
+		return p.errs[run-1]
+	}
+
+	<-ctx.Done()
+	return p.stopErr
+}
+
+type panicPlugin struct{}
+
+func (panicPlugin) Run(context.Context) error {
+	panic("boom")
+}
+
+func TestRunStopsOnContextDone(t *testing.T) {
+	a, b := &fakePlugin{}, &fakePlugin{stopErr: context.Canceled}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() {
+		errch <- Run(ctx, Plugin{Name: "a", Plugin: a}, Plugin{Name: "b", Plugin: b})
+	}()
+
+	cancel()
+	select {
+	case err := <-errch:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugins not stopped")
+	}
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	failed := &fakePlugin{errs: []error{errors.New("listen failed")}}
+	other := &fakePlugin{stopErr: errors.New("shutdown failed")}
+	stopped := &fakePlugin{}
+
+	err := Run(context.Background(),
+		Plugin{Name: "failed", Plugin: failed},
+		Plugin{Name: "other", Plugin: other},
+		Plugin{Name: "stopped", Plugin: stopped},
+	)
+	require.Error(t, err)
+
+	var errs Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	assert.ElementsMatch(t, []string{
+		"failed failed: listen failed",
+		"other failed to stop: shutdown failed",
+	}, []string{errs[0].Error(), errs[1].Error()})
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	err := Run(context.Background(), Plugin{Name: "panic", Plugin: panicPlugin{}}, Plugin{Name: "other", Plugin: &fakePlugin{}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic failed: panic: boom")
+}
+
+func TestRunRestarts(t *testing.T) {
+	policy := &RestartPolicy{
+		MaxRestarts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}
+
+	for _, tt := range []struct {
+		name string
+		errs []error
+		runs int32
+		err  string
+	}{
+		{
+			name: "recovered",
+			errs: []error{errors.New("first"), errors.New("second")},
+			runs: 3,
+		},
+		{
+			name: "too many restarts",
+			errs: []error{errors.New("first"), errors.New("second"), errors.New("third")},
+			runs: 3,
+			err:  "flaky failed after 2 restarts: third",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &fakePlugin{errs: tt.errs}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errch := make(chan error, 1)
+			go func() {
+				errch <- Run(ctx, Plugin{Name: "flaky", Plugin: flaky, Restart: policy}, Plugin{Name: "other", Plugin: &fakePlugin{}})
+			}()
+
+			if tt.err == "" {
+				require.Eventually(t, func() bool { return atomic.LoadInt32(&flaky.runs) == tt.runs }, 5*time.Second, time.Millisecond)
+				cancel()
+			}
+
+			select {
+			case err := <-errch:
+				if tt.err == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.EqualError(t, err, tt.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("plugins not stopped")
+			}
+			assert.Equal(t, tt.runs, atomic.LoadInt32(&flaky.runs))
+		})
+	}
+}
+
+func TestRunValidatesRestartPolicy(t *testing.T) {
+	flaky := &fakePlugin{}
+	policy := &RestartPolicy{MaxBackoff: time.Second}
+
+	err := Run(context.Background(), Plugin{Name: "flaky", Plugin: flaky, Restart: policy})
+	assert.EqualError(t, err, "invalid restart policy of flaky: initial backoff must be positive")
+	assert.Zero(t, atomic.LoadInt32(&flaky.runs))
+}
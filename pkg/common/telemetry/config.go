@@ -1,5 +1,168 @@
 package telemetry
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TelemetryConfigSection configures the exporters of the metrics and of the
+// traces. The metrics are not exported if no metric exporter is configured,
+// and the traces if tracing is not configured.
 type TelemetryConfigSection struct {
-	Tool string `hcl:"tool"`
+	Prometheus *PrometheusConfigSection `hcl:"Prometheus"`
+	OTLP       *OTLPConfigSection       `hcl:"OTLP"`
+	Tracing    *TracingConfigSection    `hcl:"Tracing"`
+}
+
+// PrometheusConfigSection configures the listener of the Prometheus metrics
+// endpoint, scraped by the Prometheus servers.
+type PrometheusConfigSection struct {
+	Host string `hcl:"host"`
+	Port int    `hcl:"port"`
+}
+
+// OTLPConfigSection configures the export of the metrics to an OpenTelemetry
+// collector over OTLP/gRPC.
+type OTLPConfigSection struct {
+	Endpoint string `hcl:"endpoint"`
+	// Insecure connects to the collector in plaintext instead of TLS.
+	Insecure bool `hcl:"insecure"`
+	// ExportInterval is the time between two exports of the metrics.
+	ExportInterval string `hcl:"export_interval"`
+}
+
+// TracingConfigSection configures the export of the spans.
+type TracingConfigSection struct {
+	// Exporter is "otlp" to export the spans to an OpenTelemetry collector
+	// over OTLP/gRPC, "stdout" to print them, or "file" to append them to
+	// FilePath.
+	Exporter string `hcl:"exporter"`
+	// Endpoint and Insecure configure the collector of the otlp exporter.
+	Endpoint string `hcl:"endpoint"`
+	Insecure bool   `hcl:"insecure"`
+	FilePath string `hcl:"file_path"`
+}
+
+// Span exporters.
+const (
+	OTLPExporter   = "otlp"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+)
+
+// Config configures the metric server.
+type Config struct {
+	// ServiceName identifies the process in the exported metrics.
+	ServiceName string
+	// PrometheusAddress is the address the Prometheus metrics are served on,
+	// at /metrics. They are not served if empty.
+	PrometheusAddress string
+	// OTLPEndpoint is the address of the collector the metrics are exported
+	// to every OTLPExportInterval. They are not exported if empty.
+	OTLPEndpoint       string
+	OTLPInsecure       bool
+	OTLPExportInterval time.Duration
+}
+
+// SetDefaults sets the defaults of the configured exporters.
+func (c *TelemetryConfigSection) SetDefaults() {
+	if c.Prometheus != nil && c.Prometheus.Host == "" {
+		c.Prometheus.Host = "localhost"
+	}
+
+	if otlp := c.OTLP; otlp != nil {
+		if otlp.Endpoint == "" {
+			otlp.Endpoint = "localhost:4317"
+		}
+		if otlp.ExportInterval == "" {
+			otlp.ExportInterval = "10s"
+		}
+	}
+
+	if tracing := c.Tracing; tracing != nil {
+		if tracing.Exporter == "" {
+			tracing.Exporter = OTLPExporter
+		}
+		if tracing.Exporter == OTLPExporter && tracing.Endpoint == "" {
+			tracing.Endpoint = "localhost:4317"
+		}
+	}
+}
+
+// Validate checks the configuration of the exporters.
+func (c *TelemetryConfigSection) Validate() error {
+	if prom := c.Prometheus; prom != nil && (prom.Port <= 0 || prom.Port > 65535) {
+		return errors.Errorf("invalid telemetry.Prometheus.port %d", prom.Port)
+	}
+
+	if otlp := c.OTLP; otlp != nil {
+		interval, err := time.ParseDuration(otlp.ExportInterval)
+		if err != nil {
+			return errors.Wrap(err, "invalid telemetry.OTLP.export_interval")
+		}
+		if interval <= 0 {
+			return errors.New("telemetry.OTLP.export_interval must be positive")
+		}
+	}
+
+	if tracing := c.Tracing; tracing != nil {
+		switch tracing.Exporter {
+		case OTLPExporter, StdoutExporter:
+		case FileExporter:
+			if tracing.FilePath == "" {
+				return errors.New("telemetry.Tracing.file_path is required by the file exporter")
+			}
+		default:
+			return errors.Errorf("unknown telemetry.Tracing.exporter %q", tracing.Exporter)
+		}
+	}
+
+	return nil
+}
+
+// MetricsEnabled reports whether a metric exporter is configured.
+func (c *TelemetryConfigSection) MetricsEnabled() bool {
+	return c != nil && (c.Prometheus != nil || c.OTLP != nil)
+}
+
+// TracingEnabled reports whether tracing is configured.
+func (c *TelemetryConfigSection) TracingEnabled() bool {
+	return c != nil && c.Tracing != nil
+}
+
+// MetricServerConfig returns the configuration of the metric server of the
+// given service. The section must have been validated.
+func (c *TelemetryConfigSection) MetricServerConfig(serviceName string) (Config, error) {
+	config := Config{ServiceName: serviceName}
+
+	if prom := c.Prometheus; prom != nil {
+		config.PrometheusAddress = fmt.Sprintf("%s:%d", prom.Host, prom.Port)
+	}
+
+	if otlp := c.OTLP; otlp != nil {
+		interval, err := time.ParseDuration(otlp.ExportInterval)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid export interval: %v", err)
+		}
+
+		config.OTLPEndpoint = otlp.Endpoint
+		config.OTLPInsecure = otlp.Insecure
+		config.OTLPExportInterval = interval
+	}
+
+	return config, nil
+}
+
+// TracerConfig returns the configuration of the tracer of the given service.
+// The section must have been validated.
+func (c *TelemetryConfigSection) TracerConfig(serviceName string) TracerConfig {
+	return TracerConfig{
+		ServiceName: serviceName,
+		Exporter:    c.Tracing.Exporter,
+		Endpoint:    c.Tracing.Endpoint,
+		Insecure:    c.Tracing.Insecure,
+		FilePath:    c.Tracing.FilePath,
+	}
 }
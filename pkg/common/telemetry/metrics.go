@@ -2,25 +2,273 @@ package telemetry
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/asyncint64"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// meterName is the name of the meter of the Galadriel metrics.
+const meterName = "github.com/HewlettPackard/galadriel"
+
+// seconds is the unit of the durations.
+const seconds unit.Unit = "s"
+
+// Attributes of the metrics.
+const (
+	componentKey   = attribute.Key("component")
+	entityKey      = attribute.Key("entity")
+	actionKey      = attribute.Key("action")
+	outcomeKey     = attribute.Key("outcome")
+	trustDomainKey = attribute.Key("trust_domain")
+	methodKey      = attribute.Key("method")
+	codeKey        = attribute.Key("code")
+	statusKey      = attribute.Key("status")
 )
 
-func Count(ctx context.Context, component, entity, action string) {
-	var increment int64
-	increment = 1
+// RelationshipsObserver returns the number of federation relationships by
+// status.
+type RelationshipsObserver func(ctx context.Context) (map[string]int64, error)
+
+// BundlesObserver returns the state of the bundles known to the component.
+type BundlesObserver func(ctx context.Context) ([]BundleState, error)
+
+// BundleState is the state of a bundle, observed in the bundle age and expiry
+// gauges.
+type BundleState struct {
+	TrustDomain string
+	// UpdatedAt is the time the bundle was last updated. The age of the
+	// bundle is not observed if zero.
+	UpdatedAt time.Time
+	// ExpiresAt is the time the last X.509 authority of the bundle expires.
+	// The expiry of the bundle is not observed if zero.
+	ExpiresAt time.Time
+}
+
+// NewBundleState returns the state of the bundle, last updated at the given
+// time.
+func NewBundleState(bundle *spiffebundle.Bundle, updatedAt time.Time) BundleState {
+	state := BundleState{
+		TrustDomain: bundle.TrustDomain().String(),
+		UpdatedAt:   updatedAt,
+	}
+	for _, authority := range bundle.X509Authorities() {
+		if authority.NotAfter.After(state.ExpiresAt) {
+			state.ExpiresAt = authority.NotAfter
+		}
+	}
+
+	return state
+}
+
+// metrics holds the instruments of the Galadriel metrics. The instruments are
+// created once, and what a measurement is about (component, action, trust
+// domain...) is recorded in its attributes.
+type metrics struct {
+	operations       syncint64.Counter
+	bundleTransfers  syncint64.Counter
+	syncDuration     syncfloat64.Histogram
+	spireAPIDuration syncfloat64.Histogram
+	relationships    asyncint64.Gauge
+	bundleAge        asyncfloat64.Gauge
+	bundleExpiry     asyncfloat64.Gauge
+
+	mtx                   sync.RWMutex
+	relationshipsObserver RelationshipsObserver
+	bundlesObserver       BundlesObserver
+}
 
-	meter := InitializeMeterProvider(ctx)
+// registry holds the instruments of the process. They are created at startup
+// from the global meter provider, that forwards them to the one set by the
+// metric server once it runs.
+var registry = newRegistry()
 
-	label := FormatLabel(component, entity, action)
-	updown_counter, err := meter.SyncInt64().UpDownCounter(
-		label,
-	)
+func newRegistry() *metrics {
+	m, err := newMetrics(global.MeterProvider().Meter(meterName))
 	if err != nil {
-		panic(err)
+		// The metrics are not recorded rather than failing the process
+		otel.Handle(err)
+		m, _ = newMetrics(metric.NewNoopMeter())
+	}
+
+	return m
+}
+
+func newMetrics(meter metric.Meter) (*metrics, error) {
+	m := &metrics{}
+
+	var err error
+	if m.operations, err = meter.SyncInt64().Counter("galadriel.operations",
+		instrument.WithDescription("Operations by component, entity, action and outcome")); err != nil {
+		return nil, fmt.Errorf("failed to create operations counter: %v", err)
+	}
+	if m.bundleTransfers, err = meter.SyncInt64().Counter("galadriel.bundle.transfers",
+		instrument.WithDescription("Bundles pushed to and pulled from the Galadriel Server, by trust domain")); err != nil {
+		return nil, fmt.Errorf("failed to create bundle transfers counter: %v", err)
+	}
+	if m.syncDuration, err = meter.SyncFloat64().Histogram("galadriel.harvester.sync.duration",
+		instrument.WithDescription("Duration of the synchronizations of the harvester with the Galadriel Server"),
+		instrument.WithUnit(seconds)); err != nil {
+		return nil, fmt.Errorf("failed to create sync duration histogram: %v", err)
+	}
+	if m.spireAPIDuration, err = meter.SyncFloat64().Histogram("galadriel.spire.api.duration",
+		instrument.WithDescription("Latency of the calls to the SPIRE Server API, by method and code"),
+		instrument.WithUnit(seconds)); err != nil {
+		return nil, fmt.Errorf("failed to create spire api duration histogram: %v", err)
+	}
+	if m.relationships, err = meter.AsyncInt64().Gauge("galadriel.relationships",
+		instrument.WithDescription("Federation relationships by status")); err != nil {
+		return nil, fmt.Errorf("failed to create relationships gauge: %v", err)
+	}
+	if m.bundleAge, err = meter.AsyncFloat64().Gauge("galadriel.bundle.age",
+		instrument.WithDescription("Time since the bundle of the trust domain was updated"),
+		instrument.WithUnit(seconds)); err != nil {
+		return nil, fmt.Errorf("failed to create bundle age gauge: %v", err)
+	}
+	if m.bundleExpiry, err = meter.AsyncFloat64().Gauge("galadriel.bundle.expiry",
+		instrument.WithDescription("Time until the last X.509 authority of the bundle of the trust domain expires"),
+		instrument.WithUnit(seconds)); err != nil {
+		return nil, fmt.Errorf("failed to create bundle expiry gauge: %v", err)
+	}
+
+	if err := meter.RegisterCallback([]instrument.Asynchronous{m.relationships, m.bundleAge, m.bundleExpiry}, m.observe); err != nil {
+		return nil, fmt.Errorf("failed to register gauges callback: %v", err)
+	}
+
+	return m, nil
+}
+
+// observe observes the gauges with the registered observers.
+func (m *metrics) observe(ctx context.Context) {
+	m.mtx.RLock()
+	relationshipsObserver, bundlesObserver := m.relationshipsObserver, m.bundlesObserver
+	m.mtx.RUnlock()
+
+	if relationshipsObserver != nil {
+		counts, err := relationshipsObserver(ctx)
+		if err != nil {
+			otel.Handle(fmt.Errorf("failed to observe relationships: %v", err))
+		}
+		for status, count := range counts {
+			m.relationships.Observe(ctx, count, statusKey.String(status))
+		}
+	}
+
+	if bundlesObserver != nil {
+		bundles, err := bundlesObserver(ctx)
+		if err != nil {
+			otel.Handle(fmt.Errorf("failed to observe bundles: %v", err))
+		}
+		now := time.Now()
+		for _, bundle := range bundles {
+			td := trustDomainKey.String(bundle.TrustDomain)
+			if !bundle.UpdatedAt.IsZero() {
+				m.bundleAge.Observe(ctx, now.Sub(bundle.UpdatedAt).Seconds(), td)
+			}
+			if !bundle.ExpiresAt.IsZero() {
+				m.bundleExpiry.Observe(ctx, bundle.ExpiresAt.Sub(now).Seconds(), td)
+			}
+		}
 	}
+}
+
+func (m *metrics) count(ctx context.Context, component, entity, action, outcome string, attrs []attribute.KeyValue) {
+	attrs = append([]attribute.KeyValue{
+		componentKey.String(component),
+		entityKey.String(entity),
+		actionKey.String(action),
+		outcomeKey.String(outcome),
+	}, attrs...)
+	m.operations.Add(ctx, 1, attrs...)
+}
+
+func (m *metrics) countBundleTransfer(ctx context.Context, component, action, trustDomain string, err error) {
+	m.bundleTransfers.Add(ctx, 1,
+		componentKey.String(component),
+		actionKey.String(action),
+		trustDomainKey.String(trustDomain),
+		outcomeKey.String(outcome(err)))
+}
+
+func (m *metrics) recordSyncDuration(ctx context.Context, duration time.Duration, err error) {
+	m.syncDuration.Record(ctx, duration.Seconds(), outcomeKey.String(outcome(err)))
+}
+
+func (m *metrics) recordSpireAPICall(ctx context.Context, method, code string, duration time.Duration) {
+	m.spireAPIDuration.Record(ctx, duration.Seconds(), methodKey.String(method), codeKey.String(code))
+}
+
+// Count increments the counter of the successful operations of the component,
+// with the given action on the given entity. The attributes, such as the
+// trust domain, are added to those of the operation.
+func Count(ctx context.Context, component, entity, action string, attrs ...attribute.KeyValue) {
+	registry.count(ctx, component, entity, action, Success, attrs)
+}
+
+// CountError increments the counter of the failed operations of the
+// component, with the given action on the given entity.
+func CountError(ctx context.Context, component, entity, action string, attrs ...attribute.KeyValue) {
+	registry.count(ctx, component, entity, action, Error, attrs)
+}
+
+// TrustDomainAttr returns the attribute of the trust domain an operation is
+// about.
+func TrustDomainAttr(trustDomain string) attribute.KeyValue {
+	return trustDomainKey.String(trustDomain)
+}
+
+// CountBundleTransfer increments the counter of the bundles of the trust
+// domain pushed to or pulled from the Galadriel Server, failed if err is not
+// nil.
+func CountBundleTransfer(ctx context.Context, component, action, trustDomain string, err error) {
+	registry.countBundleTransfer(ctx, component, action, trustDomain, err)
+}
+
+// RecordSyncDuration records the duration of a synchronization of the
+// harvester, failed if err is not nil.
+func RecordSyncDuration(ctx context.Context, duration time.Duration, err error) {
+	registry.recordSyncDuration(ctx, duration, err)
+}
+
+// RecordSpireAPICall records the latency of a call to the given method of the
+// SPIRE Server API, that ended with the given gRPC code.
+func RecordSpireAPICall(ctx context.Context, method, code string, duration time.Duration) {
+	registry.recordSpireAPICall(ctx, method, code, duration)
+}
+
+// ObserveRelationships sets the observer of the relationships gauge, called
+// when the metrics are collected.
+func ObserveRelationships(observer RelationshipsObserver) {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+
+	registry.relationshipsObserver = observer
+}
 
-	if action == Remove {
-		increment = -1
+// ObserveBundles sets the observer of the bundle age and expiry gauges,
+// called when the metrics are collected.
+func ObserveBundles(observer BundlesObserver) {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+
+	registry.bundlesObserver = observer
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return Error
 	}
 
-	updown_counter.Add(ctx, increment)
+	return Success
 }
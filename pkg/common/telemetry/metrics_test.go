@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+)
+
+// sdkLabels matches the labels of the SDK resource, left out of the scraped
+// metrics.
+var sdkLabels = regexp.MustCompile(`,telemetry_sdk_\w+="[^"]*"`)
+
+// scrape returns the Prometheus metrics of the metrics recorded with a new
+// registry by the record function.
+func scrape(t *testing.T, record func(m *metrics)) string {
+	ctrl, err := newController("galadriel-test")
+	require.NoError(t, err)
+	m, err := newMetrics(ctrl.Meter(meterName))
+	require.NoError(t, err)
+
+	record(m)
+
+	exporter, err := prometheus.New(prometheus.Config{}, ctrl)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	return sdkLabels.ReplaceAllString(string(body), "")
+}
+
+func TestMetricsCount(t *testing.T) {
+	body := scrape(t, func(m *metrics) {
+		ctx := context.Background()
+		m.count(ctx, HarvesterController, FederatedBundle, Set, Success, nil)
+		m.count(ctx, HarvesterController, FederatedBundle, Set, Success, nil)
+		m.count(ctx, HarvesterController, FederatedBundle, Set, Error, []attribute.KeyValue{TrustDomainAttr("td1.org")})
+	})
+
+	assert.Contains(t, body, `galadriel_operations{action="set",component="harvester_controller",entity="federated_bundle",outcome="success",service_name="galadriel-test"} 2`)
+	assert.Contains(t, body, `galadriel_operations{action="set",component="harvester_controller",entity="federated_bundle",outcome="error",service_name="galadriel-test",trust_domain="td1.org"} 1`)
+}
+
+func TestMetricsBundleTransfers(t *testing.T) {
+	body := scrape(t, func(m *metrics) {
+		ctx := context.Background()
+		m.countBundleTransfer(ctx, HarvesterController, Push, "td1.org", nil)
+		m.countBundleTransfer(ctx, HarvesterController, Pull, "td1.org", errors.New("unavailable"))
+	})
+
+	assert.Contains(t, body, `galadriel_bundle_transfers{action="push",component="harvester_controller",outcome="success",service_name="galadriel-test",trust_domain="td1.org"} 1`)
+	assert.Contains(t, body, `galadriel_bundle_transfers{action="pull",component="harvester_controller",outcome="error",service_name="galadriel-test",trust_domain="td1.org"} 1`)
+}
+
+func TestMetricsDurations(t *testing.T) {
+	body := scrape(t, func(m *metrics) {
+		ctx := context.Background()
+		m.recordSyncDuration(ctx, 200*time.Millisecond, nil)
+		m.recordSpireAPICall(ctx, "/spire.api.server.bundle.v1.Bundle/GetBundle", "OK", 3*time.Millisecond)
+	})
+
+	assert.Contains(t, body, `galadriel_harvester_sync_duration_count{outcome="success",service_name="galadriel-test"} 1`)
+	assert.Contains(t, body, `galadriel_spire_api_duration_count{code="OK",method="/spire.api.server.bundle.v1.Bundle/GetBundle",service_name="galadriel-test"} 1`)
+}
+
+func TestMetricsGauges(t *testing.T) {
+	body := scrape(t, func(m *metrics) {
+		m.relationshipsObserver = func(context.Context) (map[string]int64, error) {
+			return map[string]int64{"active": 2, "invited": 1}, nil
+		}
+		m.bundlesObserver = func(context.Context) ([]BundleState, error) {
+			return []BundleState{
+				{TrustDomain: "td1.org", UpdatedAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(time.Hour)},
+				{TrustDomain: "td2.org"},
+			}, nil
+		}
+	})
+
+	assert.Contains(t, body, `galadriel_relationships{service_name="galadriel-test",status="active"} 2`)
+	assert.Contains(t, body, `galadriel_relationships{service_name="galadriel-test",status="invited"} 1`)
+	assert.Contains(t, body, `galadriel_bundle_age{service_name="galadriel-test",trust_domain="td1.org"} 3600`)
+	assert.Contains(t, body, `galadriel_bundle_expiry{service_name="galadriel-test",trust_domain="td1.org"} 3599`)
+	assert.NotContains(t, body, `trust_domain="td2.org"`)
+}
+
+func TestNewBundleState(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("td1.org")
+	updatedAt := time.Now()
+	notAfter := updatedAt.Add(time.Hour)
+
+	state := NewBundleState(spiffebundle.FromX509Authorities(td, []*x509.Certificate{
+		{NotAfter: notAfter.Add(-time.Minute), Raw: []byte("first")},
+		{NotAfter: notAfter, Raw: []byte("last")},
+	}), updatedAt)
+	assert.Equal(t, BundleState{TrustDomain: "td1.org", UpdatedAt: updatedAt, ExpiresAt: notAfter}, state)
+
+	state = NewBundleState(spiffebundle.New(td), time.Time{})
+	assert.Equal(t, BundleState{TrustDomain: "td1.org"}, state)
+}
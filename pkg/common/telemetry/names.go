@@ -8,9 +8,11 @@ const (
 
 // entity
 const (
-	TrustBundle = "trust_bundle"
-	PackageName = "package_name"
-	Federation  = "federation"
+	TrustBundle            = "trust_bundle"
+	FederatedBundle        = "federated_bundle"
+	FederationRelationship = "federation_relationship"
+	Federation             = "federation"
+	Event                  = "event"
 )
 
 // action
@@ -22,15 +24,42 @@ const (
 	Create  = "create"
 	Approve = "approve"
 	Deny    = "deny"
+	Push    = "push"
+	Pull    = "pull"
+	Set     = "set"
+	Sync    = "sync"
+	Resync  = "resync"
+	Prune   = "prune"
+	Verify  = "verify"
+	Update  = "update"
+	Delete  = "delete"
+
+	MarkToDelete = "mark_to_delete"
+)
+
+// outcome
+const (
+	Success = "success"
+	Error   = "error"
 )
 
 // component
 const (
 	MetricsServer       = "metrics_server"
+	Tracing             = "tracing"
 	HarvesterController = "harvester_controller"
 
 	GaladrielServer = "galadriel_server"
 	HTTPApi         = "http_api"
+	ManagementAPI   = "management_api"
+	HarvesterAPI    = "harvester_api"
+	AdminAPI        = "admin_api"
+	BundleEndpoint  = "bundle_endpoint"
+	BundlePruner    = "bundle_pruner"
+	Datastore       = "datastore"
+	Supervisor      = "supervisor"
+	HealthChecks    = "health_checks"
+	X509SVIDSource  = "x509svid_source"
 
 	ID = "id"
 	// spiffeID = "spiffeID"
@@ -2,92 +2,180 @@ package telemetry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
 	runtimemetrics "go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
-	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/global"
-	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
 	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
 	"go.opentelemetry.io/otel/sdk/metric/export/aggregation"
 	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
 	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 )
 
 type MetricServer interface {
 	common.RunnablePlugin
 }
 
+// metricsPath is the path the Prometheus metrics are served on.
+const metricsPath = "/metrics"
+
 type LocalMetricServer struct {
+	config Config
 	logger common.Logger
 }
 
-func NewLocalMetricServer() MetricServer {
+// NewLocalMetricServer returns a metric server exporting the metrics with
+// the configured exporters.
+func NewLocalMetricServer(config Config) MetricServer {
 	return &LocalMetricServer{
+		config: config,
 		logger: *common.NewLogger(MetricsServer),
 	}
 }
 
+// Run exports the metrics until the context is done.
 func (c *LocalMetricServer) Run(ctx context.Context) error {
 	c.logger.Info("Starting metric server")
 
-	if err := runtimemetrics.Start(); err != nil {
-		panic(err)
+	// The errors of the exporters are logged rather than printed on stderr
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		// The Prometheus exporter can not collect the metrics itself when
+		// they are exported over OTLP as well, it serves the last ones
+		if !errors.Is(err, controller.ErrControllerStarted) {
+			c.logger.Warn("Failed to export metrics:", err)
+		}
+	}))
+
+	var opts []controller.Option
+	if c.config.OTLPEndpoint != "" {
+		exporter, err := newOTLPExporter(ctx, c.config)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, controller.WithExporter(exporter), controller.WithCollectPeriod(c.config.OTLPExportInterval))
 	}
 
-	// TODO: verify telemetry plugin config to run specified plugin
-	exporter := configurePrometheusMetrics()
-	http.HandleFunc("/metrics", exporter.ServeHTTP)
+	ctrl, err := newController(c.config.ServiceName, opts...)
+	if err != nil {
+		return err
+	}
+	global.SetMeterProvider(ctrl)
 
-	go func() {
-		port := "8888"
-		c.logger.Info("Listening on http://localhost:8888/metrics")
+	if err := runtimemetrics.Start(runtimemetrics.WithMeterProvider(ctrl)); err != nil {
+		return fmt.Errorf("failed to start runtime metrics: %v", err)
+	}
 
-		address := fmt.Sprintf(":%s", port)
-		err := http.ListenAndServe(address, nil)
-		if err != nil {
-			panic(err)
+	if c.config.OTLPEndpoint != "" {
+		if err := ctrl.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start metrics export: %v", err)
 		}
+		c.logger.Info("Exporting metrics to", c.config.OTLPEndpoint, "every", c.config.OTLPExportInterval)
+
+		defer func() {
+			// The last metrics are exported before stopping
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := ctrl.Stop(stopCtx); err != nil {
+				c.logger.Warn("Failed to export last metrics:", err)
+			}
+		}()
+	}
+
+	if c.config.PrometheusAddress == "" {
+		<-ctx.Done()
+		return nil
+	}
+
+	return c.servePrometheus(ctx, ctrl)
+}
+
+// servePrometheus serves the metrics collected by the controller on the
+// Prometheus address until the context is done.
+func (c *LocalMetricServer) servePrometheus(ctx context.Context, ctrl *controller.Controller) error {
+	exporter, err := prometheus.New(prometheus.Config{}, ctrl)
+	if err != nil {
+		return fmt.Errorf("failed to create prometheus exporter: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", c.config.PrometheusAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on prometheus address: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, exporter)
+
+	server := &http.Server{Handler: mux}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- server.Serve(listener)
 	}()
+	c.logger.Info("Serving Prometheus metrics on", "http://"+listener.Addr().String()+metricsPath)
+
+	select {
+	case err = <-errch:
+	case <-ctx.Done():
+		err = server.Shutdown(context.Background())
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
 
-	<-ctx.Done()
-	return nil
+	return err
 }
 
-func configurePrometheusMetrics() *prometheus.Exporter {
-	config := prometheus.Config{}
+// newController returns the controller of the metrics of the given service,
+// with cumulative temporality as Prometheus requires.
+func newController(serviceName string, opts ...controller.Option) (*controller.Controller, error) {
+	res, err := newResource(serviceName)
+	if err != nil {
+		return nil, err
+	}
 
-	ctrl := controller.New(
+	return controller.New(
 		processor.NewFactory(
-			selector.NewWithHistogramDistribution(
-				histogram.WithExplicitBoundaries(config.DefaultHistogramBoundaries),
-			),
+			selector.NewWithHistogramDistribution(),
 			aggregation.CumulativeTemporalitySelector(),
 			processor.WithMemory(true),
 		),
-	)
+		append(opts, controller.WithResource(res))...,
+	), nil
+}
 
-	exporter, err := prometheus.New(config, ctrl)
+// newResource returns the resource of the metrics and spans of the given
+// service.
+func newResource(serviceName string) (*resource.Resource, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName)))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to create telemetry resource: %v", err)
 	}
 
-	global.SetMeterProvider(exporter.MeterProvider())
-
-	return exporter
+	return res, nil
 }
 
-func FormatLabel(component, entity, action string) string {
-	return fmt.Sprintf("%s.%s.%s", component, entity, action)
-}
+// newOTLPExporter returns an exporter of the metrics to the OTLP/gRPC
+// collector of the configuration.
+func newOTLPExporter(ctx context.Context, config Config) (*otlpmetric.Exporter, error) {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(config.OTLPEndpoint)}
+	if config.OTLPInsecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
 
-func InitializeMeterProvider(ctx context.Context) metric.Meter {
-	type key string
-	ctxKey := key(PackageName)
-	packageName := fmt.Sprintf("%v", ctx.Value(ctxKey))
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %v", err)
+	}
 
-	return global.MeterProvider().Meter(packageName)
+	return exporter, nil
 }
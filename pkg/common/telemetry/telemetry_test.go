@@ -1,52 +1,123 @@
 package telemetry
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"testing"
+	"time"
 
-	"github.com/HewlettPackard/galadriel/pkg/common"
 	"github.com/stretchr/testify/assert"
-	"go.opentelemetry.io/otel/exporters/prometheus"
-	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
-	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
-	"go.opentelemetry.io/otel/sdk/metric/export/aggregation"
-	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
-	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewLocalMetricServer(t *testing.T) {
-	expected := &LocalMetricServer{
-		logger: *common.NewLogger(MetricsServer),
-	}
+	metricServer := NewLocalMetricServer(Config{})
+	assert.IsType(t, &LocalMetricServer{}, metricServer)
+}
+
+func TestNewController(t *testing.T) {
+	ctrl, err := newController("galadriel-test")
+	require.NoError(t, err)
 
-	metricServer := NewLocalMetricServer()
-	assert.Equal(t, expected, metricServer)
+	serviceName, ok := ctrl.Resource().Set().Value("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "galadriel-test", serviceName.AsString())
 }
 
-func TestFormatLabel(t *testing.T) {
-	component := "component"
-	entity := "entity"
-	action := "action"
-	expected := "component.entity.action"
-	label := FormatLabel(component, entity, action)
+func TestRunPrometheus(t *testing.T) {
+	// Find a free port for the Prometheus endpoint
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	metricServer := NewLocalMetricServer(Config{ServiceName: "galadriel-test", PrometheusAddress: address})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- metricServer.Run(ctx) }()
+
+	var body string
+	require.Eventually(t, func() bool {
+		Count(context.Background(), "component", "entity", "action")
 
-	assert.Equal(t, expected, label)
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", address, metricsPath))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		body = string(b)
+		return err == nil && resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, body, `galadriel_operations{action="action",component="component",entity="entity",outcome="success"`)
+	assert.Contains(t, body, `service_name="galadriel-test"`)
+
+	cancel()
+	require.NoError(t, <-errch)
 }
 
-func TestConfigurePrometheusMetrics(t *testing.T) {
-	config := prometheus.Config{}
-	ctrl := controller.New(
-		processor.NewFactory(
-			selector.NewWithHistogramDistribution(
-				histogram.WithExplicitBoundaries(config.DefaultHistogramBoundaries),
-			),
-			aggregation.CumulativeTemporalitySelector(),
-			processor.WithMemory(true),
-		),
-	)
-
-	expected, err := prometheus.New(config, ctrl)
-
-	exporter := configurePrometheusMetrics()
-	assert.ObjectsAreEqual(expected, exporter)
-	assert.Nil(t, err)
+func TestTelemetryConfigSection(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		section  *TelemetryConfigSection
+		expected Config
+		err      string
+	}{
+		{
+			name:     "prometheus",
+			section:  &TelemetryConfigSection{Prometheus: &PrometheusConfigSection{Port: 8888}},
+			expected: Config{ServiceName: "galadriel-test", PrometheusAddress: "localhost:8888"},
+		},
+		{
+			name: "otlp",
+			section: &TelemetryConfigSection{
+				Prometheus: &PrometheusConfigSection{Host: "0.0.0.0", Port: 8888},
+				OTLP:       &OTLPConfigSection{Insecure: true},
+			},
+			expected: Config{
+				ServiceName:        "galadriel-test",
+				PrometheusAddress:  "0.0.0.0:8888",
+				OTLPEndpoint:       "localhost:4317",
+				OTLPInsecure:       true,
+				OTLPExportInterval: 10 * time.Second,
+			},
+		},
+		{
+			name:    "missing_prometheus_port",
+			section: &TelemetryConfigSection{Prometheus: &PrometheusConfigSection{}},
+			err:     "invalid telemetry.Prometheus.port 0",
+		},
+		{
+			name:    "invalid_otlp_export_interval",
+			section: &TelemetryConfigSection{OTLP: &OTLPConfigSection{ExportInterval: "often"}},
+			err:     `invalid telemetry.OTLP.export_interval: time: invalid duration "often"`,
+		},
+		{
+			name:    "negative_otlp_export_interval",
+			section: &TelemetryConfigSection{OTLP: &OTLPConfigSection{ExportInterval: "-1s"}},
+			err:     "telemetry.OTLP.export_interval must be positive",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.section.SetDefaults()
+
+			err := tt.section.Validate()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.section.MetricsEnabled())
+
+			config, err := tt.section.MetricServerConfig("galadriel-test")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, config)
+		})
+	}
 }
@@ -0,0 +1,180 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer of the Galadriel spans.
+const tracerName = "github.com/HewlettPackard/galadriel"
+
+// TracerConfig configures the tracer.
+type TracerConfig struct {
+	// ServiceName identifies the process in the exported spans.
+	ServiceName string
+	// Exporter is the exporter of the spans: OTLPExporter, StdoutExporter or
+	// FileExporter.
+	Exporter string
+	// Endpoint is the address of the collector of the OTLP exporter.
+	Endpoint string
+	Insecure bool
+	// FilePath is the file the file exporter appends the spans to.
+	FilePath string
+}
+
+// Tracer exports the spans of the process.
+type Tracer struct {
+	config TracerConfig
+	logger common.Logger
+}
+
+// NewTracer returns a tracer exporting the spans with the configured
+// exporter.
+func NewTracer(config TracerConfig) *Tracer {
+	return &Tracer{
+		config: config,
+		logger: *common.NewLogger(Tracing),
+	}
+}
+
+// Run sets the global tracer provider, and exports the spans until the
+// context is done. The trace context is propagated over HTTP with the W3C
+// Trace Context headers.
+func (t *Tracer) Run(ctx context.Context) error {
+	exporter, closer, err := newSpanExporter(ctx, t.config)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	res, err := newResource(t.config.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.logger.Info("Exporting traces with the", t.config.Exporter, "exporter")
+
+	<-ctx.Done()
+
+	// The last spans are exported before stopping
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(shutdownCtx); err != nil {
+		t.logger.Warn("Failed to export last spans:", err)
+	}
+
+	return nil
+}
+
+// newSpanExporter returns the exporter of the spans of the configuration,
+// and the file it writes to, if any, to close once the exporter is shut
+// down.
+func newSpanExporter(ctx context.Context, config TracerConfig) (sdktrace.SpanExporter, io.Closer, error) {
+	switch config.Exporter {
+	case OTLPExporter:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create otlp span exporter: %v", err)
+		}
+		return exporter, nil, nil
+
+	case StdoutExporter:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout span exporter: %v", err)
+		}
+		return exporter, nil, nil
+
+	case FileExporter:
+		file, err := os.OpenFile(config.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open spans file: %v", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to create file span exporter: %v", err)
+		}
+		return exporter, file, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown span exporter %q", config.Exporter)
+}
+
+// StartSpan starts a span with the given name, child of the span of the
+// context if any.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// EndSpan ends the span, failed if err is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingMiddleware returns an echo middleware starting a span for every
+// request served by the given server, child of the span propagated by the
+// client if any.
+func TracingMiddleware(serverName string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			reqCtx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := ctx.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			reqCtx, span := StartSpan(reqCtx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serverName, route, req)...),
+			)
+			defer span.End()
+			ctx.SetRequest(req.WithContext(reqCtx))
+
+			err := next(ctx)
+			if err != nil {
+				span.RecordError(err)
+				// The error is handled here, so that the status of the
+				// response is known
+				ctx.Error(err)
+			}
+
+			status := ctx.Response().Status
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingConfigSection(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		section  *TracingConfigSection
+		expected TracerConfig
+		err      string
+	}{
+		{
+			name:     "defaults",
+			section:  &TracingConfigSection{},
+			expected: TracerConfig{ServiceName: "galadriel-test", Exporter: OTLPExporter, Endpoint: "localhost:4317"},
+		},
+		{
+			name:     "otlp",
+			section:  &TracingConfigSection{Exporter: OTLPExporter, Endpoint: "collector:4317", Insecure: true},
+			expected: TracerConfig{ServiceName: "galadriel-test", Exporter: OTLPExporter, Endpoint: "collector:4317", Insecure: true},
+		},
+		{
+			name:     "stdout",
+			section:  &TracingConfigSection{Exporter: StdoutExporter},
+			expected: TracerConfig{ServiceName: "galadriel-test", Exporter: StdoutExporter},
+		},
+		{
+			name:     "file",
+			section:  &TracingConfigSection{Exporter: FileExporter, FilePath: "/tmp/spans.json"},
+			expected: TracerConfig{ServiceName: "galadriel-test", Exporter: FileExporter, FilePath: "/tmp/spans.json"},
+		},
+		{
+			name:    "missing_file_path",
+			section: &TracingConfigSection{Exporter: FileExporter},
+			err:     "telemetry.Tracing.file_path is required by the file exporter",
+		},
+		{
+			name:    "unknown_exporter",
+			section: &TracingConfigSection{Exporter: "jaeger"},
+			err:     `unknown telemetry.Tracing.exporter "jaeger"`,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			section := &TelemetryConfigSection{Tracing: tt.section}
+			section.SetDefaults()
+
+			err := section.Validate()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, section.TracingEnabled())
+			assert.False(t, section.MetricsEnabled())
+			assert.Equal(t, tt.expected, section.TracerConfig("galadriel-test"))
+		})
+	}
+
+	var section *TelemetryConfigSection
+	assert.False(t, section.TracingEnabled())
+}
+
+func TestTracerRunFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	tracer := NewTracer(TracerConfig{ServiceName: "galadriel-test", Exporter: FileExporter, FilePath: path})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- tracer.Run(ctx) }()
+
+	// The spans are exported once the tracer provider is set
+	require.Eventually(t, func() bool {
+		_, span := StartSpan(context.Background(), "test.span")
+		EndSpan(span, errors.New("failed"))
+		_, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, span := StartSpan(context.Background(), "test.span")
+	EndSpan(span, nil)
+
+	// The last spans are exported when the tracer stops
+	cancel()
+	require.NoError(t, <-errch)
+
+	spans, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(spans), `"Name":"test.span"`)
+	assert.Contains(t, string(spans), `"galadriel-test"`)
+}
+
+func TestNewSpanExporterUnknown(t *testing.T) {
+	_, _, err := newSpanExporter(context.Background(), TracerConfig{Exporter: "jaeger"})
+	assert.EqualError(t, err, `unknown span exporter "jaeger"`)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := echo.New()
+	router.Use(TracingMiddleware("test_api"))
+	router.GET("/things/:id", func(ctx echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such thing")
+	})
+
+	// The client propagates the span of its request
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "client")
+	req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+	otel.GetTextMapPropagator().Inject(parentCtx, propagation.HeaderCarrier(req.Header))
+	parent.End()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var served sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			served = span
+		}
+	}
+	require.NotNil(t, served)
+	assert.Equal(t, "GET /things/:id", served.Name())
+	assert.Equal(t, parent.SpanContext().TraceID(), served.SpanContext().TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), served.Parent().SpanID())
+	assert.Equal(t, codes.Unset, served.Status().Code, "client errors are not server span errors")
+}
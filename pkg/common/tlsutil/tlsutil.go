@@ -0,0 +1,84 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// LoadCertPool returns a pool with the PEM encoded certificates of the given
+// CA bundle file.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %q", path)
+	}
+
+	return pool, nil
+}
+
+// NewServerConfig returns the TLS configuration of a server presenting the
+// given certificate. Client certificates are verified against the CA bundle
+// when presented, and required if requireClientCert is true.
+func NewServerConfig(certFile, keyFile, caBundleFile string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch {
+	case caBundleFile != "":
+		pool, err := LoadCertPool(caBundleFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	case requireClientCert:
+		return nil, errors.New("a CA bundle is required to verify client certificates")
+	}
+
+	return config, nil
+}
+
+// NewClientConfig returns the TLS configuration of a client that verifies the
+// server certificate against the CA bundle, or the system roots if empty, and
+// presents the given certificate, if any.
+func NewClientConfig(certFile, keyFile, caBundleFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caBundleFile != "" {
+		pool, err := LoadCertPool(caBundleFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
@@ -0,0 +1,201 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPKI struct {
+	caFile         string
+	serverCertFile string
+	serverKeyFile  string
+	clientCertFile string
+	clientKeyFile  string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	pki := testPKI{caFile: filepath.Join(dir, "ca.pem")}
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+
+	issue := func(name string, template *x509.Certificate) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+
+	pki.serverCertFile, pki.serverKeyFile = issue("server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.clientCertFile, pki.clientKeyFile = issue("client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "example.org"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	return pki
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+func TestLoadCertPool(t *testing.T) {
+	pki := newTestPKI(t)
+
+	pool, err := LoadCertPool(pki.caFile)
+	require.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = LoadCertPool(pki.serverKeyFile)
+	assert.EqualError(t, err, "no certificates found in CA bundle \""+pki.serverKeyFile+"\"")
+
+	_, err = LoadCertPool(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.ErrorContains(t, err, "failed to read CA bundle")
+}
+
+func TestNewServerConfig(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name              string
+		caBundleFile      string
+		requireClientCert bool
+		clientAuth        tls.ClientAuthType
+		err               string
+	}{
+		{
+			name:       "no_client_authentication",
+			clientAuth: tls.NoClientCert,
+		},
+		{
+			name:         "optional_client_certificate",
+			caBundleFile: pki.caFile,
+			clientAuth:   tls.VerifyClientCertIfGiven,
+		},
+		{
+			name:              "required_client_certificate",
+			caBundleFile:      pki.caFile,
+			requireClientCert: true,
+			clientAuth:        tls.RequireAndVerifyClientCert,
+		},
+		{
+			name:              "required_client_certificate_without_ca_bundle",
+			requireClientCert: true,
+			err:               "a CA bundle is required to verify client certificates",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewServerConfig(pki.serverCertFile, pki.serverKeyFile, tt.caBundleFile, tt.requireClientCert)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, config.Certificates, 1)
+			assert.Equal(t, tt.clientAuth, config.ClientAuth)
+		})
+	}
+
+	_, err := NewServerConfig(pki.serverCertFile, pki.clientKeyFile, "", false)
+	assert.ErrorContains(t, err, "failed to load certificate")
+}
+
+func TestNewClientConfig(t *testing.T) {
+	pki := newTestPKI(t)
+
+	config, err := NewClientConfig("", "", "")
+	require.NoError(t, err)
+	assert.Empty(t, config.Certificates)
+	assert.Nil(t, config.RootCAs)
+
+	config, err = NewClientConfig(pki.clientCertFile, pki.clientKeyFile, pki.caFile)
+	require.NoError(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.NotNil(t, config.RootCAs)
+
+	_, err = NewClientConfig(pki.clientCertFile, "", "")
+	assert.ErrorContains(t, err, "failed to load certificate")
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	serverConfig, err := NewServerConfig(pki.serverCertFile, pki.serverKeyFile, pki.caFile, true)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	clientConfig, err := NewClientConfig(pki.clientCertFile, pki.clientKeyFile, pki.caFile)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Without a client certificate the handshake fails
+	clientConfig, err = NewClientConfig("", "", pki.caFile)
+	require.NoError(t, err)
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// ErrStaleTrustBundle is returned when an uploaded trust bundle is older than
+// the current one, according to their sequence numbers.
+var ErrStaleTrustBundle = errors.New("stale trust bundle")
+
+// The contents of a TrustBundle is the SPIFFE bundle of its trust domain, as
+// the JWKS document defined by the SPIFFE Trust Domain and Bundle
+// specification. It is always converted from and to a spiffebundle.Bundle, so
+// that the spiffe_sequence and spiffe_refresh_hint members are preserved.
+
+// NewTrustBundle returns the TrustBundle of the given SPIFFE bundle.
+func NewTrustBundle(bundle *spiffebundle.Bundle) (*TrustBundle, error) {
+	bundleBytes, err := bundle.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle of %q: %v", bundle.TrustDomain(), err)
+	}
+
+	trustDomain := bundle.TrustDomain().String()
+	out := &TrustBundle{
+		TrustDomain: &trustDomain,
+		Bundle:      string(bundleBytes),
+	}
+	setMetadata(out, bundle)
+
+	return out, nil
+}
+
+// SPIFFEBundle parses the contents of the trust bundle.
+func (b TrustBundle) SPIFFEBundle() (*spiffebundle.Bundle, error) {
+	if b.TrustDomain == nil {
+		return nil, errors.New("trust domain is missing")
+	}
+
+	td, err := spiffeid.TrustDomainFromString(*b.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust domain %q: %v", *b.TrustDomain, err)
+	}
+
+	bundle, err := spiffebundle.Parse(td, []byte(b.Bundle))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle of %q: %v", td, err)
+	}
+
+	return bundle, nil
+}
+
+// SetBundleMetadata sets the read-only fields of the trust bundle that are
+// derived from its contents. Contents that do not parse are left alone.
+func SetBundleMetadata(b *TrustBundle) {
+	if bundle, err := b.SPIFFEBundle(); err == nil {
+		setMetadata(b, bundle)
+	}
+}
+
+func setMetadata(b *TrustBundle, bundle *spiffebundle.Bundle) {
+	if sequenceNumber, ok := bundle.SequenceNumber(); ok {
+		b.SequenceNumber = &sequenceNumber
+	}
+	if refreshHint, ok := bundle.RefreshHint(); ok {
+		seconds := int64(refreshHint / time.Second)
+		b.RefreshHint = &seconds
+	}
+}
+
+// ValidateTrustBundle validates the contents of a trust bundle uploaded for
+// the given trust domain: the JWKS document and its certificates must parse,
+// the X.509 authorities with a SPIFFE ID must belong to the trust domain, and
+// the sequence number must not be lower than the one of the current contents,
+// if any. It returns the parsed bundle.
+func ValidateTrustBundle(td spiffeid.TrustDomain, contents, current []byte) (*spiffebundle.Bundle, error) {
+	bundle, err := spiffebundle.Parse(td, contents)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle of %q: %v", td, err)
+	}
+
+	for _, authority := range bundle.X509Authorities() {
+		for _, uri := range authority.URIs {
+			if uri.Scheme != "spiffe" {
+				continue
+			}
+			id, err := spiffeid.FromURI(uri)
+			if err != nil {
+				return nil, fmt.Errorf("invalid X.509 authority of %q: %v", td, err)
+			}
+			if id.TrustDomain() != td {
+				return nil, fmt.Errorf("X.509 authority %q does not belong to %q", id, td)
+			}
+		}
+	}
+
+	if len(current) == 0 {
+		return bundle, nil
+	}
+
+	// Current contents that do not parse can not be compared, and are replaced
+	currentBundle, err := spiffebundle.Parse(td, current)
+	if err != nil {
+		return bundle, nil
+	}
+
+	currentSequence, ok := currentBundle.SequenceNumber()
+	if !ok {
+		return bundle, nil
+	}
+	sequence, _ := bundle.SequenceNumber()
+	if sequence < currentSequence {
+		return nil, fmt.Errorf("%w: sequence number %d of %q is lower than the current %d", ErrStaleTrustBundle, sequence, td, currentSequence)
+	}
+
+	return bundle, nil
+}
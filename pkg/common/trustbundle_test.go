@@ -0,0 +1,144 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuthority returns a self-signed X.509 authority, with the SPIFFE ID of
+// the given trust domain if not empty.
+func newAuthority(t *testing.T, trustDomain string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if trustDomain != "" {
+		template.URIs = []*url.URL{spiffeid.RequireTrustDomainFromString(trustDomain).ID().URL()}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func marshalBundle(t *testing.T, trustDomain string, sequenceNumber uint64, authorities ...*x509.Certificate) []byte {
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(trustDomain), authorities)
+	bundle.SetSequenceNumber(sequenceNumber)
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+
+	return bundleBytes
+}
+
+func TestTrustBundleConversion(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	bundle := spiffebundle.FromX509Authorities(td, []*x509.Certificate{newAuthority(t, "example.org")})
+	bundle.SetSequenceNumber(42)
+	bundle.SetRefreshHint(5 * time.Minute)
+
+	trustBundle, err := NewTrustBundle(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", *trustBundle.TrustDomain)
+	assert.Equal(t, uint64(42), *trustBundle.SequenceNumber)
+	assert.Equal(t, int64(300), *trustBundle.RefreshHint)
+	assert.Contains(t, trustBundle.Bundle, `"spiffe_sequence":42`)
+	assert.Contains(t, trustBundle.Bundle, `"spiffe_refresh_hint":300`)
+
+	parsed, err := trustBundle.SPIFFEBundle()
+	require.NoError(t, err)
+	assert.True(t, bundle.Equal(parsed))
+
+	// The read-only fields are derived from the contents
+	stored := TrustBundle{TrustDomain: trustBundle.TrustDomain, Bundle: trustBundle.Bundle}
+	SetBundleMetadata(&stored)
+	assert.Equal(t, trustBundle, &stored)
+
+	_, err = TrustBundle{Bundle: trustBundle.Bundle}.SPIFFEBundle()
+	assert.EqualError(t, err, "trust domain is missing")
+}
+
+func TestValidateTrustBundle(t *testing.T) {
+	authority := newAuthority(t, "example.org")
+	current := marshalBundle(t, "example.org", 2, authority)
+
+	tests := []struct {
+		name     string
+		contents []byte
+		current  []byte
+		err      string
+	}{
+		{
+			name:     "first_upload",
+			contents: marshalBundle(t, "example.org", 1, authority),
+		},
+		{
+			name:     "authority_without_spiffe_id",
+			contents: marshalBundle(t, "example.org", 1, newAuthority(t, "")),
+		},
+		{
+			name:     "rotated",
+			contents: marshalBundle(t, "example.org", 3, authority),
+			current:  current,
+		},
+		{
+			name:     "same_sequence_number",
+			contents: marshalBundle(t, "example.org", 2, authority),
+			current:  current,
+		},
+		{
+			name:     "current_does_not_parse",
+			contents: marshalBundle(t, "example.org", 1, authority),
+			current:  []byte("not a bundle"),
+		},
+		{
+			name:     "err_stale",
+			contents: marshalBundle(t, "example.org", 1, authority),
+			current:  current,
+			err:      `stale trust bundle: sequence number 1 of "example.org" is lower than the current 2`,
+		},
+		{
+			name:     "err_invalid_contents",
+			contents: []byte("not a bundle"),
+			err:      `invalid bundle of "example.org": spiffebundle: unable to parse JWKS: invalid character 'o' in literal null (expecting 'u')`,
+		},
+		{
+			name:     "err_foreign_authority",
+			contents: marshalBundle(t, "example.org", 1, newAuthority(t, "other.org")),
+			err:      `X.509 authority "spiffe://other.org" does not belong to "example.org"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := ValidateTrustBundle(spiffeid.RequireTrustDomainFromString("example.org"), tt.contents, tt.current)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, bundle)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package admin provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/deepmap/oapi-codegen version v1.11.0 DO NOT EDIT.
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/deepmap/oapi-codegen/pkg/runtime"
+	"github.com/labstack/echo/v4"
+)
+
+// SyncStatus defines model for SyncStatus.
+type SyncStatus struct {
+	FederatedTrustDomains []string   `json:"federatedTrustDomains"`
+	LastError             *string    `json:"lastError,omitempty"`
+	LastSuccess           *time.Time `json:"lastSuccess,omitempty"`
+	LastSync              *time.Time `json:"lastSync,omitempty"`
+	ManagedRelationships  []string   `json:"managedRelationships"`
+}
+
+// GetRelationshipsParams defines parameters for GetRelationships.
+type GetRelationshipsParams struct {
+	// filter relationships by status
+	Status *string `form:"status,omitempty" json:"status,omitempty"`
+
+	// filter relationships by federation group
+	FederationGroupId *int64 `form:"federationGroupId,omitempty" json:"federationGroupId,omitempty"`
+}
+
+// ServerInterface represents all server handlers.
+type ServerInterface interface {
+
+	// (GET /bundle)
+	GetBundle(ctx echo.Context) error
+
+	// (GET /bundles/federated)
+	GetFederatedBundles(ctx echo.Context) error
+
+	// (GET /federation/relationships)
+	GetRelationships(ctx echo.Context, params GetRelationshipsParams) error
+
+	// (GET /federation/relationships/{relationshipID})
+	GetRelationship(ctx echo.Context, relationshipID int64) error
+
+	// (POST /federation/relationships/{relationshipID}/approve)
+	ApproveRelationship(ctx echo.Context, relationshipID int64) error
+
+	// (POST /federation/relationships/{relationshipID}/deny)
+	DenyRelationship(ctx echo.Context, relationshipID int64) error
+
+	// (GET /sync)
+	GetSyncStatus(ctx echo.Context) error
+
+	// (POST /sync)
+	Resync(ctx echo.Context) error
+}
+
+// ServerInterfaceWrapper converts echo contexts to parameters.
+type ServerInterfaceWrapper struct {
+	Handler ServerInterface
+}
+
+// GetBundle converts echo context to params.
+func (w *ServerInterfaceWrapper) GetBundle(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetBundle(ctx)
+	return err
+}
+
+// GetFederatedBundles converts echo context to params.
+func (w *ServerInterfaceWrapper) GetFederatedBundles(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetFederatedBundles(ctx)
+	return err
+}
+
+// GetRelationships converts echo context to params.
+func (w *ServerInterfaceWrapper) GetRelationships(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetRelationshipsParams
+	// ------------- Optional query parameter "status" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "status", ctx.QueryParams(), &params.Status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter status: %s", err))
+	}
+
+	// ------------- Optional query parameter "federationGroupId" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "federationGroupId", ctx.QueryParams(), &params.FederationGroupId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter federationGroupId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetRelationships(ctx, params)
+	return err
+}
+
+// GetRelationship converts echo context to params.
+func (w *ServerInterfaceWrapper) GetRelationship(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "relationshipID" -------------
+	var relationshipID int64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "relationshipID", runtime.ParamLocationPath, ctx.Param("relationshipID"), &relationshipID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter relationshipID: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetRelationship(ctx, relationshipID)
+	return err
+}
+
+// ApproveRelationship converts echo context to params.
+func (w *ServerInterfaceWrapper) ApproveRelationship(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "relationshipID" -------------
+	var relationshipID int64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "relationshipID", runtime.ParamLocationPath, ctx.Param("relationshipID"), &relationshipID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter relationshipID: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.ApproveRelationship(ctx, relationshipID)
+	return err
+}
+
+// DenyRelationship converts echo context to params.
+func (w *ServerInterfaceWrapper) DenyRelationship(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "relationshipID" -------------
+	var relationshipID int64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "relationshipID", runtime.ParamLocationPath, ctx.Param("relationshipID"), &relationshipID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter relationshipID: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.DenyRelationship(ctx, relationshipID)
+	return err
+}
+
+// GetSyncStatus converts echo context to params.
+func (w *ServerInterfaceWrapper) GetSyncStatus(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetSyncStatus(ctx)
+	return err
+}
+
+// Resync converts echo context to params.
+func (w *ServerInterfaceWrapper) Resync(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.Resync(ctx)
+	return err
+}
+
+// This is a simple interface which specifies echo.Route addition functions which
+// are present on both echo.Echo and echo.Group, since we want to allow using
+// either of them for path registration
+type EchoRouter interface {
+	CONNECT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	HEAD(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	OPTIONS(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	TRACE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+}
+
+// RegisterHandlers adds each server route to the EchoRouter.
+func RegisterHandlers(router EchoRouter, si ServerInterface) {
+	RegisterHandlersWithBaseURL(router, si, "")
+}
+
+// Registers handlers, and prepends BaseURL to the paths, so that the paths
+// can be served under a prefix.
+func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL string) {
+
+	wrapper := ServerInterfaceWrapper{
+		Handler: si,
+	}
+
+	router.GET(baseURL+"/bundle", wrapper.GetBundle)
+	router.GET(baseURL+"/bundles/federated", wrapper.GetFederatedBundles)
+	router.GET(baseURL+"/federation/relationships", wrapper.GetRelationships)
+	router.GET(baseURL+"/federation/relationships/:relationshipID", wrapper.GetRelationship)
+	router.POST(baseURL+"/federation/relationships/:relationshipID/approve", wrapper.ApproveRelationship)
+	router.POST(baseURL+"/federation/relationships/:relationshipID/deny", wrapper.DenyRelationship)
+	router.GET(baseURL+"/sync", wrapper.GetSyncStatus)
+	router.POST(baseURL+"/sync", wrapper.Resync)
+
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+)
+
+// Client is an HTTP client of the admin API of a harvester, listening on the
+// given unix domain socket.
+type Client struct {
+	client *http.Client
+}
+
+func NewClient(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	return &Client{client: &http.Client{Transport: transport}}
+}
+
+// ListRelationships returns the federation relationships of the harvester
+// with the given status and federation group, if not empty nor zero.
+func (c *Client) ListRelationships(ctx context.Context, status string, federationGroupID int64) ([]common.FederationRelationship, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if federationGroupID != 0 {
+		query.Set("federationGroupId", strconv.FormatInt(federationGroupID, 10))
+	}
+
+	var relationships []common.FederationRelationship
+	if err := c.do(ctx, http.MethodGet, "/federation/relationships", query, &relationships); err != nil {
+		return nil, err
+	}
+
+	return relationships, nil
+}
+
+func (c *Client) GetRelationship(ctx context.Context, id int64) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/federation/relationships/%d", id), nil, &relationship); err != nil {
+		return nil, err
+	}
+
+	return &relationship, nil
+}
+
+func (c *Client) ApproveRelationship(ctx context.Context, id int64) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/federation/relationships/%d/approve", id), nil, &relationship); err != nil {
+		return nil, err
+	}
+
+	return &relationship, nil
+}
+
+func (c *Client) DenyRelationship(ctx context.Context, id int64) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/federation/relationships/%d/deny", id), nil, &relationship); err != nil {
+		return nil, err
+	}
+
+	return &relationship, nil
+}
+
+// GetBundle returns the trust bundle of the SPIRE Server managed by the
+// harvester.
+func (c *Client) GetBundle(ctx context.Context) (*common.TrustBundle, error) {
+	var bundle common.TrustBundle
+	if err := c.do(ctx, http.MethodGet, "/bundle", nil, &bundle); err != nil {
+		return nil, err
+	}
+
+	return &bundle, nil
+}
+
+// ListFederatedBundles returns the trust bundles of the trust domains
+// federated with the SPIRE Server managed by the harvester.
+func (c *Client) ListFederatedBundles(ctx context.Context) ([]common.TrustBundle, error) {
+	var bundles []common.TrustBundle
+	if err := c.do(ctx, http.MethodGet, "/bundles/federated", nil, &bundles); err != nil {
+		return nil, err
+	}
+
+	return bundles, nil
+}
+
+func (c *Client) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	var status SyncStatus
+	if err := c.do(ctx, http.MethodGet, "/sync", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Resync makes the harvester synchronize with the Galadriel Server right
+// away, and returns the resulting status.
+func (c *Client) Resync(ctx context.Context) (*SyncStatus, error) {
+	var status SyncStatus
+	if err := c.do(ctx, http.MethodPost, "/sync", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// do sends a request to the admin API, and decodes the JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out interface{}) error {
+	// The host is ignored, requests are sent to the socket
+	u := url.URL{Scheme: "http", Host: "harvester", Path: path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the harvester admin API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr common.Error
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s (status %d)", apiErr.Message, resp.StatusCode)
+		}
+		return fmt.Errorf("harvester admin API responded with status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return nil
+}
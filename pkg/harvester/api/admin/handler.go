@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/controller"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/server"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+var _ ServerInterface = (*Handler)(nil)
+
+// Handler implements the admin API of the harvester. Every request is made
+// on behalf of the trust domain of the SPIRE Server managed by the harvester.
+type Handler struct {
+	catalog    catalog.Catalog
+	controller controller.HarvesterController
+	logger     common.Logger
+}
+
+// NewHandler returns a new admin API handler on top of the given catalog and
+// harvester controller.
+func NewHandler(cat catalog.Catalog, controller controller.HarvesterController) *Handler {
+	return &Handler{
+		catalog:    cat,
+		controller: controller,
+		logger:     *common.NewLogger(telemetry.AdminAPI),
+	}
+}
+
+// (GET /bundle)
+func (h *Handler) GetBundle(ctx echo.Context) error {
+	bundle, err := h.catalog.Spire.GetBundle(ctx.Request().Context())
+	if err != nil {
+		return h.handleError(ctx, fmt.Errorf("failed to get bundle from spire server: %v", err))
+	}
+
+	trustBundle, err := common.NewTrustBundle(bundle)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, trustBundle)
+}
+
+// (GET /bundles/federated)
+func (h *Handler) GetFederatedBundles(ctx echo.Context) error {
+	bundles, err := h.catalog.Spire.ListFederatedBundles(ctx.Request().Context())
+	if err != nil {
+		return h.handleError(ctx, fmt.Errorf("failed to list federated bundles of spire server: %v", err))
+	}
+
+	out := make([]common.TrustBundle, 0, len(bundles))
+	for _, bundle := range bundles {
+		trustBundle, err := common.NewTrustBundle(bundle)
+		if err != nil {
+			return h.handleError(ctx, err)
+		}
+		out = append(out, *trustBundle)
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (GET /sync)
+func (h *Handler) GetSyncStatus(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, toSyncStatus(h.controller.SyncStatus()))
+}
+
+// (POST /sync)
+func (h *Handler) Resync(ctx echo.Context) error {
+	h.logger.Info("Resync requested")
+
+	status, err := h.controller.Resync(ctx.Request().Context())
+	if err != nil {
+		return h.handleError(ctx, fmt.Errorf("failed to resync: %v", err))
+	}
+
+	return ctx.JSON(http.StatusOK, toSyncStatus(status))
+}
+
+// (GET /federation/relationships)
+func (h *Handler) GetRelationships(ctx echo.Context, params GetRelationshipsParams) error {
+	reqCtx := ctx.Request().Context()
+
+	td, err := h.trustDomain(reqCtx)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	relationships, err := h.catalog.Server.GetMemberships(reqCtx, td)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := []common.FederationRelationship{}
+	for _, relationship := range relationships {
+		if params.Status != nil && (relationship.Status == nil || string(*relationship.Status) != *params.Status) {
+			continue
+		}
+		if params.FederationGroupId != nil && relationship.FederationGroupId != *params.FederationGroupId {
+			continue
+		}
+		out = append(out, relationship)
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (GET /federation/relationships/{relationshipID})
+func (h *Handler) GetRelationship(ctx echo.Context, relationshipID int64) error {
+	reqCtx := ctx.Request().Context()
+
+	td, err := h.trustDomain(reqCtx)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	relationship, err := h.catalog.Server.GetRelationship(reqCtx, td, relationshipID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, relationship)
+}
+
+// (POST /federation/relationships/{relationshipID}/approve)
+func (h *Handler) ApproveRelationship(ctx echo.Context, relationshipID int64) error {
+	return h.setConsent(ctx, relationshipID, common.ConsentAccepted, telemetry.Approve)
+}
+
+// (POST /federation/relationships/{relationshipID}/deny)
+func (h *Handler) DenyRelationship(ctx echo.Context, relationshipID int64) error {
+	return h.setConsent(ctx, relationshipID, common.ConsentDenied, telemetry.Deny)
+}
+
+// setConsent sets the consent of the trust domain of the harvester to the
+// relationship, and writes the updated relationship.
+func (h *Handler) setConsent(ctx echo.Context, relationshipID int64, consent, action string) error {
+	reqCtx := ctx.Request().Context()
+
+	td, err := h.trustDomain(reqCtx)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	if err := h.catalog.Server.SetRelationshipConsent(reqCtx, td, relationshipID, consent); err != nil {
+		return h.handleError(ctx, err)
+	}
+	telemetry.Count(reqCtx, telemetry.AdminAPI, telemetry.FederationRelationship, action, telemetry.TrustDomainAttr(td.String()))
+	h.logger.Info("Consent of", td, "to federation relationship", relationshipID, "is", consent)
+
+	relationship, err := h.catalog.Server.GetRelationship(reqCtx, td, relationshipID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, relationship)
+}
+
+func toSyncStatus(in controller.SyncStatus) SyncStatus {
+	out := SyncStatus{
+		FederatedTrustDomains: trustDomainStrings(in.FederatedTrustDomains),
+		ManagedRelationships:  trustDomainStrings(in.ManagedRelationships),
+	}
+	if !in.LastSync.IsZero() {
+		out.LastSync = &in.LastSync
+	}
+	if !in.LastSuccess.IsZero() {
+		out.LastSuccess = &in.LastSuccess
+	}
+	if in.LastError != nil {
+		lastError := in.LastError.Error()
+		out.LastError = &lastError
+	}
+
+	return out
+}
+
+func trustDomainStrings(tds []spiffeid.TrustDomain) []string {
+	out := make([]string, 0, len(tds))
+	for _, td := range tds {
+		out = append(out, td.String())
+	}
+
+	return out
+}
+
+// trustDomain returns the trust domain of the SPIRE Server managed by the
+// harvester.
+func (h *Handler) trustDomain(ctx context.Context) (spiffeid.TrustDomain, error) {
+	bundle, err := h.catalog.Spire.GetBundle(ctx)
+	if err != nil {
+		return spiffeid.TrustDomain{}, fmt.Errorf("failed to get trust domain of the spire server: %v", err)
+	}
+
+	return bundle.TrustDomain(), nil
+}
+
+// handleError writes a common.Error response. Errors returned by the
+// Galadriel Server keep their status code, so that operators can tell why a
+// request was rejected.
+func (h *Handler) handleError(ctx echo.Context, err error) error {
+	var respErr *server.ResponseError
+	if errors.As(err, &respErr) {
+		return writeError(ctx, respErr.StatusCode, respErr.Message)
+	}
+
+	h.logger.Error(ctx.Request().Method, ctx.Request().URL.Path, "failed:", err)
+	return writeError(ctx, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(ctx echo.Context, code int, message string) error {
+	return ctx.JSON(code, common.Error{
+		Code:    int32(code),
+		Message: message,
+	})
+}
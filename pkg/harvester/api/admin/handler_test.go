@@ -0,0 +1,257 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/controller"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/server"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/spire"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	td      = spiffeid.RequireTrustDomainFromString("example.org")
+	otherTD = spiffeid.RequireTrustDomainFromString("other.org")
+)
+
+type fakeSpire struct {
+	spire.SpireServer
+}
+
+func (fakeSpire) GetBundle(context.Context) (*spiffebundle.Bundle, error) {
+	return spiffebundle.New(td), nil
+}
+
+func (fakeSpire) ListFederatedBundles(context.Context) ([]*spiffebundle.Bundle, error) {
+	return []*spiffebundle.Bundle{spiffebundle.New(otherTD)}, nil
+}
+
+type fakeController struct {
+	controller.HarvesterController
+
+	status    controller.SyncStatus
+	resyncErr error
+	resyncs   int
+}
+
+func (c *fakeController) SyncStatus() controller.SyncStatus {
+	return c.status
+}
+
+func (c *fakeController) Resync(context.Context) (controller.SyncStatus, error) {
+	c.resyncs++
+	return c.status, c.resyncErr
+}
+
+type fakeServer struct {
+	server.GaladrielServer
+
+	relationships map[int64]*common.FederationRelationship
+	consents      map[int64]string
+}
+
+func (s *fakeServer) GetMemberships(_ context.Context, got spiffeid.TrustDomain) ([]common.FederationRelationship, error) {
+	if got != td {
+		return nil, &server.ResponseError{StatusCode: http.StatusForbidden, Message: "not allowed"}
+	}
+
+	var out []common.FederationRelationship
+	for id := int64(1); id <= int64(len(s.relationships)); id++ {
+		out = append(out, *s.relationships[id])
+	}
+	return out, nil
+}
+
+func (s *fakeServer) GetRelationship(_ context.Context, _ spiffeid.TrustDomain, id int64) (*common.FederationRelationship, error) {
+	relationship, ok := s.relationships[id]
+	if !ok {
+		return nil, &server.ResponseError{StatusCode: http.StatusNotFound, Message: "federation relationship: not found"}
+	}
+	return relationship, nil
+}
+
+func (s *fakeServer) SetRelationshipConsent(_ context.Context, _ spiffeid.TrustDomain, id int64, consent string) error {
+	relationship, ok := s.relationships[id]
+	if !ok {
+		return &server.ResponseError{StatusCode: http.StatusNotFound, Message: "federation relationship: not found"}
+	}
+	if s.consents[id] == consent {
+		return &server.ResponseError{StatusCode: http.StatusConflict, Message: "consent is already " + consent}
+	}
+
+	s.consents[id] = consent
+	relationship.SpireServerConsent = &consent
+	return nil
+}
+
+func relationship(id, groupID int64, status common.FederationRelationshipStatus) *common.FederationRelationship {
+	return &common.FederationRelationship{
+		Id:                       id,
+		FederationGroupId:        groupID,
+		SpireServer:              td.String(),
+		SpireServerFederatedWith: "other.org",
+		Status:                   &status,
+	}
+}
+
+// newTestClient serves the admin API of a harvester with the given Galadriel
+// Server and controller on a unix domain socket, and returns a client of it.
+func newTestClient(t *testing.T, galadrielServer server.GaladrielServer, harvesterController controller.HarvesterController) *Client {
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	router := echo.New()
+	RegisterHandlers(router, NewHandler(catalog.Catalog{Spire: fakeSpire{}, Server: galadrielServer}, harvesterController))
+
+	httpServer := &http.Server{Handler: router}
+	go func() { _ = httpServer.Serve(listener) }()
+	t.Cleanup(func() { httpServer.Close() })
+
+	return NewClient(socketPath)
+}
+
+func TestRelationships(t *testing.T) {
+	galadrielServer := &fakeServer{
+		relationships: map[int64]*common.FederationRelationship{
+			1: relationship(1, 1, common.FederationRelationshipStatusInvited),
+			2: relationship(2, 1, common.FederationRelationshipStatusActive),
+			3: relationship(3, 2, common.FederationRelationshipStatusInvited),
+		},
+		consents: make(map[int64]string),
+	}
+	client := newTestClient(t, galadrielServer, &fakeController{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name              string
+		status            string
+		federationGroupID int64
+		expected          []int64
+	}{
+		{name: "all", expected: []int64{1, 2, 3}},
+		{name: "status", status: "invited", expected: []int64{1, 3}},
+		{name: "federation_group", federationGroupID: 1, expected: []int64{1, 2}},
+		{name: "status_and_federation_group", status: "active", federationGroupID: 2, expected: []int64{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			relationships, err := client.ListRelationships(ctx, tt.status, tt.federationGroupID)
+			require.NoError(t, err)
+
+			ids := []int64{}
+			for _, relationship := range relationships {
+				ids = append(ids, relationship.Id)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+
+	got, err := client.GetRelationship(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, galadrielServer.relationships[2], got)
+
+	_, err = client.GetRelationship(ctx, 4)
+	assert.EqualError(t, err, "federation relationship: not found (status 404)")
+}
+
+func TestConsent(t *testing.T) {
+	galadrielServer := &fakeServer{
+		relationships: map[int64]*common.FederationRelationship{
+			1: relationship(1, 1, common.FederationRelationshipStatusInvited),
+		},
+		consents: make(map[int64]string),
+	}
+	client := newTestClient(t, galadrielServer, &fakeController{})
+	ctx := context.Background()
+
+	relationship, err := client.ApproveRelationship(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, common.ConsentAccepted, *relationship.SpireServerConsent)
+
+	_, err = client.ApproveRelationship(ctx, 1)
+	assert.EqualError(t, err, "consent is already accepted (status 409)")
+
+	relationship, err = client.DenyRelationship(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, common.ConsentDenied, *relationship.SpireServerConsent)
+
+	_, err = client.DenyRelationship(ctx, 2)
+	assert.EqualError(t, err, "federation relationship: not found (status 404)")
+}
+
+func TestBundles(t *testing.T) {
+	client := newTestClient(t, &fakeServer{}, &fakeController{})
+	ctx := context.Background()
+
+	bundle, err := client.GetBundle(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, td.String(), *bundle.TrustDomain)
+	expected, err := spiffebundle.New(td).Marshal()
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), bundle.Bundle)
+
+	bundles, err := client.ListFederatedBundles(ctx)
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+	assert.Equal(t, otherTD.String(), *bundles[0].TrustDomain)
+}
+
+func TestSync(t *testing.T) {
+	lastSuccess := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	lastSync := lastSuccess.Add(10 * time.Second)
+	harvesterController := &fakeController{
+		status: controller.SyncStatus{
+			LastSync:              lastSync,
+			LastSuccess:           lastSuccess,
+			LastError:             errors.New("galadriel server is down"),
+			FederatedTrustDomains: []spiffeid.TrustDomain{otherTD},
+		},
+	}
+	client := newTestClient(t, &fakeServer{}, harvesterController)
+	ctx := context.Background()
+
+	lastError := "galadriel server is down"
+	expected := &SyncStatus{
+		LastSync:              &lastSync,
+		LastSuccess:           &lastSuccess,
+		LastError:             &lastError,
+		FederatedTrustDomains: []string{otherTD.String()},
+		ManagedRelationships:  []string{},
+	}
+
+	status, err := client.GetSyncStatus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, expected, status)
+	assert.Zero(t, harvesterController.resyncs)
+
+	status, err = client.Resync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, expected, status)
+	assert.Equal(t, 1, harvesterController.resyncs)
+
+	harvesterController.resyncErr = context.DeadlineExceeded
+	_, err = client.Resync(ctx)
+	assert.EqualError(t, err, "failed to resync: context deadline exceeded (status 500)")
+}
+
+func TestUnreachableSocket(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+
+	_, err := client.ListRelationships(context.Background(), "", 0)
+	assert.ErrorContains(t, err, "failed to reach the harvester admin API")
+}
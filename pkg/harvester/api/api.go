@@ -3,45 +3,114 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
 	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/api/admin"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/controller"
+	"github.com/labstack/echo/v4"
 )
 
 type API interface {
 	common.RunnablePlugin
-	GetTrustBundle(context.Context, string) (string, error)
-	AddTrustBundle(context.Context, string) error
+}
+
+const (
+	// socketDirMode is the mode of the directory of the admin socket, when
+	// it does not exist.
+	socketDirMode = 0750
+	// socketMode only lets the user running the harvester, and its group,
+	// connect to the admin socket.
+	socketMode = 0770
+	// shutdownTimeout is the time the in-flight requests are given to
+	// complete when the admin API shuts down.
+	shutdownTimeout = 10 * time.Second
+)
+
+// Config configures the admin API of the harvester.
+type Config struct {
+	// SocketPath is the path of the unix domain socket the admin API
+	// listens on.
+	SocketPath string
 }
 
 type HTTPApi struct {
 	controller controller.HarvesterController
+	catalog    catalog.Catalog
+	config     Config
 	logger     common.Logger
 }
 
-func NewHTTPApi(controller controller.HarvesterController) API {
-	// TODO: Add listen address and port
+func NewHTTPApi(controller controller.HarvesterController, cat catalog.Catalog, config Config) API {
 	return &HTTPApi{
 		controller: controller,
+		catalog:    cat,
+		config:     config,
 		logger:     *common.NewLogger(telemetry.HTTPApi),
 	}
 }
 
+// Run serves the admin API on the socket until the context is done.
 func (a *HTTPApi) Run(ctx context.Context) error {
-	a.logger.Info("Starting HTTP API")
-	// TODO: implement
+	listener, err := listenSocket(a.config.SocketPath)
+	if err != nil {
+		return err
+	}
 
-	<-ctx.Done()
-	return nil
-}
+	router := echo.New()
+	router.HideBanner = true
+	router.HidePort = true
+	admin.RegisterHandlers(router, admin.NewHandler(a.catalog, a.controller))
+
+	server := &http.Server{Handler: router}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- server.Serve(listener)
+	}()
+	a.logger.Info("Serving admin API on", a.config.SocketPath)
 
-func (a *HTTPApi) GetTrustBundle(ctx context.Context, spiffeID string) (string, error) {
-	telemetry.Count(ctx, telemetry.HTTPApi, telemetry.TrustBundle, telemetry.Get)
-	return "", errors.New("not implemented")
+	select {
+	case err = <-errch:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	return err
 }
 
-func (a *HTTPApi) AddTrustBundle(ctx context.Context, spiffeID string) error {
-	telemetry.Count(ctx, telemetry.HTTPApi, telemetry.TrustBundle, telemetry.Add)
-	return errors.New("not implemented")
+// listenSocket listens on the unix domain socket at path, replacing the
+// socket left behind by a previous run, if any. Access to the admin API is
+// controlled by the permissions of the socket.
+func listenSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), socketDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create admin socket directory: %v", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale admin socket: %v", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin socket: %v", err)
+	}
+
+	if err := os.Chmod(path, socketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set admin socket permissions: %v", err)
+	}
+
+	return listener, nil
 }
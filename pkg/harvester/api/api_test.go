@@ -1 +1,40 @@
 package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunServesAdminSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "admin", "admin.sock")
+
+	// A socket left behind by a previous run is replaced
+	require.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0755))
+	require.NoError(t, os.WriteFile(socketPath, nil, 0600))
+
+	api := NewHTTPApi(nil, catalog.Catalog{}, Config{SocketPath: socketPath})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- api.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(socketPath)
+		return err == nil && info.Mode()&os.ModeSocket != 0 && info.Mode().Perm() == socketMode
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-errch:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("admin API did not stop")
+	}
+}
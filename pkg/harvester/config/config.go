@@ -3,12 +3,16 @@ package config
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
 	"github.com/hashicorp/hcl"
 	"github.com/pkg/errors"
 )
 
+// DefaultAdminSocketPath is the default unix domain socket of the admin API.
+const DefaultAdminSocketPath = "/tmp/galadriel-harvester/admin.sock"
+
 type HarvesterConfig struct {
 	HarvesterConfigSection *HarvesterConfigSection           `hcl:"harvester"`
 	TelemetryConfigSection *telemetry.TelemetryConfigSection `hcl:"telemetry"`
@@ -18,6 +22,57 @@ type HarvesterConfigSection struct {
 	SpireSocketPath string `hcl:"spire_socket_path"`
 	ServerAddress   string `hcl:"server_address"`
 	LogLevel        string `hcl:"log_level"`
+	SyncInterval    string `hcl:"sync_interval"`
+	// AdminSocketPath is the unix domain socket of the admin API, used by
+	// the harvester CLI.
+	AdminSocketPath string `hcl:"admin_socket_path"`
+	// DataDir is where the harvester persists its state, such as the
+	// credential issued by the Galadriel Server when onboarding.
+	DataDir string `hcl:"data_dir"`
+	// JoinToken is redeemed to onboard the harvester with the Galadriel
+	// Server. Not required once the harvester has onboarded.
+	JoinToken string `hcl:"join_token"`
+	// AllowUnsignedBundles sets the federated bundles that are not signed by
+	// the harvester of their trust domain in the SPIRE Server, and trusts the
+	// first bundle of a trust domain on first use.
+	AllowUnsignedBundles bool `hcl:"allow_unsigned_bundles"`
+	// AdoptFederationRelationships takes over the federation relationships
+	// configured out of band in the SPIRE Server that match an active
+	// Galadriel relationship.
+	AdoptFederationRelationships bool `hcl:"adopt_federation_relationships"`
+	// PushUnsignedBundles pushes the bundle of the SPIRE Server without
+	// signing it with an X509-SVID minted by the SPIRE Server.
+	PushUnsignedBundles bool `hcl:"push_unsigned_bundles"`
+
+	// TLS configures the connection to the Galadriel Server. Plaintext HTTP is
+	// used if not set and the server address has no https scheme.
+	TLS *TLSConfigSection `hcl:"tls"`
+
+	// HealthChecks configures the listener of the liveness and readiness
+	// endpoints. They are not served if not set.
+	HealthChecks *HealthChecksConfigSection `hcl:"health_checks"`
+}
+
+// TLSConfigSection configures the verification of the Galadriel Server
+// certificate and the client certificate of the harvester.
+type TLSConfigSection struct {
+	CertFile string `hcl:"cert_file"`
+	KeyFile  string `hcl:"key_file"`
+	// CABundleFile is the bundle used to verify the Galadriel Server
+	// certificate. The system roots are used if not set.
+	CABundleFile string `hcl:"ca_bundle_file"`
+	// UseSpireSVID presents an X509-SVID minted by the managed SPIRE Server
+	// as client certificate, instead of CertFile.
+	UseSpireSVID bool `hcl:"use_spire_svid"`
+}
+
+// HealthChecksConfigSection configures the listener of the health endpoints
+// and the readiness of the harvester.
+type HealthChecksConfigSection struct {
+	ListenAddress string `hcl:"listen_address"`
+	// SyncWindow is the time since the last successful synchronization with
+	// the Galadriel Server after which the harvester is not ready.
+	SyncWindow string `hcl:"sync_window"`
 }
 
 // New creates a new HarvesterConfig from the given input reader.
@@ -44,7 +99,6 @@ func newConfig(configBytes []byte) (*HarvesterConfig, error) {
 
 	if config.HarvesterConfigSection == nil {
 		config.HarvesterConfigSection = &HarvesterConfigSection{}
-		config.TelemetryConfigSection = &telemetry.TelemetryConfigSection{}
 	}
 
 	config.setDefaults()
@@ -61,6 +115,39 @@ func (c *HarvesterConfig) validate() error {
 		return errors.New("harvester.server_address is required")
 	}
 
+	syncInterval, err := time.ParseDuration(c.HarvesterConfigSection.SyncInterval)
+	if err != nil {
+		return errors.Wrap(err, "invalid harvester.sync_interval")
+	}
+	if syncInterval <= 0 {
+		return errors.New("harvester.sync_interval must be positive")
+	}
+
+	if tls := c.HarvesterConfigSection.TLS; tls != nil {
+		if (tls.CertFile == "") != (tls.KeyFile == "") {
+			return errors.New("harvester.tls.cert_file and harvester.tls.key_file must be set together")
+		}
+		if tls.UseSpireSVID && tls.CertFile != "" {
+			return errors.New("harvester.tls.use_spire_svid cannot be set along with harvester.tls.cert_file")
+		}
+	}
+
+	if healthChecks := c.HarvesterConfigSection.HealthChecks; healthChecks != nil {
+		syncWindow, err := time.ParseDuration(healthChecks.SyncWindow)
+		if err != nil {
+			return errors.Wrap(err, "invalid harvester.health_checks.sync_window")
+		}
+		if syncWindow < syncInterval {
+			return errors.New("harvester.health_checks.sync_window must not be shorter than harvester.sync_interval")
+		}
+	}
+
+	if c.TelemetryConfigSection != nil {
+		if err := c.TelemetryConfigSection.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -72,4 +159,29 @@ func (c *HarvesterConfig) setDefaults() {
 	if c.HarvesterConfigSection.SpireSocketPath == "" {
 		c.HarvesterConfigSection.SpireSocketPath = "/tmp/spire-server/private/api.sock"
 	}
+
+	if c.HarvesterConfigSection.SyncInterval == "" {
+		c.HarvesterConfigSection.SyncInterval = "1m"
+	}
+
+	if c.HarvesterConfigSection.AdminSocketPath == "" {
+		c.HarvesterConfigSection.AdminSocketPath = DefaultAdminSocketPath
+	}
+
+	if c.HarvesterConfigSection.DataDir == "" {
+		c.HarvesterConfigSection.DataDir = "./.data"
+	}
+
+	if healthChecks := c.HarvesterConfigSection.HealthChecks; healthChecks != nil {
+		if healthChecks.ListenAddress == "" {
+			healthChecks.ListenAddress = "localhost:8083"
+		}
+		if healthChecks.SyncWindow == "" {
+			healthChecks.SyncWindow = "5m"
+		}
+	}
+
+	if c.TelemetryConfigSection != nil {
+		c.TelemetryConfigSection.SetDefaults()
+	}
 }
@@ -25,15 +25,19 @@ func TestNew(t *testing.T) {
 	}{
 		{
 			name:   "ok",
-			config: bytes.NewBuffer([]byte(`harvester { spire_socket_path = "spire_socket_path" server_address = "server_address" } telemetry { tool = "Prometheus" }`)),
+			config: bytes.NewBuffer([]byte(`harvester { spire_socket_path = "spire_socket_path" server_address = "server_address" } telemetry { Prometheus { port = 8888 } OTLP { endpoint = "collector:4317" } }`)),
 			expected: &HarvesterConfig{
 				HarvesterConfigSection: &HarvesterConfigSection{
 					SpireSocketPath: "spire_socket_path",
 					ServerAddress:   "server_address",
 					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
 				},
 				TelemetryConfigSection: &telemetry.TelemetryConfigSection{
-					Tool: "Prometheus",
+					Prometheus: &telemetry.PrometheusConfigSection{Host: "localhost", Port: 8888},
+					OTLP:       &telemetry.OTLPConfigSection{Endpoint: "collector:4317", ExportInterval: "10s"},
 				},
 			},
 		},
@@ -45,9 +49,177 @@ func TestNew(t *testing.T) {
 					SpireSocketPath: "/tmp/spire-server/private/api.sock",
 					ServerAddress:   "server_address",
 					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
 				},
 			},
 		},
+		{
+			name:   "sync_interval",
+			config: bytes.NewBuffer([]byte(`harvester { server_address = "server_address" sync_interval = "5m" }`)),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath: "/tmp/spire-server/private/api.sock",
+					ServerAddress:   "server_address",
+					LogLevel:        "INFO",
+					SyncInterval:    "5m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
+				},
+			},
+		},
+		{
+			name: "tls",
+			config: bytes.NewBufferString(`harvester {
+				server_address = "server_address"
+				tls {
+					cert_file = "harvester.pem"
+					key_file = "harvester.key"
+					ca_bundle_file = "ca.pem"
+				}
+			}`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath: "/tmp/spire-server/private/api.sock",
+					ServerAddress:   "server_address",
+					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
+					TLS: &TLSConfigSection{
+						CertFile:     "harvester.pem",
+						KeyFile:      "harvester.key",
+						CABundleFile: "ca.pem",
+					},
+				},
+			},
+		},
+		{
+			name:   "join_token",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" data_dir = "/var/lib/harvester" join_token = "token" }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath: "/tmp/spire-server/private/api.sock",
+					ServerAddress:   "server_address",
+					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "/var/lib/harvester",
+					JoinToken:       "token",
+				},
+			},
+		},
+		{
+			name:   "allow_unsigned_bundles",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" allow_unsigned_bundles = true }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath:      "/tmp/spire-server/private/api.sock",
+					ServerAddress:        "server_address",
+					LogLevel:             "INFO",
+					SyncInterval:         "1m",
+					AdminSocketPath:      DefaultAdminSocketPath,
+					DataDir:              "./.data",
+					AllowUnsignedBundles: true,
+				},
+			},
+		},
+		{
+			name:   "adopt_federation_relationships",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" adopt_federation_relationships = true }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath:              "/tmp/spire-server/private/api.sock",
+					ServerAddress:                "server_address",
+					LogLevel:                     "INFO",
+					SyncInterval:                 "1m",
+					AdminSocketPath:              DefaultAdminSocketPath,
+					DataDir:                      "./.data",
+					AdoptFederationRelationships: true,
+				},
+			},
+		},
+		{
+			name:   "push_unsigned_bundles",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" push_unsigned_bundles = true }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath:     "/tmp/spire-server/private/api.sock",
+					ServerAddress:       "server_address",
+					LogLevel:            "INFO",
+					SyncInterval:        "1m",
+					AdminSocketPath:     DefaultAdminSocketPath,
+					DataDir:             "./.data",
+					PushUnsignedBundles: true,
+				},
+			},
+		},
+		{
+			name:   "tls_spire_svid",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" tls { use_spire_svid = true } }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath: "/tmp/spire-server/private/api.sock",
+					ServerAddress:   "server_address",
+					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
+					TLS:             &TLSConfigSection{UseSpireSVID: true},
+				},
+			},
+		},
+		{
+			name:   "health_checks",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" health_checks {} }`),
+			expected: &HarvesterConfig{
+				HarvesterConfigSection: &HarvesterConfigSection{
+					SpireSocketPath: "/tmp/spire-server/private/api.sock",
+					ServerAddress:   "server_address",
+					LogLevel:        "INFO",
+					SyncInterval:    "1m",
+					AdminSocketPath: DefaultAdminSocketPath,
+					DataDir:         "./.data",
+					HealthChecks:    &HealthChecksConfigSection{ListenAddress: "localhost:8083", SyncWindow: "5m"},
+				},
+			},
+		},
+		{
+			name:   "health_checks_invalid_sync_window",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" health_checks { sync_window = "later" } }`),
+			err:    `bad configuration: invalid harvester.health_checks.sync_window: time: invalid duration "later"`,
+		},
+		{
+			name:   "health_checks_sync_window_shorter_than_sync_interval",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" sync_interval = "10m" health_checks {} }`),
+			err:    "bad configuration: harvester.health_checks.sync_window must not be shorter than harvester.sync_interval",
+		},
+		{
+			name:   "tls_spire_svid_and_certificate",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" tls { use_spire_svid = true cert_file = "harvester.pem" key_file = "harvester.key" } }`),
+			err:    "bad configuration: harvester.tls.use_spire_svid cannot be set along with harvester.tls.cert_file",
+		},
+		{
+			name:   "tls_missing_key",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" tls { cert_file = "harvester.pem" } }`),
+			err:    "bad configuration: harvester.tls.cert_file and harvester.tls.key_file must be set together",
+		},
+		{
+			name:   "invalid_telemetry",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" } telemetry { Prometheus { host = "0.0.0.0" } }`),
+			err:    "bad configuration: invalid telemetry.Prometheus.port 0",
+		},
+		{
+			name:   "invalid_sync_interval",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" sync_interval = "often" }`),
+			err:    `bad configuration: invalid harvester.sync_interval: time: invalid duration "often"`,
+		},
+		{
+			name:   "negative_sync_interval",
+			config: bytes.NewBufferString(`harvester { server_address = "server_address" sync_interval = "-1s" }`),
+			err:    "bad configuration: harvester.sync_interval must be positive",
+		},
 		{
 			name:   "empty_config_file",
 			config: bytes.NewBufferString(``),
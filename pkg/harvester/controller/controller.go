@@ -2,62 +2,1059 @@ package controller
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/bundlesig"
 	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/server"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/spire"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type HarvesterController interface {
 	common.RunnablePlugin
-	GetTrustBundle(context.Context, string) (string, error)
-	AddTrustBundle(context.Context, string) error
+	// SyncStatus returns the status of the synchronizations with the
+	// Galadriel Server.
+	SyncStatus() SyncStatus
+	// Resync synchronizes with the Galadriel Server right away, without
+	// waiting for the sync interval, and returns the resulting status.
+	Resync(context.Context) (SyncStatus, error)
+}
+
+// SyncStatus is the status of the synchronizations of the harvester with the
+// Galadriel Server.
+type SyncStatus struct {
+	// LastSync is the time of the last synchronization, zero if none ran yet.
+	LastSync time.Time
+	// LastSuccess is the time of the last successful synchronization.
+	LastSuccess time.Time
+	// LastError is the error of the last synchronization, nil if it
+	// succeeded.
+	LastError error
+	// FederatedTrustDomains are the trust domains whose bundles are set in
+	// the SPIRE Server.
+	FederatedTrustDomains []spiffeid.TrustDomain
+	// ManagedRelationships are the trust domains of the federation
+	// relationships of the SPIRE Server managed by the harvester.
+	ManagedRelationships []spiffeid.TrustDomain
+}
+
+const (
+	defaultBundleWatchMinInterval = time.Second
+	defaultBundleWatchMaxInterval = 30 * time.Second
+
+	// eventsWait is the time the Galadriel Server holds a request for the
+	// events of the federated trust domains when there is none yet.
+	eventsWait = 30 * time.Second
+
+	// streamRetryInterval is the time the events are polled for before
+	// trying to stream them again, when the Galadriel Server did not stream
+	// them.
+	streamRetryInterval = 5 * time.Minute
+)
+
+// ErrStopped is returned by Resync when the controller stopped running.
+var ErrStopped = errors.New("harvester controller stopped")
+
+// Config configures the harvester controller.
+type Config struct {
+	// SyncInterval is the time between two synchronizations of the bundles
+	// of the SPIRE Server with the Galadriel Server. Changes of the bundle of
+	// the SPIRE Server and of the federated bundles are synced as soon as
+	// they are detected, regardless of the interval.
+	SyncInterval time.Duration
+	// BundleWatchMinInterval and BundleWatchMaxInterval bound the time
+	// between two checks of the bundle of the SPIRE Server. It is checked
+	// every BundleWatchMinInterval after a change, and the interval doubles
+	// on every check that finds no change, up to BundleWatchMaxInterval.
+	// They default to 1s and 30s.
+	BundleWatchMinInterval time.Duration
+	BundleWatchMaxInterval time.Duration
+	// SVIDSource provides the X509-SVID the bundle of the SPIRE Server is
+	// signed with before being pushed. The bundle is pushed unsigned if nil.
+	SVIDSource x509svid.Source
+	// AllowUnsignedBundles sets the federated bundles that are not signed in
+	// the SPIRE Server, instead of ignoring them, and trusts the first bundle
+	// of a trust domain on first use.
+	AllowUnsignedBundles bool
+	// AdoptFederationRelationships takes over the federation relationships
+	// of the SPIRE Server configured out of band that match an active
+	// Galadriel relationship: they are then updated and deleted like the
+	// ones created by the harvester. They are left untouched otherwise.
+	AdoptFederationRelationships bool
 }
 
 type LocalHarvesterController struct {
 	logger  common.Logger
 	catalog catalog.Catalog
+	config  Config
+
+	// pushedBundle is the last local bundle pushed to the Galadriel Server.
+	pushedBundle *spiffebundle.Bundle
+	// resignAt is the time the pushed bundle is signed and pushed again,
+	// half way through the lifetime of the X509-SVID it was signed with, so
+	// that the federated harvesters can always verify its signature. It is
+	// zero if the bundle was pushed unsigned.
+	resignAt time.Time
+	// federatedBundles are the last federated bundles set in the SPIRE Server.
+	// It is only kept in memory, so bundles no longer served while the
+	// harvester is not running are not deleted from the SPIRE Server.
+	federatedBundles map[spiffeid.TrustDomain]*spiffebundle.Bundle
+	// managedRelationships are the trust domains of the federation
+	// relationships of the SPIRE Server managed by the harvester. It is only
+	// kept in memory, so relationships removed from the Galadriel Server while
+	// the harvester is not running are not deleted from the SPIRE Server.
+	managedRelationships map[spiffeid.TrustDomain]struct{}
+	// unmanagedRelationships are the trust domains of the active Galadriel
+	// relationships whose federation relationship was configured out of band
+	// in the SPIRE Server, as of the last sync. They are only warned about
+	// once.
+	unmanagedRelationships map[spiffeid.TrustDomain]struct{}
+	// lastEventID is the ID of the last trust bundle event processed.
+	lastEventID int64
+	// pendingDeletions are the trust domains whose federated bundles must be
+	// deleted from the SPIRE Server, following their expiry or because the
+	// Galadriel Server no longer serves them.
+	pendingDeletions map[spiffeid.TrustDomain]struct{}
+
+	// resyncs receives the requests of Resync, answered on the given channel
+	// once the synchronization is done. stopped is closed once the
+	// synchronizations stopped, so that Resync does not wait for them.
+	resyncs chan chan error
+	stopped chan struct{}
+	// changes receives the changes detected by the watchers, that trigger a
+	// synchronization.
+	changes chan struct{}
+
+	mtx    sync.RWMutex
+	status SyncStatus
+	// relationshipCounts are the Galadriel relationships of the trust domain
+	// by status, and bundles the state of the bundle of the SPIRE Server and
+	// of the federated bundles, as of the last synchronization. They are
+	// observed in the metrics.
+	relationshipCounts map[string]int64
+	bundles            []telemetry.BundleState
 }
 
-func NewLocalHarvesterController(catalog catalog.Catalog) HarvesterController {
+func NewLocalHarvesterController(catalog catalog.Catalog, config Config) HarvesterController {
+	if config.BundleWatchMinInterval == 0 {
+		config.BundleWatchMinInterval = defaultBundleWatchMinInterval
+	}
+	if config.BundleWatchMaxInterval == 0 {
+		config.BundleWatchMaxInterval = defaultBundleWatchMaxInterval
+	}
+	if config.BundleWatchMaxInterval < config.BundleWatchMinInterval {
+		config.BundleWatchMaxInterval = config.BundleWatchMinInterval
+	}
+
 	return &LocalHarvesterController{
-		logger:  *common.NewLogger(telemetry.HarvesterController),
-		catalog: catalog,
+		logger:                 *common.NewLogger(telemetry.HarvesterController),
+		catalog:                catalog,
+		config:                 config,
+		managedRelationships:   make(map[spiffeid.TrustDomain]struct{}),
+		unmanagedRelationships: make(map[spiffeid.TrustDomain]struct{}),
+		pendingDeletions:       make(map[spiffeid.TrustDomain]struct{}),
+		resyncs:                make(chan chan error),
+		stopped:                make(chan struct{}),
+		changes:                make(chan struct{}, 1),
 	}
 }
 
 func (c *LocalHarvesterController) Run(ctx context.Context) error {
 	c.logger.Info("Starting harvester controller")
 
+	telemetry.ObserveRelationships(c.observeRelationships)
+	telemetry.ObserveBundles(c.observeBundles)
+
 	go c.run(ctx)
+	go c.watchBundle(ctx)
+	go c.watchEvents(ctx)
 
 	<-ctx.Done()
+	<-c.stopped
 	return nil
 }
 
-func (c *LocalHarvesterController) GetTrustBundle(ctx context.Context, spiffeID string) (string, error) {
-	telemetry.Count(ctx, telemetry.HarvesterController, telemetry.TrustBundle, telemetry.Get)
-	return "", errors.New("not implemented")
+func (c *LocalHarvesterController) SyncStatus() SyncStatus {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.status
 }
 
-func (c *LocalHarvesterController) AddTrustBundle(ctx context.Context, spiffeID string) error {
-	telemetry.Count(ctx, telemetry.HarvesterController, telemetry.TrustBundle, telemetry.Add)
-	return errors.New("not implemented")
+func (c *LocalHarvesterController) Resync(ctx context.Context) (SyncStatus, error) {
+	done := make(chan error, 1)
+	select {
+	case c.resyncs <- done:
+	case <-c.stopped:
+		return SyncStatus{}, ErrStopped
+	case <-ctx.Done():
+		return SyncStatus{}, ctx.Err()
+	}
+
+	select {
+	case <-done:
+	case <-c.stopped:
+		return SyncStatus{}, ErrStopped
+	case <-ctx.Done():
+		return SyncStatus{}, ctx.Err()
+	}
+	telemetry.Count(ctx, telemetry.HarvesterController, telemetry.TrustBundle, telemetry.Resync)
+
+	return c.SyncStatus(), nil
 }
 
 func (c *LocalHarvesterController) run(ctx context.Context) {
-	ticker := time.NewTicker(2 * time.Second)
+	defer close(c.stopped)
 
+	ticker := time.NewTicker(c.config.SyncInterval)
+	defer ticker.Stop()
+
+	// Syncs triggered by Resync run on this goroutine too, so that two syncs
+	// never run at the same time.
+	var done chan error
 	for {
+		// The calls of a synchronization are traced as a whole
+		syncCtx, span := telemetry.StartSpan(ctx, telemetry.HarvesterController+"."+telemetry.Sync)
+		start := time.Now()
+		err := c.sync(syncCtx)
+		telemetry.RecordSyncDuration(ctx, time.Since(start), err)
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			c.logger.Error(err)
+		}
+		c.updateStatus(err)
+		if done != nil {
+			done <- err
+			done = nil
+		}
+
+		// The pushed bundle is signed again before its signature expires,
+		// even if the sync interval is longer
+		var resign <-chan time.Time
+		if !c.resignAt.IsZero() && time.Until(c.resignAt) < c.config.SyncInterval {
+			resign = time.After(time.Until(c.resignAt))
+		}
+
 		select {
 		case <-ticker.C:
-			c.logger.Debug("Doing something")
-			telemetry.Count(ctx, telemetry.HarvesterController, telemetry.TrustBundle, telemetry.Add)
+		case <-resign:
+		case done = <-c.resyncs:
+			ticker.Reset(c.config.SyncInterval)
+		case <-c.changes:
+			ticker.Reset(c.config.SyncInterval)
 		case <-ctx.Done():
 			c.logger.Debug("Done")
 			return
 		}
 	}
 }
+
+// watchBundle checks the bundle of the SPIRE Server for changes, and triggers
+// a synchronization when it changed. The bundle is checked often right after a
+// change, as SPIRE rotates its authorities in several steps, and less and less
+// often while it does not change.
+func (c *LocalHarvesterController) watchBundle(ctx context.Context) {
+	var previous *spiffebundle.Bundle
+	interval := c.config.BundleWatchMinInterval
+	for {
+		bundle, err := c.catalog.Spire.GetBundle(ctx)
+		switch {
+		case err != nil:
+			c.logger.Debug("Failed to get bundle from spire server:", err)
+			interval = c.backoff(interval)
+		case previous != nil && bundleChanged(previous, bundle):
+			c.logger.Debug("Bundle of the spire server changed")
+			c.notifyChange()
+			interval = c.config.BundleWatchMinInterval
+		default:
+			interval = c.backoff(interval)
+		}
+		if bundle != nil {
+			previous = bundle
+		}
+
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// watchEvents waits for the events of the trust domains federated with the
+// SPIRE Server on the Galadriel Server, and triggers a synchronization when
+// one happens, so that a rotated federated bundle is set as soon as its
+// harvester pushed it. The events are streamed, or polled for if the Galadriel
+// Server does not stream them. They are only processed by the synchronization.
+func (c *LocalHarvesterController) watchEvents(ctx context.Context) {
+	// The events that happened before the start are processed by the first
+	// synchronization
+	var td spiffeid.TrustDomain
+	var after int64
+	if !c.retry(ctx, func() error {
+		bundle, err := c.catalog.Spire.GetBundle(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get bundle from spire server: %v", err)
+		}
+		events, err := c.catalog.Server.GetEvents(ctx, bundle.TrustDomain(), 0)
+		if err != nil {
+			return err
+		}
+		td, after = bundle.TrustDomain(), lastEventID(events, 0)
+		return nil
+	}) {
+		return
+	}
+
+	interval := c.config.BundleWatchMinInterval
+	var pollUntil time.Time
+	for {
+		if time.Now().After(pollUntil) {
+			// The stream resumes after the last event received, so that
+			// none is missed while reconnecting
+			received := false
+			err := c.catalog.Server.StreamEvents(ctx, td, after, func(event common.Event) {
+				after = lastEventID([]common.Event{event}, after)
+				received = true
+				c.logger.Debug("Got event", event.Id, "of", event.TrustDomain)
+				c.notifyChange()
+			})
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, server.ErrStreamUnavailable):
+				c.logger.Info("Galadriel Server does not stream events, polling for them")
+				pollUntil = time.Now().Add(streamRetryInterval)
+				continue
+			case errors.Is(err, common.ErrEventsExpired):
+				// Some events were missed, the synchronization catches up
+				c.logger.Debug("Events expired on the Galadriel Server, resuming from the retained ones")
+				after = 0
+				c.notifyChange()
+				continue
+			case received:
+				c.logger.Debug("Event stream interrupted:", err)
+				interval = c.config.BundleWatchMinInterval
+			default:
+				c.logger.Debug("Failed to stream events:", err)
+				interval = c.backoff(interval)
+			}
+
+			if !sleep(ctx, interval) {
+				return
+			}
+			continue
+		}
+
+		events, err := c.catalog.Server.WaitEvents(ctx, td, after, eventsWait)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, common.ErrEventsExpired):
+			c.logger.Debug("Events expired on the Galadriel Server, resuming from the retained ones")
+			after = 0
+			c.notifyChange()
+			continue
+		case err != nil:
+			c.logger.Debug("Failed to wait for events:", err)
+			interval = c.backoff(interval)
+		case len(events) > 0:
+			after = lastEventID(events, after)
+			c.logger.Debug("Got", len(events), "events of the federated trust domains")
+			c.notifyChange()
+			interval = c.config.BundleWatchMinInterval
+			continue
+		default:
+			// The Galadriel Server may answer right away if it does not
+			// hold requests, which must not turn into a busy loop
+			interval = c.config.BundleWatchMinInterval
+		}
+
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// retry calls f until it succeeds, backing off between the attempts, and
+// reports false if the context is done first.
+func (c *LocalHarvesterController) retry(ctx context.Context, f func() error) bool {
+	interval := c.config.BundleWatchMinInterval
+	for {
+		err := f()
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		c.logger.Debug(err)
+
+		if !sleep(ctx, interval) {
+			return false
+		}
+		interval = c.backoff(interval)
+	}
+}
+
+// notifyChange triggers a synchronization, unless one is already pending.
+func (c *LocalHarvesterController) notifyChange() {
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+// backoff returns the interval following the given one while nothing changes.
+func (c *LocalHarvesterController) backoff(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval > c.config.BundleWatchMaxInterval {
+		interval = c.config.BundleWatchMaxInterval
+	}
+
+	return interval
+}
+
+// updateStatus records the result of the last synchronization.
+func (c *LocalHarvesterController) updateStatus(err error) {
+	federated := make([]spiffeid.TrustDomain, 0, len(c.federatedBundles))
+	for td := range c.federatedBundles {
+		federated = append(federated, td)
+	}
+	managed := make([]spiffeid.TrustDomain, 0, len(c.managedRelationships))
+	for td := range c.managedRelationships {
+		managed = append(managed, td)
+	}
+	sortTrustDomains(federated)
+	sortTrustDomains(managed)
+
+	// The harvester does not know when the bundles were updated, so only
+	// their expiry is observed
+	bundles := make([]telemetry.BundleState, 0, len(c.federatedBundles)+1)
+	if c.pushedBundle != nil {
+		bundles = append(bundles, telemetry.NewBundleState(c.pushedBundle, time.Time{}))
+	}
+	for _, bundle := range c.federatedBundles {
+		bundles = append(bundles, telemetry.NewBundleState(bundle, time.Time{}))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.status.LastSync = time.Now()
+	c.status.LastError = err
+	if err == nil {
+		c.status.LastSuccess = c.status.LastSync
+	}
+	c.status.FederatedTrustDomains = federated
+	c.status.ManagedRelationships = managed
+	c.bundles = bundles
+}
+
+func (c *LocalHarvesterController) observeRelationships(context.Context) (map[string]int64, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.relationshipCounts, nil
+}
+
+func (c *LocalHarvesterController) observeBundles(context.Context) ([]telemetry.BundleState, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.bundles, nil
+}
+
+// sync pushes the bundle of the SPIRE Server to the Galadriel Server, sets
+// the bundles of the federated trust domains in the SPIRE Server, and
+// reconciles its federation relationships with the Galadriel Server ones.
+func (c *LocalHarvesterController) sync(ctx context.Context) error {
+	bundle, err := c.catalog.Spire.GetBundle(ctx)
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.TrustBundle, telemetry.Get)
+		return fmt.Errorf("failed to get bundle from spire server: %v", err)
+	}
+
+	// Every step runs even if the previous ones fail, so that a Galadriel
+	// Server rejecting the local bundle does not stop the federation.
+	var errs []string
+	if err := c.pushBundle(ctx, bundle); err != nil {
+		telemetry.CountBundleTransfer(ctx, telemetry.HarvesterController, telemetry.Push, bundle.TrustDomain().String(), err)
+		errs = append(errs, err.Error())
+	}
+
+	if err := c.processEvents(ctx, bundle.TrustDomain()); err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.Event, telemetry.Get)
+		errs = append(errs, err.Error())
+	}
+
+	// Expired bundles are only deleted once the served bundles are known, so
+	// that the bundles renewed since they expired are kept.
+	if err := c.pullFederatedBundles(ctx, bundle.TrustDomain()); err != nil {
+		errs = append(errs, err.Error())
+	} else if err := c.deleteExpiredBundles(ctx); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	// Relationships are synced after the federated bundles are set, so that
+	// SPIRE has the bundle of a trust domain when federating with it.
+	if err := c.syncFederationRelationships(ctx, bundle.TrustDomain()); err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederationRelationship, telemetry.Sync)
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// pushBundle pushes the bundle of the SPIRE Server to the Galadriel Server
+// when its sequence number or contents changed since the last push, or when
+// its signature is about to expire.
+func (c *LocalHarvesterController) pushBundle(ctx context.Context, bundle *spiffebundle.Bundle) error {
+	if c.pushedBundle != nil && c.pushedBundle.Equal(bundle) && (c.resignAt.IsZero() || time.Now().Before(c.resignAt)) {
+		return nil
+	}
+
+	trustBundle, err := common.NewTrustBundle(bundle)
+	if err != nil {
+		return err
+	}
+
+	var resignAt time.Time
+	if c.config.SVIDSource != nil {
+		svid, err := c.config.SVIDSource.GetX509SVID()
+		if err != nil {
+			return fmt.Errorf("failed to get X509-SVID to sign bundle: %v", err)
+		}
+		signature, signingCertificate, err := bundlesig.Sign([]byte(trustBundle.Bundle), svid)
+		if err != nil {
+			return err
+		}
+		trustBundle.Signature = &signature
+		trustBundle.SigningCertificate = &signingCertificate
+
+		leaf := svid.Certificates[0]
+		resignAt = leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2)
+	}
+
+	if err := c.catalog.Server.PushUpdates(ctx, *trustBundle); err != nil {
+		return err
+	}
+
+	c.pushedBundle = bundle.Clone()
+	c.resignAt = resignAt
+	telemetry.CountBundleTransfer(ctx, telemetry.HarvesterController, telemetry.Push, bundle.TrustDomain().String(), nil)
+	c.logger.Info("Pushed bundle of", bundle.TrustDomain(), "to the galadriel server")
+
+	return nil
+}
+
+// pullFederatedBundles gets the bundles of the trust domains federated with
+// the given one from the Galadriel Server, and sets the ones that changed
+// since the last sync in the SPIRE Server.
+func (c *LocalHarvesterController) pullFederatedBundles(ctx context.Context, td spiffeid.TrustDomain) error {
+	trustBundles, err := c.catalog.Server.GetUpdates(ctx, td)
+	telemetry.CountBundleTransfer(ctx, telemetry.HarvesterController, telemetry.Pull, td.String(), err)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[spiffeid.TrustDomain]*spiffebundle.Bundle, len(trustBundles))
+	var changed []*spiffebundle.Bundle
+	for _, trustBundle := range trustBundles {
+		bundle, err := trustBundle.SPIFFEBundle()
+		if err != nil {
+			telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Get)
+			c.logger.Warn("Ignoring federated bundle:", err)
+			continue
+		}
+
+		// The previous bundle of a trust domain whose served bundle can not
+		// be verified, e.g. because its signing X509-SVID expired while its
+		// harvester is down, stays set
+		if err := c.verifyTrustBundle(ctx, trustBundle, bundle); err != nil {
+			telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Verify, telemetry.TrustDomainAttr(bundle.TrustDomain().String()))
+			c.logger.Warn("Ignoring federated bundle:", err)
+			if previous, ok := c.federatedBundles[bundle.TrustDomain()]; ok {
+				current[bundle.TrustDomain()] = previous
+			}
+			continue
+		}
+		bundle = dropExpiredAuthorities(bundle, time.Now())
+
+		current[bundle.TrustDomain()] = bundle
+		delete(c.pendingDeletions, bundle.TrustDomain())
+		if previous, ok := c.federatedBundles[bundle.TrustDomain()]; !ok || !previous.Equal(bundle) {
+			changed = append(changed, bundle)
+		}
+	}
+
+	// The bundles set by the harvester that are no longer served, e.g.
+	// because the relationship ended, are scheduled for deletion. Bundles set
+	// out of band are left alone.
+	for td := range c.federatedBundles {
+		if _, ok := current[td]; !ok {
+			c.pendingDeletions[td] = struct{}{}
+		}
+	}
+
+	if len(changed) == 0 {
+		c.federatedBundles = current
+		return nil
+	}
+
+	results, err := c.catalog.Spire.SetFederatedBundles(ctx, changed)
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Set)
+		return err
+	}
+
+	// Bundles that could not be set are forgotten, so that they are set
+	// again on the next sync
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Set, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+			failed = append(failed, fmt.Sprintf("%s: %v", result.TrustDomain, result.Err))
+			delete(current, result.TrustDomain)
+			continue
+		}
+
+		telemetry.Count(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Set, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+		c.logger.Info("Set federated bundle of", result.TrustDomain, "in the spire server")
+	}
+
+	c.federatedBundles = current
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to set federated bundles: %s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// verifyTrustBundle verifies that a federated bundle was signed by the
+// harvester of its trust domain, with an X509-SVID valid according to the
+// bundle of the trust domain currently set in the SPIRE Server. The first
+// bundle of a trust domain can only be verified once the operator set a
+// bundle of the trust domain in the SPIRE Server out of band. It is otherwise
+// trusted on first use if unsigned bundles are allowed: its signing X509-SVID
+// is verified against the bundle itself. Bundles older than the current one
+// are rejected, so that a replayed bundle does not roll back its authorities.
+func (c *LocalHarvesterController) verifyTrustBundle(ctx context.Context, in common.TrustBundle, bundle *spiffebundle.Bundle) error {
+	td := bundle.TrustDomain()
+	trusted, ok := c.federatedBundles[td]
+	if !ok {
+		var err error
+		trusted, err = c.catalog.Spire.GetFederatedBundle(ctx, td)
+		switch {
+		case errors.Is(err, spire.ErrFederatedBundleNotFound):
+			trusted = nil
+		case err != nil:
+			return fmt.Errorf("failed to get current bundle of %q: %v", td, err)
+		}
+	}
+
+	if trusted != nil {
+		if err := checkNotRolledBack(trusted, bundle); err != nil {
+			return fmt.Errorf("bundle of %q: %v", td, err)
+		}
+	}
+
+	if in.Signature == nil {
+		if c.config.AllowUnsignedBundles {
+			return nil
+		}
+		return fmt.Errorf("bundle of %q is not signed", td)
+	}
+
+	if trusted == nil {
+		if !c.config.AllowUnsignedBundles {
+			return fmt.Errorf("no bundle of %q set in the spire server to verify its first bundle with", td)
+		}
+		trusted = bundle
+	}
+
+	signingCertificate := ""
+	if in.SigningCertificate != nil {
+		signingCertificate = *in.SigningCertificate
+	}
+	if _, err := bundlesig.Verify(td, []byte(in.Bundle), *in.Signature, signingCertificate, trusted); err != nil {
+		return fmt.Errorf("bundle of %q: %v", td, err)
+	}
+
+	return nil
+}
+
+// checkNotRolledBack returns an error if the given bundle has a lower
+// sequence number than the trusted one, unless it has the same authorities.
+// The expired authorities of the bundle are ignored, as they were dropped
+// from the trusted one.
+func checkNotRolledBack(trusted, bundle *spiffebundle.Bundle) error {
+	trustedSequenceNumber, ok := trusted.SequenceNumber()
+	if !ok {
+		return nil
+	}
+	sequenceNumber, _ := bundle.SequenceNumber()
+	if sequenceNumber >= trustedSequenceNumber {
+		return nil
+	}
+
+	current := dropExpiredAuthorities(bundle, time.Now())
+	if current.X509Bundle().Equal(trusted.X509Bundle()) && current.JWTBundle().Equal(trusted.JWTBundle()) {
+		return nil
+	}
+
+	return fmt.Errorf("sequence number %d is lower than the one of the current bundle, %d", sequenceNumber, trustedSequenceNumber)
+}
+
+// processEvents gets the trust bundle events of the trust domains federated
+// with the given one that happened since the last sync. The bundles whose
+// authorities all expired are scheduled for deletion from the SPIRE Server.
+func (c *LocalHarvesterController) processEvents(ctx context.Context, td spiffeid.TrustDomain) error {
+	events, err := c.catalog.Server.GetEvents(ctx, td, c.lastEventID)
+	if errors.Is(err, common.ErrEventsExpired) {
+		// The Galadriel Server deleted some of the events since the last
+		// sync. The retained ones are processed again, and the bundles it
+		// no longer serves are deleted after pulling the federated bundles.
+		c.logger.Warn("Missed events deleted by the Galadriel Server, resyncing from the retained ones")
+		c.lastEventID = 0
+		events, err = c.catalog.Server.GetEvents(ctx, td, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if event.Id > c.lastEventID {
+			c.lastEventID = event.Id
+		}
+
+		trustDomain, err := spiffeid.TrustDomainFromString(event.TrustDomain)
+		if err != nil {
+			c.logger.Warn("Ignoring event", event.Id, "with invalid trust domain:", err)
+			continue
+		}
+
+		switch event.Type {
+		case common.TrustBundleToDelete, common.TrustBundleDeleted:
+			c.pendingDeletions[trustDomain] = struct{}{}
+		case common.TrustBundlePruned:
+			c.logger.Info("Expired authorities pruned from the bundle of", trustDomain)
+		case common.TrustBundleUpdated:
+			// The new bundle is set when pulling the federated bundles
+			c.logger.Debug("Bundle of", trustDomain, "updated")
+		case common.RelationshipUpdated:
+			// The relationships are synchronized from the memberships
+			c.logger.Debug("Relationship with", trustDomain, "updated")
+		default:
+			c.logger.Debug("Ignoring event", event.Id, "of unknown type", event.Type)
+		}
+	}
+
+	return nil
+}
+
+// deleteExpiredBundles deletes the federated bundles scheduled for deletion
+// from the SPIRE Server, whether they expired or are no longer served. Bundles
+// that could not be deleted are retried on the next sync.
+func (c *LocalHarvesterController) deleteExpiredBundles(ctx context.Context) error {
+	if len(c.pendingDeletions) == 0 {
+		return nil
+	}
+
+	tds := make([]spiffeid.TrustDomain, 0, len(c.pendingDeletions))
+	for td := range c.pendingDeletions {
+		tds = append(tds, td)
+	}
+	sortTrustDomains(tds)
+
+	results, err := c.catalog.Spire.DeleteFederatedBundles(ctx, tds)
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Delete)
+		return err
+	}
+
+	var failed []string
+	for _, result := range results {
+		// The bundle may have been deleted already, e.g. by a previous run
+		if result.Err != nil && status.Code(result.Err) != codes.NotFound {
+			telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Delete, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+			failed = append(failed, fmt.Sprintf("%s: %v", result.TrustDomain, result.Err))
+			continue
+		}
+
+		delete(c.pendingDeletions, result.TrustDomain)
+		delete(c.federatedBundles, result.TrustDomain)
+		telemetry.Count(ctx, telemetry.HarvesterController, telemetry.FederatedBundle, telemetry.Delete, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+		c.logger.Info("Deleted federated bundle of", result.TrustDomain, "from the spire server")
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete federated bundles: %s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// syncFederationRelationships creates a federation relationship in the SPIRE
+// Server for every active Galadriel relationship of the given trust domain,
+// updates the ones whose bundle endpoint changed, and deletes the managed ones
+// whose Galadriel relationship is gone or no longer active.
+func (c *LocalHarvesterController) syncFederationRelationships(ctx context.Context, td spiffeid.TrustDomain) error {
+	memberships, err := c.catalog.Server.GetMemberships(ctx, td)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int64)
+	for _, membership := range memberships {
+		if membership.Status != nil {
+			counts[string(*membership.Status)]++
+		}
+	}
+	c.mtx.Lock()
+	c.relationshipCounts = counts
+	c.mtx.Unlock()
+
+	desired := make(map[spiffeid.TrustDomain]*spire.FederationRelationship, len(memberships))
+	for _, membership := range memberships {
+		if membership.Status == nil || *membership.Status != common.FederationRelationshipStatusActive {
+			continue
+		}
+
+		relationship, err := federationRelationshipFromMembership(td, membership)
+		if err != nil {
+			c.logger.Warn("Ignoring federation relationship:", err)
+			continue
+		}
+		desired[relationship.TrustDomain] = relationship
+	}
+
+	existing, err := c.catalog.Spire.ListFederationRelationships(ctx)
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederationRelationship, telemetry.List)
+		return err
+	}
+
+	current := make(map[spiffeid.TrustDomain]*spire.FederationRelationship, len(existing))
+	for _, relationship := range existing {
+		current[relationship.TrustDomain] = relationship
+	}
+
+	var toCreate, toUpdate []*spire.FederationRelationship
+	unmanaged := make(map[spiffeid.TrustDomain]struct{})
+	for trustDomain, relationship := range desired {
+		previous, ok := current[trustDomain]
+		_, managed := c.managedRelationships[trustDomain]
+		switch {
+		case !ok:
+			toCreate = append(toCreate, relationship)
+		case !managed && !c.config.AdoptFederationRelationships:
+			// A relationship configured out of band is left untouched
+			unmanaged[trustDomain] = struct{}{}
+			if _, warned := c.unmanagedRelationships[trustDomain]; !warned {
+				c.logger.Warn("Leaving the federation relationship with", trustDomain, "configured out of band in the spire server untouched")
+			}
+		case !sameBundleEndpoint(previous, relationship):
+			toUpdate = append(toUpdate, relationship)
+		default:
+			c.managedRelationships[trustDomain] = struct{}{}
+		}
+	}
+	c.unmanagedRelationships = unmanaged
+
+	var toDelete []spiffeid.TrustDomain
+	for trustDomain := range c.managedRelationships {
+		if _, ok := desired[trustDomain]; ok {
+			continue
+		}
+		if _, ok := current[trustDomain]; !ok {
+			delete(c.managedRelationships, trustDomain)
+			continue
+		}
+		toDelete = append(toDelete, trustDomain)
+	}
+
+	var errs []string
+	if len(toCreate) > 0 {
+		results, err := c.catalog.Spire.CreateFederationRelationships(ctx, toCreate)
+		errs = append(errs, c.handleRelationshipResults(ctx, telemetry.Create, results, err)...)
+	}
+	if len(toUpdate) > 0 {
+		results, err := c.catalog.Spire.UpdateFederationRelationships(ctx, toUpdate)
+		errs = append(errs, c.handleRelationshipResults(ctx, telemetry.Update, results, err)...)
+	}
+	if len(toDelete) > 0 {
+		results, err := c.catalog.Spire.DeleteFederationRelationships(ctx, toDelete)
+		errs = append(errs, c.handleRelationshipResults(ctx, telemetry.Delete, results, err)...)
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// handleRelationshipResults updates the managed relationships with the
+// results of a batch operation on the federation relationships of the SPIRE
+// Server, and returns the errors of the operation.
+func (c *LocalHarvesterController) handleRelationshipResults(ctx context.Context, action string, results []spire.BatchResult, err error) []string {
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederationRelationship, action)
+		return []string{err.Error()}
+	}
+
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			telemetry.CountError(ctx, telemetry.HarvesterController, telemetry.FederationRelationship, action, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+			failed = append(failed, fmt.Sprintf("%s: %v", result.TrustDomain, result.Err))
+			continue
+		}
+
+		telemetry.Count(ctx, telemetry.HarvesterController, telemetry.FederationRelationship, action, telemetry.TrustDomainAttr(result.TrustDomain.String()))
+		if action == telemetry.Delete {
+			delete(c.managedRelationships, result.TrustDomain)
+			c.logger.Info("Deleted federation relationship with", result.TrustDomain, "from the spire server")
+			continue
+		}
+		c.managedRelationships[result.TrustDomain] = struct{}{}
+		c.logger.Info("Configured federation relationship with", result.TrustDomain, "in the spire server")
+	}
+
+	if len(failed) > 0 {
+		return []string{fmt.Sprintf("failed to %s federation relationships: %s", action, strings.Join(failed, "; "))}
+	}
+
+	return nil
+}
+
+// federationRelationshipFromMembership builds the SPIRE federation
+// relationship of the given trust domain with the other side of a Galadriel
+// relationship, using the bundle endpoint of the other side.
+func federationRelationshipFromMembership(td spiffeid.TrustDomain, in common.FederationRelationship) (*spire.FederationRelationship, error) {
+	peer, endpoint := in.SpireServerFederatedWith, in.SpireServerFederatedWithBundleEndpoint
+	if in.SpireServerFederatedWith == td.String() {
+		peer, endpoint = in.SpireServer, in.SpireServerBundleEndpoint
+	}
+
+	peerTD, err := spiffeid.TrustDomainFromString(peer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust domain %q: %v", peer, err)
+	}
+	if endpoint == nil {
+		return nil, fmt.Errorf("%q has no bundle endpoint", peerTD)
+	}
+
+	out := &spire.FederationRelationship{
+		TrustDomain:       peerTD,
+		BundleEndpointURL: endpoint.Url,
+	}
+
+	switch endpoint.Profile {
+	case common.HttpsWeb:
+		out.BundleEndpointProfile = spire.HTTPSWebProfile
+	case common.HttpsSpiffe:
+		if endpoint.SpiffeId == nil {
+			return nil, fmt.Errorf("bundle endpoint of %q has no spiffe id", peerTD)
+		}
+		endpointSPIFFEID, err := spiffeid.FromString(*endpoint.SpiffeId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle endpoint spiffe id of %q: %v", peerTD, err)
+		}
+		out.BundleEndpointProfile = spire.HTTPSSPIFFEProfile
+		out.EndpointSPIFFEID = endpointSPIFFEID
+	default:
+		return nil, fmt.Errorf("unsupported bundle endpoint profile %q of %q", endpoint.Profile, peerTD)
+	}
+
+	return out, nil
+}
+
+func sameBundleEndpoint(a, b *spire.FederationRelationship) bool {
+	return a.BundleEndpointURL == b.BundleEndpointURL &&
+		a.BundleEndpointProfile == b.BundleEndpointProfile &&
+		a.EndpointSPIFFEID == b.EndpointSPIFFEID
+}
+
+// dropExpiredAuthorities returns the bundle without its expired X.509
+// authorities. The Galadriel Server does not prune signed bundles, as it
+// would invalidate their signature. A bundle whose authorities all expired
+// is returned as is, and deleted once the Galadriel Server reports it.
+func dropExpiredAuthorities(bundle *spiffebundle.Bundle, now time.Time) *spiffebundle.Bundle {
+	authorities := bundle.X509Authorities()
+	var valid []*x509.Certificate
+	for _, authority := range authorities {
+		if now.Before(authority.NotAfter) {
+			valid = append(valid, authority)
+		}
+	}
+
+	if len(valid) == len(authorities) || len(valid) == 0 {
+		return bundle
+	}
+
+	pruned := bundle.Clone()
+	pruned.SetX509Authorities(valid)
+	return pruned
+}
+
+// bundleChanged reports whether a bundle changed, based on its sequence
+// number, or on its contents if it has none.
+func bundleChanged(previous, current *spiffebundle.Bundle) bool {
+	previousSequenceNumber, ok := previous.SequenceNumber()
+	currentSequenceNumber, currentOK := current.SequenceNumber()
+	if ok && currentOK {
+		return previousSequenceNumber != currentSequenceNumber
+	}
+
+	return !previous.Equal(current)
+}
+
+// lastEventID returns the greatest ID of the given events, or after if there
+// are none.
+func lastEventID(events []common.Event, after int64) int64 {
+	for _, event := range events {
+		if event.Id > after {
+			after = event.Id
+		}
+	}
+
+	return after
+}
+
+// sleep waits for the given time, and reports false if the context is done
+// first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sortTrustDomains(tds []spiffeid.TrustDomain) {
+	sort.Slice(tds, func(i, j int) bool {
+		return tds[i].String() < tds[j].String()
+	})
+}
@@ -1 +1,1217 @@
 package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/bundlesig"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/server"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/spire"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	td      = spiffeid.RequireTrustDomainFromString("example.org")
+	otherTD = spiffeid.RequireTrustDomainFromString("other.org")
+)
+
+type fakeSpire struct {
+	// mtx guards the bundle, which is also read by the watchers of the
+	// running controllers.
+	mtx          sync.Mutex
+	bundle       *spiffebundle.Bundle
+	getBundleErr error
+	setErr       error
+	setResultErr map[spiffeid.TrustDomain]error
+	setBundles   [][]*spiffebundle.Bundle
+
+	relationships   map[spiffeid.TrustDomain]*spire.FederationRelationship
+	listErr         error
+	relationshipErr map[spiffeid.TrustDomain]error
+	created         []spiffeid.TrustDomain
+	updated         []spiffeid.TrustDomain
+	deleted         []spiffeid.TrustDomain
+
+	federatedBundles map[spiffeid.TrustDomain]*spiffebundle.Bundle
+	deleteErr        map[spiffeid.TrustDomain]error
+	deletedBundles   []spiffeid.TrustDomain
+}
+
+func (s *fakeSpire) GetBundle(context.Context) (*spiffebundle.Bundle, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.bundle, s.getBundleErr
+}
+
+func (s *fakeSpire) setBundle(bundle *spiffebundle.Bundle, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.bundle, s.getBundleErr = bundle, err
+}
+
+func (s *fakeSpire) GetFederatedBundle(_ context.Context, td spiffeid.TrustDomain) (*spiffebundle.Bundle, error) {
+	bundle, ok := s.federatedBundles[td]
+	if !ok {
+		return nil, spire.ErrFederatedBundleNotFound
+	}
+
+	return bundle, nil
+}
+
+func (s *fakeSpire) ListFederatedBundles(context.Context) ([]*spiffebundle.Bundle, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeSpire) SetFederatedBundles(_ context.Context, bundles []*spiffebundle.Bundle) ([]spire.BatchResult, error) {
+	s.setBundles = append(s.setBundles, bundles)
+	if s.setErr != nil {
+		return nil, s.setErr
+	}
+
+	if s.federatedBundles == nil {
+		s.federatedBundles = make(map[spiffeid.TrustDomain]*spiffebundle.Bundle)
+	}
+
+	var results []spire.BatchResult
+	for _, bundle := range bundles {
+		if s.setResultErr[bundle.TrustDomain()] == nil {
+			s.federatedBundles[bundle.TrustDomain()] = bundle
+		}
+		results = append(results, spire.BatchResult{
+			TrustDomain: bundle.TrustDomain(),
+			Err:         s.setResultErr[bundle.TrustDomain()],
+		})
+	}
+
+	return results, nil
+}
+
+func (s *fakeSpire) DeleteFederatedBundles(_ context.Context, tds []spiffeid.TrustDomain) ([]spire.BatchResult, error) {
+	var results []spire.BatchResult
+	for _, td := range tds {
+		err := s.deleteErr[td]
+		if _, ok := s.federatedBundles[td]; err == nil && !ok {
+			err = status.Error(codes.NotFound, "bundle not found")
+		}
+		if err == nil {
+			s.deletedBundles = append(s.deletedBundles, td)
+			delete(s.federatedBundles, td)
+		}
+		results = append(results, spire.BatchResult{TrustDomain: td, Err: err})
+	}
+
+	return results, nil
+}
+
+func (s *fakeSpire) GetFederationRelationship(context.Context, spiffeid.TrustDomain) (*spire.FederationRelationship, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeSpire) ListFederationRelationships(context.Context) ([]*spire.FederationRelationship, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+
+	var out []*spire.FederationRelationship
+	for _, relationship := range s.relationships {
+		out = append(out, relationship)
+	}
+
+	return out, nil
+}
+
+func (s *fakeSpire) CreateFederationRelationships(_ context.Context, relationships []*spire.FederationRelationship) ([]spire.BatchResult, error) {
+	return s.setRelationships(relationships, &s.created), nil
+}
+
+func (s *fakeSpire) UpdateFederationRelationships(_ context.Context, relationships []*spire.FederationRelationship) ([]spire.BatchResult, error) {
+	return s.setRelationships(relationships, &s.updated), nil
+}
+
+func (s *fakeSpire) DeleteFederationRelationships(_ context.Context, tds []spiffeid.TrustDomain) ([]spire.BatchResult, error) {
+	var results []spire.BatchResult
+	for _, td := range tds {
+		err := s.relationshipErr[td]
+		if err == nil {
+			s.deleted = append(s.deleted, td)
+			delete(s.relationships, td)
+		}
+		results = append(results, spire.BatchResult{TrustDomain: td, Err: err})
+	}
+
+	return results, nil
+}
+
+func (s *fakeSpire) MintX509SVID(context.Context, spiffeid.ID, time.Duration) (*x509svid.SVID, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeSpire) setRelationships(relationships []*spire.FederationRelationship, done *[]spiffeid.TrustDomain) []spire.BatchResult {
+	if s.relationships == nil {
+		s.relationships = make(map[spiffeid.TrustDomain]*spire.FederationRelationship)
+	}
+
+	var results []spire.BatchResult
+	for _, relationship := range relationships {
+		err := s.relationshipErr[relationship.TrustDomain]
+		if err == nil {
+			*done = append(*done, relationship.TrustDomain)
+			s.relationships[relationship.TrustDomain] = relationship
+		}
+		results = append(results, spire.BatchResult{TrustDomain: relationship.TrustDomain, Err: err})
+	}
+
+	return results
+}
+
+type fakeServer struct {
+	pushed     []common.TrustBundle
+	pushErr    error
+	updates    []common.TrustBundle
+	updatesErr error
+
+	memberships    []common.FederationRelationship
+	membershipsErr error
+
+	// mtx guards the events, which are also read by the watchers of the
+	// running controllers. eventsAdded is closed when an event is added.
+	mtx         sync.Mutex
+	events      []common.Event
+	eventsErr   error
+	eventsAdded chan struct{}
+	// firstEventID is the ID of the oldest event retained, the events
+	// after an earlier one have expired.
+	firstEventID int64
+
+	// streamUnavailable makes StreamEvents fail as if the Galadriel Server
+	// did not stream events. streams counts the calls to StreamEvents.
+	streamUnavailable bool
+	streams           int
+}
+
+func (s *fakeServer) GetUpdates(context.Context, spiffeid.TrustDomain) ([]common.TrustBundle, error) {
+	return s.updates, s.updatesErr
+}
+
+func (s *fakeServer) PushUpdates(_ context.Context, bundle common.TrustBundle) error {
+	s.pushed = append(s.pushed, bundle)
+	return s.pushErr
+}
+
+func (s *fakeServer) GetMemberships(context.Context, spiffeid.TrustDomain) ([]common.FederationRelationship, error) {
+	return s.memberships, s.membershipsErr
+}
+
+func (s *fakeServer) GetEvents(_ context.Context, _ spiffeid.TrustDomain, after int64) ([]common.Event, error) {
+	events, _, err := s.eventsAfter(after)
+	return events, err
+}
+
+func (s *fakeServer) WaitEvents(ctx context.Context, _ spiffeid.TrustDomain, after int64, wait time.Duration) ([]common.Event, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		events, added, err := s.eventsAfter(after)
+		if len(events) > 0 || err != nil {
+			return events, err
+		}
+
+		select {
+		case <-added:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *fakeServer) StreamEvents(ctx context.Context, _ spiffeid.TrustDomain, after int64, handle func(common.Event)) error {
+	s.mtx.Lock()
+	s.streams++
+	unavailable := s.streamUnavailable
+	s.mtx.Unlock()
+	if unavailable {
+		return server.ErrStreamUnavailable
+	}
+
+	for {
+		events, added, err := s.eventsAfter(after)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			handle(event)
+			after = event.Id
+		}
+
+		select {
+		case <-added:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *fakeServer) streamCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.streams
+}
+
+func (s *fakeServer) eventsAfter(after int64) ([]common.Event, <-chan struct{}, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.eventsAdded == nil {
+		s.eventsAdded = make(chan struct{})
+	}
+
+	if after != 0 && after+1 < s.firstEventID {
+		return nil, s.eventsAdded, common.ErrEventsExpired
+	}
+
+	var out []common.Event
+	for _, event := range s.events {
+		if event.Id > after {
+			out = append(out, event)
+		}
+	}
+
+	return out, s.eventsAdded, s.eventsErr
+}
+
+func (s *fakeServer) addEvent(event common.Event) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.events = append(s.events, event)
+	if s.eventsAdded != nil {
+		close(s.eventsAdded)
+		s.eventsAdded = nil
+	}
+}
+
+func (s *fakeServer) GetRelationship(context.Context, spiffeid.TrustDomain, int64) (*common.FederationRelationship, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeServer) SetRelationshipConsent(context.Context, spiffeid.TrustDomain, int64, string) error {
+	return errors.New("not implemented")
+}
+
+func (s *fakeServer) Onboard(context.Context, string) (*common.OnboardResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func newBundle(t *testing.T, td spiffeid.TrustDomain, sequenceNumber uint64) *spiffebundle.Bundle {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	bundle := spiffebundle.FromX509Authorities(td, []*x509.Certificate{cert})
+	bundle.SetSequenceNumber(sequenceNumber)
+	return bundle
+}
+
+func trustBundle(t *testing.T, bundle *spiffebundle.Bundle) common.TrustBundle {
+	trustBundle, err := common.NewTrustBundle(bundle)
+	require.NoError(t, err)
+
+	return *trustBundle
+}
+
+// newTestController returns a controller accepting unsigned bundles, like
+// the ones built by trustBundle.
+func newTestController(spireServer *fakeSpire, server *fakeServer) *LocalHarvesterController {
+	return NewLocalHarvesterController(catalog.Catalog{Spire: spireServer, Server: server}, Config{AllowUnsignedBundles: true}).(*LocalHarvesterController)
+}
+
+func TestSyncPushesChangedBundle(t *testing.T) {
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{}
+	c := newTestController(spire, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, server.pushed, 1)
+	assert.Equal(t, trustBundle(t, spire.bundle), server.pushed[0])
+
+	// The bundle did not change
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, server.pushed, 1)
+
+	spire.bundle = newBundle(t, td, 2)
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, server.pushed, 2)
+	assert.Equal(t, trustBundle(t, spire.bundle), server.pushed[1])
+}
+
+func TestSyncSetsChangedFederatedBundles(t *testing.T) {
+	federated := newBundle(t, otherTD, 1)
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{updates: []common.TrustBundle{trustBundle(t, federated)}}
+	c := newTestController(spire, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 1)
+	require.Len(t, spire.setBundles[0], 1)
+	assert.True(t, federated.Equal(spire.setBundles[0][0]))
+
+	// The federated bundle did not change
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 1)
+
+	federated = newBundle(t, otherTD, 2)
+	server.updates = []common.TrustBundle{trustBundle(t, federated)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 2)
+	assert.True(t, federated.Equal(spire.setBundles[1][0]))
+}
+
+func TestSyncErrors(t *testing.T) {
+	invalidTD := "not a trust domain"
+
+	tests := []struct {
+		name       string
+		spire      *fakeSpire
+		server     *fakeServer
+		err        string
+		pushed     int
+		setBundles int
+	}{
+		{
+			name:  "get_bundle_error",
+			spire: &fakeSpire{getBundleErr: errors.New("spire is down")},
+			err:   "failed to get bundle from spire server: spire is down",
+		},
+		{
+			name:       "push_error_still_pulls",
+			spire:      &fakeSpire{bundle: newBundle(t, td, 1)},
+			server:     &fakeServer{pushErr: errors.New("push failed"), updates: []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))}},
+			err:        "push failed",
+			pushed:     1,
+			setBundles: 1,
+		},
+		{
+			name:   "push_and_pull_errors",
+			spire:  &fakeSpire{bundle: newBundle(t, td, 1)},
+			server: &fakeServer{pushErr: errors.New("push failed"), updatesErr: errors.New("pull failed")},
+			err:    "push failed; pull failed",
+			pushed: 1,
+		},
+		{
+			name:       "set_error",
+			spire:      &fakeSpire{bundle: newBundle(t, td, 1), setErr: errors.New("set failed")},
+			server:     &fakeServer{updates: []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))}},
+			err:        "set failed",
+			pushed:     1,
+			setBundles: 1,
+		},
+		{
+			name:  "invalid_federated_bundles_are_ignored",
+			spire: &fakeSpire{bundle: newBundle(t, td, 1)},
+			server: &fakeServer{updates: []common.TrustBundle{
+				{Bundle: "no trust domain"},
+				{TrustDomain: &invalidTD, Bundle: "{}"},
+				{TrustDomain: func() *string { s := otherTD.String(); return &s }(), Bundle: "not a bundle"},
+			}},
+			pushed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.server == nil {
+				tt.server = &fakeServer{}
+			}
+			c := newTestController(tt.spire, tt.server)
+
+			err := c.sync(context.Background())
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, tt.server.pushed, tt.pushed)
+			assert.Len(t, tt.spire.setBundles, tt.setBundles)
+		})
+	}
+}
+
+func TestSyncRetriesFailedSet(t *testing.T) {
+	spire := &fakeSpire{bundle: newBundle(t, td, 1), setErr: errors.New("set failed")}
+	server := &fakeServer{updates: []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))}}
+	c := newTestController(spire, server)
+
+	assert.Error(t, c.sync(context.Background()))
+
+	spire.setErr = nil
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 2)
+}
+
+func TestSyncRetriesFailedItems(t *testing.T) {
+	thirdTD := spiffeid.RequireTrustDomainFromString("third.org")
+	spire := &fakeSpire{
+		bundle:       newBundle(t, td, 1),
+		setResultErr: map[spiffeid.TrustDomain]error{thirdTD: errors.New("invalid bundle")},
+	}
+	server := &fakeServer{updates: []common.TrustBundle{
+		trustBundle(t, newBundle(t, otherTD, 1)),
+		trustBundle(t, newBundle(t, thirdTD, 1)),
+	}}
+	c := newTestController(spire, server)
+
+	assert.EqualError(t, c.sync(context.Background()), "failed to set federated bundles: third.org: invalid bundle")
+
+	// Only the bundle that failed is set again
+	spire.setResultErr = nil
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 2)
+	require.Len(t, spire.setBundles[1], 1)
+	assert.Equal(t, thirdTD, spire.setBundles[1][0].TrustDomain())
+}
+
+func membership(spireServer, federatedWith string, endpoint *common.BundleEndpoint, status common.FederationRelationshipStatus) common.FederationRelationship {
+	return common.FederationRelationship{
+		SpireServer:                            spireServer,
+		SpireServerFederatedWith:               federatedWith,
+		SpireServerBundleEndpoint:              endpoint,
+		SpireServerFederatedWithBundleEndpoint: endpoint,
+		Status:                                 &status,
+	}
+}
+
+func TestSyncFederationRelationships(t *testing.T) {
+	thirdTD := spiffeid.RequireTrustDomainFromString("third.org")
+	spiffeID := "spiffe://third.org/spire/server"
+	webEndpoint := &common.BundleEndpoint{Url: "https://other.org/bundle", Profile: common.HttpsWeb}
+	spiffeEndpoint := &common.BundleEndpoint{Url: "https://third.org:8443", Profile: common.HttpsSpiffe, SpiffeId: &spiffeID}
+
+	spireServer := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{memberships: []common.FederationRelationship{
+		membership(td.String(), otherTD.String(), webEndpoint, common.FederationRelationshipStatusActive),
+		// The harvester trust domain is on the federated with side
+		membership(thirdTD.String(), td.String(), spiffeEndpoint, common.FederationRelationshipStatusActive),
+		membership(td.String(), "pending.org", webEndpoint, common.FederationRelationshipStatusInvited),
+		membership(td.String(), "no-endpoint.org", nil, common.FederationRelationshipStatusActive),
+	}}
+	c := newTestController(spireServer, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.ElementsMatch(t, []spiffeid.TrustDomain{otherTD, thirdTD}, spireServer.created)
+	assert.Equal(t, &spire.FederationRelationship{
+		TrustDomain:           otherTD,
+		BundleEndpointURL:     "https://other.org/bundle",
+		BundleEndpointProfile: spire.HTTPSWebProfile,
+	}, spireServer.relationships[otherTD])
+	assert.Equal(t, &spire.FederationRelationship{
+		TrustDomain:           thirdTD,
+		BundleEndpointURL:     "https://third.org:8443",
+		BundleEndpointProfile: spire.HTTPSSPIFFEProfile,
+		EndpointSPIFFEID:      spiffeid.RequireFromString(spiffeID),
+	}, spireServer.relationships[thirdTD])
+
+	// Nothing changed
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spireServer.created, 2)
+	assert.Empty(t, spireServer.updated)
+
+	// The bundle endpoint of other.org changed and the relationship with
+	// third.org was removed
+	server.memberships = []common.FederationRelationship{
+		membership(td.String(), otherTD.String(), &common.BundleEndpoint{Url: "https://other.org/new", Profile: common.HttpsWeb}, common.FederationRelationshipStatusActive),
+	}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spireServer.updated)
+	assert.Equal(t, "https://other.org/new", spireServer.relationships[otherTD].BundleEndpointURL)
+	assert.Equal(t, []spiffeid.TrustDomain{thirdTD}, spireServer.deleted)
+	assert.NotContains(t, spireServer.relationships, thirdTD)
+}
+
+func TestSyncFederationRelationshipsKeepsUnmanaged(t *testing.T) {
+	endpoint := &common.BundleEndpoint{Url: "https://other.org/new", Profile: common.HttpsWeb}
+	active := []common.FederationRelationship{
+		membership(td.String(), otherTD.String(), endpoint, common.FederationRelationshipStatusActive),
+	}
+
+	for _, adopt := range []bool{false, true} {
+		adopt := adopt
+		t.Run(fmt.Sprintf("adopt_%t", adopt), func(t *testing.T) {
+			unmanaged := &spire.FederationRelationship{
+				TrustDomain:           otherTD,
+				BundleEndpointURL:     "https://other.org/bundle",
+				BundleEndpointProfile: spire.HTTPSWebProfile,
+			}
+			spireServer := &fakeSpire{
+				bundle:        newBundle(t, td, 1),
+				relationships: map[spiffeid.TrustDomain]*spire.FederationRelationship{otherTD: unmanaged},
+			}
+			server := &fakeServer{memberships: active}
+			c := NewLocalHarvesterController(catalog.Catalog{Spire: spireServer, Server: server}, Config{
+				AllowUnsignedBundles:         true,
+				AdoptFederationRelationships: adopt,
+			}).(*LocalHarvesterController)
+
+			// The relationship configured out of band matches an active
+			// Galadriel relationship with another bundle endpoint
+			require.NoError(t, c.sync(context.Background()))
+			assert.Empty(t, spireServer.created)
+
+			server.memberships = nil
+			require.NoError(t, c.sync(context.Background()))
+
+			if adopt {
+				assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spireServer.updated)
+				assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spireServer.deleted)
+				assert.NotContains(t, spireServer.relationships, otherTD)
+			} else {
+				assert.Empty(t, spireServer.updated)
+				assert.Empty(t, spireServer.deleted)
+				assert.Equal(t, unmanaged, spireServer.relationships[otherTD])
+			}
+		})
+	}
+}
+
+func TestSyncFederationRelationshipsErrors(t *testing.T) {
+	endpoint := &common.BundleEndpoint{Url: "https://other.org/bundle", Profile: common.HttpsWeb}
+	active := []common.FederationRelationship{
+		membership(td.String(), otherTD.String(), endpoint, common.FederationRelationshipStatusActive),
+	}
+
+	tests := []struct {
+		name        string
+		spireServer *fakeSpire
+		server      *fakeServer
+		err         string
+	}{
+		{
+			name:        "memberships_error",
+			spireServer: &fakeSpire{bundle: newBundle(t, td, 1)},
+			server:      &fakeServer{membershipsErr: errors.New("memberships failed")},
+			err:         "memberships failed",
+		},
+		{
+			name:        "list_error",
+			spireServer: &fakeSpire{bundle: newBundle(t, td, 1), listErr: errors.New("list failed")},
+			server:      &fakeServer{memberships: active},
+			err:         "list failed",
+		},
+		{
+			name: "create_error",
+			spireServer: &fakeSpire{
+				bundle:          newBundle(t, td, 1),
+				relationshipErr: map[spiffeid.TrustDomain]error{otherTD: errors.New("bad relationship")},
+			},
+			server: &fakeServer{memberships: active},
+			err:    "failed to create federation relationships: other.org: bad relationship",
+		},
+		{
+			name:        "pull_and_relationships_errors",
+			spireServer: &fakeSpire{bundle: newBundle(t, td, 1)},
+			server:      &fakeServer{updatesErr: errors.New("pull failed"), membershipsErr: errors.New("memberships failed")},
+			err:         "pull failed; memberships failed",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(tt.spireServer, tt.server)
+			assert.EqualError(t, c.sync(context.Background()), tt.err)
+		})
+	}
+}
+
+func TestResync(t *testing.T) {
+	federated := newBundle(t, otherTD, 1)
+	spireServer := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{updates: []common.TrustBundle{trustBundle(t, federated)}}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spireServer, Server: server}, Config{SyncInterval: time.Hour, AllowUnsignedBundles: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		_ = c.Run(ctx)
+		close(stopped)
+	}()
+
+	// The first sync runs on start, the sync interval is not over
+	status, err := c.Resync(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, status.LastError)
+	assert.Equal(t, status.LastSync, status.LastSuccess)
+	assert.Equal(t, []spiffeid.TrustDomain{otherTD}, status.FederatedTrustDomains)
+	assert.Empty(t, status.ManagedRelationships)
+
+	spireServer.setBundle(newBundle(t, td, 1), errors.New("spire is down"))
+	status, err = c.Resync(ctx)
+	require.NoError(t, err)
+	assert.EqualError(t, status.LastError, "failed to get bundle from spire server: spire is down")
+	assert.True(t, status.LastSync.After(status.LastSuccess))
+	assert.Equal(t, status, c.SyncStatus())
+
+	resyncCtx, cancelResync := context.WithCancel(context.Background())
+	cancelResync()
+	_, err = c.Resync(resyncCtx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Resync does not wait for a stopped controller
+	cancel()
+	<-stopped
+	_, err = c.Resync(context.Background())
+	assert.ErrorIs(t, err, ErrStopped)
+}
+
+func TestObserveMetrics(t *testing.T) {
+	federated := newBundle(t, otherTD, 1)
+	endpoint := &common.BundleEndpoint{Url: "https://other.org/bundle", Profile: common.HttpsWeb}
+	spireServer := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{
+		updates: []common.TrustBundle{trustBundle(t, federated)},
+		memberships: []common.FederationRelationship{
+			membership(td.String(), otherTD.String(), endpoint, common.FederationRelationshipStatusActive),
+			membership(td.String(), "pending.org", endpoint, common.FederationRelationshipStatusInvited),
+			membership(td.String(), "other-pending.org", endpoint, common.FederationRelationshipStatusInvited),
+		},
+	}
+	c := newTestController(spireServer, server)
+
+	err := c.sync(context.Background())
+	require.NoError(t, err)
+	c.updateStatus(err)
+
+	counts, err := c.observeRelationships(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		string(common.FederationRelationshipStatusActive):  1,
+		string(common.FederationRelationshipStatusInvited): 2,
+	}, counts)
+
+	bundles, err := c.observeBundles(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []telemetry.BundleState{
+		telemetry.NewBundleState(spireServer.bundle, time.Time{}),
+		telemetry.NewBundleState(federated, time.Time{}),
+	}, bundles)
+}
+
+func TestSyncDeletesExpiredBundles(t *testing.T) {
+	thirdTD := spiffeid.RequireTrustDomainFromString("third.org")
+	federated := newBundle(t, otherTD, 1)
+	third := newBundle(t, thirdTD, 1)
+
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{updates: []common.TrustBundle{trustBundle(t, federated), trustBundle(t, third)}}
+	c := newTestController(spire, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.Empty(t, spire.deletedBundles)
+
+	// The bundle of other.org expired, and is no longer served
+	server.events = []common.Event{
+		{Id: 1, TrustDomain: "third.org", Type: common.TrustBundlePruned},
+		{Id: 2, TrustDomain: "other.org", Type: common.TrustBundleToDelete},
+	}
+	server.updates = []common.TrustBundle{trustBundle(t, third)}
+	spire.deleteErr = map[spiffeid.TrustDomain]error{otherTD: errors.New("entries federate with other.org")}
+
+	assert.EqualError(t, c.sync(context.Background()), "failed to delete federated bundles: other.org: entries federate with other.org")
+	assert.Empty(t, spire.deletedBundles)
+	assert.Equal(t, int64(2), c.lastEventID)
+
+	// Failed deletions are retried
+	spire.deleteErr = nil
+	require.NoError(t, c.sync(context.Background()))
+	assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spire.deletedBundles)
+	assert.NotContains(t, c.federatedBundles, otherTD)
+	assert.Contains(t, c.federatedBundles, thirdTD)
+
+	// Deleting a bundle that is already gone succeeds
+	server.events = append(server.events, common.Event{Id: 3, TrustDomain: "other.org", Type: common.TrustBundleDeleted})
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.deletedBundles, 1)
+	assert.Empty(t, c.pendingDeletions)
+
+	// A bundle renewed since it expired is kept
+	server.events = append(server.events, common.Event{Id: 4, TrustDomain: "third.org", Type: common.TrustBundleToDelete})
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.deletedBundles, 1)
+	assert.Empty(t, c.pendingDeletions)
+}
+
+func TestSyncDeletesBundlesNoLongerServed(t *testing.T) {
+	otherTD := spiffeid.RequireTrustDomainFromString("other.org")
+	manualTD := spiffeid.RequireTrustDomainFromString("manual.org")
+
+	// The bundle of manual.org was set out of band
+	spire := &fakeSpire{
+		bundle:           newBundle(t, td, 1),
+		federatedBundles: map[spiffeid.TrustDomain]*spiffebundle.Bundle{manualTD: newBundle(t, manualTD, 1)},
+	}
+	server := &fakeServer{updates: []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))}}
+	c := newTestController(spire, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.Contains(t, spire.federatedBundles, otherTD)
+
+	// The relationship with other.org ended, its bundle is no longer served
+	server.updates = nil
+	spire.deleteErr = map[spiffeid.TrustDomain]error{otherTD: errors.New("entries federate with other.org")}
+	assert.EqualError(t, c.sync(context.Background()), "failed to delete federated bundles: other.org: entries federate with other.org")
+
+	// Failed deletions are retried
+	spire.deleteErr = nil
+	require.NoError(t, c.sync(context.Background()))
+	assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spire.deletedBundles)
+	assert.Contains(t, spire.federatedBundles, manualTD)
+	assert.Empty(t, c.federatedBundles)
+	assert.Empty(t, c.pendingDeletions)
+}
+
+func TestSyncResyncsExpiredEvents(t *testing.T) {
+	otherTD := spiffeid.RequireTrustDomainFromString("other.org")
+
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{
+		updates: []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))},
+		events:  []common.Event{{Id: 1, TrustDomain: "other.org", Type: common.TrustBundlePruned}},
+	}
+	c := newTestController(spire, server)
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.Equal(t, int64(1), c.lastEventID)
+
+	// The events 2 to 4 were deleted before the next sync, the retained
+	// ones are processed
+	server.updates = nil
+	server.events = []common.Event{{Id: 5, TrustDomain: "other.org", Type: common.TrustBundleToDelete}}
+	server.firstEventID = 5
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.Equal(t, int64(5), c.lastEventID)
+	assert.Equal(t, []spiffeid.TrustDomain{otherTD}, spire.deletedBundles)
+}
+
+type testCA struct {
+	td   spiffeid.TrustDomain
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, td spiffeid.TrustDomain) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{td: td, cert: cert, key: key}
+}
+
+func (ca *testCA) mintSVID(t *testing.T) *x509svid.SVID {
+	return ca.mintSVIDValidity(t, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+}
+
+// mintSVIDValidity returns an X509-SVID valid between the given times.
+func (ca *testCA) mintSVIDValidity(t *testing.T, notBefore, notAfter time.Time) *x509svid.SVID {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	id := spiffeid.RequireFromPath(ca.td, "/galadriel/harvester")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		URIs:         []*url.URL{id.URL()},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &x509svid.SVID{ID: id, Certificates: []*x509.Certificate{cert}, PrivateKey: key}
+}
+
+// signedTrustBundle returns the bundle of the given authorities, signed by an
+// X509-SVID of the given CA.
+func signedTrustBundle(t *testing.T, ca *testCA, authorities ...*x509.Certificate) common.TrustBundle {
+	return signedTrustBundleWith(t, ca.mintSVID(t), authorities...)
+}
+
+// signedTrustBundleWith returns the bundle of the given authorities, signed
+// by the given X509-SVID.
+func signedTrustBundleWith(t *testing.T, svid *x509svid.SVID, authorities ...*x509.Certificate) common.TrustBundle {
+	return signTrustBundle(t, svid, spiffebundle.FromX509Authorities(svid.ID.TrustDomain(), authorities))
+}
+
+// signTrustBundle returns the given bundle, signed by the given X509-SVID.
+func signTrustBundle(t *testing.T, svid *x509svid.SVID, bundle *spiffebundle.Bundle) common.TrustBundle {
+	trustBundle := trustBundle(t, bundle)
+	signature, signingCertificate, err := bundlesig.Sign([]byte(trustBundle.Bundle), svid)
+	require.NoError(t, err)
+	trustBundle.Signature = &signature
+	trustBundle.SigningCertificate = &signingCertificate
+
+	return trustBundle
+}
+
+type fakeSVIDSource struct {
+	svid *x509svid.SVID
+}
+
+func (s fakeSVIDSource) GetX509SVID() (*x509svid.SVID, error) {
+	return s.svid, nil
+}
+
+func TestSyncSignsPushedBundle(t *testing.T) {
+	ca := newTestCA(t, td)
+	spire := &fakeSpire{bundle: spiffebundle.FromX509Authorities(td, []*x509.Certificate{ca.cert})}
+	server := &fakeServer{}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{
+		SVIDSource: fakeSVIDSource{svid: ca.mintSVID(t)},
+	}).(*LocalHarvesterController)
+
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, server.pushed, 1)
+
+	pushed := server.pushed[0]
+	require.NotNil(t, pushed.Signature)
+	require.NotNil(t, pushed.SigningCertificate)
+	id, err := bundlesig.Verify(td, []byte(pushed.Bundle), *pushed.Signature, *pushed.SigningCertificate, spire.bundle)
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://example.org/galadriel/harvester", id.String())
+}
+
+func TestSyncResignsPushedBundle(t *testing.T) {
+	ca := newTestCA(t, td)
+	spire := &fakeSpire{bundle: spiffebundle.FromX509Authorities(td, []*x509.Certificate{ca.cert})}
+	server := &fakeServer{}
+	source := &fakeSVIDSource{svid: ca.mintSVIDValidity(t, time.Now().Add(-50*time.Minute), time.Now().Add(10*time.Minute))}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{SVIDSource: source}).(*LocalHarvesterController)
+
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, server.pushed, 1)
+
+	// The unchanged bundle is signed and pushed again once half of the
+	// lifetime of its signing X509-SVID passed
+	source.svid = ca.mintSVID(t)
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, server.pushed, 2)
+	id, err := bundlesig.Verify(td, []byte(server.pushed[1].Bundle), *server.pushed[1].Signature, *server.pushed[1].SigningCertificate, spire.bundle)
+	require.NoError(t, err)
+	assert.Equal(t, source.svid.ID, id)
+
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, server.pushed, 2)
+}
+
+func TestSyncIgnoresExpiredSignature(t *testing.T) {
+	ca := newTestCA(t, otherTD)
+	spire := &fakeSpire{
+		bundle:           newBundle(t, td, 1),
+		federatedBundles: map[spiffeid.TrustDomain]*spiffebundle.Bundle{otherTD: spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{ca.cert})},
+	}
+	server := &fakeServer{}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{}).(*LocalHarvesterController)
+
+	next := newTestCA(t, otherTD)
+	server.updates = []common.TrustBundle{signedTrustBundle(t, ca, ca.cert, next.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 1)
+
+	// The bundle signed by an expired X509-SVID is ignored, and the previous
+	// one stays set
+	expired := ca.mintSVIDValidity(t, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	server.updates = []common.TrustBundle{signedTrustBundleWith(t, expired, next.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 1)
+	assert.Empty(t, spire.deletedBundles)
+	assert.Equal(t, []*x509.Certificate{ca.cert, next.cert}, c.federatedBundles[otherTD].X509Authorities())
+}
+
+func TestSyncVerifiesFederatedBundles(t *testing.T) {
+	ca := newTestCA(t, otherTD)
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{}).(*LocalHarvesterController)
+
+	// Unsigned bundles are ignored
+	server.updates = []common.TrustBundle{trustBundle(t, newBundle(t, otherTD, 1))}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Empty(t, spire.setBundles)
+
+	// The first signed bundle of a trust domain is ignored until the
+	// operator sets a bundle of the trust domain in the SPIRE Server, as it
+	// could have been forged by the Galadriel Server
+	forger := newTestCA(t, otherTD)
+	server.updates = []common.TrustBundle{signedTrustBundle(t, forger, forger.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Empty(t, spire.setBundles)
+
+	spire.federatedBundles = map[spiffeid.TrustDomain]*spiffebundle.Bundle{otherTD: spiffebundle.New(otherTD)}
+	spire.federatedBundles[otherTD].AddX509Authority(ca.cert)
+	server.updates = []common.TrustBundle{signedTrustBundle(t, ca, ca.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 1)
+
+	// A bundle signed by an authority that is not trusted yet is ignored,
+	// even if the bundle itself includes the authority. The previous bundle
+	// stays set.
+	server.updates = []common.TrustBundle{signedTrustBundle(t, forger, forger.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 1)
+	assert.Empty(t, spire.deletedBundles)
+
+	// Rotated bundles are signed by an authority of the current bundle
+	next := newTestCA(t, otherTD)
+	server.updates = []common.TrustBundle{signedTrustBundle(t, ca, ca.cert, next.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 2)
+	assert.Equal(t, []*x509.Certificate{ca.cert, next.cert}, spire.setBundles[1][0].X509Authorities())
+
+	// After a restart, the current bundle is read from the SPIRE Server
+	c = NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{}).(*LocalHarvesterController)
+	server.updates = []common.TrustBundle{signedTrustBundle(t, forger, forger.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 2)
+
+	server.updates = []common.TrustBundle{signedTrustBundle(t, next, next.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 3)
+	assert.Equal(t, []*x509.Certificate{next.cert}, spire.setBundles[2][0].X509Authorities())
+}
+
+func TestSyncRejectsReplayedBundles(t *testing.T) {
+	ca := newTestCA(t, otherTD)
+	spire := &fakeSpire{
+		bundle:           newBundle(t, td, 1),
+		federatedBundles: map[spiffeid.TrustDomain]*spiffebundle.Bundle{otherTD: spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{ca.cert})},
+	}
+	server := &fakeServer{}
+	c := NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{}).(*LocalHarvesterController)
+
+	old := spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{ca.cert})
+	old.SetSequenceNumber(1)
+	replayed := signTrustBundle(t, ca.mintSVID(t), old)
+
+	next := newTestCA(t, otherTD)
+	rotated := spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{ca.cert, next.cert})
+	rotated.SetSequenceNumber(2)
+	server.updates = []common.TrustBundle{signTrustBundle(t, ca.mintSVID(t), rotated)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 1)
+
+	// The older bundle is validly signed, but would roll back the rotation
+	server.updates = []common.TrustBundle{replayed}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 1)
+	assert.Empty(t, spire.deletedBundles)
+	assert.True(t, rotated.Equal(c.federatedBundles[otherTD]))
+
+	// After a restart, the current bundle is read from the SPIRE Server
+	spire.federatedBundles[otherTD] = rotated
+	c = NewLocalHarvesterController(catalog.Catalog{Spire: spire, Server: server}, Config{}).(*LocalHarvesterController)
+	require.NoError(t, c.sync(context.Background()))
+	assert.Len(t, spire.setBundles, 1)
+}
+
+func TestSyncTrustsFirstBundleOnFirstUse(t *testing.T) {
+	ca := newTestCA(t, otherTD)
+	spire := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{}
+	c := newTestController(spire, server)
+
+	// The first bundle of a trust domain is only verified against itself
+	// when unsigned bundles are allowed
+	server.updates = []common.TrustBundle{signedTrustBundle(t, newTestCA(t, otherTD), ca.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	assert.Empty(t, spire.setBundles)
+
+	server.updates = []common.TrustBundle{signedTrustBundle(t, ca, ca.cert)}
+	require.NoError(t, c.sync(context.Background()))
+	require.Len(t, spire.setBundles, 1)
+}
+
+func TestDropExpiredAuthorities(t *testing.T) {
+	expired := newBundle(t, otherTD, 1).X509Authorities()[0]
+	valid := newBundle(t, otherTD, 1).X509Authorities()[0]
+	now := expired.NotAfter.Add(time.Second)
+	valid.NotAfter = now.Add(time.Hour)
+
+	bundle := spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{expired, valid})
+	assert.Equal(t, []*x509.Certificate{valid}, dropExpiredAuthorities(bundle, now).X509Authorities())
+	assert.Len(t, bundle.X509Authorities(), 2)
+
+	// Bundles whose authorities all expired are kept as is
+	bundle = spiffebundle.FromX509Authorities(otherTD, []*x509.Certificate{expired})
+	assert.Equal(t, bundle, dropExpiredAuthorities(bundle, now))
+}
+
+func TestBundleChanged(t *testing.T) {
+	bundle := newBundle(t, td, 1)
+	withoutSequenceNumber := bundle.Clone()
+	withoutSequenceNumber.ClearSequenceNumber()
+
+	tests := []struct {
+		name     string
+		previous *spiffebundle.Bundle
+		current  *spiffebundle.Bundle
+		expected bool
+	}{
+		{name: "same_sequence_number", previous: bundle, current: bundle.Clone(), expected: false},
+		{name: "new_sequence_number", previous: bundle, current: newBundle(t, td, 2), expected: true},
+		{name: "same_contents", previous: withoutSequenceNumber, current: withoutSequenceNumber.Clone(), expected: false},
+		{name: "new_contents", previous: withoutSequenceNumber, current: bundle, expected: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, bundleChanged(tt.previous, tt.current))
+		})
+	}
+}
+
+// newWatchController returns a controller checking the bundle of the SPIRE
+// Server every few milliseconds, which never syncs on its own.
+func newWatchController(spireServer *fakeSpire, server *fakeServer) *LocalHarvesterController {
+	return NewLocalHarvesterController(catalog.Catalog{Spire: spireServer, Server: server}, Config{
+		SyncInterval:           time.Hour,
+		BundleWatchMinInterval: time.Millisecond,
+		BundleWatchMaxInterval: 10 * time.Millisecond,
+		AllowUnsignedBundles:   true,
+	}).(*LocalHarvesterController)
+}
+
+func TestWatchBundle(t *testing.T) {
+	spireServer := &fakeSpire{bundle: newBundle(t, td, 1)}
+	c := newWatchController(spireServer, &fakeServer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.watchBundle(ctx)
+
+	// The bundle seen on start is not a change
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, c.changes)
+
+	spireServer.setBundle(nil, errors.New("spire is down"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, c.changes)
+
+	spireServer.setBundle(newBundle(t, td, 2), nil)
+	select {
+	case <-c.changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bundle change not detected")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		streamUnavailable bool
+	}{
+		{name: "stream"},
+		{name: "polling fallback", streamUnavailable: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{
+				events:            []common.Event{{Id: 1, TrustDomain: otherTD.String(), Type: common.TrustBundleUpdated}},
+				streamUnavailable: tt.streamUnavailable,
+			}
+			c := newWatchController(&fakeSpire{bundle: newBundle(t, td, 1)}, server)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.watchEvents(ctx)
+
+			// The events that happened before the start are not changes
+			time.Sleep(50 * time.Millisecond)
+			assert.Empty(t, c.changes)
+
+			server.addEvent(common.Event{Id: 2, TrustDomain: otherTD.String(), Type: common.RelationshipUpdated})
+			select {
+			case <-c.changes:
+			case <-time.After(5 * time.Second):
+				t.Fatal("event not detected")
+			}
+
+			// The stream is not retried right away when unavailable
+			assert.Equal(t, 1, server.streamCount())
+		})
+	}
+}
+
+func TestRunSyncsOnChange(t *testing.T) {
+	spireServer := &fakeSpire{bundle: newBundle(t, td, 1)}
+	server := &fakeServer{}
+	c := newWatchController(spireServer, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	lastSync := func() time.Time { return c.SyncStatus().LastSync }
+	require.Eventually(t, func() bool { return !lastSync().IsZero() }, 5*time.Second, time.Millisecond)
+
+	// The sync interval is not over, the change of the bundle triggers a sync
+	start := lastSync()
+	spireServer.setBundle(newBundle(t, td, 2), nil)
+	require.Eventually(t, func() bool { return lastSync().After(start) }, 5*time.Second, time.Millisecond)
+
+	// So does an event of a federated trust domain
+	start = lastSync()
+	server.addEvent(common.Event{Id: 1, TrustDomain: otherTD.String(), Type: common.TrustBundleUpdated})
+	require.Eventually(t, func() bool { return lastSync().After(start) }, 5*time.Second, time.Millisecond)
+}
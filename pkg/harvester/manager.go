@@ -2,14 +2,21 @@ package harvester
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"os/signal"
-	"runtime/debug"
-	"sync"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/health"
+	"github.com/HewlettPackard/galadriel/pkg/common/supervisor"
 	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/common/tlsutil"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/api"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/catalog"
 	"github.com/HewlettPackard/galadriel/pkg/harvester/config"
@@ -18,6 +25,39 @@ import (
 	"github.com/HewlettPackard/galadriel/pkg/harvester/spire"
 )
 
+const (
+	// credentialFile is the name of the file of the data directory holding
+	// the credential issued by the Galadriel Server when onboarding.
+	credentialFile = "credential"
+
+	// harvesterSVIDPath is the path of the SPIFFE ID of the X509-SVIDs
+	// minted for the harvester.
+	harvesterSVIDPath = "/galadriel/harvester"
+	// harvesterSVIDTTL is the lifetime of the X509-SVIDs minted for the
+	// harvester.
+	harvesterSVIDTTL = time.Hour
+
+	// serviceName identifies the harvester in the exported metrics and
+	// spans.
+	serviceName = "galadriel-harvester"
+)
+
+// adminAPIRestartPolicy is the policy for restarting the admin API when it
+// fails.
+var adminAPIRestartPolicy = &supervisor.RestartPolicy{
+	MaxRestarts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+// svidSourceRestartPolicy is the policy for restarting the X509-SVID source
+// when it fails to mint its first X509-SVID, e.g. while the SPIRE Server is
+// not reachable.
+var svidSourceRestartPolicy = &supervisor.RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
 // Manager is the entity that enables managing the Galadriel Server
 type Manager struct {
 	catalog    catalog.Catalog
@@ -25,6 +65,12 @@ type Manager struct {
 	api        api.API
 	logger     common.Logger
 	telemetry  telemetry.MetricServer
+	tracer     *telemetry.Tracer
+	health     *health.Server
+	// svidSource provides the X509-SVID the harvester signs the bundle of the
+	// managed SPIRE Server with, and its client certificate when it
+	// authenticates with an X509-SVID. It is nil if neither is enabled.
+	svidSource *spire.X509SVIDSource
 }
 
 func NewHarvesterManager() *Manager {
@@ -33,19 +79,16 @@ func NewHarvesterManager() *Manager {
 	}
 }
 
-func (m *Manager) Start(ctx context.Context, config config.HarvesterConfig) {
-	type key string
-
-	if m.load(ctx, config) != nil {
-		panic("unable to load configuration")
+// Start runs the harvester until the context is done, it receives SIGINT or
+// SIGTERM, or one of its plugins fails.
+func (m *Manager) Start(ctx context.Context, config config.HarvesterConfig) error {
+	if err := m.load(ctx, config); err != nil {
+		return fmt.Errorf("failed to load harvester: %w", err)
 	}
 
 	defer m.Stop()
 
-	ctxKey := key(telemetry.PackageName)
-	ctx = context.WithValue(ctx, ctxKey, telemetry.Harvester)
-
-	m.run(ctx)
+	return m.run(ctx)
 }
 
 func (m *Manager) Stop() {
@@ -53,60 +96,206 @@ func (m *Manager) Stop() {
 }
 
 func (m *Manager) load(ctx context.Context, config config.HarvesterConfig) error {
+	spireServer := spire.NewLocalSpireServer(ctx, config.HarvesterConfigSection.SpireSocketPath)
+
+	signBundles := !config.HarvesterConfigSection.PushUnsignedBundles
+	tlsConfig := config.HarvesterConfigSection.TLS
+	if signBundles || (tlsConfig != nil && tlsConfig.UseSpireSVID) {
+		m.svidSource = spire.NewX509SVIDSource(spireServer, harvesterSVIDPath, harvesterSVIDTTL)
+	}
+
+	var serverOptions server.Options
+	if tlsConfig != nil {
+		var err error
+		serverOptions.TLSConfig, err = tlsutil.NewClientConfig(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.CABundleFile)
+		if err != nil {
+			return fmt.Errorf("failed to load tls configuration: %v", err)
+		}
+
+		if tlsConfig.UseSpireSVID {
+			serverOptions.TLSConfig.GetClientCertificate = m.svidSource.GetClientCertificate
+		}
+	}
+
+	dataDir := config.HarvesterConfigSection.DataDir
+	credential, err := loadCredential(dataDir)
+	if err != nil {
+		return err
+	}
+	serverOptions.Credential = credential
+
+	galadrielServer, err := server.NewRemoteGaladrielServer(config.HarvesterConfigSection.ServerAddress, serverOptions)
+	if err != nil {
+		return fmt.Errorf("failed to load galadriel server client: %v", err)
+	}
+
+	if err := m.onboard(ctx, galadrielServer, dataDir, credential, config.HarvesterConfigSection.JoinToken); err != nil {
+		return err
+	}
+
 	cat := catalog.Catalog{
-		Spire:  spire.NewLocalSpireServer(ctx, config.HarvesterConfigSection.SpireSocketPath),
-		Server: server.NewRemoteGaladrielServer(config.HarvesterConfigSection.ServerAddress),
+		Spire:  spireServer,
+		Server: galadrielServer,
 	}
 
-	controller := controller.NewLocalHarvesterController(cat)
-	api := api.NewHTTPApi(controller)
+	// The sync interval has been validated when loading the configuration
+	syncInterval, err := time.ParseDuration(config.HarvesterConfigSection.SyncInterval)
+	if err != nil {
+		return fmt.Errorf("invalid sync interval: %v", err)
+	}
+
+	controllerConfig := controller.Config{
+		SyncInterval:                 syncInterval,
+		AllowUnsignedBundles:         config.HarvesterConfigSection.AllowUnsignedBundles,
+		AdoptFederationRelationships: config.HarvesterConfigSection.AdoptFederationRelationships,
+	}
+	if signBundles {
+		controllerConfig.SVIDSource = m.svidSource
+	}
+	controller := controller.NewLocalHarvesterController(cat, controllerConfig)
+	api := api.NewHTTPApi(controller, cat, api.Config{
+		SocketPath: config.HarvesterConfigSection.AdminSocketPath,
+	})
 
 	m.catalog = cat
 	m.controller = controller
 	m.api = api
 
-	telemetry := telemetry.NewLocalMetricServer()
-	m.telemetry = telemetry
+	if telemetryConfig := config.TelemetryConfigSection; telemetryConfig.MetricsEnabled() {
+		metricServerConfig, err := telemetryConfig.MetricServerConfig(serviceName)
+		if err != nil {
+			return fmt.Errorf("failed to load telemetry configuration: %v", err)
+		}
+		m.telemetry = telemetry.NewLocalMetricServer(metricServerConfig)
+	}
+	if telemetryConfig := config.TelemetryConfigSection; telemetryConfig.TracingEnabled() {
+		m.tracer = telemetry.NewTracer(telemetryConfig.TracerConfig(serviceName))
+	}
+
+	if healthChecks := config.HarvesterConfigSection.HealthChecks; healthChecks != nil {
+		// The sync window has been validated when loading the configuration
+		syncWindow, err := time.ParseDuration(healthChecks.SyncWindow)
+		if err != nil {
+			return fmt.Errorf("invalid sync window: %v", err)
+		}
+
+		m.health = health.NewServer(healthChecks.ListenAddress, map[string]health.Check{
+			"spire_server": checkSpireServer(spireServer),
+			"sync":         checkSync(controller, syncWindow, time.Now),
+		})
+	}
 
 	return nil
 }
 
-func (m *Manager) run(ctx context.Context) {
+func (m *Manager) run(ctx context.Context) error {
 	m.logger.Info("Starting harvester manager")
 
-	var wg sync.WaitGroup
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	plugins := []supervisor.Plugin{
+		{Name: telemetry.HarvesterController, Plugin: m.controller},
+		// The admin API is restarted when it fails, e.g. if its socket is
+		// removed, as the synchronizations go on without it
+		{Name: telemetry.AdminAPI, Plugin: m.api, Restart: adminAPIRestartPolicy},
+	}
+	if m.svidSource != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.X509SVIDSource, Plugin: m.svidSource, Restart: svidSourceRestartPolicy})
+	}
+	if m.telemetry != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.MetricsServer, Plugin: m.telemetry})
+	}
+	if m.tracer != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.Tracing, Plugin: m.tracer})
+	}
+	if m.health != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.HealthChecks, Plugin: m.health})
+	}
 
-	_, cancel := context.WithCancel(ctx)
-	ctx, _ = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	return supervisor.Run(ctx, plugins...)
+}
 
-	defer func() {
-		wg.Wait()
-		cancel()
-	}()
+// checkSpireServer returns a readiness check failing when the SPIRE Server
+// does not answer.
+func checkSpireServer(spireServer spire.SpireServer) health.Check {
+	return func(ctx context.Context) error {
+		if _, err := spireServer.GetBundle(ctx); err != nil {
+			return fmt.Errorf("failed to get bundle: %v", err)
+		}
 
-	plugins := []common.RunnablePlugin{
-		m.controller,
-		m.api,
-		m.telemetry,
+		return nil
 	}
-	wg.Add(len(plugins))
+}
 
-	errch := make(chan error, len(plugins))
-	for _, plugin := range plugins {
-		plugin := plugin
-		go func() {
-			errch <- runTask(ctx, &wg, plugin.Run)
-		}()
+// checkSync returns a readiness check failing when the last successful
+// synchronization with the Galadriel Server is older than the sync window.
+func checkSync(c controller.HarvesterController, window time.Duration, now func() time.Time) health.Check {
+	return func(context.Context) error {
+		status := c.SyncStatus()
+		switch {
+		case status.LastSuccess.IsZero() && status.LastError != nil:
+			return fmt.Errorf("no successful sync yet: %v", status.LastError)
+		case status.LastSuccess.IsZero():
+			return errors.New("no successful sync yet")
+		case now().Sub(status.LastSuccess) <= window:
+			return nil
+		case status.LastError != nil:
+			return fmt.Errorf("last successful sync at %s: %v", status.LastSuccess.Format(time.RFC3339), status.LastError)
+		default:
+			return fmt.Errorf("last successful sync at %s", status.LastSuccess.Format(time.RFC3339))
+		}
 	}
 }
 
-func runTask(ctx context.Context, wg *sync.WaitGroup, task func(context.Context) error) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v\n%s", r, string(debug.Stack()))
-		}
-		wg.Done()
-	}()
+// onboard redeems the join token, if any, and stores the credential issued by
+// the Galadriel Server. The join token is single use, so it is not redeemed
+// again once the harvester onboarded and stored its credential.
+func (m *Manager) onboard(ctx context.Context, galadrielServer server.GaladrielServer, dataDir, credential, joinToken string) error {
+	switch {
+	case joinToken == "":
+		return nil
+	case credential != "":
+		m.logger.Info("Ignoring the join token: the harvester onboarded already")
+		return nil
+	}
 
-	return task(ctx)
+	resp, err := galadrielServer.Onboard(ctx, joinToken)
+	if err != nil {
+		return err
+	}
+	if err := storeCredential(dataDir, resp.Credential); err != nil {
+		return err
+	}
+	m.logger.Info("Onboarded to the Galadriel Server as", resp.TrustDomain)
+
+	return nil
+}
+
+// loadCredential returns the credential stored in the data directory, or an
+// empty string if the harvester has not onboarded yet.
+func loadCredential(dataDir string) (string, error) {
+	credential, err := os.ReadFile(filepath.Join(dataDir, credentialFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("failed to load credential: %v", err)
+	}
+
+	return strings.TrimSpace(string(credential)), nil
+}
+
+// storeCredential persists the credential in the data directory, readable
+// only by the harvester.
+func storeCredential(dataDir, credential string) error {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, credentialFile), []byte(credential), 0600); err != nil {
+		return fmt.Errorf("failed to store credential: %v", err)
+	}
+
+	return nil
 }
@@ -1 +1,121 @@
 package harvester
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/controller"
+	"github.com/HewlettPackard/galadriel/pkg/harvester/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredential(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	credential, err := loadCredential(dataDir)
+	require.NoError(t, err)
+	assert.Empty(t, credential)
+
+	require.NoError(t, storeCredential(dataDir, "credential"))
+
+	info, err := os.Stat(filepath.Join(dataDir, credentialFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	credential, err = loadCredential(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, "credential", credential)
+}
+
+type fakeServer struct {
+	server.GaladrielServer
+	joinTokens []string
+}
+
+func (s *fakeServer) Onboard(_ context.Context, joinToken string) (*common.OnboardResponse, error) {
+	s.joinTokens = append(s.joinTokens, joinToken)
+	return &common.OnboardResponse{TrustDomain: "example.org", Credential: "credential"}, nil
+}
+
+func TestOnboard(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	m := NewHarvesterManager()
+	galadrielServer := &fakeServer{}
+
+	// Harvesters without join token do not onboard
+	require.NoError(t, m.onboard(context.Background(), galadrielServer, dataDir, "", ""))
+	assert.Empty(t, galadrielServer.joinTokens)
+
+	require.NoError(t, m.onboard(context.Background(), galadrielServer, dataDir, "", "token"))
+	assert.Equal(t, []string{"token"}, galadrielServer.joinTokens)
+	credential, err := loadCredential(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, "credential", credential)
+
+	// The join token is not redeemed again on restart
+	require.NoError(t, m.onboard(context.Background(), galadrielServer, dataDir, credential, "token"))
+	assert.Equal(t, []string{"token"}, galadrielServer.joinTokens)
+}
+
+type fakeController struct {
+	controller.HarvesterController
+	status controller.SyncStatus
+}
+
+func (c fakeController) SyncStatus() controller.SyncStatus {
+	return c.status
+}
+
+func TestCheckSync(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	syncErr := errors.New("galadriel server is down")
+
+	for _, tt := range []struct {
+		name   string
+		status controller.SyncStatus
+		err    string
+	}{
+		{
+			name: "no sync yet",
+			err:  "no successful sync yet",
+		},
+		{
+			name:   "no successful sync yet",
+			status: controller.SyncStatus{LastSync: now, LastError: syncErr},
+			err:    "no successful sync yet: galadriel server is down",
+		},
+		{
+			name:   "within window",
+			status: controller.SyncStatus{LastSync: now, LastSuccess: now.Add(-5 * time.Minute), LastError: syncErr},
+		},
+		{
+			name:   "outside window",
+			status: controller.SyncStatus{LastSync: now, LastSuccess: now.Add(-6 * time.Minute), LastError: syncErr},
+			err:    "last successful sync at 2022-09-01T09:54:00Z: galadriel server is down",
+		},
+		{
+			name:   "no sync within window",
+			status: controller.SyncStatus{LastSync: now.Add(-6 * time.Minute), LastSuccess: now.Add(-6 * time.Minute)},
+			err:    "last successful sync at 2022-09-01T09:54:00Z",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkSync(fakeController{status: tt.status}, 5*time.Minute, func() time.Time { return now })
+
+			err := check(context.Background())
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -1,38 +1,495 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+const (
+	defaultTimeout        = 10 * time.Second
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+
+	// streamIdleTimeout is the time without any data on an event stream, not
+	// even a heartbeat, after which the stream is considered broken.
+	streamIdleTimeout = 45 * time.Second
+)
+
+// ErrStreamUnavailable is returned by StreamEvents when the Galadriel Server
+// does not stream events, so that the caller falls back to polling.
+var ErrStreamUnavailable = errors.New("galadriel server does not stream events")
+
+// GaladrielServer is the harvester view of the Galadriel Server. Every call
+// is made on behalf of the SPIRE Server managed by the harvester.
 type GaladrielServer interface {
-	GetUpdates(context.Context) ([]string, error)
-	PushUpdates(context.Context, []string) error
-	GetMemberships(context.Context) ([]string, error)
+	// GetUpdates returns the trust bundles of the trust domains federated
+	// with the given trust domain.
+	GetUpdates(context.Context, spiffeid.TrustDomain) ([]common.TrustBundle, error)
+	// PushUpdates uploads the trust bundle of the SPIRE Server managed by
+	// the harvester.
+	PushUpdates(context.Context, common.TrustBundle) error
+	// GetMemberships returns the federation relationships the given trust
+	// domain is part of.
+	GetMemberships(context.Context, spiffeid.TrustDomain) ([]common.FederationRelationship, error)
+	// GetRelationship returns a federation relationship the given trust
+	// domain is part of.
+	GetRelationship(ctx context.Context, td spiffeid.TrustDomain, id int64) (*common.FederationRelationship, error)
+	// SetRelationshipConsent sets the consent of the given trust domain to a
+	// federation relationship it is part of.
+	SetRelationshipConsent(ctx context.Context, td spiffeid.TrustDomain, id int64, consent string) error
+	// GetEvents returns the trust bundle events of the trust domains
+	// federated with the given trust domain, with an ID greater than after.
+	// common.ErrEventsExpired is returned if some of those events are no
+	// longer retained, in which case the caller must resync.
+	GetEvents(ctx context.Context, td spiffeid.TrustDomain, after int64) ([]common.Event, error)
+	// WaitEvents is like GetEvents, but waits up to the given time for an
+	// event when there is none yet, returning no events if none happened.
+	WaitEvents(ctx context.Context, td spiffeid.TrustDomain, after int64, wait time.Duration) ([]common.Event, error)
+	// StreamEvents streams the events of the given trust domain with an ID
+	// greater than after, passing them to handle as they happen, until the
+	// context is done or the stream breaks. ErrStreamUnavailable is returned
+	// if the Galadriel Server does not stream events.
+	StreamEvents(ctx context.Context, td spiffeid.TrustDomain, after int64, handle func(common.Event)) error
+	// Onboard redeems the given join token, and authenticates subsequent
+	// calls with the issued credential.
+	Onboard(ctx context.Context, joinToken string) (*common.OnboardResponse, error)
+}
+
+// Options configures how the harvester talks to the Galadriel Server. Zero
+// values are replaced by defaults.
+type Options struct {
+	// Timeout of every request attempt.
+	Timeout time.Duration
+	// MaxRetries is the number of times a failed request is retried.
+	// A negative value disables retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry. It is doubled on
+	// every subsequent retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// TLSConfig is used to connect to the Galadriel Server over HTTPS. The
+	// address defaults to the https scheme when set.
+	TLSConfig *tls.Config
+	// Credential issued to the harvester when onboarding, sent as a bearer
+	// token on every request.
+	Credential string
+}
+
+// ResponseError is returned when the Galadriel Server answers with a
+// non-successful status code.
+type ResponseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("galadriel server responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns common.ErrEventsExpired when the events after the given one
+// are no longer retained by the Galadriel Server, so that the caller resyncs.
+func (e *ResponseError) Unwrap() error {
+	if e.StatusCode == http.StatusGone {
+		return common.ErrEventsExpired
+	}
+
+	return nil
+}
+
+// retryable reports whether a request that failed with this error may succeed
+// if sent again.
+func (e *ResponseError) retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
 }
 
+// RemoteGaladrielServer is an HTTP client of the Galadriel Server harvester API.
 type RemoteGaladrielServer struct {
-	address string
+	baseURL *url.URL
+	client  *http.Client
+	options Options
 	logger  common.Logger
+
+	streamIdleTimeout time.Duration
 }
 
-func NewRemoteGaladrielServer(address string) GaladrielServer {
+func NewRemoteGaladrielServer(address string, options Options) (GaladrielServer, error) {
+	if !strings.Contains(address, "://") {
+		scheme := "http://"
+		if options.TLSConfig != nil {
+			scheme = "https://"
+		}
+		address = scheme + address
+	}
+
+	baseURL, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid galadriel server address: %v", err)
+	}
+	if baseURL.Scheme == "http" && options.TLSConfig != nil {
+		return nil, errors.New("galadriel server address must use https when tls is configured")
+	}
+
+	options.setDefaults()
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if options.TLSConfig != nil {
+		tlsTransport := http.DefaultTransport.(*http.Transport).Clone()
+		tlsTransport.TLSClientConfig = options.TLSConfig
+		transport = tlsTransport
+	}
+	// The requests are traced, and propagate the trace to the Galadriel
+	// Server
+	client := &http.Client{
+		Timeout:   options.Timeout,
+		Transport: otelhttp.NewTransport(transport, otelhttp.WithSpanNameFormatter(spanName)),
+	}
+
 	return &RemoteGaladrielServer{
-		address: address,
+		baseURL: baseURL,
+		client:  client,
+		options: options,
 		logger:  *common.NewLogger("remote_galadriel_server"),
+
+		streamIdleTimeout: streamIdleTimeout,
+	}, nil
+}
+
+// spanName names the span of a request after its method and path.
+func spanName(_ string, req *http.Request) string {
+	return req.Method + " " + req.URL.Path
+}
+
+func (s *RemoteGaladrielServer) GetUpdates(ctx context.Context, td spiffeid.TrustDomain) ([]common.TrustBundle, error) {
+	var bundles []common.TrustBundle
+	query := url.Values{"spireServer": {td.String()}}
+	if err := s.do(ctx, http.MethodGet, "/trustBundles", query, nil, &bundles); err != nil {
+		return nil, fmt.Errorf("failed to get trust bundles: %w", err)
+	}
+
+	return bundles, nil
+}
+
+func (s *RemoteGaladrielServer) PushUpdates(ctx context.Context, bundle common.TrustBundle) error {
+	if bundle.TrustDomain == nil {
+		return errors.New("trust bundle trust domain is required")
+	}
+
+	path := fmt.Sprintf("/trustBundles/%d", bundle.Id)
+	query := url.Values{"spireServer": {*bundle.TrustDomain}}
+	if err := s.do(ctx, http.MethodPut, path, query, bundle, nil); err != nil {
+		return fmt.Errorf("failed to push trust bundle: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RemoteGaladrielServer) GetEvents(ctx context.Context, td spiffeid.TrustDomain, after int64) ([]common.Event, error) {
+	var events []common.Event
+	query := url.Values{
+		"spireServer": {td.String()},
+		"after":       {strconv.FormatInt(after, 10)},
+	}
+	if err := s.do(ctx, http.MethodGet, "/events", query, nil, &events); err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (s *RemoteGaladrielServer) WaitEvents(ctx context.Context, td spiffeid.TrustDomain, after int64, wait time.Duration) ([]common.Event, error) {
+	var events []common.Event
+	query := url.Values{
+		"spireServer": {td.String()},
+		"after":       {strconv.FormatInt(after, 10)},
+		"wait":        {strconv.Itoa(int(wait.Seconds()))},
+	}
+
+	// The request is held by the Galadriel Server during the wait, on top of
+	// the time it takes to answer
+	client := *s.client
+	client.Timeout += wait
+	if err := s.doWith(ctx, &client, http.MethodGet, "/events", query, nil, &events); err != nil {
+		return nil, fmt.Errorf("failed to wait for events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (s *RemoteGaladrielServer) StreamEvents(ctx context.Context, td spiffeid.TrustDomain, after int64, handle func(common.Event)) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	u := s.baseURL.JoinPath("/events/stream")
+	u.RawQuery = url.Values{
+		"spireServer": {td.String()},
+		"after":       {strconv.FormatInt(after, 10)},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if s.options.Credential != "" {
+		req.Header.Set("Authorization", "Bearer "+s.options.Credential)
+	}
+
+	// The stream outlives the request timeout. It is watched for data
+	// instead, as the Galadriel Server sends heartbeats while it is idle.
+	idle := time.AfterFunc(s.streamIdleTimeout, cancel)
+	defer idle.Stop()
+
+	client := *s.client
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to stream events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return ErrStreamUnavailable
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to stream events: %w", newResponseError(resp.StatusCode, respBody))
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		return ErrStreamUnavailable
+	}
+
+	// Only the data of the messages is used, as the events carry their ID
+	// and type. Comments are heartbeats.
+	reader := bufio.NewReader(resp.Body)
+	var data string
+	for {
+		line, err := reader.ReadString('\n')
+		switch {
+		case err != nil && ctx.Err() == nil && streamCtx.Err() != nil:
+			return fmt.Errorf("event stream idle for %s", s.streamIdleTimeout)
+		case err != nil:
+			return fmt.Errorf("event stream closed: %v", err)
+		}
+		idle.Reset(s.streamIdleTimeout)
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && data != "":
+			var event common.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return fmt.Errorf("failed to decode event: %v", err)
+			}
+			data = ""
+			handle(event)
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+}
+
+func (s *RemoteGaladrielServer) GetMemberships(ctx context.Context, td spiffeid.TrustDomain) ([]common.FederationRelationship, error) {
+	var relationships []common.FederationRelationship
+	query := url.Values{"spireServer": {td.String()}}
+	if err := s.do(ctx, http.MethodGet, "/FederationRelationship", query, nil, &relationships); err != nil {
+		return nil, fmt.Errorf("failed to get federation relationships: %w", err)
+	}
+
+	return relationships, nil
+}
+
+func (s *RemoteGaladrielServer) GetRelationship(ctx context.Context, td spiffeid.TrustDomain, id int64) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	path := fmt.Sprintf("/FederationRelationship/%d", id)
+	query := url.Values{"spireServer": {td.String()}}
+	if err := s.do(ctx, http.MethodGet, path, query, nil, &relationship); err != nil {
+		return nil, fmt.Errorf("failed to get federation relationship: %w", err)
 	}
+
+	return &relationship, nil
 }
 
-func (s *RemoteGaladrielServer) GetUpdates(ctx context.Context) ([]string, error) {
-	return nil, errors.New("not implemented")
+func (s *RemoteGaladrielServer) SetRelationshipConsent(ctx context.Context, td spiffeid.TrustDomain, id int64, consent string) error {
+	relationship, err := s.GetRelationship(ctx, td, id)
+	if err != nil {
+		return err
+	}
+
+	// The consent of the trust domain is the one of its side of the relationship
+	var update common.FederationRelationship
+	if relationship.SpireServer == td.String() {
+		update.SpireServerConsent = &consent
+	} else {
+		update.SpireServerFederatedWithConsent = &consent
+	}
+
+	path := fmt.Sprintf("/FederationRelationship/%d", id)
+	query := url.Values{"spireServer": {td.String()}}
+	if err := s.do(ctx, http.MethodPut, path, query, update, nil); err != nil {
+		return fmt.Errorf("failed to set federation relationship consent: %w", err)
+	}
+
+	return nil
 }
 
-func (s *RemoteGaladrielServer) PushUpdates(ctx context.Context, updates []string) error {
-	return errors.New("not implemented")
+func (s *RemoteGaladrielServer) Onboard(ctx context.Context, joinToken string) (*common.OnboardResponse, error) {
+	body, err := json.Marshal(common.OnboardRequest{JoinToken: joinToken})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	// Onboarding is not retried: the join token is single use, and is
+	// redeemed already if the request failed after the server handled it
+	var resp common.OnboardResponse
+	if err := s.doOnce(ctx, s.client, http.MethodPost, "/onboard", nil, body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to onboard: %w", err)
+	}
+	if resp.Credential == "" {
+		return nil, errors.New("failed to onboard: galadriel server issued no credential")
+	}
+
+	s.options.Credential = resp.Credential
+	return &resp, nil
+}
+
+// do sends a request to the Galadriel Server, retrying with exponential
+// backoff while it fails with a transient error, and decodes the JSON
+// response into out, if not nil.
+func (s *RemoteGaladrielServer) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	return s.doWith(ctx, s.client, method, path, query, in, out)
+}
+
+// doWith is like do, but sends the request with the given client.
+func (s *RemoteGaladrielServer) doWith(ctx context.Context, client *http.Client, method, path string, query url.Values, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+	}
+
+	backoff := s.options.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.doOnce(ctx, client, method, path, query, body, out)
+		if err == nil || attempt >= s.options.MaxRetries || !isRetryable(ctx, err) {
+			return err
+		}
+
+		s.logger.Debug(method, path, "failed, retrying in", backoff, ":", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > s.options.MaxBackoff {
+			backoff = s.options.MaxBackoff
+		}
+	}
 }
 
-func (s *RemoteGaladrielServer) GetMemberships(ctx context.Context) ([]string, error) {
-	return nil, errors.New("not implemented")
+func (s *RemoteGaladrielServer) doOnce(ctx context.Context, client *http.Client, method, path string, query url.Values, body []byte, out interface{}) error {
+	u := s.baseURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.options.Credential != "" {
+		req.Header.Set("Authorization", "Bearer "+s.options.Credential)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return newResponseError(resp.StatusCode, respBody)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// newResponseError returns the error of a non-successful response, with the
+// message of the API error in its body, if any.
+func newResponseError(statusCode int, body []byte) *ResponseError {
+	respErr := &ResponseError{StatusCode: statusCode, Message: http.StatusText(statusCode)}
+	var apiErr common.Error
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+		respErr.Message = apiErr.Message
+	}
+
+	return respErr
+}
+
+// isRetryable reports whether a failed request should be retried. Requests
+// are retried on network errors and on server-side errors, unless the
+// context of the caller is done.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.retryable()
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func (o *Options) setDefaults() {
+	if o.Timeout == 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaultMaxRetries
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = defaultInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
 }
@@ -1 +1,466 @@
 package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var td = spiffeid.RequireTrustDomainFromString("example.org")
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) GaladrielServer {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewRemoteGaladrielServer(server.Listener.Addr().String(), Options{
+		Timeout:        time.Second,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	return client
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestGetMemberships(t *testing.T) {
+	status := common.FederationRelationshipStatusActive
+	expected := []common.FederationRelationship{{
+		Id:                       1,
+		FederationGroupId:        2,
+		SpireServer:              "example.org",
+		SpireServerFederatedWith: "other.org",
+		Status:                   &status,
+	}}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/FederationRelationship", r.URL.Path)
+		assert.Equal(t, "example.org", r.URL.Query().Get("spireServer"))
+		writeJSON(w, http.StatusOK, expected)
+	})
+
+	relationships, err := client.GetMemberships(context.Background(), td)
+	require.NoError(t, err)
+	assert.Equal(t, expected, relationships)
+}
+
+func TestGetUpdates(t *testing.T) {
+	trustDomain := "other.org"
+	expected := []common.TrustBundle{{Id: 1, TrustDomain: &trustDomain, Bundle: "bundle"}}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/trustBundles", r.URL.Path)
+		assert.Equal(t, "example.org", r.URL.Query().Get("spireServer"))
+		writeJSON(w, http.StatusOK, expected)
+	})
+
+	bundles, err := client.GetUpdates(context.Background(), td)
+	require.NoError(t, err)
+	assert.Equal(t, expected, bundles)
+}
+
+func TestGetEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/events", r.URL.Path)
+		assert.Equal(t, "td1.org", r.URL.Query().Get("spireServer"))
+		assert.Equal(t, "42", r.URL.Query().Get("after"))
+		writeJSON(w, http.StatusOK, []common.Event{{Id: 43, TrustDomain: "td2.org", Type: common.TrustBundleToDelete}})
+	})
+
+	events, err := client.GetEvents(context.Background(), spiffeid.RequireTrustDomainFromString("td1.org"), 42)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(43), events[0].Id)
+	assert.Equal(t, common.TrustBundleToDelete, events[0].Type)
+}
+
+func TestWaitEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/events", r.URL.Path)
+		assert.Equal(t, "42", r.URL.Query().Get("after"))
+		assert.Equal(t, "2", r.URL.Query().Get("wait"))
+
+		// Answering after the request timeout does not fail, as the wait
+		// extends it
+		time.Sleep(1200 * time.Millisecond)
+		writeJSON(w, http.StatusOK, []common.Event{{Id: 43, TrustDomain: "td2.org", Type: common.TrustBundleUpdated}})
+	})
+
+	events, err := client.WaitEvents(context.Background(), spiffeid.RequireTrustDomainFromString("td1.org"), 42, 2*time.Second)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, common.TrustBundleUpdated, events[0].Type)
+}
+
+func TestStreamEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/events/stream", r.URL.Path)
+		assert.Equal(t, "42", r.URL.Query().Get("after"))
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": heartbeat\n\n")
+		fmt.Fprint(w, "id: 43\nevent: trust_bundle_updated\ndata: {\"id\":43,\"trustDomain\":\"td2.org\",\"type\":\"trust_bundle_updated\"}\n\n")
+		fmt.Fprint(w, "id: 44\nevent: relationship_updated\ndata: {\"id\":44,\"trustDomain\":\"example.org\",\"type\":\"relationship_updated\"}\n\n")
+	})
+
+	var events []common.Event
+	err := client.StreamEvents(context.Background(), td, 42, func(event common.Event) {
+		events = append(events, event)
+	})
+	require.EqualError(t, err, "event stream closed: EOF")
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(43), events[0].Id)
+	assert.Equal(t, common.TrustBundleUpdated, events[0].Type)
+	assert.Equal(t, int64(44), events[1].Id)
+	assert.Equal(t, common.RelationshipUpdated, events[1].Type)
+}
+
+func TestStreamEventsUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		err     error
+	}{
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusNotFound, common.Error{Message: "Not Found"})
+			},
+			err: ErrStreamUnavailable,
+		},
+		{
+			name: "not a stream",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, []common.Event{})
+			},
+			err: ErrStreamUnavailable,
+		},
+		{
+			name: "error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusBadRequest, common.Error{Message: "invalid cursor"})
+			},
+			err: &ResponseError{StatusCode: http.StatusBadRequest, Message: "invalid cursor"},
+		},
+		{
+			name: "expired",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusGone, common.Error{Message: "cursor expired, resync"})
+			},
+			err: common.ErrEventsExpired,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+
+			err := client.StreamEvents(context.Background(), td, 0, func(common.Event) {
+				t.Error("unexpected event")
+			})
+			require.Error(t, err)
+			if respErr, ok := tt.err.(*ResponseError); ok {
+				var got *ResponseError
+				require.ErrorAs(t, err, &got)
+				assert.Equal(t, respErr, got)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestStreamEventsIdle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewRemoteGaladrielServer(server.Listener.Addr().String(), Options{Timeout: time.Second})
+	require.NoError(t, err)
+	client.(*RemoteGaladrielServer).streamIdleTimeout = 50 * time.Millisecond
+
+	err = client.StreamEvents(context.Background(), td, 0, func(common.Event) {})
+	require.EqualError(t, err, "event stream idle for 50ms")
+}
+
+func TestPushUpdates(t *testing.T) {
+	trustDomain := td.String()
+	bundle := common.TrustBundle{Id: 3, TrustDomain: &trustDomain, Bundle: "bundle"}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/trustBundles/3", r.URL.Path)
+		assert.Equal(t, "example.org", r.URL.Query().Get("spireServer"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var got common.TrustBundle
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		assert.Equal(t, bundle, got)
+
+		writeJSON(w, http.StatusOK, got)
+	})
+
+	require.NoError(t, client.PushUpdates(context.Background(), bundle))
+
+	err := client.PushUpdates(context.Background(), common.TrustBundle{Bundle: "bundle"})
+	assert.EqualError(t, err, "trust bundle trust domain is required")
+}
+
+func TestRelationshipConsent(t *testing.T) {
+	relationship := common.FederationRelationship{
+		Id:                       1,
+		FederationGroupId:        2,
+		SpireServer:              "other.org",
+		SpireServerFederatedWith: "example.org",
+	}
+
+	var updates []common.FederationRelationship
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "example.org", r.URL.Query().Get("spireServer"))
+		switch {
+		case r.URL.Path != "/FederationRelationship/1":
+			writeJSON(w, http.StatusNotFound, common.Error{Code: http.StatusNotFound, Message: "federation relationship 3: not found"})
+		case r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, relationship)
+		case r.Method == http.MethodPut:
+			var update common.FederationRelationship
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+			updates = append(updates, update)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	got, err := client.GetRelationship(context.Background(), td, 1)
+	require.NoError(t, err)
+	assert.Equal(t, &relationship, got)
+
+	// example.org is on the federated with side of the relationship
+	require.NoError(t, client.SetRelationshipConsent(context.Background(), td, 1, common.ConsentAccepted))
+	require.Len(t, updates, 1)
+	assert.Nil(t, updates[0].SpireServerConsent)
+	assert.Equal(t, common.ConsentAccepted, *updates[0].SpireServerFederatedWithConsent)
+
+	err = client.SetRelationshipConsent(context.Background(), td, 3, common.ConsentDenied)
+	assert.EqualError(t, err, "failed to get federation relationship: galadriel server responded with status 404: federation relationship 3: not found")
+}
+
+func TestOnboard(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/onboard":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Empty(t, r.Header.Get("Authorization"))
+
+			var req common.OnboardRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req.JoinToken != "token" {
+				writeJSON(w, http.StatusUnauthorized, common.Error{Code: http.StatusUnauthorized, Message: "invalid or expired join token"})
+				return
+			}
+			writeJSON(w, http.StatusOK, common.OnboardResponse{TrustDomain: "example.org", Credential: "credential"})
+		default:
+			assert.Equal(t, "Bearer credential", r.Header.Get("Authorization"))
+			writeJSON(w, http.StatusOK, []common.TrustBundle{})
+		}
+	})
+
+	_, err := client.Onboard(context.Background(), "invalid")
+	assert.EqualError(t, err, "failed to onboard: galadriel server responded with status 401: invalid or expired join token")
+
+	resp, err := client.Onboard(context.Background(), "token")
+	require.NoError(t, err)
+	assert.Equal(t, &common.OnboardResponse{TrustDomain: "example.org", Credential: "credential"}, resp)
+
+	// Subsequent calls are authenticated with the credential
+	_, err = client.GetUpdates(context.Background(), td)
+	require.NoError(t, err)
+}
+
+func TestOnboardIsNotRetried(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeJSON(w, http.StatusServiceUnavailable, common.Error{Code: http.StatusServiceUnavailable, Message: "unavailable"})
+	})
+
+	_, err := client.Onboard(context.Background(), "token")
+	assert.EqualError(t, err, "failed to onboard: galadriel server responded with status 503: unavailable")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		calls    int32
+		err      string
+		respCode int
+	}{
+		{
+			name:  "success_after_server_errors",
+			codes: []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK},
+			calls: 3,
+		},
+		{
+			name:  "too_many_requests",
+			codes: []int{http.StatusTooManyRequests, http.StatusOK},
+			calls: 2,
+		},
+		{
+			name:     "retries_exhausted",
+			codes:    []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			calls:    4,
+			err:      "failed to get trust bundles: galadriel server responded with status 502: failed",
+			respCode: http.StatusBadGateway,
+		},
+		{
+			name:     "client_errors_are_not_retried",
+			codes:    []int{http.StatusForbidden, http.StatusOK},
+			calls:    1,
+			err:      "failed to get trust bundles: galadriel server responded with status 403: failed",
+			respCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				code := tt.codes[atomic.AddInt32(&calls, 1)-1]
+				if code != http.StatusOK {
+					writeJSON(w, code, common.Error{Code: int32(code), Message: "failed"})
+					return
+				}
+				writeJSON(w, code, []common.TrustBundle{})
+			})
+
+			_, err := client.GetUpdates(context.Background(), td)
+			assert.Equal(t, tt.calls, atomic.LoadInt32(&calls))
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.err)
+			var respErr *ResponseError
+			require.True(t, errors.As(err, &respErr))
+			assert.Equal(t, tt.respCode, respErr.StatusCode)
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, err := NewRemoteGaladrielServer(server.URL, Options{
+		Timeout:    10 * time.Millisecond,
+		MaxRetries: -1,
+	})
+	require.NoError(t, err)
+
+	_, err = client.GetMemberships(context.Background(), td)
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestContextCancellation(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, common.Error{Message: "unavailable"})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetMemberships(ctx, td)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestInvalidResponse(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "not json")
+	})
+
+	_, err := client.GetMemberships(context.Background(), td)
+	assert.ErrorContains(t, err, "failed to get federation relationships: failed to decode response")
+}
+
+func TestNewRemoteGaladrielServer(t *testing.T) {
+	client, err := NewRemoteGaladrielServer("localhost:8080", Options{})
+	require.NoError(t, err)
+
+	remote := client.(*RemoteGaladrielServer)
+	assert.Equal(t, "http://localhost:8080", remote.baseURL.String())
+	assert.Equal(t, Options{
+		Timeout:        defaultTimeout,
+		MaxRetries:     defaultMaxRetries,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+	}, remote.options)
+
+	_, err = NewRemoteGaladrielServer("http://[::1", Options{})
+	assert.ErrorContains(t, err, "invalid galadriel server address")
+
+	client, err = NewRemoteGaladrielServer("localhost:8080", Options{TLSConfig: &tls.Config{}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://localhost:8080", client.(*RemoteGaladrielServer).baseURL.String())
+
+	_, err = NewRemoteGaladrielServer("http://localhost:8080", Options{TLSConfig: &tls.Config{}})
+	assert.EqualError(t, err, "galadriel server address must use https when tls is configured")
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []common.FederationRelationship{})
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	client, err := NewRemoteGaladrielServer(server.Listener.Addr().String(), Options{TLSConfig: &tls.Config{RootCAs: roots}})
+	require.NoError(t, err)
+
+	_, err = client.GetMemberships(context.Background(), td)
+	assert.NoError(t, err)
+
+	// The server certificate is not trusted
+	client, err = NewRemoteGaladrielServer(server.Listener.Addr().String(), Options{
+		MaxRetries: -1,
+		TLSConfig:  &tls.Config{RootCAs: x509.NewCertPool()},
+	})
+	require.NoError(t, err)
+
+	_, err = client.GetMemberships(context.Background(), td)
+	assert.ErrorContains(t, err, "certificate")
+}
@@ -2,15 +2,40 @@ package spire
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ErrFederatedBundleNotFound is returned when the SPIRE Server has no bundle
+// for the requested federated trust domain.
+var ErrFederatedBundleNotFound = errors.New("federated bundle not found")
+
+// listFederatedBundlesPageSize is the number of federated bundles requested
+// on every ListFederatedBundles call.
+const listFederatedBundlesPageSize = 100
+
 type BundleClient interface {
 	GetBundle(context.Context) (*spiffebundle.Bundle, error)
+	GetFederatedBundle(context.Context, spiffeid.TrustDomain) (*spiffebundle.Bundle, error)
+	ListFederatedBundles(context.Context) ([]*spiffebundle.Bundle, error)
+	SetFederatedBundles(context.Context, []*spiffebundle.Bundle) ([]BatchResult, error)
+	DeleteFederatedBundles(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error)
+}
+
+// BatchResult is the outcome of a batch operation for a single trust domain.
+type BatchResult struct {
+	TrustDomain spiffeid.TrustDomain
+	// Err is nil if the operation succeeded for the trust domain. Otherwise
+	// it is a gRPC status error with the code returned by the SPIRE Server.
+	Err error
 }
 
 func NewBundleClient(cc grpc.ClientConnInterface) BundleClient {
@@ -34,3 +59,114 @@ func (c bundleClient) GetBundle(ctx context.Context) (*spiffebundle.Bundle, erro
 
 	return spiffeBundle, nil
 }
+
+func (c bundleClient) GetFederatedBundle(ctx context.Context, td spiffeid.TrustDomain) (*spiffebundle.Bundle, error) {
+	bundle, err := c.client.GetFederatedBundle(ctx, &bundlev1.GetFederatedBundleRequest{TrustDomain: td.String()})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return nil, fmt.Errorf("%q: %w", td, ErrFederatedBundleNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("failed to get federated bundle from trust domain client: %v", err)
+	}
+
+	spiffeBundle, err := protoToBundle(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spire server federated bundle response: %v", err)
+	}
+
+	return spiffeBundle, nil
+}
+
+func (c bundleClient) ListFederatedBundles(ctx context.Context) ([]*spiffebundle.Bundle, error) {
+	var out []*spiffebundle.Bundle
+
+	req := &bundlev1.ListFederatedBundlesRequest{PageSize: listFederatedBundlesPageSize}
+	for {
+		resp, err := c.client.ListFederatedBundles(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list federated bundles from trust domain client: %v", err)
+		}
+
+		for _, bundle := range resp.Bundles {
+			spiffeBundle, err := protoToBundle(bundle)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse spire server federated bundle response: %v", err)
+			}
+			out = append(out, spiffeBundle)
+		}
+
+		if resp.NextPageToken == "" {
+			return out, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+func (c bundleClient) SetFederatedBundles(ctx context.Context, bundles []*spiffebundle.Bundle) ([]BatchResult, error) {
+	req := &bundlev1.BatchSetFederatedBundleRequest{}
+	for _, bundle := range bundles {
+		protoBundle, err := bundleToProto(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert federated bundle: %v", err)
+		}
+		req.Bundle = append(req.Bundle, protoBundle)
+	}
+
+	resp, err := c.client.BatchSetFederatedBundle(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch set federated bundles on trust domain client: %v", err)
+	}
+	if len(resp.Results) != len(bundles) {
+		return nil, fmt.Errorf("spire server returned %d results for %d federated bundles", len(resp.Results), len(bundles))
+	}
+
+	out := make([]BatchResult, 0, len(bundles))
+	for i, result := range resp.Results {
+		out = append(out, BatchResult{
+			TrustDomain: bundles[i].TrustDomain(),
+			Err:         statusToError(result.Status),
+		})
+	}
+
+	return out, nil
+}
+
+// DeleteFederatedBundles deletes the bundles of the given trust domains. The
+// bundle of a trust domain that registration entries federate with is not
+// deleted.
+func (c bundleClient) DeleteFederatedBundles(ctx context.Context, tds []spiffeid.TrustDomain) ([]BatchResult, error) {
+	req := &bundlev1.BatchDeleteFederatedBundleRequest{
+		Mode: bundlev1.BatchDeleteFederatedBundleRequest_RESTRICT,
+	}
+	for _, td := range tds {
+		req.TrustDomains = append(req.TrustDomains, td.String())
+	}
+
+	resp, err := c.client.BatchDeleteFederatedBundle(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch delete federated bundles on trust domain client: %v", err)
+	}
+	if len(resp.Results) != len(tds) {
+		return nil, fmt.Errorf("spire server returned %d results for %d federated bundles", len(resp.Results), len(tds))
+	}
+
+	out := make([]BatchResult, 0, len(tds))
+	for i, result := range resp.Results {
+		out = append(out, BatchResult{
+			TrustDomain: tds[i],
+			Err:         statusToError(result.Status),
+		})
+	}
+
+	return out, nil
+}
+
+// statusToError returns the error of a batch operation result status, or nil
+// if it succeeded. A missing status is treated as a success.
+func statusToError(s *types.Status) error {
+	if s == nil || codes.Code(s.Code) == codes.OK {
+		return nil
+	}
+
+	return status.Error(codes.Code(s.Code), s.Message)
+}
@@ -8,8 +8,12 @@ import (
 
 	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestNewBundleClientSuccess(t *testing.T) {
@@ -71,3 +75,167 @@ func TestClientGetBundle(t *testing.T) {
 		})
 	}
 }
+
+func TestClientGetFederatedBundle(t *testing.T) {
+	tests := []struct {
+		name        string
+		trustDomain string
+		expected    *spiffebundle.Bundle
+		clientErr   string
+		err         string
+		notFound    bool
+	}{
+		{
+			name:        "ok",
+			trustDomain: "example.org",
+			expected:    spiffebundle.New(spiffeid.RequireTrustDomainFromString("example.org")),
+		},
+		{
+			name:        "not_found",
+			trustDomain: "other.org",
+			err:         `"other.org": federated bundle not found`,
+			notFound:    true,
+		},
+		{
+			name:        "error_calling_client",
+			trustDomain: "example.org",
+			clientErr:   "error_from_client",
+			err:         "failed to get federated bundle from trust domain client: error_from_client",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spireBundleClient := &fakeSpireBundleClient{federatedBundles: []*types.Bundle{{TrustDomain: "example.org"}}}
+			if tt.clientErr != "" {
+				spireBundleClient.federatedBundlesErr = errors.New(tt.clientErr)
+			}
+			if tt.expected != nil {
+				tt.expected.SetX509Authorities([]*x509.Certificate{})
+			}
+
+			client := &bundleClient{client: spireBundleClient}
+
+			got, err := client.GetFederatedBundle(context.Background(), spiffeid.RequireTrustDomainFromString(tt.trustDomain))
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Equal(t, tt.notFound, errors.Is(err, ErrFederatedBundleNotFound))
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClientListFederatedBundles(t *testing.T) {
+	spireBundleClient := &fakeSpireBundleClient{
+		federatedBundles: []*types.Bundle{{TrustDomain: "td1.org"}, {TrustDomain: "td2.org"}, {TrustDomain: "td3.org"}},
+		listPageSize:     2,
+	}
+	client := &bundleClient{client: spireBundleClient}
+
+	got, err := client.ListFederatedBundles(context.Background())
+	require.NoError(t, err)
+
+	var trustDomains []string
+	for _, bundle := range got {
+		trustDomains = append(trustDomains, bundle.TrustDomain().String())
+	}
+	assert.Equal(t, []string{"td1.org", "td2.org", "td3.org"}, trustDomains)
+
+	spireBundleClient.federatedBundles = []*types.Bundle{{}}
+	_, err = client.ListFederatedBundles(context.Background())
+	assert.EqualError(t, err, "failed to parse spire server federated bundle response: failed to parse trust domain: trust domain is missing")
+
+	spireBundleClient.federatedBundlesErr = errors.New("error_from_client")
+	_, err = client.ListFederatedBundles(context.Background())
+	assert.EqualError(t, err, "failed to list federated bundles from trust domain client: error_from_client")
+}
+
+func TestClientSetFederatedBundles(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	bundle := spiffebundle.New(td)
+	bundle.SetSequenceNumber(2)
+
+	tests := []struct {
+		name        string
+		results     []*bundlev1.BatchSetFederatedBundleResponse_Result
+		batchSetErr string
+		expected    []BatchResult
+		err         string
+	}{
+		{
+			name:     "ok",
+			results:  []*bundlev1.BatchSetFederatedBundleResponse_Result{{Status: &types.Status{}}},
+			expected: []BatchResult{{TrustDomain: td}},
+		},
+		{
+			name:     "error_setting_bundle",
+			results:  []*bundlev1.BatchSetFederatedBundleResponse_Result{{Status: &types.Status{Code: int32(codes.InvalidArgument), Message: "bad bundle"}}},
+			expected: []BatchResult{{TrustDomain: td, Err: status.Error(codes.InvalidArgument, "bad bundle")}},
+		},
+		{
+			name:        "error_calling_client",
+			batchSetErr: "error_from_client",
+			err:         "failed to batch set federated bundles on trust domain client: error_from_client",
+		},
+		{
+			name: "missing_results",
+			err:  "spire server returned 0 results for 1 federated bundles",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spireBundleClient := &fakeSpireBundleClient{batchSetResults: tt.results}
+			if tt.batchSetErr != "" {
+				spireBundleClient.batchSetErr = errors.New(tt.batchSetErr)
+			}
+
+			client := &bundleClient{client: spireBundleClient}
+
+			got, err := client.SetFederatedBundles(context.Background(), []*spiffebundle.Bundle{bundle})
+			require.NotNil(t, spireBundleClient.batchSetRequest)
+			assert.Equal(t, []*types.Bundle{{TrustDomain: "example.org", SequenceNumber: 2}}, spireBundleClient.batchSetRequest.Bundle)
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClientDeleteFederatedBundles(t *testing.T) {
+	td1 := spiffeid.RequireTrustDomainFromString("td1.org")
+	td2 := spiffeid.RequireTrustDomainFromString("td2.org")
+
+	spireBundleClient := &fakeSpireBundleClient{batchDeleteResults: []*bundlev1.BatchDeleteFederatedBundleResponse_Result{
+		{Status: &types.Status{}, TrustDomain: "td1.org"},
+		{Status: &types.Status{Code: int32(codes.FailedPrecondition), Message: "in use"}, TrustDomain: "td2.org"},
+	}}
+	client := &bundleClient{client: spireBundleClient}
+
+	got, err := client.DeleteFederatedBundles(context.Background(), []spiffeid.TrustDomain{td1, td2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"td1.org", "td2.org"}, spireBundleClient.batchDeleteRequest.TrustDomains)
+	assert.Equal(t, bundlev1.BatchDeleteFederatedBundleRequest_RESTRICT, spireBundleClient.batchDeleteRequest.Mode)
+	assert.Equal(t, []BatchResult{
+		{TrustDomain: td1},
+		{TrustDomain: td2, Err: status.Error(codes.FailedPrecondition, "in use")},
+	}, got)
+
+	spireBundleClient.batchDeleteErr = errors.New("error_from_client")
+	_, err = client.DeleteFederatedBundles(context.Background(), []spiffeid.TrustDomain{td1})
+	assert.EqualError(t, err, "failed to batch delete federated bundles on trust domain client: error_from_client")
+}
@@ -3,11 +3,20 @@ package spire
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	trustdomainv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/trustdomain/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type fakeClientConn struct{}
@@ -22,6 +31,18 @@ func (fakeClientConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, meth
 type fakeSpireBundleClient struct {
 	bundle       *types.Bundle
 	getBundleErr error
+
+	federatedBundles    []*types.Bundle
+	listPageSize        int
+	federatedBundlesErr error
+
+	batchSetRequest *bundlev1.BatchSetFederatedBundleRequest
+	batchSetResults []*bundlev1.BatchSetFederatedBundleResponse_Result
+	batchSetErr     error
+
+	batchDeleteRequest *bundlev1.BatchDeleteFederatedBundleRequest
+	batchDeleteResults []*bundlev1.BatchDeleteFederatedBundleResponse_Result
+	batchDeleteErr     error
 }
 
 func (c fakeSpireBundleClient) GetBundle(ctx context.Context, in *bundlev1.GetBundleRequest, opts ...grpc.CallOption) (*types.Bundle, error) {
@@ -44,12 +65,40 @@ func (c fakeSpireBundleClient) PublishJWTAuthority(ctx context.Context, in *bund
 	return nil, errors.New("not implemented")
 }
 
+// ListFederatedBundles returns listPageSize federated bundles per page, using
+// the index of the next bundle as page token.
 func (c fakeSpireBundleClient) ListFederatedBundles(ctx context.Context, in *bundlev1.ListFederatedBundlesRequest, opts ...grpc.CallOption) (*bundlev1.ListFederatedBundlesResponse, error) {
-	return nil, errors.New("not implemented")
+	if c.federatedBundlesErr != nil {
+		return nil, c.federatedBundlesErr
+	}
+
+	start := 0
+	if in.PageToken != "" {
+		start, _ = strconv.Atoi(in.PageToken)
+	}
+	end := start + c.listPageSize
+	if end >= len(c.federatedBundles) {
+		return &bundlev1.ListFederatedBundlesResponse{Bundles: c.federatedBundles[start:]}, nil
+	}
+
+	return &bundlev1.ListFederatedBundlesResponse{
+		Bundles:       c.federatedBundles[start:end],
+		NextPageToken: strconv.Itoa(end),
+	}, nil
 }
 
 func (c fakeSpireBundleClient) GetFederatedBundle(ctx context.Context, in *bundlev1.GetFederatedBundleRequest, opts ...grpc.CallOption) (*types.Bundle, error) {
-	return nil, errors.New("not implemented")
+	if c.federatedBundlesErr != nil {
+		return nil, c.federatedBundlesErr
+	}
+
+	for _, bundle := range c.federatedBundles {
+		if bundle.TrustDomain == in.TrustDomain {
+			return bundle, nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "bundle not found")
 }
 
 func (c fakeSpireBundleClient) BatchCreateFederatedBundle(ctx context.Context, in *bundlev1.BatchCreateFederatedBundleRequest, opts ...grpc.CallOption) (*bundlev1.BatchCreateFederatedBundleResponse, error) {
@@ -60,17 +109,129 @@ func (c fakeSpireBundleClient) BatchUpdateFederatedBundle(ctx context.Context, i
 	return nil, errors.New("not implemented")
 }
 
-func (c fakeSpireBundleClient) BatchSetFederatedBundle(ctx context.Context, in *bundlev1.BatchSetFederatedBundleRequest, opts ...grpc.CallOption) (*bundlev1.BatchSetFederatedBundleResponse, error) {
-	return nil, errors.New("not implemented")
+func (c *fakeSpireBundleClient) BatchSetFederatedBundle(ctx context.Context, in *bundlev1.BatchSetFederatedBundleRequest, opts ...grpc.CallOption) (*bundlev1.BatchSetFederatedBundleResponse, error) {
+	c.batchSetRequest = in
+	if c.batchSetErr != nil {
+		return nil, c.batchSetErr
+	}
+
+	return &bundlev1.BatchSetFederatedBundleResponse{Results: c.batchSetResults}, nil
+}
+
+func (c *fakeSpireBundleClient) BatchDeleteFederatedBundle(ctx context.Context, in *bundlev1.BatchDeleteFederatedBundleRequest, opts ...grpc.CallOption) (*bundlev1.BatchDeleteFederatedBundleResponse, error) {
+	c.batchDeleteRequest = in
+	if c.batchDeleteErr != nil {
+		return nil, c.batchDeleteErr
+	}
+
+	return &bundlev1.BatchDeleteFederatedBundleResponse{Results: c.batchDeleteResults}, nil
+}
+
+type fakeSpireTrustDomainClient struct {
+	relationships    []*types.FederationRelationship
+	listPageSize     int
+	relationshipsErr error
+
+	batchCreateRequest *trustdomainv1.BatchCreateFederationRelationshipRequest
+	batchUpdateRequest *trustdomainv1.BatchUpdateFederationRelationshipRequest
+	batchDeleteRequest *trustdomainv1.BatchDeleteFederationRelationshipRequest
+	batchStatuses      []*types.Status
+	batchErr           error
+}
+
+// ListFederationRelationships returns listPageSize relationships per page,
+// using the index of the next relationship as page token.
+func (c fakeSpireTrustDomainClient) ListFederationRelationships(ctx context.Context, in *trustdomainv1.ListFederationRelationshipsRequest, opts ...grpc.CallOption) (*trustdomainv1.ListFederationRelationshipsResponse, error) {
+	if c.relationshipsErr != nil {
+		return nil, c.relationshipsErr
+	}
+
+	start := 0
+	if in.PageToken != "" {
+		start, _ = strconv.Atoi(in.PageToken)
+	}
+	end := start + c.listPageSize
+	if end >= len(c.relationships) {
+		return &trustdomainv1.ListFederationRelationshipsResponse{FederationRelationships: c.relationships[start:]}, nil
+	}
+
+	return &trustdomainv1.ListFederationRelationshipsResponse{
+		FederationRelationships: c.relationships[start:end],
+		NextPageToken:           strconv.Itoa(end),
+	}, nil
+}
+
+func (c fakeSpireTrustDomainClient) GetFederationRelationship(ctx context.Context, in *trustdomainv1.GetFederationRelationshipRequest, opts ...grpc.CallOption) (*types.FederationRelationship, error) {
+	if c.relationshipsErr != nil {
+		return nil, c.relationshipsErr
+	}
+
+	for _, relationship := range c.relationships {
+		if relationship.TrustDomain == in.TrustDomain {
+			return relationship, nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "federation relationship does not exist")
+}
+
+func (c *fakeSpireTrustDomainClient) BatchCreateFederationRelationship(ctx context.Context, in *trustdomainv1.BatchCreateFederationRelationshipRequest, opts ...grpc.CallOption) (*trustdomainv1.BatchCreateFederationRelationshipResponse, error) {
+	c.batchCreateRequest = in
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	resp := &trustdomainv1.BatchCreateFederationRelationshipResponse{}
+	for _, s := range c.batchStatuses {
+		resp.Results = append(resp.Results, &trustdomainv1.BatchCreateFederationRelationshipResponse_Result{Status: s})
+	}
+
+	return resp, nil
+}
+
+func (c *fakeSpireTrustDomainClient) BatchUpdateFederationRelationship(ctx context.Context, in *trustdomainv1.BatchUpdateFederationRelationshipRequest, opts ...grpc.CallOption) (*trustdomainv1.BatchUpdateFederationRelationshipResponse, error) {
+	c.batchUpdateRequest = in
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	resp := &trustdomainv1.BatchUpdateFederationRelationshipResponse{}
+	for _, s := range c.batchStatuses {
+		resp.Results = append(resp.Results, &trustdomainv1.BatchUpdateFederationRelationshipResponse_Result{Status: s})
+	}
+
+	return resp, nil
 }
 
-func (c fakeSpireBundleClient) BatchDeleteFederatedBundle(ctx context.Context, in *bundlev1.BatchDeleteFederatedBundleRequest, opts ...grpc.CallOption) (*bundlev1.BatchDeleteFederatedBundleResponse, error) {
+func (c *fakeSpireTrustDomainClient) BatchDeleteFederationRelationship(ctx context.Context, in *trustdomainv1.BatchDeleteFederationRelationshipRequest, opts ...grpc.CallOption) (*trustdomainv1.BatchDeleteFederationRelationshipResponse, error) {
+	c.batchDeleteRequest = in
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	resp := &trustdomainv1.BatchDeleteFederationRelationshipResponse{}
+	for _, s := range c.batchStatuses {
+		resp.Results = append(resp.Results, &trustdomainv1.BatchDeleteFederationRelationshipResponse_Result{Status: s})
+	}
+
+	return resp, nil
+}
+
+func (c fakeSpireTrustDomainClient) RefreshBundle(ctx context.Context, in *trustdomainv1.RefreshBundleRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	return nil, errors.New("not implemented")
 }
 
 type fakeInternalClient struct {
 	bundle       *spiffebundle.Bundle
 	getBundleErr error
+	results      []BatchResult
+	batchErr     error
+
+	relationship    *FederationRelationship
+	relationshipErr error
+
+	svid    *x509svid.SVID
+	svidErr error
 }
 
 func (c fakeInternalClient) GetBundle(context.Context) (*spiffebundle.Bundle, error) {
@@ -80,3 +241,114 @@ func (c fakeInternalClient) GetBundle(context.Context) (*spiffebundle.Bundle, er
 
 	return c.bundle, nil
 }
+
+func (c fakeInternalClient) GetFederatedBundle(context.Context, spiffeid.TrustDomain) (*spiffebundle.Bundle, error) {
+	if c.getBundleErr != nil {
+		return nil, c.getBundleErr
+	}
+
+	return c.bundle, nil
+}
+
+func (c fakeInternalClient) ListFederatedBundles(context.Context) ([]*spiffebundle.Bundle, error) {
+	if c.getBundleErr != nil {
+		return nil, c.getBundleErr
+	}
+
+	return []*spiffebundle.Bundle{c.bundle}, nil
+}
+
+func (c fakeInternalClient) SetFederatedBundles(context.Context, []*spiffebundle.Bundle) ([]BatchResult, error) {
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	return c.results, nil
+}
+
+func (c fakeInternalClient) DeleteFederatedBundles(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error) {
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	return c.results, nil
+}
+
+func (c fakeInternalClient) GetFederationRelationship(context.Context, spiffeid.TrustDomain) (*FederationRelationship, error) {
+	if c.relationshipErr != nil {
+		return nil, c.relationshipErr
+	}
+
+	return c.relationship, nil
+}
+
+func (c fakeInternalClient) ListFederationRelationships(context.Context) ([]*FederationRelationship, error) {
+	if c.relationshipErr != nil {
+		return nil, c.relationshipErr
+	}
+
+	return []*FederationRelationship{c.relationship}, nil
+}
+
+func (c fakeInternalClient) CreateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error) {
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	return c.results, nil
+}
+
+func (c fakeInternalClient) UpdateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error) {
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	return c.results, nil
+}
+
+func (c fakeInternalClient) DeleteFederationRelationships(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error) {
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
+
+	return c.results, nil
+}
+
+func (c fakeInternalClient) MintX509SVID(context.Context, spiffeid.ID, time.Duration) (*x509svid.SVID, error) {
+	if c.svidErr != nil {
+		return nil, c.svidErr
+	}
+
+	return c.svid, nil
+}
+
+type fakeSpireSVIDClient struct {
+	mintRequest *svidv1.MintX509SVIDRequest
+	certChain   [][]byte
+	mintErr     error
+}
+
+func (c *fakeSpireSVIDClient) MintX509SVID(ctx context.Context, in *svidv1.MintX509SVIDRequest, opts ...grpc.CallOption) (*svidv1.MintX509SVIDResponse, error) {
+	c.mintRequest = in
+	if c.mintErr != nil {
+		return nil, c.mintErr
+	}
+
+	return &svidv1.MintX509SVIDResponse{Svid: &types.X509SVID{CertChain: c.certChain}}, nil
+}
+
+func (c *fakeSpireSVIDClient) MintJWTSVID(ctx context.Context, in *svidv1.MintJWTSVIDRequest, opts ...grpc.CallOption) (*svidv1.MintJWTSVIDResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeSpireSVIDClient) BatchNewX509SVID(ctx context.Context, in *svidv1.BatchNewX509SVIDRequest, opts ...grpc.CallOption) (*svidv1.BatchNewX509SVIDResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeSpireSVIDClient) NewJWTSVID(ctx context.Context, in *svidv1.NewJWTSVIDRequest, opts ...grpc.CallOption) (*svidv1.NewJWTSVIDResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeSpireSVIDClient) NewDownstreamX509CA(ctx context.Context, in *svidv1.NewDownstreamX509CARequest, opts ...grpc.CallOption) (*svidv1.NewDownstreamX509CAResponse, error) {
+	return nil, errors.New("not implemented")
+}
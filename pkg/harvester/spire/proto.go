@@ -73,3 +73,127 @@ func protoToJWTAuthorities(in []*apitypes.JWTKey) (map[string]crypto.PublicKey,
 
 	return out, nil
 }
+
+func bundleToProto(in *spiffebundle.Bundle) (*apitypes.Bundle, error) {
+	if in == nil {
+		return nil, fmt.Errorf("bundle is empty")
+	}
+
+	jwtAuthorities, err := jwtAuthoritiesToProto(in.JWTAuthorities())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal jwt authorities: %v", err)
+	}
+
+	out := &apitypes.Bundle{
+		TrustDomain:     in.TrustDomain().String(),
+		X509Authorities: x509CertificatesToProto(in.X509Authorities()),
+		JwtAuthorities:  jwtAuthorities,
+	}
+
+	if refreshHint, ok := in.RefreshHint(); ok {
+		out.RefreshHint = int64(refreshHint / time.Second)
+	}
+	if sequenceNumber, ok := in.SequenceNumber(); ok {
+		out.SequenceNumber = sequenceNumber
+	}
+
+	return out, nil
+}
+
+func x509CertificatesToProto(in []*x509.Certificate) []*apitypes.X509Certificate {
+	var out []*apitypes.X509Certificate
+
+	for _, cert := range in {
+		out = append(out, &apitypes.X509Certificate{Asn1: cert.Raw})
+	}
+
+	return out
+}
+
+func jwtAuthoritiesToProto(in map[string]crypto.PublicKey) ([]*apitypes.JWTKey, error) {
+	var out []*apitypes.JWTKey
+
+	for keyID, pub := range in {
+		pkix, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal public key id %s: %v", keyID, err)
+		}
+		out = append(out, &apitypes.JWTKey{KeyId: keyID, PublicKey: pkix})
+	}
+
+	return out, nil
+}
+
+func protoToFederationRelationship(in *apitypes.FederationRelationship) (*FederationRelationship, error) {
+	if in == nil {
+		return nil, fmt.Errorf("federation relationship is empty")
+	}
+
+	td, err := spiffeid.TrustDomainFromString(in.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trust domain: %v", err)
+	}
+
+	out := &FederationRelationship{
+		TrustDomain:       td,
+		BundleEndpointURL: in.BundleEndpointUrl,
+	}
+
+	switch profile := in.BundleEndpointProfile.(type) {
+	case *apitypes.FederationRelationship_HttpsWeb:
+		out.BundleEndpointProfile = HTTPSWebProfile
+	case *apitypes.FederationRelationship_HttpsSpiffe:
+		endpointSPIFFEID, err := spiffeid.FromString(profile.HttpsSpiffe.GetEndpointSpiffeId())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse endpoint spiffe id: %v", err)
+		}
+		out.BundleEndpointProfile = HTTPSSPIFFEProfile
+		out.EndpointSPIFFEID = endpointSPIFFEID
+	default:
+		return nil, fmt.Errorf("unsupported bundle endpoint profile %T", profile)
+	}
+
+	if in.TrustDomainBundle != nil {
+		bundle, err := protoToBundle(in.TrustDomainBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trust domain bundle: %v", err)
+		}
+		out.TrustDomainBundle = bundle
+	}
+
+	return out, nil
+}
+
+func federationRelationshipToProto(in *FederationRelationship) (*apitypes.FederationRelationship, error) {
+	if in == nil {
+		return nil, fmt.Errorf("federation relationship is empty")
+	}
+
+	out := &apitypes.FederationRelationship{
+		TrustDomain:       in.TrustDomain.String(),
+		BundleEndpointUrl: in.BundleEndpointURL,
+	}
+
+	switch in.BundleEndpointProfile {
+	case HTTPSWebProfile:
+		out.BundleEndpointProfile = &apitypes.FederationRelationship_HttpsWeb{
+			HttpsWeb: &apitypes.HTTPSWebProfile{},
+		}
+	case HTTPSSPIFFEProfile:
+		out.BundleEndpointProfile = &apitypes.FederationRelationship_HttpsSpiffe{
+			HttpsSpiffe: &apitypes.HTTPSSPIFFEProfile{EndpointSpiffeId: in.EndpointSPIFFEID.String()},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bundle endpoint profile %q", in.BundleEndpointProfile)
+	}
+
+	if in.TrustDomainBundle != nil {
+		bundle, err := bundleToProto(in.TrustDomainBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert trust domain bundle: %v", err)
+		}
+		out.TrustDomainBundle = bundle
+	}
+
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package spire
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleToProto(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	bundle := spiffebundle.New(spiffeid.RequireTrustDomainFromString("example.org"))
+	bundle.AddX509Authority(cert)
+	require.NoError(t, bundle.AddJWTAuthority("key-id", key.Public()))
+	bundle.SetRefreshHint(5 * time.Minute)
+	bundle.SetSequenceNumber(42)
+
+	proto, err := bundleToProto(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", proto.TrustDomain)
+	assert.Equal(t, int64(300), proto.RefreshHint)
+	assert.Equal(t, uint64(42), proto.SequenceNumber)
+
+	got, err := protoToBundle(proto)
+	require.NoError(t, err)
+	assert.True(t, bundle.Equal(got))
+
+	_, err = bundleToProto(nil)
+	assert.EqualError(t, err, "bundle is empty")
+}
@@ -5,15 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
 	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type SpireServer interface {
 	GetBundle(context.Context) (*spiffebundle.Bundle, error)
+	GetFederatedBundle(context.Context, spiffeid.TrustDomain) (*spiffebundle.Bundle, error)
+	ListFederatedBundles(context.Context) ([]*spiffebundle.Bundle, error)
+	SetFederatedBundles(context.Context, []*spiffebundle.Bundle) ([]BatchResult, error)
+	DeleteFederatedBundles(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error)
+
+	GetFederationRelationship(context.Context, spiffeid.TrustDomain) (*FederationRelationship, error)
+	ListFederationRelationships(context.Context) ([]*FederationRelationship, error)
+	CreateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error)
+	UpdateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error)
+	DeleteFederationRelationships(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error)
+
+	MintX509SVID(context.Context, spiffeid.ID, time.Duration) (*x509svid.SVID, error)
 }
 
 type localSpireServer struct {
@@ -23,6 +41,8 @@ type localSpireServer struct {
 
 type client interface {
 	BundleClient
+	TrustDomainClient
+	SVIDClient
 }
 
 var dialFn = dialSocket
@@ -49,6 +69,96 @@ func (s *localSpireServer) GetBundle(ctx context.Context) (*spiffebundle.Bundle,
 	return bundle, nil
 }
 
+func (s *localSpireServer) GetFederatedBundle(ctx context.Context, td spiffeid.TrustDomain) (*spiffebundle.Bundle, error) {
+	bundle, err := s.client.GetFederatedBundle(ctx, td)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get federated bundle: %w", err)
+	}
+
+	return bundle, nil
+}
+
+func (s *localSpireServer) ListFederatedBundles(ctx context.Context) ([]*spiffebundle.Bundle, error) {
+	bundles, err := s.client.ListFederatedBundles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list federated bundles: %v", err)
+	}
+
+	return bundles, nil
+}
+
+func (s *localSpireServer) SetFederatedBundles(ctx context.Context, bundles []*spiffebundle.Bundle) ([]BatchResult, error) {
+	results, err := s.client.SetFederatedBundles(ctx, bundles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set federated bundles: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *localSpireServer) DeleteFederatedBundles(ctx context.Context, tds []spiffeid.TrustDomain) ([]BatchResult, error) {
+	results, err := s.client.DeleteFederatedBundles(ctx, tds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete federated bundles: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *localSpireServer) GetFederationRelationship(ctx context.Context, td spiffeid.TrustDomain) (*FederationRelationship, error) {
+	relationship, err := s.client.GetFederationRelationship(ctx, td)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get federation relationship: %w", err)
+	}
+
+	return relationship, nil
+}
+
+func (s *localSpireServer) ListFederationRelationships(ctx context.Context) ([]*FederationRelationship, error) {
+	relationships, err := s.client.ListFederationRelationships(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list federation relationships: %v", err)
+	}
+
+	return relationships, nil
+}
+
+func (s *localSpireServer) CreateFederationRelationships(ctx context.Context, relationships []*FederationRelationship) ([]BatchResult, error) {
+	results, err := s.client.CreateFederationRelationships(ctx, relationships)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create federation relationships: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *localSpireServer) UpdateFederationRelationships(ctx context.Context, relationships []*FederationRelationship) ([]BatchResult, error) {
+	results, err := s.client.UpdateFederationRelationships(ctx, relationships)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update federation relationships: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *localSpireServer) DeleteFederationRelationships(ctx context.Context, tds []spiffeid.TrustDomain) ([]BatchResult, error) {
+	results, err := s.client.DeleteFederationRelationships(ctx, tds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete federation relationships: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *localSpireServer) MintX509SVID(ctx context.Context, id spiffeid.ID, ttl time.Duration) (*x509svid.SVID, error) {
+	svid, err := s.client.MintX509SVID(ctx, id, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint X509-SVID: %v", err)
+	}
+
+	return svid, nil
+}
+
 type clientMaker func(*grpc.ClientConn) (client, error)
 
 func dialSocket(ctx context.Context, path string, makeClient clientMaker) (client, error) {
@@ -59,7 +169,9 @@ func dialSocket(ctx context.Context, path string, makeClient clientMaker) (clien
 	} else {
 		target = "unix:" + path
 	}
-	clientConn, err := grpcDialContext(ctx, target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	clientConn, err := grpcDialContext(ctx, target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor(), observeCall))
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial API socket: %v", err)
 	}
@@ -72,6 +184,15 @@ func dialSocket(ctx context.Context, path string, makeClient clientMaker) (clien
 	return client, nil
 }
 
+// observeCall records the latency of the calls to the SPIRE Server API.
+func observeCall(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	telemetry.RecordSpireAPICall(ctx, method, status.Code(err).String(), time.Since(start))
+
+	return err
+}
+
 func makeSpireClient(clientConn *grpc.ClientConn) (client, error) {
 	if clientConn == nil {
 		return nil, errors.New("grpc client connection is invalid")
@@ -79,7 +200,11 @@ func makeSpireClient(clientConn *grpc.ClientConn) (client, error) {
 
 	return struct {
 		BundleClient
+		TrustDomainClient
+		SVIDClient
 	}{
-		BundleClient: NewBundleClient(clientConn),
+		BundleClient:      NewBundleClient(clientConn),
+		TrustDomainClient: NewTrustDomainClient(clientConn),
+		SVIDClient:        NewSVIDClient(clientConn),
 	}, nil
 }
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/HewlettPackard/galadriel/pkg/common"
 	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestNewLocalSpireServerSuccess(t *testing.T) {
@@ -18,13 +20,9 @@ func TestNewLocalSpireServerSuccess(t *testing.T) {
 		return fakeInternalClient{}, nil
 	}
 	got := NewLocalSpireServer(context.Background(), "")
-	expected := &localSpireServer{
-		client: fakeInternalClient{},
-		logger: *common.NewLogger("local_spire_server"),
-	}
 
-	assert.NotNil(t, got)
-	assert.Equal(t, expected, got)
+	require.IsType(t, &localSpireServer{}, got)
+	assert.Equal(t, fakeInternalClient{}, got.(*localSpireServer).client)
 }
 
 func TestNewLocalSpireServerPanic(t *testing.T) {
@@ -50,6 +48,18 @@ func TestMakeSpireClient(t *testing.T) {
 	assert.EqualError(t, err, "grpc client connection is invalid")
 }
 
+func TestObserveCall(t *testing.T) {
+	var invoked string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked = method
+		return status.Error(codes.Unavailable, "spire server unavailable")
+	}
+
+	err := observeCall(context.Background(), "/spire.api.server.bundle.v1.Bundle/GetBundle", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "/spire.api.server.bundle.v1.Bundle/GetBundle", invoked)
+}
+
 func TestDialSocket(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -153,3 +163,98 @@ func TestLocalSpireGetBundle(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalSpireFederatedBundles(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	bundle := spiffebundle.New(td)
+	results := []BatchResult{{TrustDomain: td}}
+
+	spire := &localSpireServer{client: &fakeInternalClient{bundle: bundle, results: results}}
+
+	got, err := spire.GetFederatedBundle(context.Background(), td)
+	assert.NoError(t, err)
+	assert.Equal(t, bundle, got)
+
+	list, err := spire.ListFederatedBundles(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*spiffebundle.Bundle{bundle}, list)
+
+	gotResults, err := spire.SetFederatedBundles(context.Background(), []*spiffebundle.Bundle{bundle})
+	assert.NoError(t, err)
+	assert.Equal(t, results, gotResults)
+
+	gotResults, err = spire.DeleteFederatedBundles(context.Background(), []spiffeid.TrustDomain{td})
+	assert.NoError(t, err)
+	assert.Equal(t, results, gotResults)
+
+	spire = &localSpireServer{client: &fakeInternalClient{
+		getBundleErr: fmt.Errorf("%q: %w", td, ErrFederatedBundleNotFound),
+		batchErr:     errors.New("error_from_client"),
+	}}
+
+	_, err = spire.GetFederatedBundle(context.Background(), td)
+	assert.EqualError(t, err, `failed to get federated bundle: "example.org": federated bundle not found`)
+	assert.ErrorIs(t, err, ErrFederatedBundleNotFound)
+
+	_, err = spire.ListFederatedBundles(context.Background())
+	assert.EqualError(t, err, `failed to list federated bundles: "example.org": federated bundle not found`)
+
+	_, err = spire.SetFederatedBundles(context.Background(), []*spiffebundle.Bundle{bundle})
+	assert.EqualError(t, err, "failed to set federated bundles: error_from_client")
+
+	_, err = spire.DeleteFederatedBundles(context.Background(), []spiffeid.TrustDomain{td})
+	assert.EqualError(t, err, "failed to delete federated bundles: error_from_client")
+}
+
+func TestLocalSpireFederationRelationships(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	relationship := &FederationRelationship{
+		TrustDomain:           td,
+		BundleEndpointURL:     "https://example.org/bundle",
+		BundleEndpointProfile: HTTPSWebProfile,
+	}
+	results := []BatchResult{{TrustDomain: td}}
+
+	spire := &localSpireServer{client: &fakeInternalClient{relationship: relationship, results: results}}
+
+	got, err := spire.GetFederationRelationship(context.Background(), td)
+	assert.NoError(t, err)
+	assert.Equal(t, relationship, got)
+
+	list, err := spire.ListFederationRelationships(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*FederationRelationship{relationship}, list)
+
+	gotResults, err := spire.CreateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	assert.NoError(t, err)
+	assert.Equal(t, results, gotResults)
+
+	gotResults, err = spire.UpdateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	assert.NoError(t, err)
+	assert.Equal(t, results, gotResults)
+
+	gotResults, err = spire.DeleteFederationRelationships(context.Background(), []spiffeid.TrustDomain{td})
+	assert.NoError(t, err)
+	assert.Equal(t, results, gotResults)
+
+	spire = &localSpireServer{client: &fakeInternalClient{
+		relationshipErr: fmt.Errorf("%q: %w", td, ErrFederationRelationshipNotFound),
+		batchErr:        errors.New("error_from_client"),
+	}}
+
+	_, err = spire.GetFederationRelationship(context.Background(), td)
+	assert.EqualError(t, err, `failed to get federation relationship: "example.org": federation relationship not found`)
+	assert.ErrorIs(t, err, ErrFederationRelationshipNotFound)
+
+	_, err = spire.ListFederationRelationships(context.Background())
+	assert.EqualError(t, err, `failed to list federation relationships: "example.org": federation relationship not found`)
+
+	_, err = spire.CreateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	assert.EqualError(t, err, "failed to create federation relationships: error_from_client")
+
+	_, err = spire.UpdateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	assert.EqualError(t, err, "failed to update federation relationships: error_from_client")
+
+	_, err = spire.DeleteFederationRelationships(context.Background(), []spiffeid.TrustDomain{td})
+	assert.EqualError(t, err, "failed to delete federation relationships: error_from_client")
+}
@@ -0,0 +1,75 @@
+package spire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	"google.golang.org/grpc"
+)
+
+type SVIDClient interface {
+	// MintX509SVID returns an X509-SVID with the given SPIFFE ID, signed by
+	// the SPIRE Server for a new private key. The SPIRE Server default TTL
+	// is used if ttl is zero.
+	MintX509SVID(ctx context.Context, id spiffeid.ID, ttl time.Duration) (*x509svid.SVID, error)
+}
+
+func NewSVIDClient(cc grpc.ClientConnInterface) SVIDClient {
+	return svidClient{client: svidv1.NewSVIDClient(cc)}
+}
+
+type svidClient struct {
+	client svidv1.SVIDClient
+}
+
+func (c svidClient) MintX509SVID(ctx context.Context, id spiffeid.ID, ttl time.Duration) (*x509svid.SVID, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		URIs: []*url.URL{id.URL()},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate signing request: %v", err)
+	}
+
+	resp, err := c.client.MintX509SVID(ctx, &svidv1.MintX509SVIDRequest{
+		Csr: csr,
+		Ttl: int32(ttl / time.Second),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint X509-SVID from svid client: %v", err)
+	}
+
+	certChain := resp.GetSvid().GetCertChain()
+	if len(certChain) == 0 {
+		return nil, errors.New("svid client returned an empty certificate chain")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(certChain))
+	for _, der := range certChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse X509-SVID certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return &x509svid.SVID{
+		ID:           id,
+		Certificates: certs,
+		PrivateKey:   key,
+	}, nil
+}
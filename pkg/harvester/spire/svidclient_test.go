@@ -0,0 +1,104 @@
+package spire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var harvesterID = spiffeid.RequireFromString("spiffe://example.org/galadriel/harvester")
+
+// newSVIDCertificate returns a self-signed certificate with the given SPIFFE
+// ID, valid for the given lifetime.
+func newSVIDCertificate(t *testing.T, id spiffeid.ID, lifetime time.Duration) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		URIs:         []*url.URL{id.URL()},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(lifetime),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func TestNewSVIDClientSuccess(t *testing.T) {
+	got := NewSVIDClient(fakeClientConn{})
+
+	assert.NotNil(t, got)
+	assert.IsType(t, svidClient{}, got)
+}
+
+func TestClientMintX509SVID(t *testing.T) {
+	cert := newSVIDCertificate(t, harvesterID, time.Hour)
+
+	tests := []struct {
+		name      string
+		certChain [][]byte
+		clientErr error
+		err       string
+	}{
+		{
+			name:      "success",
+			certChain: [][]byte{cert.Raw},
+		},
+		{
+			name:      "error_calling_client",
+			clientErr: errors.New("error_from_client"),
+			err:       "failed to mint X509-SVID from svid client: error_from_client",
+		},
+		{
+			name: "empty_certificate_chain",
+			err:  "svid client returned an empty certificate chain",
+		},
+		{
+			name:      "invalid_certificate",
+			certChain: [][]byte{[]byte("not a certificate")},
+			err:       "failed to parse X509-SVID certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spireSVIDClient := &fakeSpireSVIDClient{certChain: tt.certChain, mintErr: tt.clientErr}
+			client := svidClient{client: spireSVIDClient}
+
+			svid, err := client.MintX509SVID(context.Background(), harvesterID, time.Minute)
+
+			require.NotNil(t, spireSVIDClient.mintRequest)
+			assert.Equal(t, int32(60), spireSVIDClient.mintRequest.Ttl)
+			csr, csrErr := x509.ParseCertificateRequest(spireSVIDClient.mintRequest.Csr)
+			require.NoError(t, csrErr)
+			require.Len(t, csr.URIs, 1)
+			assert.Equal(t, harvesterID.String(), csr.URIs[0].String())
+
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, harvesterID, svid.ID)
+			assert.Equal(t, []*x509.Certificate{cert}, svid.Certificates)
+			assert.Equal(t, csr.PublicKey, svid.PrivateKey.Public())
+		})
+	}
+}
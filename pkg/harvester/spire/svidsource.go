@@ -0,0 +1,162 @@
+package spire
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+const (
+	// minSVIDRenewalInterval bounds how often the X509-SVID is minted when
+	// the SPIRE Server returns short-lived SVIDs, or fails to mint them.
+	minSVIDRenewalInterval = 5 * time.Second
+)
+
+// errNoX509SVID is returned by the source until its first X509-SVID is minted.
+var errNoX509SVID = errors.New("no X509-SVID minted yet")
+
+// X509SVIDSource provides an X509-SVID minted by the SPIRE Server, and renews
+// it when half of its lifetime has passed.
+type X509SVIDSource struct {
+	server SpireServer
+	path   string
+	ttl    time.Duration
+	logger common.Logger
+
+	// id is the SPIFFE ID of the X509-SVIDs, in the trust domain of the
+	// SPIRE Server. It is only set and read by Run.
+	id spiffeid.ID
+
+	mtx  sync.RWMutex
+	svid *x509svid.SVID
+	cert *tls.Certificate
+}
+
+// NewX509SVIDSource returns a source of X509-SVIDs with the SPIFFE ID of the
+// given path in the trust domain of the SPIRE Server. The SPIRE Server is not
+// contacted until the source runs.
+func NewX509SVIDSource(server SpireServer, path string, ttl time.Duration) *X509SVIDSource {
+	return &X509SVIDSource{
+		server: server,
+		path:   path,
+		ttl:    ttl,
+		logger: *common.NewLogger(telemetry.X509SVIDSource),
+	}
+}
+
+// Run mints the first X509-SVID, failing if it can not so that it is retried,
+// and then renews it until the context is done.
+func (s *X509SVIDSource) Run(ctx context.Context) error {
+	if _, err := s.GetX509SVID(); err != nil {
+		if err := s.renew(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+
+	timer := time.NewTimer(s.renewalInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if err := s.renew(ctx); err != nil {
+				s.logger.Error(err)
+			}
+			timer.Reset(s.renewalInterval())
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// GetX509SVID returns the current X509-SVID.
+func (s *X509SVIDSource) GetX509SVID() (*x509svid.SVID, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.svid == nil {
+		return nil, errNoX509SVID
+	}
+
+	return s.svid, nil
+}
+
+// GetClientCertificate returns the current X509-SVID as the client
+// certificate of a TLS connection. It implements the GetClientCertificate
+// callback of tls.Config. No client certificate is presented until the first
+// X509-SVID is minted, e.g. when onboarding with a join token on start.
+func (s *X509SVIDSource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return s.cert, nil
+}
+
+func (s *X509SVIDSource) renew(ctx context.Context) error {
+	if s.id.IsZero() {
+		bundle, err := s.server.GetBundle(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := spiffeid.FromPath(bundle.TrustDomain(), s.path)
+		if err != nil {
+			return fmt.Errorf("invalid X509-SVID SPIFFE ID: %v", err)
+		}
+		s.id = id
+	}
+
+	svid, err := s.server.MintX509SVID(ctx, s.id, s.ttl)
+	if err != nil {
+		return err
+	}
+	if len(svid.Certificates) == 0 {
+		return errors.New("minted X509-SVID has no certificates")
+	}
+
+	cert := &tls.Certificate{
+		PrivateKey: svid.PrivateKey,
+		Leaf:       svid.Certificates[0],
+	}
+	for _, c := range svid.Certificates {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	s.mtx.Lock()
+	s.svid = svid
+	s.cert = cert
+	s.mtx.Unlock()
+
+	s.logger.Debug("Minted X509-SVID", s.id, "expiring at", svid.Certificates[0].NotAfter)
+
+	return nil
+}
+
+// renewalInterval returns the time until half of the lifetime of the current
+// X509-SVID has passed.
+func (s *X509SVIDSource) renewalInterval() time.Duration {
+	s.mtx.RLock()
+	leaf := s.svid.Certificates[0]
+	s.mtx.RUnlock()
+
+	interval := time.Until(leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2))
+	if interval < minSVIDRenewalInterval {
+		interval = minSVIDRenewalInterval
+	}
+
+	return interval
+}
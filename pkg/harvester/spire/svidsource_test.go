@@ -0,0 +1,66 @@
+package spire
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestX509SVIDSource(t *testing.T) {
+	cert := newSVIDCertificate(t, harvesterID, time.Hour)
+	svid := &x509svid.SVID{ID: harvesterID, Certificates: []*x509.Certificate{cert}}
+	bundle := spiffebundle.New(harvesterID.TrustDomain())
+
+	// The first X509-SVID is minted when the source runs, which fails so
+	// that the supervisor retries
+	source := NewX509SVIDSource(&localSpireServer{client: fakeInternalClient{getBundleErr: errors.New("spire is down")}}, harvesterID.Path(), time.Hour)
+	_, err := source.GetX509SVID()
+	assert.EqualError(t, err, "no X509-SVID minted yet")
+	tlsCert, err := source.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Empty(t, tlsCert.Certificate)
+	assert.EqualError(t, source.Run(context.Background()), "failed to get bundle: spire is down")
+
+	source = NewX509SVIDSource(&localSpireServer{client: fakeInternalClient{bundle: bundle, svidErr: errors.New("error_from_client")}}, harvesterID.Path(), time.Hour)
+	assert.EqualError(t, source.Run(context.Background()), "failed to mint X509-SVID: error_from_client")
+
+	source = NewX509SVIDSource(&localSpireServer{client: fakeInternalClient{bundle: bundle, svid: &x509svid.SVID{ID: harvesterID}}}, harvesterID.Path(), time.Hour)
+	assert.EqualError(t, source.Run(context.Background()), "minted X509-SVID has no certificates")
+
+	source = NewX509SVIDSource(&localSpireServer{client: fakeInternalClient{bundle: bundle, svid: svid}}, harvesterID.Path(), time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() {
+		errch <- source.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		_, err := source.GetX509SVID()
+		return err == nil
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-errch)
+	assert.Equal(t, harvesterID, source.id)
+
+	got, err := source.GetX509SVID()
+	require.NoError(t, err)
+	assert.Equal(t, svid, got)
+
+	tlsCert, err = source.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{cert.Raw}, tlsCert.Certificate)
+	assert.Equal(t, cert, tlsCert.Leaf)
+
+	// The SVID is renewed at half of its lifetime
+	assert.InDelta(t, 30*time.Minute, source.renewalInterval(), float64(time.Minute))
+
+	// Short-lived SVIDs are not renewed continuously
+	source.svid = &x509svid.SVID{Certificates: []*x509.Certificate{newSVIDCertificate(t, harvesterID, time.Second)}}
+	assert.Equal(t, minSVIDRenewalInterval, source.renewalInterval())
+}
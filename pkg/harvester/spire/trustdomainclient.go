@@ -0,0 +1,212 @@
+package spire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	trustdomainv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/trustdomain/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrFederationRelationshipNotFound is returned when the SPIRE Server has no
+// federation relationship with the requested trust domain.
+var ErrFederationRelationshipNotFound = errors.New("federation relationship not found")
+
+// listFederationRelationshipsPageSize is the number of federation
+// relationships requested on every ListFederationRelationships call.
+const listFederationRelationshipsPageSize = 100
+
+// BundleEndpointProfile is the profile of the SPIFFE bundle endpoint of a
+// federated trust domain.
+type BundleEndpointProfile string
+
+const (
+	HTTPSWebProfile    BundleEndpointProfile = "https_web"
+	HTTPSSPIFFEProfile BundleEndpointProfile = "https_spiffe"
+)
+
+// FederationRelationship is a federation relationship of the SPIRE Server
+// with another trust domain, whose bundle is fetched from the bundle endpoint.
+type FederationRelationship struct {
+	TrustDomain           spiffeid.TrustDomain
+	BundleEndpointURL     string
+	BundleEndpointProfile BundleEndpointProfile
+	// EndpointSPIFFEID is the SPIFFE ID of the bundle endpoint server. Only
+	// used by the https_spiffe profile.
+	EndpointSPIFFEID spiffeid.ID
+	// TrustDomainBundle is optional. When set, it is the initial bundle of
+	// the federated trust domain.
+	TrustDomainBundle *spiffebundle.Bundle
+}
+
+type TrustDomainClient interface {
+	GetFederationRelationship(context.Context, spiffeid.TrustDomain) (*FederationRelationship, error)
+	ListFederationRelationships(context.Context) ([]*FederationRelationship, error)
+	CreateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error)
+	UpdateFederationRelationships(context.Context, []*FederationRelationship) ([]BatchResult, error)
+	DeleteFederationRelationships(context.Context, []spiffeid.TrustDomain) ([]BatchResult, error)
+}
+
+func NewTrustDomainClient(cc grpc.ClientConnInterface) TrustDomainClient {
+	return trustDomainClient{client: trustdomainv1.NewTrustDomainClient(cc)}
+}
+
+type trustDomainClient struct {
+	client trustdomainv1.TrustDomainClient
+}
+
+func (c trustDomainClient) GetFederationRelationship(ctx context.Context, td spiffeid.TrustDomain) (*FederationRelationship, error) {
+	relationship, err := c.client.GetFederationRelationship(ctx, &trustdomainv1.GetFederationRelationshipRequest{TrustDomain: td.String()})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		return nil, fmt.Errorf("%q: %w", td, ErrFederationRelationshipNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("failed to get federation relationship from trust domain client: %v", err)
+	}
+
+	out, err := protoToFederationRelationship(relationship)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spire server federation relationship response: %v", err)
+	}
+
+	return out, nil
+}
+
+func (c trustDomainClient) ListFederationRelationships(ctx context.Context) ([]*FederationRelationship, error) {
+	var out []*FederationRelationship
+
+	req := &trustdomainv1.ListFederationRelationshipsRequest{PageSize: listFederationRelationshipsPageSize}
+	for {
+		resp, err := c.client.ListFederationRelationships(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list federation relationships from trust domain client: %v", err)
+		}
+
+		for _, relationship := range resp.FederationRelationships {
+			r, err := protoToFederationRelationship(relationship)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse spire server federation relationship response: %v", err)
+			}
+			out = append(out, r)
+		}
+
+		if resp.NextPageToken == "" {
+			return out, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+func (c trustDomainClient) CreateFederationRelationships(ctx context.Context, relationships []*FederationRelationship) ([]BatchResult, error) {
+	protoRelationships, err := federationRelationshipsToProto(relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.BatchCreateFederationRelationship(ctx, &trustdomainv1.BatchCreateFederationRelationshipRequest{
+		FederationRelationships: protoRelationships,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch create federation relationships on trust domain client: %v", err)
+	}
+
+	statuses := make([]*types.Status, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		statuses = append(statuses, result.Status)
+	}
+
+	return federationRelationshipResults(relationships, statuses)
+}
+
+// UpdateFederationRelationships updates the bundle endpoint of the given
+// federation relationships, and their trust domain bundle when set.
+func (c trustDomainClient) UpdateFederationRelationships(ctx context.Context, relationships []*FederationRelationship) ([]BatchResult, error) {
+	protoRelationships, err := federationRelationshipsToProto(relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	var updateBundle bool
+	for _, relationship := range relationships {
+		updateBundle = updateBundle || relationship.TrustDomainBundle != nil
+	}
+
+	resp, err := c.client.BatchUpdateFederationRelationship(ctx, &trustdomainv1.BatchUpdateFederationRelationshipRequest{
+		FederationRelationships: protoRelationships,
+		InputMask: &types.FederationRelationshipMask{
+			BundleEndpointUrl:     true,
+			BundleEndpointProfile: true,
+			TrustDomainBundle:     updateBundle,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch update federation relationships on trust domain client: %v", err)
+	}
+
+	statuses := make([]*types.Status, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		statuses = append(statuses, result.Status)
+	}
+
+	return federationRelationshipResults(relationships, statuses)
+}
+
+func (c trustDomainClient) DeleteFederationRelationships(ctx context.Context, tds []spiffeid.TrustDomain) ([]BatchResult, error) {
+	req := &trustdomainv1.BatchDeleteFederationRelationshipRequest{}
+	for _, td := range tds {
+		req.TrustDomains = append(req.TrustDomains, td.String())
+	}
+
+	resp, err := c.client.BatchDeleteFederationRelationship(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch delete federation relationships on trust domain client: %v", err)
+	}
+	if len(resp.Results) != len(tds) {
+		return nil, fmt.Errorf("spire server returned %d results for %d federation relationships", len(resp.Results), len(tds))
+	}
+
+	out := make([]BatchResult, 0, len(tds))
+	for i, result := range resp.Results {
+		out = append(out, BatchResult{
+			TrustDomain: tds[i],
+			Err:         statusToError(result.Status),
+		})
+	}
+
+	return out, nil
+}
+
+func federationRelationshipsToProto(relationships []*FederationRelationship) ([]*types.FederationRelationship, error) {
+	out := make([]*types.FederationRelationship, 0, len(relationships))
+	for _, relationship := range relationships {
+		r, err := federationRelationshipToProto(relationship)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert federation relationship: %v", err)
+		}
+		out = append(out, r)
+	}
+
+	return out, nil
+}
+
+func federationRelationshipResults(relationships []*FederationRelationship, statuses []*types.Status) ([]BatchResult, error) {
+	if len(statuses) != len(relationships) {
+		return nil, fmt.Errorf("spire server returned %d results for %d federation relationships", len(statuses), len(relationships))
+	}
+
+	out := make([]BatchResult, 0, len(relationships))
+	for i, s := range statuses {
+		out = append(out, BatchResult{
+			TrustDomain: relationships[i].TrustDomain,
+			Err:         statusToError(s),
+		})
+	}
+
+	return out, nil
+}
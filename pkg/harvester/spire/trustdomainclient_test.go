@@ -0,0 +1,248 @@
+package spire
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewTrustDomainClientSuccess(t *testing.T) {
+	got := NewTrustDomainClient(fakeClientConn{})
+
+	assert.NotNil(t, got)
+	assert.IsType(t, trustDomainClient{}, got)
+}
+
+func TestClientGetFederationRelationship(t *testing.T) {
+	tests := []struct {
+		name        string
+		trustDomain string
+		expected    *FederationRelationship
+		clientErr   string
+		err         string
+		notFound    bool
+	}{
+		{
+			name:        "https_web",
+			trustDomain: "web.org",
+			expected: &FederationRelationship{
+				TrustDomain:           spiffeid.RequireTrustDomainFromString("web.org"),
+				BundleEndpointURL:     "https://web.org/bundle",
+				BundleEndpointProfile: HTTPSWebProfile,
+			},
+		},
+		{
+			name:        "https_spiffe",
+			trustDomain: "spiffe.org",
+			expected: &FederationRelationship{
+				TrustDomain:           spiffeid.RequireTrustDomainFromString("spiffe.org"),
+				BundleEndpointURL:     "https://spiffe.org:8443",
+				BundleEndpointProfile: HTTPSSPIFFEProfile,
+				EndpointSPIFFEID:      spiffeid.RequireFromString("spiffe://spiffe.org/spire/server"),
+			},
+		},
+		{
+			name:        "not_found",
+			trustDomain: "other.org",
+			err:         `"other.org": federation relationship not found`,
+			notFound:    true,
+		},
+		{
+			name:        "error_calling_client",
+			trustDomain: "web.org",
+			clientErr:   "error_from_client",
+			err:         "failed to get federation relationship from trust domain client: error_from_client",
+		},
+		{
+			name:        "error_parsing_client_response",
+			trustDomain: "invalid.org",
+			err:         "failed to parse spire server federation relationship response: unsupported bundle endpoint profile <nil>",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spireTrustDomainClient := &fakeSpireTrustDomainClient{relationships: []*types.FederationRelationship{
+				{
+					TrustDomain:           "web.org",
+					BundleEndpointUrl:     "https://web.org/bundle",
+					BundleEndpointProfile: &types.FederationRelationship_HttpsWeb{HttpsWeb: &types.HTTPSWebProfile{}},
+				},
+				{
+					TrustDomain:       "spiffe.org",
+					BundleEndpointUrl: "https://spiffe.org:8443",
+					BundleEndpointProfile: &types.FederationRelationship_HttpsSpiffe{
+						HttpsSpiffe: &types.HTTPSSPIFFEProfile{EndpointSpiffeId: "spiffe://spiffe.org/spire/server"},
+					},
+				},
+				{TrustDomain: "invalid.org"},
+			}}
+			if tt.clientErr != "" {
+				spireTrustDomainClient.relationshipsErr = errors.New(tt.clientErr)
+			}
+
+			client := &trustDomainClient{client: spireTrustDomainClient}
+
+			got, err := client.GetFederationRelationship(context.Background(), spiffeid.RequireTrustDomainFromString(tt.trustDomain))
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Equal(t, tt.notFound, errors.Is(err, ErrFederationRelationshipNotFound))
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClientListFederationRelationships(t *testing.T) {
+	webProfile := &types.FederationRelationship_HttpsWeb{HttpsWeb: &types.HTTPSWebProfile{}}
+	spireTrustDomainClient := &fakeSpireTrustDomainClient{
+		relationships: []*types.FederationRelationship{
+			{TrustDomain: "td1.org", BundleEndpointUrl: "https://td1.org", BundleEndpointProfile: webProfile},
+			{TrustDomain: "td2.org", BundleEndpointUrl: "https://td2.org", BundleEndpointProfile: webProfile},
+			{TrustDomain: "td3.org", BundleEndpointUrl: "https://td3.org", BundleEndpointProfile: webProfile},
+		},
+		listPageSize: 2,
+	}
+	client := &trustDomainClient{client: spireTrustDomainClient}
+
+	got, err := client.ListFederationRelationships(context.Background())
+	require.NoError(t, err)
+
+	var trustDomains []string
+	for _, relationship := range got {
+		trustDomains = append(trustDomains, relationship.TrustDomain.String())
+	}
+	assert.Equal(t, []string{"td1.org", "td2.org", "td3.org"}, trustDomains)
+
+	spireTrustDomainClient.relationships = []*types.FederationRelationship{{}}
+	_, err = client.ListFederationRelationships(context.Background())
+	assert.EqualError(t, err, "failed to parse spire server federation relationship response: failed to parse trust domain: trust domain is missing")
+
+	spireTrustDomainClient.relationshipsErr = errors.New("error_from_client")
+	_, err = client.ListFederationRelationships(context.Background())
+	assert.EqualError(t, err, "failed to list federation relationships from trust domain client: error_from_client")
+}
+
+func TestClientCreateFederationRelationships(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	relationship := &FederationRelationship{
+		TrustDomain:           td,
+		BundleEndpointURL:     "https://example.org:8443",
+		BundleEndpointProfile: HTTPSSPIFFEProfile,
+		EndpointSPIFFEID:      spiffeid.RequireFromString("spiffe://example.org/spire/server"),
+	}
+
+	tests := []struct {
+		name     string
+		statuses []*types.Status
+		batchErr string
+		expected []BatchResult
+		err      string
+	}{
+		{
+			name:     "ok",
+			statuses: []*types.Status{{}},
+			expected: []BatchResult{{TrustDomain: td}},
+		},
+		{
+			name:     "error_creating_relationship",
+			statuses: []*types.Status{{Code: int32(codes.AlreadyExists), Message: "already exists"}},
+			expected: []BatchResult{{TrustDomain: td, Err: status.Error(codes.AlreadyExists, "already exists")}},
+		},
+		{
+			name:     "error_calling_client",
+			batchErr: "error_from_client",
+			err:      "failed to batch create federation relationships on trust domain client: error_from_client",
+		},
+		{
+			name: "missing_results",
+			err:  "spire server returned 0 results for 1 federation relationships",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spireTrustDomainClient := &fakeSpireTrustDomainClient{batchStatuses: tt.statuses}
+			if tt.batchErr != "" {
+				spireTrustDomainClient.batchErr = errors.New(tt.batchErr)
+			}
+
+			client := &trustDomainClient{client: spireTrustDomainClient}
+
+			got, err := client.CreateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+			require.NotNil(t, spireTrustDomainClient.batchCreateRequest)
+			require.Len(t, spireTrustDomainClient.batchCreateRequest.FederationRelationships, 1)
+			assert.Equal(t, "spiffe://example.org/spire/server", spireTrustDomainClient.batchCreateRequest.FederationRelationships[0].GetHttpsSpiffe().GetEndpointSpiffeId())
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClientUpdateFederationRelationships(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	relationship := &FederationRelationship{
+		TrustDomain:           td,
+		BundleEndpointURL:     "https://example.org/bundle",
+		BundleEndpointProfile: HTTPSWebProfile,
+	}
+
+	spireTrustDomainClient := &fakeSpireTrustDomainClient{batchStatuses: []*types.Status{{}}}
+	client := &trustDomainClient{client: spireTrustDomainClient}
+
+	got, err := client.UpdateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	require.NoError(t, err)
+	assert.Equal(t, []BatchResult{{TrustDomain: td}}, got)
+	assert.Equal(t, &types.FederationRelationshipMask{BundleEndpointUrl: true, BundleEndpointProfile: true}, spireTrustDomainClient.batchUpdateRequest.InputMask)
+
+	_, err = client.UpdateFederationRelationships(context.Background(), []*FederationRelationship{{TrustDomain: td}})
+	assert.EqualError(t, err, `failed to convert federation relationship: unsupported bundle endpoint profile ""`)
+
+	spireTrustDomainClient.batchErr = errors.New("error_from_client")
+	_, err = client.UpdateFederationRelationships(context.Background(), []*FederationRelationship{relationship})
+	assert.EqualError(t, err, "failed to batch update federation relationships on trust domain client: error_from_client")
+}
+
+func TestClientDeleteFederationRelationships(t *testing.T) {
+	td1 := spiffeid.RequireTrustDomainFromString("td1.org")
+	td2 := spiffeid.RequireTrustDomainFromString("td2.org")
+
+	spireTrustDomainClient := &fakeSpireTrustDomainClient{batchStatuses: []*types.Status{
+		{},
+		{Code: int32(codes.NotFound), Message: "not found"},
+	}}
+	client := &trustDomainClient{client: spireTrustDomainClient}
+
+	got, err := client.DeleteFederationRelationships(context.Background(), []spiffeid.TrustDomain{td1, td2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"td1.org", "td2.org"}, spireTrustDomainClient.batchDeleteRequest.TrustDomains)
+	assert.Equal(t, []BatchResult{
+		{TrustDomain: td1},
+		{TrustDomain: td2, Err: status.Error(codes.NotFound, "not found")},
+	}, got)
+
+	spireTrustDomainClient.batchErr = errors.New("error_from_client")
+	_, err = client.DeleteFederationRelationships(context.Background(), []spiffeid.TrustDomain{td1})
+	assert.EqualError(t, err, "failed to batch delete federation relationships on trust domain client: error_from_client")
+}
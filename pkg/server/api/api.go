@@ -2,34 +2,109 @@ package api
 
 import (
 	"context"
-	"flag"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/bundle"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/harvester"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/management"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
 	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
 )
 
-func NewHTTPServer() HTTPServer {
-	return HTTPServer{}
+// shutdownTimeout is the time the in-flight requests are given to complete
+// when the server shuts down.
+const shutdownTimeout = 10 * time.Second
+
+// Config configures the listeners of the Galadriel Server APIs.
+type Config struct {
+	ListenAddress           string
+	ManagementListenAddress string
+	// TLSConfig of the harvester API listener. The harvester API is served
+	// in plaintext if nil.
+	TLSConfig *tls.Config
+	// Insecure lets the harvesters that do not authenticate use the
+	// harvester API on behalf of the SPIRE Server they name.
+	Insecure bool
+
+	// BundleEndpointListenAddress is the address of the SPIFFE bundle
+	// endpoint, served with BundleEndpointTLSConfig. The bundle endpoint is
+	// not served if empty.
+	BundleEndpointListenAddress string
+	BundleEndpointTLSConfig     *tls.Config
 }
 
-type HTTPServer struct{}
+// NewHTTPServer returns a server that exposes the harvester API on the
+// listen address, the management API on the management listen address and,
+// if configured, the SPIFFE bundle endpoint on its own listen address.
+func NewHTTPServer(config Config, ds datastore.Datastore) *HTTPServer {
+	return &HTTPServer{
+		config:    config,
+		datastore: ds,
+	}
+}
 
-func (s HTTPServer) Run(ctx context.Context) error {
-	var port = flag.Int("port", 33208, "Port for HTTP Galadriel server")
-	flag.Parse()
+type HTTPServer struct {
+	config    Config
+	datastore datastore.Datastore
 
-	router := echo.New()
+	// mtx guards the routers of the APIs, set when the server runs.
+	mtx     sync.RWMutex
+	routers map[string]*echo.Echo
+}
 
-	// Log all requests
-	router.Use(echomiddleware.Logger())
+func (s *HTTPServer) Run(ctx context.Context) error {
+	harvesterHandler := harvester.NewHandler(s.datastore, s.config.Insecure)
+	harvesterRouter := newRouter(telemetry.HarvesterAPI)
+	harvester.RegisterHandlers(harvesterRouter, harvesterHandler)
 
-	errch := make(chan error)
+	managementRouter := newRouter(telemetry.ManagementAPI)
+	management.RegisterHandlers(managementRouter, management.NewHandler(s.datastore))
+
+	routers := map[string]*echo.Echo{
+		telemetry.HarvesterAPI:  harvesterRouter,
+		telemetry.ManagementAPI: managementRouter,
+	}
+	errch := make(chan error, 3)
 
 	// Start serving
 	go func() {
-		errch <- router.Start(fmt.Sprintf("0.0.0.0:%d", *port))
+		if s.config.TLSConfig == nil {
+			errch <- harvesterRouter.Start(s.config.ListenAddress)
+			return
+		}
+
+		// The TLS server of the router is used, so that it is gracefully
+		// shut down along with the router
+		harvesterRouter.TLSServer.Addr = s.config.ListenAddress
+		harvesterRouter.TLSServer.TLSConfig = harvesterHandler.TLSConfig(s.config.TLSConfig)
+		errch <- harvesterRouter.StartServer(harvesterRouter.TLSServer)
+	}()
+	go func() {
+		errch <- managementRouter.Start(s.config.ManagementListenAddress)
 	}()
+	if s.config.BundleEndpointListenAddress != "" {
+		bundleRouter := newRouter(telemetry.BundleEndpoint)
+		bundle.RegisterHandlers(bundleRouter, bundle.NewHandler(s.datastore))
+		routers[telemetry.BundleEndpoint] = bundleRouter
+
+		go func() {
+			bundleRouter.TLSServer.Addr = s.config.BundleEndpointListenAddress
+			bundleRouter.TLSServer.TLSConfig = s.config.BundleEndpointTLSConfig
+			errch <- bundleRouter.StartServer(bundleRouter.TLSServer)
+		}()
+	}
+
+	s.mtx.Lock()
+	s.routers = routers
+	s.mtx.Unlock()
 
 	// Graceful shutdown
 	var err error
@@ -38,14 +113,61 @@ func (s HTTPServer) Run(ctx context.Context) error {
 		// shutdown routines
 		fmt.Println("Gracefully shutting down...")
 		// TODO: understand why we're not seeing logs from `router.Logger`
-		router.Logger.Info("Gracefully shutting down...")
-		err = router.Shutdown(ctx)
+		harvesterRouter.Logger.Info("Gracefully shutting down...")
 	case err = <-errch:
 	}
 
+	// Requests held for events would delay the shutdown until they are over
+	harvesterHandler.CloseStreams()
+
+	// The context is done already, the in-flight requests are given some
+	// time to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, router := range routers {
+		if shutdownErr := router.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+
 	if err != nil {
-		router.Logger.Error("Error gracefully shutting down server")
+		harvesterRouter.Logger.Error("Error gracefully shutting down server")
 	}
 
 	return err
 }
+
+// CheckListening reports the APIs that are not listening yet. The server is
+// not ready to serve requests until they all are.
+func (s *HTTPServer) CheckListening(context.Context) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.routers == nil {
+		return errors.New("apis not started")
+	}
+
+	var names []string
+	for name, router := range s.routers {
+		if router.ListenerAddr() == nil && router.TLSListenerAddr() == nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return fmt.Errorf("not listening: %s", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+func newRouter(name string) *echo.Echo {
+	router := echo.New()
+
+	// Log all requests
+	router.Use(echomiddleware.Logger())
+	// Trace all requests, as part of the traces of the harvesters
+	router.Use(telemetry.TracingMiddleware(name))
+
+	return router
+}
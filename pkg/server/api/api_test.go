@@ -4,13 +4,15 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHTTPServer_Run(t *testing.T) {
 	var wg sync.WaitGroup
-	s := NewHTTPServer()
+	s := NewHTTPServer(Config{ListenAddress: "localhost:0", ManagementListenAddress: "localhost:0"}, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	wg.Add(1)
@@ -24,3 +26,17 @@ func TestHTTPServer_Run(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func TestHTTPServer_CheckListening(t *testing.T) {
+	s := NewHTTPServer(Config{ListenAddress: "localhost:0", ManagementListenAddress: "localhost:0"}, nil)
+	require.EqualError(t, s.CheckListening(context.Background()), "apis not started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- s.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return s.CheckListening(context.Background()) == nil }, 5*time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-errch)
+}
@@ -0,0 +1,161 @@
+package bundle
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/httputil"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+)
+
+var _ ServerInterface = (*Handler)(nil)
+
+// Profiles of the SPIFFE bundle endpoint.
+const (
+	// ProfileHTTPSWeb serves the bundles with a Web PKI certificate.
+	ProfileHTTPSWeb = "https_web"
+	// ProfileHTTPSSPIFFE serves the bundles with an X509-SVID.
+	ProfileHTTPSSPIFFE = "https_spiffe"
+)
+
+const (
+	spireServerActive     = "active"
+	membershipActive      = "active"
+	federationGroupActive = "active"
+)
+
+// errBundleNotFound is returned for the trust domains whose bundle is not
+// served, without telling apart the unknown trust domains from the inactive
+// ones.
+var errBundleNotFound = fmt.Errorf("bundle: %w", datastore.ErrNotFound)
+
+// Handler serves the trust bundles of the active members of the federation
+// groups following the SPIFFE bundle endpoint specification.
+type Handler struct {
+	datastore datastore.Datastore
+	logger    common.Logger
+}
+
+// NewHandler returns a new bundle endpoint handler backed by the given datastore.
+func NewHandler(ds datastore.Datastore) *Handler {
+	return &Handler{
+		datastore: ds,
+		logger:    *common.NewLogger(telemetry.BundleEndpoint),
+	}
+}
+
+// NewTLSConfig returns the TLS configuration of the bundle endpoint for the
+// given profile. The certificate must be an X509-SVID for the https_spiffe
+// profile, which is reloaded when its files change, as X509-SVIDs are short
+// lived.
+func NewTLSConfig(profile, certFile, keyFile string) (*tls.Config, error) {
+	switch profile {
+	case ProfileHTTPSWeb:
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}, nil
+	case ProfileHTTPSSPIFFE:
+		source, err := newSVIDSource(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load X509-SVID: %v", err)
+		}
+		config := tlsconfig.TLSServerConfig(source)
+		config.MinVersion = tls.VersionTLS12
+		return config, nil
+	default:
+		return nil, fmt.Errorf("unsupported bundle endpoint profile %q", profile)
+	}
+}
+
+// (GET /bundles/{trustDomain})
+func (h *Handler) GetBundle(ctx echo.Context, trustDomain string) error {
+	td, err := spiffeid.TrustDomainFromString(trustDomain)
+	if err != nil {
+		return httputil.BadRequest(ctx, "invalid trust domain: %v", err)
+	}
+
+	bundle, err := h.activeBundle(ctx.Request().Context(), td)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.Blob(http.StatusOK, echo.MIMEApplicationJSON, bundle.Bundle)
+}
+
+// activeBundle returns the trust bundle of the trust domain, if its SPIRE
+// Server is an active member of an active federation group and the bundle
+// is not about to be deleted.
+func (h *Handler) activeBundle(ctx context.Context, td spiffeid.TrustDomain) (*datastore.TrustBundle, error) {
+	server, err := h.datastore.GetSpireServerByTrustDomain(ctx, td.String())
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return nil, errBundleNotFound
+	case err != nil:
+		return nil, err
+	case server.Status != spireServerActive:
+		return nil, errBundleNotFound
+	}
+
+	member, err := h.isActiveMember(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, errBundleNotFound
+	}
+
+	bundle, err := h.datastore.GetTrustBundleBySpireServer(ctx, server.ID)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return nil, errBundleNotFound
+	case err != nil:
+		return nil, err
+	case bundle.Status != string(common.TrustBundleStatusActive):
+		return nil, errBundleNotFound
+	}
+
+	return bundle, nil
+}
+
+func (h *Handler) isActiveMember(ctx context.Context, server *datastore.SpireServer) (bool, error) {
+	memberships, err := h.datastore.ListMemberships(ctx, datastore.MembershipFilter{
+		SpireServerID: server.ID,
+		Status:        membershipActive,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, membership := range memberships {
+		group, err := h.datastore.GetFederationGroup(ctx, membership.FederationGroupID)
+		if err != nil {
+			return false, err
+		}
+		if group.Status == federationGroupActive {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (h *Handler) handleError(ctx echo.Context, err error) error {
+	if httputil.StatusCode(err) == http.StatusInternalServerError {
+		h.logger.Error(ctx.Request().Method, ctx.Request().URL.Path, "failed:", err)
+	}
+
+	return httputil.HandleError(ctx, err)
+}
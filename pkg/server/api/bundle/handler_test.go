@@ -0,0 +1,272 @@
+package bundle
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type member struct {
+	trustDomain      string
+	serverStatus     string
+	membershipStatus string
+	groupStatus      string
+	// bundleStatus is the status of the trust bundle of the member, which
+	// has no trust bundle if empty.
+	bundleStatus string
+}
+
+// setupMember creates a SPIRE Server member of its own federation group, and
+// returns its trust bundle, if any.
+func setupMember(t *testing.T, ds datastore.Datastore, m member) []byte {
+	ctx := context.Background()
+
+	org, err := ds.CreateOrganization(ctx, &datastore.Organization{Name: m.trustDomain})
+	require.NoError(t, err)
+	group, err := ds.CreateFederationGroup(ctx, &datastore.FederationGroup{OrgID: org.ID, Name: m.trustDomain, Status: m.groupStatus})
+	require.NoError(t, err)
+	server, err := ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: m.trustDomain, Status: m.serverStatus})
+	require.NoError(t, err)
+	_, err = ds.CreateMembership(ctx, &datastore.Membership{SpireServerID: server.ID, FederationGroupID: group.ID, Status: m.membershipStatus})
+	require.NoError(t, err)
+
+	if m.bundleStatus == "" {
+		return nil
+	}
+
+	cert, _ := newCertificate(t, nil, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: m.trustDomain},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(m.trustDomain), []*x509.Certificate{cert})
+	bundle.SetSequenceNumber(1)
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+
+	_, err = ds.SetTrustBundle(ctx, &datastore.TrustBundle{
+		SpireServerID: server.ID,
+		Bundle:        bundleBytes,
+		Status:        m.bundleStatus,
+	})
+	require.NoError(t, err)
+
+	return bundleBytes
+}
+
+// newCertificate returns a certificate created from the template, signed by
+// the parent, or self-signed if nil, and its private key.
+func newCertificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(1)
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+func TestGetBundle(t *testing.T) {
+	ds, err := datastore.NewSQLDatastore(context.Background(), datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	members := []member{
+		{trustDomain: "active.org", serverStatus: "active", membershipStatus: "active", groupStatus: "active", bundleStatus: "active"},
+		{trustDomain: "invited.org", serverStatus: "invited", membershipStatus: "active", groupStatus: "active", bundleStatus: "active"},
+		{trustDomain: "inactive-membership.org", serverStatus: "active", membershipStatus: "inactive", groupStatus: "active", bundleStatus: "active"},
+		{trustDomain: "inactive-group.org", serverStatus: "active", membershipStatus: "active", groupStatus: "inactive", bundleStatus: "active"},
+		{trustDomain: "to-delete.org", serverStatus: "active", membershipStatus: "active", groupStatus: "active", bundleStatus: "to_delete"},
+		{trustDomain: "no-bundle.org", serverStatus: "active", membershipStatus: "active", groupStatus: "active"},
+	}
+	bundles := make(map[string][]byte)
+	for _, m := range members {
+		bundles[m.trustDomain] = setupMember(t, ds, m)
+	}
+
+	router := echo.New()
+	RegisterHandlers(router, NewHandler(ds))
+
+	tests := []struct {
+		name        string
+		trustDomain string
+		code        int
+	}{
+		{name: "active_member", trustDomain: "active.org", code: http.StatusOK},
+		{name: "unknown_trust_domain", trustDomain: "unknown.org", code: http.StatusNotFound},
+		{name: "inactive_spire_server", trustDomain: "invited.org", code: http.StatusNotFound},
+		{name: "inactive_membership", trustDomain: "inactive-membership.org", code: http.StatusNotFound},
+		{name: "inactive_federation_group", trustDomain: "inactive-group.org", code: http.StatusNotFound},
+		{name: "bundle_to_delete", trustDomain: "to-delete.org", code: http.StatusNotFound},
+		{name: "no_bundle", trustDomain: "no-bundle.org", code: http.StatusNotFound},
+		{name: "invalid_trust_domain", trustDomain: "Invalid.org", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/bundles/"+url.PathEscape(tt.trustDomain), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.code, rec.Code, rec.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, bundles[tt.trustDomain], rec.Body.Bytes())
+
+			bundle, err := spiffebundle.Parse(spiffeid.RequireTrustDomainFromString(tt.trustDomain), rec.Body.Bytes())
+			require.NoError(t, err)
+			assert.Len(t, bundle.X509Authorities(), 1)
+		})
+	}
+}
+
+// writeKeyPair writes the PEM encoded certificate and key in dir, and returns
+// their paths.
+func writeKeyPair(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, caKey := newCertificate(t, nil, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	webCert, webKey := newCertificate(t, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "galadriel.example.org"},
+		DNSNames:    []string{"galadriel.example.org"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	svidCert, svidKey := newCertificate(t, ca, caKey, &x509.Certificate{
+		URIs:     []*url.URL{spiffeid.RequireFromString("spiffe://galadriel.org/server").URL()},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	})
+	webCertFile, webKeyFile := writeKeyPair(t, dir, "web", webCert, webKey)
+	svidCertFile, svidKeyFile := writeKeyPair(t, dir, "svid", svidCert, svidKey)
+
+	tests := []struct {
+		name     string
+		profile  string
+		certFile string
+		keyFile  string
+		expected *x509.Certificate
+		err      string
+	}{
+		{name: "https_web", profile: ProfileHTTPSWeb, certFile: webCertFile, keyFile: webKeyFile, expected: webCert},
+		{name: "https_spiffe", profile: ProfileHTTPSSPIFFE, certFile: svidCertFile, keyFile: svidKeyFile, expected: svidCert},
+		{name: "https_spiffe_not_svid", profile: ProfileHTTPSSPIFFE, certFile: webCertFile, keyFile: webKeyFile, err: "failed to load X509-SVID"},
+		{name: "missing_certificate", profile: ProfileHTTPSWeb, certFile: filepath.Join(dir, "missing.pem"), keyFile: webKeyFile, err: "failed to load certificate"},
+		{name: "unknown_profile", profile: "http", certFile: webCertFile, keyFile: webKeyFile, err: `unsupported bundle endpoint profile "http"`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewTLSConfig(tt.profile, tt.certFile, tt.keyFile)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var cert *tls.Certificate
+			if config.GetCertificate != nil {
+				cert, err = config.GetCertificate(&tls.ClientHelloInfo{})
+				require.NoError(t, err)
+			} else {
+				require.Len(t, config.Certificates, 1)
+				cert = &config.Certificates[0]
+			}
+			assert.Equal(t, tt.expected.Raw, cert.Certificate[0])
+		})
+	}
+}
+
+func TestNewTLSConfigReloadsSVID(t *testing.T) {
+	dir := t.TempDir()
+	newSVID := func() (*x509.Certificate, *ecdsa.PrivateKey) {
+		return newCertificate(t, nil, nil, &x509.Certificate{
+			URIs:     []*url.URL{spiffeid.RequireFromString("spiffe://galadriel.org/server").URL()},
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		})
+	}
+	servedCert := func(config *tls.Config) []byte {
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		return cert.Certificate[0]
+	}
+	// touch moves the modification time of the files forward, as rewriting
+	// them in a row may not change it on every file system
+	touch := func(offset time.Duration, files ...string) {
+		for _, file := range files {
+			modTime := time.Now().Add(offset)
+			require.NoError(t, os.Chtimes(file, modTime, modTime))
+		}
+	}
+
+	cert, key := newSVID()
+	certFile, keyFile := writeKeyPair(t, dir, "svid", cert, key)
+	config, err := NewTLSConfig(ProfileHTTPSSPIFFE, certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, servedCert(config))
+
+	// The rotated X509-SVID is served once written
+	rotated, rotatedKey := newSVID()
+	writeKeyPair(t, dir, "svid", rotated, rotatedKey)
+	touch(time.Minute, certFile, keyFile)
+	assert.Equal(t, rotated.Raw, servedCert(config))
+
+	// The previous X509-SVID is kept while the files can not be loaded
+	require.NoError(t, os.WriteFile(certFile, []byte("partially written"), 0600))
+	touch(2*time.Minute, certFile)
+	assert.Equal(t, rotated.Raw, servedCert(config))
+	require.NoError(t, os.Remove(keyFile))
+	assert.Equal(t, rotated.Raw, servedCert(config))
+}
@@ -0,0 +1,88 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// svidSource is the x509svid.Source of the X509-SVID stored in the given
+// files. The files are reloaded when they change, so that the X509-SVID can
+// be rotated, e.g. by a SPIFFE helper, without restarting the server.
+type svidSource struct {
+	certFile string
+	keyFile  string
+	logger   common.Logger
+
+	mtx  sync.Mutex
+	svid *x509svid.SVID
+	// modTime is the modification time of the files when they were last
+	// loaded, successfully or not.
+	modTime time.Time
+}
+
+// newSVIDSource returns the source of the X509-SVID stored in the given
+// files, which must be loadable.
+func newSVIDSource(certFile, keyFile string) (*svidSource, error) {
+	modTime, err := filesModTime(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	svid, err := x509svid.Load(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &svidSource{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   *common.NewLogger(telemetry.BundleEndpoint),
+		svid:     svid,
+		modTime:  modTime,
+	}, nil
+}
+
+// GetX509SVID returns the X509-SVID, reloaded first if the files changed since
+// they were last loaded. The previous X509-SVID is returned if the changed
+// files can not be loaded, e.g. while they are being written.
+func (s *svidSource) GetX509SVID() (*x509svid.SVID, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	modTime, err := filesModTime(s.certFile, s.keyFile)
+	if err != nil || modTime.Equal(s.modTime) {
+		return s.svid, nil
+	}
+
+	s.modTime = modTime
+	svid, err := x509svid.Load(s.certFile, s.keyFile)
+	if err != nil {
+		s.logger.Warn("Failed to reload the X509-SVID of the bundle endpoint, keeping the previous one:", err)
+		return s.svid, nil
+	}
+
+	s.svid = svid
+	s.logger.Info("Reloaded the X509-SVID of the bundle endpoint")
+	return s.svid, nil
+}
+
+// filesModTime returns the latest modification time of the given files.
+func filesModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %v", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,75 @@
+package harvester
+
+import (
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+)
+
+func relationshipToAPI(in *datastore.Relationship) common.FederationRelationship {
+	status := common.FederationRelationshipStatus(in.Status)
+	spireServerConsent := in.SpireServerConsent
+	federatedWithConsent := in.SpireServerFederatedWithConsent
+	return common.FederationRelationship{
+		Id:                              in.ID,
+		FederationGroupId:               in.FederationGroupID,
+		SpireServer:                     in.SpireServerTrustDomain,
+		SpireServerConsent:              &spireServerConsent,
+		SpireServerFederatedWith:        in.SpireServerFederatedWithTrustDomain,
+		SpireServerFederatedWithConsent: &federatedWithConsent,
+		Status:                          &status,
+
+		SpireServerBundleEndpoint:              bundleEndpointToAPI(in.SpireServerBundleEndpoint),
+		SpireServerFederatedWithBundleEndpoint: bundleEndpointToAPI(in.SpireServerFederatedWithBundleEndpoint),
+	}
+}
+
+func bundleEndpointToAPI(in datastore.BundleEndpoint) *common.BundleEndpoint {
+	if in.URL == "" {
+		return nil
+	}
+
+	out := &common.BundleEndpoint{
+		Url:     in.URL,
+		Profile: common.BundleEndpointProfile(in.Profile),
+	}
+	if in.SpiffeID != "" {
+		spiffeID := in.SpiffeID
+		out.SpiffeId = &spiffeID
+	}
+
+	return out
+}
+
+func trustBundleToAPI(in *datastore.TrustBundle) common.TrustBundle {
+	trustDomain := in.TrustDomain
+	status := common.TrustBundleStatus(in.Status)
+	out := common.TrustBundle{
+		Id:          in.ID,
+		TrustDomain: &trustDomain,
+		Bundle:      string(in.Bundle),
+		Status:      &status,
+	}
+	if in.Signature != "" {
+		signature, signingCertificate := in.Signature, in.SigningCertificate
+		out.Signature = &signature
+		out.SigningCertificate = &signingCertificate
+	}
+	common.SetBundleMetadata(&out)
+
+	return out
+}
+
+func eventToAPI(in *datastore.Event) common.Event {
+	out := common.Event{
+		Id:          in.ID,
+		TrustDomain: in.TrustDomain,
+		Type:        common.EventType(in.Type),
+		CreatedAt:   in.CreatedAt,
+	}
+	if in.Message != "" {
+		message := in.Message
+		out.Message = &message
+	}
+
+	return out
+}
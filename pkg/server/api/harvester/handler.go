@@ -0,0 +1,806 @@
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/httputil"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+var _ ServerInterface = (*Handler)(nil)
+
+// spireServerActive is the status of the SPIRE Servers allowed to use the harvester API.
+const spireServerActive = "active"
+
+const (
+	// maxEventsWait is the longest time a request waits for an event.
+	maxEventsWait = 60
+
+	// defaultHeartbeatInterval is the time between two heartbeats of an idle
+	// event stream.
+	defaultHeartbeatInterval = 15 * time.Second
+
+	headerLastEventID = "Last-Event-ID"
+	mimeEventStream   = "text/event-stream"
+)
+
+// bundleEventTypes are the types of the trust bundle events.
+var bundleEventTypes = []string{
+	string(common.TrustBundleUpdated),
+	string(common.TrustBundlePruned),
+	string(common.TrustBundleToDelete),
+	string(common.TrustBundleDeleted),
+}
+
+var errNotAllowed = errors.New("spire server is not allowed to access the harvester API")
+
+// Handler implements the harvester API on top of a datastore. Every request
+// is made on behalf of the SPIRE Server of the calling harvester, and only
+// has access to the data that involves its trust domain.
+type Handler struct {
+	datastore datastore.Datastore
+	logger    common.Logger
+	// clientCAs verify the client certificates that are not X509-SVIDs.
+	clientCAs *x509.CertPool
+	// insecure lets the harvesters that do not authenticate make requests on
+	// behalf of the SPIRE Server of the spireServer parameter.
+	insecure bool
+
+	heartbeatInterval time.Duration
+	// done is closed by CloseStreams.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHandler returns a new harvester API handler backed by the given
+// datastore. Harvesters must authenticate unless insecure is set, which is
+// only meant for development.
+func NewHandler(ds datastore.Datastore, insecure bool) *Handler {
+	return &Handler{
+		datastore:         ds,
+		insecure:          insecure,
+		logger:            *common.NewLogger(telemetry.HarvesterAPI),
+		heartbeatInterval: defaultHeartbeatInterval,
+		done:              make(chan struct{}),
+	}
+}
+
+// TLSConfig returns the TLS configuration of the harvester API listener,
+// based on the given one. Client certificates are requested but verified by
+// the handler instead of during the TLS handshake, so that harvesters can
+// authenticate with X509-SVIDs signed by the trust bundle of their SPIRE
+// Server as well as with certificates signed by the client CAs of config.
+func (h *Handler) TLSConfig(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	h.clientCAs = config.ClientCAs
+
+	switch config.ClientAuth {
+	case tls.RequireAndVerifyClientCert, tls.RequireAnyClientCert:
+		config.ClientAuth = tls.RequireAnyClientCert
+	default:
+		config.ClientAuth = tls.RequestClientCert
+	}
+	config.ClientCAs = nil
+
+	return config
+}
+
+// (POST /onboard)
+func (h *Handler) Onboard(ctx echo.Context) error {
+	var in common.OnboardRequest
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse onboard request: %v", err)
+	}
+	if in.JoinToken == "" {
+		return httputil.BadRequest(ctx, "join token is required")
+	}
+
+	credential, err := datastore.NewSecret()
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	server, err := h.datastore.RedeemJoinToken(ctx.Request().Context(), in.JoinToken, credential)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return httputil.WriteError(ctx, http.StatusUnauthorized, "invalid or expired join token")
+	case err != nil:
+		return h.handleError(ctx, err)
+	}
+	h.logger.Info("Onboarded harvester of", server.TrustDomain)
+
+	return ctx.JSON(http.StatusOK, common.OnboardResponse{
+		TrustDomain: server.TrustDomain,
+		Credential:  credential,
+	})
+}
+
+// (GET /FederationRelationship)
+func (h *Handler) GetFederationRelationships(ctx echo.Context, params GetFederationRelationshipsParams) error {
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	filter := datastore.RelationshipFilter{
+		TrustDomain: caller.TrustDomain,
+		Status:      stringValue(params.Status),
+	}
+	if params.FederationGroupId != nil {
+		filter.FederationGroupID = *params.FederationGroupId
+	}
+
+	relationships, err := h.datastore.ListRelationships(ctx.Request().Context(), filter)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]common.FederationRelationship, 0, len(relationships))
+	for _, relationship := range relationships {
+		out = append(out, relationshipToAPI(relationship))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (GET /FederationRelationship/{relationshipID})
+func (h *Handler) GetRelationshipbyID(ctx echo.Context, relationshipID int64, params GetRelationshipbyIDParams) error {
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	relationship, err := h.relationship(ctx.Request().Context(), caller, relationshipID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, relationshipToAPI(relationship))
+}
+
+// (PUT /FederationRelationship/{relationshipID})
+func (h *Handler) UpdateFederatedRelationshipStatus(ctx echo.Context, relationshipID int64, params UpdateFederatedRelationshipStatusParams) error {
+	var in common.FederationRelationship
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse federation relationship: %v", err)
+	}
+
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	// The consent is validated and set in a single transaction, so that the
+	// two sides consenting at the same time do not overwrite each other
+	var invalid error
+	relationship, err := h.datastore.UpdateRelationshipFunc(reqCtx, relationshipID, func(relationship *datastore.Relationship) error {
+		if relationship.SpireServerID != caller.ID && relationship.SpireServerFederatedWithID != caller.ID {
+			return fmt.Errorf("relationship: %w", datastore.ErrNotFound)
+		}
+
+		// A harvester can only give or revoke the consent of its own side
+		consent, current := in.SpireServerFederatedWithConsent, &relationship.SpireServerFederatedWithConsent
+		if relationship.SpireServerID == caller.ID {
+			consent, current = in.SpireServerConsent, &relationship.SpireServerConsent
+		}
+		if consent == nil {
+			invalid = fmt.Errorf("consent of %q is required", caller.TrustDomain)
+			return invalid
+		}
+
+		if err := common.ValidateConsentTransition(common.FederationRelationshipStatus(relationship.Status), *current, *consent); err != nil {
+			if !errors.Is(err, common.ErrInvalidTransition) {
+				invalid = err
+			}
+			return err
+		}
+
+		*current = *consent
+		relationship.Status = string(common.RelationshipStatus(relationship.SpireServerConsent, relationship.SpireServerFederatedWithConsent))
+
+		return nil
+	})
+	switch {
+	case invalid != nil:
+		return httputil.BadRequest(ctx, "%v", invalid)
+	case err != nil:
+		return h.handleError(ctx, err)
+	}
+	h.recordRelationshipEvents(reqCtx, relationship)
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (GET /trustBundles)
+func (h *Handler) GetTrustBundles(ctx echo.Context, params GetTrustBundlesParams) error {
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	peers, err := h.activePeers(reqCtx, caller)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := []common.TrustBundle{}
+	for _, peer := range peers {
+		bundle, err := h.datastore.GetTrustBundleBySpireServer(reqCtx, peer.id)
+		switch {
+		case errors.Is(err, datastore.ErrNotFound):
+			// The peer has not uploaded its trust bundle yet
+			continue
+		case err != nil:
+			return h.handleError(ctx, err)
+		}
+
+		// Trust bundles whose authorities all expired are pending deletion
+		if bundle.Status == string(common.TrustBundleStatusToDelete) {
+			continue
+		}
+
+		out = append(out, trustBundleToAPI(bundle))
+	}
+	telemetry.CountBundleTransfer(reqCtx, telemetry.HarvesterAPI, telemetry.Pull, caller.TrustDomain, nil)
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (GET /events)
+func (h *Handler) GetEvents(ctx echo.Context, params GetEventsParams) error {
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	// When there is no event yet, the request is held until one is created
+	// or the wait is over, so that harvesters get changes without polling.
+	var timeout <-chan time.Time
+	if wait := params.Wait; wait != nil && *wait != 0 {
+		if *wait < 0 || *wait > maxEventsWait {
+			return httputil.BadRequest(ctx, "wait must be between 0 and %d seconds", maxEventsWait)
+		}
+		timer := time.NewTimer(time.Duration(*wait) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	var after int64
+	if params.After != nil {
+		after = *params.After
+	}
+	if err := h.checkEventsRetained(reqCtx, after); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := []common.Event{}
+	for {
+		// The notification is taken before listing the events, so that the
+		// events created in between are not missed
+		created := h.datastore.EventsCreated()
+		events, err := h.callerEvents(reqCtx, caller, after)
+		if err != nil {
+			return h.handleError(ctx, err)
+		}
+
+		if len(events) > 0 || timeout == nil {
+			for _, event := range events {
+				out = append(out, eventToAPI(event))
+			}
+			return ctx.JSON(http.StatusOK, out)
+		}
+
+		select {
+		case <-created:
+		case <-timeout:
+			return ctx.JSON(http.StatusOK, out)
+		case <-h.done:
+			return ctx.JSON(http.StatusOK, out)
+		case <-reqCtx.Done():
+			return reqCtx.Err()
+		}
+	}
+}
+
+// (GET /events/stream)
+func (h *Handler) StreamEvents(ctx echo.Context, params StreamEventsParams) error {
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	// A reconnecting client resumes after the last event it got
+	var after int64
+	if params.After != nil {
+		after = *params.After
+	}
+	if lastEventID := ctx.Request().Header.Get(headerLastEventID); lastEventID != "" {
+		after, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			return httputil.BadRequest(ctx, "invalid %s header: %v", headerLastEventID, err)
+		}
+	}
+
+	reqCtx := ctx.Request().Context()
+	if err := h.checkEventsRetained(reqCtx, after); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, mimeEventStream)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// The notification is taken before listing the events, so that the
+		// events created in between are not missed
+		created := h.datastore.EventsCreated()
+		events, err := h.callerEvents(reqCtx, caller, after)
+		if err != nil {
+			// The status is already sent, the client reconnects and
+			// resumes after the last event it got
+			h.logger.Error("Event stream of", caller.TrustDomain, "failed:", err)
+			return nil
+		}
+
+		for _, event := range events {
+			data, err := json.Marshal(eventToAPI(event))
+			if err != nil {
+				h.logger.Error("Event stream of", caller.TrustDomain, "failed:", err)
+				return nil
+			}
+			if _, err := fmt.Fprintf(resp, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return nil
+			}
+			after = event.ID
+		}
+		if len(events) > 0 {
+			resp.Flush()
+		}
+
+		select {
+		case <-created:
+		case <-heartbeat.C:
+			// Comments keep the connection alive, and let the client tell
+			// a quiet stream from a broken one
+			if _, err := fmt.Fprint(resp, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			resp.Flush()
+		case <-h.done:
+			return nil
+		case <-reqCtx.Done():
+			return nil
+		}
+	}
+}
+
+// CloseStreams ends the requests waiting for events and the event streams,
+// so that the server can shut down gracefully. Harvesters reconnect to
+// another instance, or once the server is back.
+func (h *Handler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// checkEventsRetained returns common.ErrEventsExpired if some of the events
+// following the given one were deleted, so that the harvester resyncs instead
+// of missing them. Without a previous event, the retained events are returned.
+func (h *Handler) checkEventsRetained(ctx context.Context, after int64) error {
+	if after == 0 {
+		return nil
+	}
+
+	first, err := h.datastore.FirstEventID(ctx)
+	if err != nil {
+		return err
+	}
+	if after+1 < first {
+		return fmt.Errorf("%w: the events up to %d were deleted", common.ErrEventsExpired, first-1)
+	}
+
+	return nil
+}
+
+// callerEvents returns the trust bundle events of the SPIRE Servers the
+// caller has an active relationship with, and the events of the
+// relationships of the caller, with an ID greater than after, in order.
+func (h *Handler) callerEvents(ctx context.Context, caller *datastore.SpireServer, after int64) ([]*datastore.Event, error) {
+	events, err := h.datastore.ListEvents(ctx, datastore.EventFilter{
+		AfterID:      after,
+		TrustDomains: []string{caller.TrustDomain},
+		Types:        []string{string(common.RelationshipUpdated)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := h.activePeers(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return events, nil
+	}
+
+	filter := datastore.EventFilter{
+		AfterID: after,
+		Types:   bundleEventTypes,
+	}
+	for _, peer := range peers {
+		filter.TrustDomains = append(filter.TrustDomains, peer.trustDomain)
+	}
+	bundleEvents, err := h.datastore.ListEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events = append(events, bundleEvents...)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+// recordRelationshipEvents records the status of a relationship as an event
+// of each side, so that a harvester only gets the events of its own
+// relationships.
+func (h *Handler) recordRelationshipEvents(ctx context.Context, relationship *datastore.Relationship) {
+	sides := [][2]string{
+		{relationship.SpireServerTrustDomain, relationship.SpireServerFederatedWithTrustDomain},
+		{relationship.SpireServerFederatedWithTrustDomain, relationship.SpireServerTrustDomain},
+	}
+	for _, side := range sides {
+		if _, err := h.datastore.CreateEvent(ctx, &datastore.Event{
+			TrustDomain: side[0],
+			Type:        string(common.RelationshipUpdated),
+			Message:     fmt.Sprintf("relationship %d with %s is %s", relationship.ID, side[1], relationship.Status),
+		}); err != nil {
+			h.logger.Warn("Failed to record update of relationship", relationship.ID, "of", side[0]+":", err)
+		}
+	}
+}
+
+// (PUT /trustBundles/{trustBundleId})
+func (h *Handler) UpdateTrustBundle(ctx echo.Context, trustBundleId int64, params UpdateTrustBundleParams) error {
+	var in common.TrustBundle
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse trust bundle: %v", err)
+	}
+
+	caller, err := h.caller(ctx, params.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	if in.TrustDomain != nil && *in.TrustDomain != caller.TrustDomain {
+		return httputil.WriteError(ctx, http.StatusForbidden,
+			fmt.Sprintf("%q cannot upload the trust bundle of %q", caller.TrustDomain, *in.TrustDomain))
+	}
+	if in.Bundle == "" {
+		return httputil.BadRequest(ctx, "trust bundle is required")
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	// A zero ID creates the trust bundle of the caller, or replaces the
+	// existing one. Otherwise the ID must match the existing trust bundle.
+	var currentContents []byte
+	current, err := h.datastore.GetTrustBundleBySpireServer(reqCtx, caller.ID)
+	switch {
+	case err == nil:
+		currentContents = current.Bundle
+	case !errors.Is(err, datastore.ErrNotFound):
+		return h.handleError(ctx, err)
+	}
+	if trustBundleId != 0 && (current == nil || current.ID != trustBundleId) {
+		return h.handleError(ctx, fmt.Errorf("trust bundle %d: %w", trustBundleId, datastore.ErrNotFound))
+	}
+
+	td, err := spiffeid.TrustDomainFromString(caller.TrustDomain)
+	if err != nil {
+		return h.handleError(ctx, fmt.Errorf("invalid trust domain %q: %v", caller.TrustDomain, err))
+	}
+	if _, err := common.ValidateTrustBundle(td, []byte(in.Bundle), currentContents); err != nil {
+		if errors.Is(err, common.ErrStaleTrustBundle) {
+			return h.handleError(ctx, err)
+		}
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+
+	bundle, err := h.datastore.SetTrustBundle(reqCtx, &datastore.TrustBundle{
+		SpireServerID:      caller.ID,
+		Bundle:             []byte(in.Bundle),
+		Status:             string(common.TrustBundleStatusActive),
+		Signature:          stringValue(in.Signature),
+		SigningCertificate: stringValue(in.SigningCertificate),
+	})
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	// Harvesters push their bundle again when restarted, which is not a
+	// change worth waking up the harvesters federated with the caller for
+	if !bytes.Equal(currentContents, bundle.Bundle) {
+		if _, err := h.datastore.CreateEvent(reqCtx, &datastore.Event{
+			TrustDomain: caller.TrustDomain,
+			Type:        string(common.TrustBundleUpdated),
+			Message:     "uploaded by the harvester",
+		}); err != nil {
+			h.logger.Warn("Failed to record update of the trust bundle of", caller.TrustDomain+":", err)
+		}
+	}
+
+	telemetry.CountBundleTransfer(reqCtx, telemetry.HarvesterAPI, telemetry.Push, caller.TrustDomain, nil)
+
+	return ctx.JSON(http.StatusOK, trustBundleToAPI(bundle))
+}
+
+// caller returns the SPIRE Server on whose behalf the request is made. The
+// request is bound to the trust domain the harvester authenticated as, and
+// the spireServer parameter, if any, must match it. Harvesters that do not
+// authenticate are only identified by the spireServer parameter in insecure
+// mode. Only active SPIRE Servers are allowed to use the harvester API.
+func (h *Handler) caller(ctx echo.Context, spireServer *string) (*datastore.SpireServer, error) {
+	trustDomain := stringValue(spireServer)
+
+	authenticated, err := h.authenticatedTrustDomain(ctx.Request())
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errNotAllowed, err)
+	case authenticated != "" && trustDomain != "" && trustDomain != authenticated:
+		return nil, fmt.Errorf("%w: authenticated as %q", errNotAllowed, authenticated)
+	case authenticated != "":
+		trustDomain = authenticated
+	case !h.insecure:
+		return nil, fmt.Errorf("%w: not authenticated", errNotAllowed)
+	}
+
+	if trustDomain == "" {
+		return nil, errNotAllowed
+	}
+
+	server, err := h.datastore.GetSpireServerByTrustDomain(ctx.Request().Context(), trustDomain)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return nil, errNotAllowed
+	case err != nil:
+		return nil, err
+	}
+
+	if server.Status != spireServerActive {
+		return nil, errNotAllowed
+	}
+
+	return server, nil
+}
+
+// authenticatedTrustDomain returns the trust domain the harvester
+// authenticated as, or an empty string if it did not authenticate. Harvesters
+// authenticate with a verified client certificate, or with the credential
+// issued when they onboarded. When both are presented, they must match.
+func (h *Handler) authenticatedTrustDomain(r *http.Request) (string, error) {
+	certTrustDomain, err := h.certificateTrustDomain(r)
+	if err != nil {
+		return "", err
+	}
+
+	credential, ok := bearerCredential(r)
+	if !ok {
+		return certTrustDomain, nil
+	}
+
+	server, err := h.datastore.GetSpireServerByCredential(r.Context(), credential)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return "", errors.New("invalid credential")
+	case err != nil:
+		return "", err
+	case certTrustDomain != "" && certTrustDomain != server.TrustDomain:
+		return "", errors.New("client certificate and credential identities do not match")
+	}
+
+	return server.TrustDomain, nil
+}
+
+// certificateTrustDomain returns the trust domain of the client certificate
+// of the request, or an empty string if there is none. Client certificates
+// are either signed by the client CA bundle, or X509-SVIDs signed by the trust
+// bundle registered for their trust domain.
+func (h *Handler) certificateTrustDomain(r *http.Request) (string, error) {
+	if r.TLS == nil {
+		return "", nil
+	}
+
+	// Certificates verified during the TLS handshake
+	if len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return leafTrustDomain(r.TLS.VerifiedChains[0][0])
+	}
+
+	certs := r.TLS.PeerCertificates
+	if len(certs) == 0 {
+		return "", nil
+	}
+
+	if h.clientCAs != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         h.clientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err == nil {
+			return leafTrustDomain(certs[0])
+		}
+	}
+
+	td, err := h.verifySVID(r.Context(), certs)
+	if err != nil {
+		return "", err
+	}
+
+	return td.String(), nil
+}
+
+// verifySVID verifies the given X509-SVID against the trust bundle registered
+// for its trust domain, and returns the trust domain.
+func (h *Handler) verifySVID(ctx context.Context, certs []*x509.Certificate) (spiffeid.TrustDomain, error) {
+	id, err := x509svid.IDFromCert(certs[0])
+	if err != nil {
+		return spiffeid.TrustDomain{}, errors.New("client certificate is neither signed by the CA bundle nor an X509-SVID")
+	}
+	td := id.TrustDomain()
+
+	server, err := h.datastore.GetSpireServerByTrustDomain(ctx, td.String())
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return spiffeid.TrustDomain{}, fmt.Errorf("no spire server registered for trust domain %q", td)
+	case err != nil:
+		return spiffeid.TrustDomain{}, err
+	}
+
+	trustBundle, err := h.datastore.GetTrustBundleBySpireServer(ctx, server.ID)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return spiffeid.TrustDomain{}, fmt.Errorf("no trust bundle registered for trust domain %q", td)
+	case err != nil:
+		return spiffeid.TrustDomain{}, err
+	}
+
+	bundle, err := spiffebundle.Parse(td, trustBundle.Bundle)
+	if err != nil {
+		return spiffeid.TrustDomain{}, fmt.Errorf("failed to parse trust bundle of %q: %v", td, err)
+	}
+
+	if _, _, err := x509svid.Verify(certs, bundle); err != nil {
+		return spiffeid.TrustDomain{}, fmt.Errorf("invalid X509-SVID: %v", err)
+	}
+
+	return td, nil
+}
+
+// leafTrustDomain returns the trust domain of the SPIFFE ID of a verified
+// client certificate, or of its subject common name if it has no SPIFFE ID.
+func leafTrustDomain(cert *x509.Certificate) (string, error) {
+	if id, err := x509svid.IDFromCert(cert); err == nil {
+		return id.TrustDomain().String(), nil
+	}
+
+	td, err := spiffeid.TrustDomainFromString(cert.Subject.CommonName)
+	if err != nil {
+		return "", errors.New("client certificate has no SPIFFE ID nor trust domain common name")
+	}
+
+	return td.String(), nil
+}
+
+// bearerCredential returns the credential of the Authorization header of the
+// request, if any.
+func bearerCredential(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+
+	header := r.Header.Get(echo.HeaderAuthorization)
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return header[len(prefix):], true
+}
+
+// peer is a SPIRE Server federated with the caller.
+type peer struct {
+	id          int64
+	trustDomain string
+}
+
+// activePeers returns the SPIRE Servers the caller has an active relationship
+// with, once each.
+func (h *Handler) activePeers(ctx context.Context, caller *datastore.SpireServer) ([]peer, error) {
+	relationships, err := h.datastore.ListRelationships(ctx, datastore.RelationshipFilter{
+		TrustDomain: caller.TrustDomain,
+		Status:      string(common.FederationRelationshipStatusActive),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []peer
+	seen := make(map[int64]bool)
+	for _, relationship := range relationships {
+		p := peer{id: relationship.SpireServerFederatedWithID, trustDomain: relationship.SpireServerFederatedWithTrustDomain}
+		if p.id == caller.ID {
+			p = peer{id: relationship.SpireServerID, trustDomain: relationship.SpireServerTrustDomain}
+		}
+		if seen[p.id] {
+			continue
+		}
+		seen[p.id] = true
+		peers = append(peers, p)
+	}
+
+	return peers, nil
+}
+
+// relationship returns the relationship with the given ID, if the caller is
+// one of its sides.
+func (h *Handler) relationship(ctx context.Context, caller *datastore.SpireServer, id int64) (*datastore.Relationship, error) {
+	relationship, err := h.datastore.GetRelationship(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if relationship.SpireServerID != caller.ID && relationship.SpireServerFederatedWithID != caller.ID {
+		return nil, fmt.Errorf("relationship: %w", datastore.ErrNotFound)
+	}
+
+	return relationship, nil
+}
+
+func (h *Handler) handleError(ctx echo.Context, err error) error {
+	if errors.Is(err, errNotAllowed) {
+		return httputil.WriteError(ctx, http.StatusForbidden, err.Error())
+	}
+	if httputil.StatusCode(err) == http.StatusInternalServerError {
+		h.logger.Error(ctx.Request().Method, ctx.Request().URL.Path, "failed:", err)
+	}
+
+	return httputil.HandleError(ctx, err)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
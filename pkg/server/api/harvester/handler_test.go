@@ -0,0 +1,843 @@
+package harvester
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	t       *testing.T
+	router  *echo.Echo
+	handler *Handler
+	ds      datastore.Datastore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWithMode(t, false)
+}
+
+func newTestServerWithMode(t *testing.T, insecure bool) *testServer {
+	ds, err := datastore.NewSQLDatastore(context.Background(), datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	handler := NewHandler(ds, insecure)
+	router := echo.New()
+	RegisterHandlers(router, handler)
+
+	return &testServer{t: t, router: router, handler: handler, ds: ds}
+}
+
+func (s *testServer) do(method, path, body string, out interface{}) int {
+	return s.doAs(nil, method, path, body, out)
+}
+
+// doAs sends a request authenticated with the given verified client
+// certificate, if not nil.
+func (s *testServer) doAs(cert *x509.Certificate, method, path, body string, out interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return s.send(req, out)
+}
+
+// doFor sends a request authenticated as the harvester of the given trust
+// domain, with a verified client certificate.
+func (s *testServer) doFor(trustDomain, method, path, body string, out interface{}) int {
+	return s.doAs(&x509.Certificate{Subject: pkix.Name{CommonName: trustDomain}}, method, path, body, out)
+}
+
+// credential returns a credential of the harvester of the given SPIRE
+// Server, issued by onboarding it.
+func (s *testServer) credential(spireServerID int64) string {
+	ctx := context.Background()
+
+	token, err := datastore.NewSecret()
+	require.NoError(s.t, err)
+	_, err = s.ds.CreateJoinToken(ctx, &datastore.JoinToken{SpireServerID: spireServerID, Token: token, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(s.t, err)
+
+	credential, err := datastore.NewSecret()
+	require.NoError(s.t, err)
+	_, err = s.ds.RedeemJoinToken(ctx, token, credential)
+	require.NoError(s.t, err)
+
+	return credential
+}
+
+// doWithPeerCertificates sends a request with the given client certificate
+// chain, left to be verified by the handler.
+func (s *testServer) doWithPeerCertificates(certs []*x509.Certificate, method, path, body string, out interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.TLS = &tls.ConnectionState{PeerCertificates: certs}
+	return s.send(req, out)
+}
+
+// doWithCredential sends a request authenticated with the given harvester
+// credential.
+func (s *testServer) doWithCredential(credential, method, path, body string, out interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+credential)
+	return s.send(req, out)
+}
+
+func (s *testServer) send(req *http.Request, out interface{}) int {
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	s.router.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		require.NoError(s.t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+
+	return rec.Code
+}
+
+// setupRelationship creates td1.org and td2.org as active members of a
+// federation group, and a relationship between them.
+func (s *testServer) setupRelationship() *datastore.Relationship {
+	ctx := context.Background()
+
+	org, err := s.ds.CreateOrganization(ctx, &datastore.Organization{Name: "org"})
+	require.NoError(s.t, err)
+	group, err := s.ds.CreateFederationGroup(ctx, &datastore.FederationGroup{OrgID: org.ID, Name: "group", Status: "active"})
+	require.NoError(s.t, err)
+
+	var ids []int64
+	for _, td := range []string{"td1.org", "td2.org"} {
+		server, err := s.ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: td, Status: spireServerActive})
+		require.NoError(s.t, err)
+		_, err = s.ds.CreateMembership(ctx, &datastore.Membership{SpireServerID: server.ID, FederationGroupID: group.ID, Status: "active"})
+		require.NoError(s.t, err)
+		ids = append(ids, server.ID)
+	}
+
+	relationship, err := s.ds.CreateRelationship(ctx, &datastore.Relationship{
+		FederationGroupID:               group.ID,
+		SpireServerID:                   ids[0],
+		SpireServerFederatedWithID:      ids[1],
+		SpireServerConsent:              common.ConsentPending,
+		SpireServerFederatedWithConsent: common.ConsentPending,
+		Status:                          string(common.FederationRelationshipStatusInvited),
+	})
+	require.NoError(s.t, err)
+
+	return relationship
+}
+
+func TestCallerNotAllowed(t *testing.T) {
+	s := newTestServer(t)
+
+	_, err := s.ds.CreateSpireServer(context.Background(), &datastore.SpireServer{TrustDomain: "invited.org", Status: "invited"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		trustDomain string
+		path        string
+		err         string
+	}{
+		{
+			name: "no_caller",
+			path: "/FederationRelationship",
+			err:  errNotAllowed.Error() + ": not authenticated",
+		},
+		{
+			name: "unauthenticated_caller",
+			path: "/FederationRelationship?spireServer=invited.org",
+			err:  errNotAllowed.Error() + ": not authenticated",
+		},
+		{
+			name:        "unknown_caller",
+			trustDomain: "unknown.org",
+			path:        "/FederationRelationship",
+			err:         errNotAllowed.Error(),
+		},
+		{
+			name:        "inactive_caller",
+			trustDomain: "invited.org",
+			path:        "/FederationRelationship",
+			err:         errNotAllowed.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr common.Error
+			if tt.trustDomain == "" {
+				assert.Equal(t, http.StatusForbidden, s.do(http.MethodGet, tt.path, "", &apiErr))
+			} else {
+				assert.Equal(t, http.StatusForbidden, s.doFor(tt.trustDomain, http.MethodGet, tt.path, "", &apiErr))
+			}
+			assert.Equal(t, tt.err, apiErr.Message)
+		})
+	}
+}
+
+func TestInsecureCaller(t *testing.T) {
+	s := newTestServerWithMode(t, true)
+	s.setupRelationship()
+
+	// Harvesters that do not authenticate are trusted to name their SPIRE
+	// Server
+	var relationships []common.FederationRelationship
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/FederationRelationship?spireServer=td1.org", "", &relationships))
+	require.Len(t, relationships, 1)
+	assert.Equal(t, "td1.org", relationships[0].SpireServer)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusForbidden, s.do(http.MethodGet, "/FederationRelationship", "", &apiErr))
+	assert.Equal(t, errNotAllowed.Error(), apiErr.Message)
+
+	// Authenticated harvesters are still bound to their trust domain
+	assert.Equal(t, http.StatusForbidden, s.doFor("td1.org", http.MethodGet, "/FederationRelationship?spireServer=td2.org", "", &apiErr))
+	assert.Equal(t, errNotAllowed.Error()+`: authenticated as "td1.org"`, apiErr.Message)
+}
+
+func TestAuthenticatedCaller(t *testing.T) {
+	s := newTestServer(t)
+	s.setupRelationship()
+
+	spiffeIDCert := &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "td1.org", Path: "/galadriel/harvester"}}}
+	commonNameCert := &x509.Certificate{Subject: pkix.Name{CommonName: "td1.org"}}
+
+	tests := []struct {
+		name   string
+		cert   *x509.Certificate
+		path   string
+		status int
+		err    string
+	}{
+		{
+			name:   "spiffe_id",
+			cert:   spiffeIDCert,
+			path:   "/FederationRelationship",
+			status: http.StatusOK,
+		},
+		{
+			name:   "common_name",
+			cert:   commonNameCert,
+			path:   "/FederationRelationship",
+			status: http.StatusOK,
+		},
+		{
+			name:   "matching_spire_server",
+			cert:   spiffeIDCert,
+			path:   "/FederationRelationship?spireServer=td1.org",
+			status: http.StatusOK,
+		},
+		{
+			name:   "other_spire_server",
+			cert:   spiffeIDCert,
+			path:   "/FederationRelationship?spireServer=td2.org",
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + `: authenticated as "td1.org"`,
+		},
+		{
+			name:   "no_identity",
+			cert:   &x509.Certificate{Subject: pkix.Name{CommonName: "not a trust domain"}},
+			path:   "/FederationRelationship?spireServer=td1.org",
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + ": client certificate has no SPIFFE ID nor trust domain common name",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err != "" {
+				var apiErr common.Error
+				assert.Equal(t, tt.status, s.doAs(tt.cert, http.MethodGet, tt.path, "", &apiErr))
+				assert.Equal(t, tt.err, apiErr.Message)
+				return
+			}
+
+			var relationships []common.FederationRelationship
+			assert.Equal(t, tt.status, s.doAs(tt.cert, http.MethodGet, tt.path, "", &relationships))
+			require.Len(t, relationships, 1)
+			assert.Equal(t, "td1.org", relationships[0].SpireServer)
+		})
+	}
+}
+
+func TestOnboard(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	server, err := s.ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: "td1.org", Status: "invited"})
+	require.NoError(t, err)
+	_, err = s.ds.CreateJoinToken(ctx, &datastore.JoinToken{SpireServerID: server.ID, Token: "token", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/onboard", `{}`, &apiErr))
+	assert.Equal(t, "join token is required", apiErr.Message)
+
+	assert.Equal(t, http.StatusUnauthorized, s.do(http.MethodPost, "/onboard", `{"joinToken":"unknown"}`, &apiErr))
+	assert.Equal(t, "invalid or expired join token", apiErr.Message)
+
+	var resp common.OnboardResponse
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPost, "/onboard", `{"joinToken":"token"}`, &resp))
+	assert.Equal(t, "td1.org", resp.TrustDomain)
+	assert.NotEmpty(t, resp.Credential)
+
+	server, err = s.ds.GetSpireServer(ctx, server.ID)
+	require.NoError(t, err)
+	assert.Equal(t, spireServerActive, server.Status)
+
+	// Join tokens are single use
+	assert.Equal(t, http.StatusUnauthorized, s.do(http.MethodPost, "/onboard", `{"joinToken":"token"}`, &apiErr))
+
+	// The credential authenticates the harvester
+	var bundles []common.TrustBundle
+	assert.Equal(t, http.StatusOK, s.doWithCredential(resp.Credential, http.MethodGet, "/trustBundles", "", &bundles))
+
+	assert.Equal(t, http.StatusForbidden, s.doWithCredential(resp.Credential, http.MethodGet, "/trustBundles?spireServer=td2.org", "", &apiErr))
+	assert.Equal(t, errNotAllowed.Error()+`: authenticated as "td1.org"`, apiErr.Message)
+
+	assert.Equal(t, http.StatusForbidden, s.doWithCredential("invalid", http.MethodGet, "/trustBundles", "", &apiErr))
+	assert.Equal(t, errNotAllowed.Error()+": invalid credential", apiErr.Message)
+}
+
+// testCA is a certificate authority issuing client certificates.
+type testCA struct {
+	t    *testing.T
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{t: t, cert: cert, key: key}
+}
+
+// issue returns a client certificate with the given SPIFFE ID, if any, and
+// subject common name.
+func (ca *testCA) issue(id string, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(ca.t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if id != "" {
+		template.URIs = []*url.URL{spiffeid.RequireFromString(id).URL()}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(ca.t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(ca.t, err)
+
+	return cert
+}
+
+func TestSVIDCaller(t *testing.T) {
+	s := newTestServer(t)
+	s.setupRelationship()
+
+	// td1.org registered the bundle of its SPIRE Server
+	spireCA := newTestCA(t)
+	bundle := spiffebundle.New(spiffeid.RequireTrustDomainFromString("td1.org"))
+	bundle.AddX509Authority(spireCA.cert)
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+	_, err = s.ds.SetTrustBundle(context.Background(), &datastore.TrustBundle{SpireServerID: 1, Bundle: bundleBytes, Status: "active"})
+	require.NoError(t, err)
+
+	clientCA := newTestCA(t)
+	tlsConfig := s.handler.TLSConfig(&tls.Config{ClientCAs: newCertPool(clientCA.cert), ClientAuth: tls.RequireAndVerifyClientCert})
+	assert.Equal(t, tls.RequireAnyClientCert, tlsConfig.ClientAuth)
+	assert.Nil(t, tlsConfig.ClientCAs)
+
+	tests := []struct {
+		name   string
+		certs  []*x509.Certificate
+		status int
+		err    string
+	}{
+		{
+			name:   "svid",
+			certs:  []*x509.Certificate{spireCA.issue("spiffe://td1.org/galadriel/harvester", "")},
+			status: http.StatusOK,
+		},
+		{
+			name:   "client_ca_certificate",
+			certs:  []*x509.Certificate{clientCA.issue("", "td1.org")},
+			status: http.StatusOK,
+		},
+		{
+			name:   "svid_of_other_authority",
+			certs:  []*x509.Certificate{newTestCA(t).issue("spiffe://td1.org/galadriel/harvester", "")},
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + ": invalid X509-SVID: x509svid: could not verify leaf certificate: x509: certificate signed by unknown authority",
+		},
+		{
+			name:   "svid_without_trust_bundle",
+			certs:  []*x509.Certificate{spireCA.issue("spiffe://td2.org/galadriel/harvester", "")},
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + `: no trust bundle registered for trust domain "td2.org"`,
+		},
+		{
+			name:   "svid_of_unknown_trust_domain",
+			certs:  []*x509.Certificate{spireCA.issue("spiffe://unknown.org/galadriel/harvester", "")},
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + `: no spire server registered for trust domain "unknown.org"`,
+		},
+		{
+			name:   "unverified_certificate",
+			certs:  []*x509.Certificate{newTestCA(t).issue("", "td1.org")},
+			status: http.StatusForbidden,
+			err:    errNotAllowed.Error() + ": client certificate is neither signed by the CA bundle nor an X509-SVID",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err != "" {
+				var apiErr common.Error
+				assert.Equal(t, tt.status, s.doWithPeerCertificates(tt.certs, http.MethodGet, "/FederationRelationship", "", &apiErr))
+				assert.True(t, strings.HasPrefix(apiErr.Message, tt.err), apiErr.Message)
+				return
+			}
+
+			var relationships []common.FederationRelationship
+			assert.Equal(t, tt.status, s.doWithPeerCertificates(tt.certs, http.MethodGet, "/FederationRelationship", "", &relationships))
+			require.Len(t, relationships, 1)
+			assert.Equal(t, "td1.org", relationships[0].SpireServer)
+		})
+	}
+}
+
+func newCertPool(certs ...*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+func TestRelationshipConsent(t *testing.T) {
+	s := newTestServer(t)
+	s.setupRelationship()
+
+	var relationships []common.FederationRelationship
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/FederationRelationship", "", &relationships))
+	require.Len(t, relationships, 1)
+	assert.Equal(t, "td1.org", relationships[0].SpireServer)
+
+	// td1.org cannot consent on behalf of td2.org
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.doFor("td1.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerFederatedWithConsent":"accepted"}`, &apiErr))
+	assert.Equal(t, `consent of "td1.org" is required`, apiErr.Message)
+
+	assert.Equal(t, http.StatusNoContent, s.doFor("td1.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerConsent":"accepted"}`, nil))
+
+	assert.Equal(t, http.StatusConflict, s.doFor("td1.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerConsent":"accepted"}`, &apiErr))
+	assert.Equal(t, "consent is already accepted: invalid federation relationship transition", apiErr.Message)
+
+	var relationship common.FederationRelationship
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodGet, "/FederationRelationship/1", "", &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInvited, *relationship.Status)
+
+	assert.Equal(t, http.StatusNoContent, s.doFor("td2.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerFederatedWithConsent":"accepted"}`, nil))
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/FederationRelationship/1", "", &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusActive, *relationship.Status)
+
+	assert.Equal(t, http.StatusNoContent, s.doFor("td2.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerFederatedWithConsent":"denied"}`, nil))
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodGet, "/FederationRelationship/1", "", &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInactive, *relationship.Status)
+
+	assert.Equal(t, http.StatusBadRequest, s.doFor("td2.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerFederatedWithConsent":"maybe"}`, &apiErr))
+	assert.Equal(t, `invalid consent "maybe"`, apiErr.Message)
+
+	// Revoked relationships must be proposed again by an admin
+	assert.Equal(t, http.StatusConflict, s.doFor("td2.org", http.MethodPut, "/FederationRelationship/1", `{"spireServerFederatedWithConsent":"accepted"}`, &apiErr))
+	assert.Equal(t, "relationship is inactive and must be proposed again: invalid federation relationship transition", apiErr.Message)
+
+	// Relationships of other trust domains are not visible
+	_, err := s.ds.CreateSpireServer(context.Background(), &datastore.SpireServer{TrustDomain: "td3.org", Status: spireServerActive})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, s.doFor("td3.org", http.MethodGet, "/FederationRelationship/1", "", &apiErr))
+}
+
+// newUpload returns the trust bundle uploading the SPIFFE bundle of the
+// given trust domain, with the given sequence number and authorities.
+func newUpload(t *testing.T, trustDomain string, sequenceNumber uint64, authorities ...*x509.Certificate) *common.TrustBundle {
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(trustDomain), authorities)
+	bundle.SetSequenceNumber(sequenceNumber)
+	bundle.SetRefreshHint(5 * time.Minute)
+
+	trustBundle, err := common.NewTrustBundle(bundle)
+	require.NoError(t, err)
+
+	return trustBundle
+}
+
+func uploadBody(t *testing.T, trustDomain string, sequenceNumber uint64, authorities ...*x509.Certificate) string {
+	return jsonBody(t, newUpload(t, trustDomain, sequenceNumber, authorities...))
+}
+
+func jsonBody(t *testing.T, v interface{}) string {
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestTrustBundles(t *testing.T) {
+	s := newTestServer(t)
+	relationship := s.setupRelationship()
+	ca := newTestCA(t)
+
+	var bundle common.TrustBundle
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", uploadBody(t, "td1.org", 1, ca.cert), &bundle))
+	assert.Equal(t, common.TrustBundleStatusActive, *bundle.Status)
+	assert.Equal(t, uint64(1), *bundle.SequenceNumber)
+	assert.Equal(t, int64(300), *bundle.RefreshHint)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusForbidden, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", uploadBody(t, "td2.org", 1, ca.cert), &apiErr))
+	assert.Equal(t, `"td1.org" cannot upload the trust bundle of "td2.org"`, apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", `{}`, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", `{"bundle":"not a bundle"}`, &apiErr))
+	assert.Contains(t, apiErr.Message, `invalid bundle of "td1.org"`)
+	assert.Equal(t, http.StatusNotFound, s.doFor("td1.org", http.MethodPut, "/trustBundles/42", uploadBody(t, "td1.org", 2, ca.cert), &apiErr))
+
+	// The sequence number can not go backwards
+	assert.Equal(t, http.StatusConflict, s.doFor("td1.org", http.MethodPut, "/trustBundles/1", uploadBody(t, "td1.org", 0, ca.cert), &apiErr))
+	assert.Equal(t, `stale trust bundle: sequence number 0 of "td1.org" is lower than the current 1`, apiErr.Message)
+
+	// Signatures are relayed as-is
+	upload := newUpload(t, "td1.org", 2, ca.cert)
+	signature, signingCertificate := "c2ln", "svid"
+	upload.Signature, upload.SigningCertificate = &signature, &signingCertificate
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodPut, "/trustBundles/1", jsonBody(t, upload), &bundle))
+
+	// The relationship is not active yet
+	var bundles []common.TrustBundle
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/trustBundles", "", &bundles))
+	assert.Empty(t, bundles)
+
+	relationship.SpireServerConsent = common.ConsentAccepted
+	relationship.SpireServerFederatedWithConsent = common.ConsentAccepted
+	relationship.Status = string(common.FederationRelationshipStatusActive)
+	_, err := s.ds.UpdateRelationship(context.Background(), relationship)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/trustBundles", "", &bundles))
+	require.Len(t, bundles, 1)
+	assert.Equal(t, "td1.org", *bundles[0].TrustDomain)
+	assert.Equal(t, uint64(2), *bundles[0].SequenceNumber)
+	assert.Equal(t, "c2ln", *bundles[0].Signature)
+	assert.Equal(t, "svid", *bundles[0].SigningCertificate)
+
+	parsed, err := bundles[0].SPIFFEBundle()
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ca.cert}, parsed.X509Authorities())
+
+	// td2.org has not uploaded its trust bundle yet
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodGet, "/trustBundles", "", &bundles))
+	assert.Empty(t, bundles)
+
+	// Trust bundles pending deletion are not served
+	stored, err := s.ds.GetTrustBundle(context.Background(), bundle.Id)
+	require.NoError(t, err)
+	stored.Status = string(common.TrustBundleStatusToDelete)
+	_, err = s.ds.SetTrustBundle(context.Background(), stored)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/trustBundles", "", &bundles))
+	assert.Empty(t, bundles)
+}
+
+func TestEvents(t *testing.T) {
+	s := newTestServer(t)
+	relationship := s.setupRelationship()
+	ctx := context.Background()
+
+	for _, event := range []*datastore.Event{
+		{TrustDomain: "td1.org", Type: string(common.TrustBundlePruned), Message: "pruned"},
+		{TrustDomain: "td3.org", Type: string(common.TrustBundleToDelete)},
+		{TrustDomain: "td1.org", Type: string(common.TrustBundleToDelete)},
+	} {
+		_, err := s.ds.CreateEvent(ctx, event)
+		require.NoError(t, err)
+	}
+
+	// The relationship is not active yet
+	var events []common.Event
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/events", "", &events))
+	assert.Empty(t, events)
+
+	relationship.Status = string(common.FederationRelationshipStatusActive)
+	_, err := s.ds.UpdateRelationship(ctx, relationship)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/events", "", &events))
+	require.Len(t, events, 2)
+	assert.Equal(t, "td1.org", events[0].TrustDomain)
+	assert.Equal(t, common.TrustBundlePruned, events[0].Type)
+	assert.Equal(t, "pruned", *events[0].Message)
+	assert.Equal(t, common.TrustBundleToDelete, events[1].Type)
+	assert.Nil(t, events[1].Message)
+
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events?after=%d", events[0].Id), "", &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, common.TrustBundleToDelete, events[0].Type)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusForbidden, s.doFor("td3.org", http.MethodGet, "/events", "", &apiErr))
+}
+
+func TestEventsExpired(t *testing.T) {
+	s := newTestServer(t)
+	relationship := s.setupRelationship()
+	ctx := context.Background()
+
+	relationship.Status = string(common.FederationRelationshipStatusActive)
+	_, err := s.ds.UpdateRelationship(ctx, relationship)
+	require.NoError(t, err)
+
+	var created []*datastore.Event
+	for i := 0; i < 3; i++ {
+		event, err := s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td1.org", Type: string(common.TrustBundleUpdated)})
+		require.NoError(t, err)
+		created = append(created, event)
+	}
+	_, err = s.ds.DeleteEventsBefore(ctx, created[2].CreatedAt)
+	require.NoError(t, err)
+
+	// Resuming after the last deleted event misses none
+	var events []common.Event
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events?after=%d", created[1].ID), "", &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, created[2].ID, events[0].Id)
+
+	// Resuming after an earlier event would miss the deleted ones
+	var apiErr common.Error
+	assert.Equal(t, http.StatusGone, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events?after=%d", created[0].ID), "", &apiErr))
+	assert.Equal(t, fmt.Sprintf("cursor expired, resync: the events up to %d were deleted", created[1].ID), apiErr.Message)
+	assert.Equal(t, http.StatusGone, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events/stream?after=%d", created[0].ID), "", &apiErr))
+
+	// Without a cursor, the retained events are returned
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/events", "", &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, created[2].ID, events[0].Id)
+}
+
+func TestWaitEvents(t *testing.T) {
+	s := newTestServer(t)
+	relationship := s.setupRelationship()
+	ctx := context.Background()
+
+	relationship.Status = string(common.FederationRelationshipStatusActive)
+	_, err := s.ds.UpdateRelationship(ctx, relationship)
+	require.NoError(t, err)
+
+	// Uploading a new bundle records an event, uploading it again does not
+	ca := newTestCA(t)
+	body := uploadBody(t, "td1.org", 1, ca.cert)
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", body, nil))
+	assert.Equal(t, http.StatusOK, s.doFor("td1.org", http.MethodPut, "/trustBundles/0", body, nil))
+
+	var events []common.Event
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, "/events?wait=10", "", &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, "td1.org", events[0].TrustDomain)
+	assert.Equal(t, common.TrustBundleUpdated, events[0].Type)
+	last := events[0].Id
+
+	// The request is held until the next event
+	created := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td1.org", Type: string(common.TrustBundlePruned)})
+		created <- err
+	}()
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events?after=%d&wait=10", last), "", &events))
+	require.NoError(t, <-created)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, events, 1)
+	assert.Equal(t, common.TrustBundlePruned, events[0].Type)
+	last = events[0].Id
+
+	// Events of trust domains that are not federated do not end the wait
+	_, err = s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td3.org", Type: string(common.TrustBundlePruned)})
+	require.NoError(t, err)
+	start = time.Now()
+	events = nil
+	assert.Equal(t, http.StatusOK, s.doFor("td2.org", http.MethodGet, fmt.Sprintf("/events?after=%d&wait=1", last), "", &events))
+	assert.Empty(t, events)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.doFor("td2.org", http.MethodGet, "/events?wait=61", "", &apiErr))
+	assert.Equal(t, "wait must be between 0 and 60 seconds", apiErr.Message)
+}
+
+// eventStream reads the server-sent events of a stream.
+type eventStream struct {
+	t          *testing.T
+	reader     *bufio.Reader
+	heartbeats int
+}
+
+// next returns the next event of the stream, skipping the heartbeats.
+func (s *eventStream) next() common.Event {
+	var event common.Event
+	var id, eventType, data string
+	for {
+		line, err := s.reader.ReadString('\n')
+		require.NoError(s.t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && data != "":
+			require.NoError(s.t, json.Unmarshal([]byte(data), &event))
+			assert.Equal(s.t, strconv.FormatInt(event.Id, 10), id)
+			assert.Equal(s.t, string(event.Type), eventType)
+			return event
+		case strings.HasPrefix(line, ":"):
+			s.heartbeats++
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (s *testServer) stream(ctx context.Context, url, credential, lastEventID string) *eventStream {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/events/stream", nil)
+	require.NoError(s.t, err)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+credential)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(s.t, http.StatusOK, resp.StatusCode)
+	assert.Equal(s.t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	return &eventStream{t: s.t, reader: bufio.NewReader(resp.Body)}
+}
+
+func TestStreamEvents(t *testing.T) {
+	s := newTestServer(t)
+	s.handler.heartbeatInterval = 10 * time.Millisecond
+	relationship := s.setupRelationship()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	_, err := s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td1.org", Type: string(common.TrustBundlePruned)})
+	require.NoError(t, err)
+	_, err = s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td3.org", Type: string(common.TrustBundlePruned)})
+	require.NoError(t, err)
+
+	// The consent of each side is recorded as an event of both sides
+	path := fmt.Sprintf("/FederationRelationship/%d", relationship.ID)
+	require.Equal(t, http.StatusNoContent, s.doFor("td1.org", http.MethodPut, path, `{"spireServerConsent":"accepted"}`, nil))
+	require.Equal(t, http.StatusNoContent, s.doFor("td2.org", http.MethodPut, path, `{"spireServerFederatedWithConsent":"accepted"}`, nil))
+
+	// td2.org gets the bundle events of td1.org, now that their relationship
+	// is active, and the events of its own relationships only
+	credential := s.credential(relationship.SpireServerFederatedWithID)
+	stream := s.stream(ctx, server.URL, credential, "")
+	event := stream.next()
+	assert.Equal(t, "td1.org", event.TrustDomain)
+	assert.Equal(t, common.TrustBundlePruned, event.Type)
+
+	event = stream.next()
+	assert.Equal(t, "td2.org", event.TrustDomain)
+	assert.Equal(t, common.RelationshipUpdated, event.Type)
+	assert.Equal(t, fmt.Sprintf("relationship %d with td1.org is invited", relationship.ID), *event.Message)
+
+	event = stream.next()
+	assert.Equal(t, "td2.org", event.TrustDomain)
+	assert.Equal(t, fmt.Sprintf("relationship %d with td1.org is active", relationship.ID), *event.Message)
+	lastEventID := strconv.FormatInt(event.Id, 10)
+
+	// New events are pushed as they happen, the stream is kept alive by
+	// heartbeats in the meantime
+	time.Sleep(50 * time.Millisecond)
+	created, err := s.ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "td1.org", Type: string(common.TrustBundleUpdated)})
+	require.NoError(t, err)
+	event = stream.next()
+	assert.Equal(t, created.ID, event.Id)
+	assert.Equal(t, common.TrustBundleUpdated, event.Type)
+	assert.Positive(t, stream.heartbeats)
+
+	// A reconnecting client resumes after the last event it got
+	stream = s.stream(ctx, server.URL, credential, lastEventID)
+	assert.Equal(t, created.ID, stream.next().Id)
+
+	// Streams end when the server shuts down
+	s.handler.CloseStreams()
+	_, err = io.ReadAll(stream.reader)
+	assert.NoError(t, err)
+
+	var apiErr common.Error
+	req := httptest.NewRequest(http.MethodGet, "/events/stream", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+credential)
+	req.Header.Set("Last-Event-ID", "last")
+	assert.Equal(t, http.StatusBadRequest, s.send(req, &apiErr))
+	assert.Equal(t, http.StatusForbidden, s.doFor("td3.org", http.MethodGet, "/events/stream", "", &apiErr))
+}
@@ -23,6 +23,57 @@ type GetFederationRelationshipsParams struct {
 	FederationGroupId *int64 `form:"federationGroupId,omitempty" json:"federationGroupId,omitempty"`
 }
 
+// GetRelationshipbyIDParams defines parameters for GetRelationshipbyID.
+type GetRelationshipbyIDParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+}
+
+// UpdateFederatedRelationshipStatusParams defines parameters for UpdateFederatedRelationshipStatus.
+type UpdateFederatedRelationshipStatusParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+}
+
+// GetEventsParams defines parameters for GetEvents.
+type GetEventsParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+
+	// only return the events with a greater id
+	After *int64 `form:"after,omitempty" json:"after,omitempty"`
+
+	// seconds to wait for an event when there is none yet, up to 60
+	Wait *int32 `form:"wait,omitempty" json:"wait,omitempty"`
+}
+
+// StreamEventsParams defines parameters for StreamEvents.
+type StreamEventsParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+
+	// only stream the events with a greater id, overridden by the Last-Event-ID header
+	After *int64 `form:"after,omitempty" json:"after,omitempty"`
+}
+
+// OnboardJSONBody defines parameters for Onboard.
+type OnboardJSONBody = interface{}
+
+// GetTrustBundlesParams defines parameters for GetTrustBundles.
+type GetTrustBundlesParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+}
+
+// UpdateTrustBundleParams defines parameters for UpdateTrustBundle.
+type UpdateTrustBundleParams struct {
+	// trust domain of the calling SPIRE server
+	SpireServer *string `form:"spireServer,omitempty" json:"spireServer,omitempty"`
+}
+
+// OnboardJSONRequestBody defines body for Onboard for application/json ContentType.
+type OnboardJSONRequestBody = OnboardJSONBody
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 
@@ -30,13 +81,25 @@ type ServerInterface interface {
 	GetFederationRelationships(ctx echo.Context, params GetFederationRelationshipsParams) error
 
 	// (GET /FederationRelationship/{relationshipID})
-	GetRelationshipbyID(ctx echo.Context, relationshipID int64) error
+	GetRelationshipbyID(ctx echo.Context, relationshipID int64, params GetRelationshipbyIDParams) error
 
 	// (PUT /FederationRelationship/{relationshipID})
-	UpdateFederatedRelationshipStatus(ctx echo.Context, relationshipID int64) error
+	UpdateFederatedRelationshipStatus(ctx echo.Context, relationshipID int64, params UpdateFederatedRelationshipStatusParams) error
+
+	// (GET /events)
+	GetEvents(ctx echo.Context, params GetEventsParams) error
+
+	// (GET /events/stream)
+	StreamEvents(ctx echo.Context, params StreamEventsParams) error
+
+	// (POST /onboard)
+	Onboard(ctx echo.Context) error
+
+	// (GET /trustBundles)
+	GetTrustBundles(ctx echo.Context, params GetTrustBundlesParams) error
 
 	// (PUT /trustBundles/{trustBundleId})
-	UpdateTrustBundle(ctx echo.Context, trustBundleId int64) error
+	UpdateTrustBundle(ctx echo.Context, trustBundleId int64, params UpdateTrustBundleParams) error
 }
 
 // ServerInterfaceWrapper converts echo contexts to parameters.
@@ -87,8 +150,17 @@ func (w *ServerInterfaceWrapper) GetRelationshipbyID(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter relationshipID: %s", err))
 	}
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetRelationshipbyIDParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshalled arguments
-	err = w.Handler.GetRelationshipbyID(ctx, relationshipID)
+	err = w.Handler.GetRelationshipbyID(ctx, relationshipID, params)
 	return err
 }
 
@@ -103,8 +175,101 @@ func (w *ServerInterfaceWrapper) UpdateFederatedRelationshipStatus(ctx echo.Cont
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter relationshipID: %s", err))
 	}
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params UpdateFederatedRelationshipStatusParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshalled arguments
-	err = w.Handler.UpdateFederatedRelationshipStatus(ctx, relationshipID)
+	err = w.Handler.UpdateFederatedRelationshipStatus(ctx, relationshipID, params)
+	return err
+}
+
+// GetEvents converts echo context to params.
+func (w *ServerInterfaceWrapper) GetEvents(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetEventsParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
+	// ------------- Optional query parameter "after" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "after", ctx.QueryParams(), &params.After)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter after: %s", err))
+	}
+
+	// ------------- Optional query parameter "wait" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "wait", ctx.QueryParams(), &params.Wait)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter wait: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetEvents(ctx, params)
+	return err
+}
+
+// StreamEvents converts echo context to params.
+func (w *ServerInterfaceWrapper) StreamEvents(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params StreamEventsParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
+	// ------------- Optional query parameter "after" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "after", ctx.QueryParams(), &params.After)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter after: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.StreamEvents(ctx, params)
+	return err
+}
+
+// Onboard converts echo context to params.
+func (w *ServerInterfaceWrapper) Onboard(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.Onboard(ctx)
+	return err
+}
+
+// GetTrustBundles converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTrustBundles(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTrustBundlesParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetTrustBundles(ctx, params)
 	return err
 }
 
@@ -119,8 +284,17 @@ func (w *ServerInterfaceWrapper) UpdateTrustBundle(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter trustBundleId: %s", err))
 	}
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params UpdateTrustBundleParams
+	// ------------- Optional query parameter "spireServer" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spireServer", ctx.QueryParams(), &params.SpireServer)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServer: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshalled arguments
-	err = w.Handler.UpdateTrustBundle(ctx, trustBundleId)
+	err = w.Handler.UpdateTrustBundle(ctx, trustBundleId, params)
 	return err
 }
 
@@ -155,6 +329,10 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 	router.GET(baseURL+"/FederationRelationship", wrapper.GetFederationRelationships)
 	router.GET(baseURL+"/FederationRelationship/:relationshipID", wrapper.GetRelationshipbyID)
 	router.PUT(baseURL+"/FederationRelationship/:relationshipID", wrapper.UpdateFederatedRelationshipStatus)
+	router.GET(baseURL+"/events", wrapper.GetEvents)
+	router.GET(baseURL+"/events/stream", wrapper.StreamEvents)
+	router.POST(baseURL+"/onboard", wrapper.Onboard)
+	router.GET(baseURL+"/trustBundles", wrapper.GetTrustBundles)
 	router.PUT(baseURL+"/trustBundles/:trustBundleId", wrapper.UpdateTrustBundle)
 
 }
@@ -0,0 +1,56 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+)
+
+// WriteError writes a common.Error response with the given HTTP status code.
+func WriteError(ctx echo.Context, code int, message string) error {
+	return ctx.JSON(code, common.Error{
+		Code:    int32(code),
+		Message: message,
+	})
+}
+
+// BadRequest writes a common.Error response with the 400 status code.
+func BadRequest(ctx echo.Context, format string, args ...interface{}) error {
+	return WriteError(ctx, http.StatusBadRequest, fmt.Sprintf(format, args...))
+}
+
+// HandleError writes a common.Error response with the HTTP status code that
+// corresponds to the given error. Internal errors are not exposed to the client.
+func HandleError(ctx echo.Context, err error) error {
+	code := StatusCode(err)
+	if code == http.StatusInternalServerError {
+		return WriteError(ctx, code, http.StatusText(code))
+	}
+
+	return WriteError(ctx, code, err.Error())
+}
+
+// StatusCode maps datastore, federation relationship workflow, stale trust
+// bundle and expired events errors to HTTP status codes.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, datastore.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, datastore.ErrInvalidReference):
+		return http.StatusBadRequest
+	case errors.Is(err, common.ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, common.ErrStaleTrustBundle):
+		return http.StatusConflict
+	case errors.Is(err, common.ErrEventsExpired):
+		return http.StatusGone
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,266 @@
+package management
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+)
+
+// Client is an HTTP client of the management API of a Galadriel Server,
+// listening on the given address.
+type Client struct {
+	address string
+	client  *http.Client
+}
+
+func NewClient(address string) *Client {
+	return &Client{
+		address: address,
+		client:  &http.Client{},
+	}
+}
+
+func (c *Client) CreateOrganization(ctx context.Context, name string) (*Organization, error) {
+	var org Organization
+	if err := c.do(ctx, http.MethodPost, "/organizations", nil, Organization{Name: name}, &org); err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// ListOrganizations returns the organizations with the given name, if not
+// empty.
+func (c *Client) ListOrganizations(ctx context.Context, name string) ([]Organization, error) {
+	query := url.Values{}
+	setQuery(query, "name", name)
+
+	var orgs []Organization
+	if err := c.do(ctx, http.MethodGet, "/organizations", query, nil, &orgs); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (c *Client) DeleteOrganization(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/organizations/%d", id), nil, nil, nil)
+}
+
+func (c *Client) CreateFederationGroup(ctx context.Context, orgID int64, name string) (*FederationGroup, error) {
+	var group FederationGroup
+	if err := c.do(ctx, http.MethodPost, "/federationGroups", nil, FederationGroup{Orgid: orgID, Name: name}, &group); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// ListFederationGroups returns the federation groups matching the given
+// parameters.
+func (c *Client) ListFederationGroups(ctx context.Context, params GetFederationGroupsParams) ([]FederationGroup, error) {
+	query := url.Values{}
+	setQuery(query, "orgId", stringValue(params.OrgId))
+	setQuery(query, "orgname", stringValue(params.Orgname))
+	setQuery(query, "name", stringValue(params.Name))
+
+	var groups []FederationGroup
+	if err := c.do(ctx, http.MethodGet, "/federationGroups", query, nil, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (c *Client) DeleteFederationGroup(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/federationGroups/%d", id), nil, nil, nil)
+}
+
+func (c *Client) CreateSpireServer(ctx context.Context, server SpireServer) (*SpireServer, error) {
+	var out SpireServer
+	if err := c.do(ctx, http.MethodPost, "/spireServers", nil, server, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// ListSpireServers returns the SPIRE servers matching the given parameters.
+func (c *Client) ListSpireServers(ctx context.Context, params GetSpireServersParams) ([]SpireServer, error) {
+	query := url.Values{}
+	setQuery(query, "trustDomain", stringValue(params.TrustDomain))
+	if params.Status != nil {
+		setQuery(query, "status", string(*params.Status))
+	}
+
+	var servers []SpireServer
+	if err := c.do(ctx, http.MethodGet, "/spireServers", query, nil, &servers); err != nil {
+		return nil, err
+	}
+
+	return servers, nil
+}
+
+func (c *Client) GetSpireServer(ctx context.Context, id int64) (*SpireServer, error) {
+	var server SpireServer
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/spireServers/%d", id), nil, nil, &server); err != nil {
+		return nil, err
+	}
+
+	return &server, nil
+}
+
+func (c *Client) UpdateSpireServer(ctx context.Context, id int64, server SpireServer) (*SpireServer, error) {
+	var out SpireServer
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/spireServers/%d", id), nil, server, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (c *Client) DeleteSpireServer(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/spireServers/%d", id), nil, nil, nil)
+}
+
+// CreateJoinToken creates a join token to onboard the harvester of the given
+// SPIRE server with. The join token expires after the given time to live,
+// rounded down to the second, or after the server default if zero.
+func (c *Client) CreateJoinToken(ctx context.Context, spireServerID int64, ttl time.Duration) (*JoinToken, error) {
+	query := url.Values{}
+	if ttl != 0 {
+		query.Set("ttl", strconv.FormatInt(int64(ttl/time.Second), 10))
+	}
+
+	var token JoinToken
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/spireServers/%d/joinToken", spireServerID), query, nil, &token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (c *Client) CreateMembership(ctx context.Context, spireServerID, federationGroupID int64) (*FederationGroupMembership, error) {
+	var membership FederationGroupMembership
+	if err := c.do(ctx, http.MethodPost, "/federationGroupMemberships", nil, FederationGroupMembership{
+		SpireServerId:     spireServerID,
+		FederationGroupId: federationGroupID,
+	}, &membership); err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (c *Client) DeleteMembership(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/federationGroupMemberships/%d", id), nil, nil, nil)
+}
+
+// CreateRelationship proposes a federation relationship between two SPIRE
+// servers of a federation group.
+func (c *Client) CreateRelationship(ctx context.Context, federationGroupID int64, spireServer, federatedWith string) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	if err := c.do(ctx, http.MethodPost, "/federationRelationships", nil, common.FederationRelationship{
+		FederationGroupId:        federationGroupID,
+		SpireServer:              spireServer,
+		SpireServerFederatedWith: federatedWith,
+	}, &relationship); err != nil {
+		return nil, err
+	}
+
+	return &relationship, nil
+}
+
+// ListRelationships returns the federation relationships matching the given
+// parameters.
+func (c *Client) ListRelationships(ctx context.Context, params GetFederationRelationshipsParams) ([]common.FederationRelationship, error) {
+	query := url.Values{}
+	setQuery(query, "orgId", stringValue(params.OrgId))
+	setQuery(query, "orgname", stringValue(params.Orgname))
+	setQuery(query, "trustDomain", stringValue(params.TrustDomain))
+	if params.Status != nil {
+		setQuery(query, "status", string(*params.Status))
+	}
+
+	var relationships []common.FederationRelationship
+	if err := c.do(ctx, http.MethodGet, "/federationRelationships", query, nil, &relationships); err != nil {
+		return nil, err
+	}
+
+	return relationships, nil
+}
+
+func (c *Client) GetRelationship(ctx context.Context, id int64) (*common.FederationRelationship, error) {
+	var relationship common.FederationRelationship
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/federationRelationships/%d", id), nil, nil, &relationship); err != nil {
+		return nil, err
+	}
+
+	return &relationship, nil
+}
+
+// do sends a request with the JSON encoded body, if not nil, to the
+// management API, and decodes the JSON response into out, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := url.URL{Scheme: "http", Host: c.address, Path: path, RawQuery: query.Encode()}
+
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the management API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr common.Error
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s (status %d)", apiErr.Message, resp.StatusCode)
+		}
+		return fmt.Errorf("management API responded with status %d", resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return nil
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
@@ -0,0 +1,253 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+func organizationToAPI(in *datastore.Organization) Organization {
+	return Organization{
+		Id:   in.ID,
+		Name: in.Name,
+	}
+}
+
+func federationGroupFromAPI(in *FederationGroup) (*datastore.FederationGroup, error) {
+	if in.Name == "" {
+		return nil, errors.New("federation group name is required")
+	}
+	if in.Orgid == 0 {
+		return nil, errors.New("federation group orgid is required")
+	}
+
+	status := FederationGroupStatusActive
+	if in.Status != nil {
+		status = *in.Status
+	}
+	switch status {
+	case FederationGroupStatusActive, FederationGroupStatusInactive:
+	default:
+		return nil, fmt.Errorf("invalid federation group status %q", status)
+	}
+
+	return &datastore.FederationGroup{
+		OrgID:  in.Orgid,
+		Name:   in.Name,
+		Status: string(status),
+	}, nil
+}
+
+func federationGroupToAPI(in *datastore.FederationGroup) FederationGroup {
+	status := FederationGroupStatus(in.Status)
+	return FederationGroup{
+		Id:     in.ID,
+		Orgid:  in.OrgID,
+		Name:   in.Name,
+		Status: &status,
+	}
+}
+
+func spireServerFromAPI(in *SpireServer) (*datastore.SpireServer, error) {
+	if in.TrustDomain == nil {
+		return nil, errors.New("spire server trust domain is required")
+	}
+
+	td, err := spiffeid.TrustDomainFromString(*in.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spire server trust domain: %v", err)
+	}
+
+	switch in.Status {
+	case Invited, Active, Inactive:
+	default:
+		return nil, fmt.Errorf("invalid spire server status %q", in.Status)
+	}
+
+	bundleEndpoint, err := bundleEndpointFromAPI(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &datastore.SpireServer{
+		TrustDomain:    td.String(),
+		Description:    in.Description,
+		BundleEndpoint: bundleEndpoint,
+		Status:         string(in.Status),
+	}, nil
+}
+
+// bundleEndpointFromAPI validates the bundle endpoint of a SPIRE server. The
+// bundle endpoint is optional, but when the URL is set it must be an https
+// URL with a profile, and the https_spiffe profile requires the SPIFFE ID of
+// the endpoint server.
+func bundleEndpointFromAPI(in *SpireServer) (datastore.BundleEndpoint, error) {
+	url, profile, spiffeID := stringValue(in.BundleEndpointUrl), "", stringValue(in.BundleEndpointSpiffeId)
+	if in.BundleEndpointProfile != nil {
+		profile = string(*in.BundleEndpointProfile)
+	}
+
+	if url == "" {
+		if profile != "" || spiffeID != "" {
+			return datastore.BundleEndpoint{}, errors.New("spire server bundleEndpointUrl is required by the bundle endpoint profile")
+		}
+		return datastore.BundleEndpoint{}, nil
+	}
+
+	u, err := neturl.Parse(url)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return datastore.BundleEndpoint{}, fmt.Errorf("invalid spire server bundleEndpointUrl %q: must be an https URL", url)
+	}
+
+	switch SpireServerBundleEndpointProfile(profile) {
+	case HttpsWeb:
+		if spiffeID != "" {
+			return datastore.BundleEndpoint{}, errors.New("spire server bundleEndpointSpiffeId is only allowed by the https_spiffe profile")
+		}
+	case HttpsSpiffe:
+		id, err := spiffeid.FromString(spiffeID)
+		if err != nil {
+			return datastore.BundleEndpoint{}, fmt.Errorf("invalid spire server bundleEndpointSpiffeId: %v", err)
+		}
+		spiffeID = id.String()
+	default:
+		return datastore.BundleEndpoint{}, fmt.Errorf("invalid spire server bundleEndpointProfile %q", profile)
+	}
+
+	return datastore.BundleEndpoint{
+		URL:      u.String(),
+		Profile:  profile,
+		SpiffeID: spiffeID,
+	}, nil
+}
+
+func spireServerToAPI(in *datastore.SpireServer) SpireServer {
+	trustDomain := in.TrustDomain
+	out := SpireServer{
+		Id:          in.ID,
+		TrustDomain: &trustDomain,
+		Description: in.Description,
+		Status:      SpireServerStatus(in.Status),
+	}
+
+	if in.BundleEndpoint.URL != "" {
+		url := in.BundleEndpoint.URL
+		profile := SpireServerBundleEndpointProfile(in.BundleEndpoint.Profile)
+		out.BundleEndpointUrl = &url
+		out.BundleEndpointProfile = &profile
+	}
+	if in.BundleEndpoint.SpiffeID != "" {
+		spiffeID := in.BundleEndpoint.SpiffeID
+		out.BundleEndpointSpiffeId = &spiffeID
+	}
+
+	return out
+}
+
+func membershipFromAPI(in *FederationGroupMembership) (*datastore.Membership, error) {
+	if in.SpireServerId == 0 {
+		return nil, errors.New("membership spireServerId is required")
+	}
+	if in.FederationGroupId == 0 {
+		return nil, errors.New("membership federationGroupId is required")
+	}
+
+	status := in.Status
+	if status == "" {
+		status = FederationGroupMembershipStatusActive
+	}
+	switch status {
+	case FederationGroupMembershipStatusActive, FederationGroupMembershipStatusInactive:
+	default:
+		return nil, fmt.Errorf("invalid membership status %q", status)
+	}
+
+	return &datastore.Membership{
+		SpireServerID:     in.SpireServerId,
+		FederationGroupID: in.FederationGroupId,
+		Status:            string(status),
+	}, nil
+}
+
+func membershipToAPI(in *datastore.Membership) FederationGroupMembership {
+	id := in.ID
+	return FederationGroupMembership{
+		Id:                &id,
+		SpireServerId:     in.SpireServerID,
+		FederationGroupId: in.FederationGroupID,
+		Status:            FederationGroupMembershipStatus(in.Status),
+	}
+}
+
+func relationshipToAPI(in *datastore.Relationship) common.FederationRelationship {
+	status := common.FederationRelationshipStatus(in.Status)
+	spireServerConsent := in.SpireServerConsent
+	federatedWithConsent := in.SpireServerFederatedWithConsent
+	return common.FederationRelationship{
+		Id:                              in.ID,
+		FederationGroupId:               in.FederationGroupID,
+		SpireServer:                     in.SpireServerTrustDomain,
+		SpireServerConsent:              &spireServerConsent,
+		SpireServerFederatedWith:        in.SpireServerFederatedWithTrustDomain,
+		SpireServerFederatedWithConsent: &federatedWithConsent,
+		Status:                          &status,
+
+		SpireServerBundleEndpoint:              bundleEndpointToAPI(in.SpireServerBundleEndpoint),
+		SpireServerFederatedWithBundleEndpoint: bundleEndpointToAPI(in.SpireServerFederatedWithBundleEndpoint),
+	}
+}
+
+func bundleEndpointToAPI(in datastore.BundleEndpoint) *common.BundleEndpoint {
+	if in.URL == "" {
+		return nil
+	}
+
+	out := &common.BundleEndpoint{
+		Url:     in.URL,
+		Profile: common.BundleEndpointProfile(in.Profile),
+	}
+	if in.SpiffeID != "" {
+		spiffeID := in.SpiffeID
+		out.SpiffeId = &spiffeID
+	}
+
+	return out
+}
+
+// isConsentGiven reports whether the given consent of a relationship side is
+// set to anything but pending.
+func isConsentGiven(consent *string) bool {
+	return consent != nil && *consent != common.ConsentPending
+}
+
+func validateTrustBundleStatus(status common.TrustBundleStatus) error {
+	switch status {
+	case common.TrustBundleStatusActive, common.TrustBundleStatusInactive, common.TrustBundleStatusToDelete:
+		return nil
+	}
+
+	return fmt.Errorf("invalid trust bundle status %q", status)
+}
+
+func trustBundleToAPI(in *datastore.TrustBundle) common.TrustBundle {
+	trustDomain := in.TrustDomain
+	status := common.TrustBundleStatus(in.Status)
+	out := common.TrustBundle{
+		Id:          in.ID,
+		TrustDomain: &trustDomain,
+		Bundle:      string(in.Bundle),
+		Status:      &status,
+	}
+	if in.Signature != "" {
+		signature, signingCertificate := in.Signature, in.SigningCertificate
+		out.Signature = &signature
+		out.SigningCertificate = &signingCertificate
+	}
+	common.SetBundleMetadata(&out)
+
+	return out
+}
@@ -1,35 +1,696 @@
 package management
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/httputil"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
 	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 )
 
-type MyDumbServer struct {
+var _ ServerInterface = (*Handler)(nil)
+
+const (
+	defaultJoinTokenTTL = time.Hour
+	maxJoinTokenTTL     = 7 * 24 * time.Hour
+
+	// consentByHarvesters is the error message of the requests that try to
+	// give the consent of a relationship side on behalf of its harvester.
+	consentByHarvesters = "consent is given by the harvesters of each side"
+)
+
+// Handler implements the management API on top of a datastore.
+type Handler struct {
+	datastore datastore.Datastore
+	logger    common.Logger
+}
+
+// NewHandler returns a new management API handler backed by the given datastore.
+func NewHandler(ds datastore.Datastore) *Handler {
+	return &Handler{
+		datastore: ds,
+		logger:    *common.NewLogger(telemetry.ManagementAPI),
+	}
+}
+
+// (GET /organizations)
+func (h *Handler) GetOrganizations(ctx echo.Context, params GetOrganizationsParams) error {
+	orgs, err := h.datastore.ListOrganizations(ctx.Request().Context(), datastore.OrganizationFilter{
+		Name: stringValue(params.Name),
+	})
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]Organization, 0, len(orgs))
+	for _, org := range orgs {
+		out = append(out, organizationToAPI(org))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (POST /organizations)
+func (h *Handler) CreateOrganization(ctx echo.Context) error {
+	var in Organization
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse organization: %v", err)
+	}
+	if in.Name == "" {
+		return httputil.BadRequest(ctx, "organization name is required")
+	}
+
+	org, err := h.datastore.CreateOrganization(ctx.Request().Context(), &datastore.Organization{Name: in.Name})
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, organizationToAPI(org))
+}
+
+// (DELETE /organizations/{orgID})
+func (h *Handler) DeleteOrganization(ctx echo.Context, orgID int64) error {
+	if err := h.datastore.DeleteOrganization(ctx.Request().Context(), orgID); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (GET /organizations/{orgID})
+func (h *Handler) GetOrgbyID(ctx echo.Context, orgID int64) error {
+	org, err := h.datastore.GetOrganization(ctx.Request().Context(), orgID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, organizationToAPI(org))
+}
+
+// (PUT /organizations/{orgID})
+func (h *Handler) UpdateOrganizaion(ctx echo.Context, orgID int64) error {
+	var in Organization
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse organization: %v", err)
+	}
+	if in.Name == "" {
+		return httputil.BadRequest(ctx, "organization name is required")
+	}
+
+	org, err := h.datastore.UpdateOrganization(ctx.Request().Context(), &datastore.Organization{ID: orgID, Name: in.Name})
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, organizationToAPI(org))
+}
+
+// (GET /federationGroups)
+func (h *Handler) GetFederationGroups(ctx echo.Context, params GetFederationGroupsParams) error {
+	orgID, err := parseID(params.OrgId)
+	if err != nil {
+		return httputil.BadRequest(ctx, "invalid orgId: %v", err)
+	}
+
+	groups, err := h.datastore.ListFederationGroups(ctx.Request().Context(), datastore.FederationGroupFilter{
+		OrgID:   orgID,
+		OrgName: stringValue(params.Orgname),
+		Name:    stringValue(params.Name),
+	})
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]FederationGroup, 0, len(groups))
+	for _, group := range groups {
+		out = append(out, federationGroupToAPI(group))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (POST /federationGroups)
+func (h *Handler) CreateFederationGroup(ctx echo.Context) error {
+	var in FederationGroup
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse federation group: %v", err)
+	}
+
+	group, err := federationGroupFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+
+	group, err = h.datastore.CreateFederationGroup(ctx.Request().Context(), group)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, federationGroupToAPI(group))
+}
+
+// (DELETE /federationGroups/{federationGroupID})
+func (h *Handler) DeletefederationGroup(ctx echo.Context, federationGroupID int64) error {
+	if err := h.datastore.DeleteFederationGroup(ctx.Request().Context(), federationGroupID); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (GET /federationGroups/{federationGroupID})
+func (h *Handler) GetFederationGroupbyID(ctx echo.Context, federationGroupID int64) error {
+	group, err := h.datastore.GetFederationGroup(ctx.Request().Context(), federationGroupID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, federationGroupToAPI(group))
+}
+
+// (PUT /federationGroups/{federationGroupID})
+func (h *Handler) UpdatefederationGroup(ctx echo.Context, federationGroupID int64) error {
+	var in FederationGroup
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse federation group: %v", err)
+	}
+
+	group, err := federationGroupFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+	group.ID = federationGroupID
+
+	group, err = h.datastore.UpdateFederationGroup(ctx.Request().Context(), group)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, federationGroupToAPI(group))
 }
 
 // (GET /spireServers)
-func (server MyDumbServer) GetSpireServers(ctx echo.Context, params GetSpireServersParams) error {
-	return errors.New("Ah, não, deu erro")
+func (h *Handler) GetSpireServers(ctx echo.Context, params GetSpireServersParams) error {
+	filter := datastore.SpireServerFilter{
+		TrustDomain: stringValue(params.TrustDomain),
+	}
+	if params.Status != nil {
+		filter.Status = string(*params.Status)
+	}
+
+	servers, err := h.datastore.ListSpireServers(ctx.Request().Context(), filter)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]SpireServer, 0, len(servers))
+	for _, server := range servers {
+		out = append(out, spireServerToAPI(server))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
 }
 
 // (POST /spireServers)
-func (server MyDumbServer) CreateSpireServer(ctx echo.Context) error {
-	return nil
+func (h *Handler) CreateSpireServer(ctx echo.Context) error {
+	var in CreateSpireServerJSONRequestBody
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse spire server: %v", err)
+	}
+	if in.Status == "" {
+		in.Status = Invited
+	}
+
+	server, err := spireServerFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+
+	server, err = h.datastore.CreateSpireServer(ctx.Request().Context(), server)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, spireServerToAPI(server))
 }
 
 // (DELETE /spireServers/{spireServerId})
-func (server MyDumbServer) DeleteSpireServer(ctx echo.Context, spireServerId int64) error {
-	return nil
+func (h *Handler) DeleteSpireServer(ctx echo.Context, spireServerId int64) error {
+	if err := h.datastore.DeleteSpireServer(ctx.Request().Context(), spireServerId); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (GET /spireServers/{spireServerId})
+func (h *Handler) GetSpireServer(ctx echo.Context, spireServerId int64) error {
+	server, err := h.datastore.GetSpireServer(ctx.Request().Context(), spireServerId)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, spireServerToAPI(server))
 }
 
 // (PUT /spireServers/{spireServerId})
-func (server MyDumbServer) UpdateSpireServer(ctx echo.Context, spireServerId int64) error {
-	return nil
+func (h *Handler) UpdateSpireServer(ctx echo.Context, spireServerId int64) error {
+	var in SpireServer
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse spire server: %v", err)
+	}
+
+	server, err := spireServerFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+	server.ID = spireServerId
+
+	current, err := h.datastore.GetSpireServer(ctx.Request().Context(), spireServerId)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	// The trust bundle and the credential of the harvester are tied to the
+	// trust domain, and SPIRE servers are activated by the onboarding of
+	// their harvester. Operators can only deactivate them.
+	if server.TrustDomain != current.TrustDomain {
+		return httputil.BadRequest(ctx, "the trust domain of a spire server can not be changed")
+	}
+	if server.Status != current.Status && server.Status != string(Inactive) {
+		return httputil.BadRequest(ctx, "spire servers can only be deactivated, they are activated when their harvester onboards")
+	}
+
+	server, err = h.datastore.UpdateSpireServer(ctx.Request().Context(), server)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, spireServerToAPI(server))
+}
+
+// (POST /spireServers/{spireServerId}/joinToken)
+func (h *Handler) CreateJoinToken(ctx echo.Context, spireServerId int64, params CreateJoinTokenParams) error {
+	ttl := defaultJoinTokenTTL
+	if params.Ttl != nil {
+		if *params.Ttl <= 0 || time.Duration(*params.Ttl)*time.Second > maxJoinTokenTTL {
+			return httputil.BadRequest(ctx, "ttl must be between 1 and %d seconds", int64(maxJoinTokenTTL/time.Second))
+		}
+		ttl = time.Duration(*params.Ttl) * time.Second
+	}
+
+	secret, err := datastore.NewSecret()
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	token, err := h.datastore.CreateJoinToken(ctx.Request().Context(), &datastore.JoinToken{
+		SpireServerID: spireServerId,
+		Token:         secret,
+		ExpiresAt:     time.Now().Add(ttl),
+	})
+	if err != nil {
+		if errors.Is(err, datastore.ErrInvalidReference) {
+			err = fmt.Errorf("spire server: %w", datastore.ErrNotFound)
+		}
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, JoinToken{
+		Token:         token.Token,
+		SpireServerId: token.SpireServerID,
+		ExpiresAt:     token.ExpiresAt,
+	})
+}
+
+// (GET /federationGroupMemberships)
+func (h *Handler) GetFederationGroupMemberships(ctx echo.Context, params GetFederationGroupMembershipsParams) error {
+	orgID, err := parseID(params.OrgId)
+	if err != nil {
+		return httputil.BadRequest(ctx, "invalid orgId: %v", err)
+	}
+
+	filter := datastore.MembershipFilter{
+		OrgID:       orgID,
+		OrgName:     stringValue(params.Orgname),
+		TrustDomain: stringValue(params.TrustDomain),
+	}
+	if params.Status != nil {
+		filter.Status = string(*params.Status)
+	}
+
+	memberships, err := h.datastore.ListMemberships(ctx.Request().Context(), filter)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]FederationGroupMembership, 0, len(memberships))
+	for _, membership := range memberships {
+		out = append(out, membershipToAPI(membership))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (POST /federationGroupMemberships)
+func (h *Handler) CreateFederationGroupMembership(ctx echo.Context) error {
+	var in FederationGroupMembership
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse membership: %v", err)
+	}
+
+	membership, err := membershipFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+
+	membership, err = h.datastore.CreateMembership(ctx.Request().Context(), membership)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusCreated, membershipToAPI(membership))
+}
+
+// (DELETE /federationGroupMemberships/{membershipID})
+func (h *Handler) DeletefederationGroupMembership(ctx echo.Context, membershipID int64) error {
+	if err := h.datastore.DeleteMembership(ctx.Request().Context(), membershipID); err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// (GET /federationGroupMemberships/{membershipID})
+func (h *Handler) GetFederationGroupMembershipbyID(ctx echo.Context, membershipID int64) error {
+	membership, err := h.datastore.GetMembership(ctx.Request().Context(), membershipID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, membershipToAPI(membership))
+}
+
+// (PUT /federationGroupMemberships/{membershipID})
+func (h *Handler) UpdatefederationGroupMembership(ctx echo.Context, membershipID int64) error {
+	var in FederationGroupMembership
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse membership: %v", err)
+	}
+
+	membership, err := membershipFromAPI(&in)
+	if err != nil {
+		return httputil.BadRequest(ctx, "%v", err)
+	}
+	membership.ID = membershipID
+
+	membership, err = h.datastore.UpdateMembership(ctx.Request().Context(), membership)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, membershipToAPI(membership))
+}
+
+// (GET /federationRelationships)
+func (h *Handler) GetFederationRelationships(ctx echo.Context, params GetFederationRelationshipsParams) error {
+	orgID, err := parseID(params.OrgId)
+	if err != nil {
+		return httputil.BadRequest(ctx, "invalid orgId: %v", err)
+	}
+
+	filter := datastore.RelationshipFilter{
+		OrgID:       orgID,
+		OrgName:     stringValue(params.Orgname),
+		TrustDomain: stringValue(params.TrustDomain),
+	}
+	if params.Status != nil {
+		filter.Status = string(*params.Status)
+	}
+
+	relationships, err := h.datastore.ListRelationships(ctx.Request().Context(), filter)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	out := make([]common.FederationRelationship, 0, len(relationships))
+	for _, relationship := range relationships {
+		out = append(out, relationshipToAPI(relationship))
+	}
+
+	return ctx.JSON(http.StatusOK, out)
+}
+
+// (POST /federationRelationships)
+func (h *Handler) CreateFederationRelationship(ctx echo.Context) error {
+	var in common.FederationRelationship
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse federation relationship: %v", err)
+	}
+
+	// Relationships are proposed, and activated by the consent of both sides
+	if isConsentGiven(in.SpireServerConsent) || isConsentGiven(in.SpireServerFederatedWithConsent) {
+		return httputil.BadRequest(ctx, consentByHarvesters)
+	}
+	if in.Status != nil && *in.Status != common.FederationRelationshipStatusInvited {
+		return httputil.BadRequest(ctx, "federation relationships are proposed with status %q", common.FederationRelationshipStatusInvited)
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	spireServer, err := h.groupMember(reqCtx, in.FederationGroupId, in.SpireServer)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+	federatedWith, err := h.groupMember(reqCtx, in.FederationGroupId, in.SpireServerFederatedWith)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	relationship := &datastore.Relationship{
+		FederationGroupID:               in.FederationGroupId,
+		SpireServerID:                   spireServer.ID,
+		SpireServerFederatedWithID:      federatedWith.ID,
+		SpireServerConsent:              common.ConsentPending,
+		SpireServerFederatedWithConsent: common.ConsentPending,
+		Status:                          string(common.FederationRelationshipStatusInvited),
+	}
+
+	relationship, err = h.datastore.CreateRelationship(reqCtx, relationship)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+	h.recordRelationshipEvents(reqCtx, relationship)
+
+	return ctx.JSON(http.StatusCreated, relationshipToAPI(relationship))
+}
+
+// (GET /federationRelationships/{relationshipID})
+func (h *Handler) GetFederationRelationshipbyID(ctx echo.Context, relationshipID int64) error {
+	relationship, err := h.datastore.GetRelationship(ctx.Request().Context(), relationshipID)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, relationshipToAPI(relationship))
+}
+
+// (PUT /federationRelationships/{relationshipID})
+func (h *Handler) UpdateFederationRelationshipship(ctx echo.Context, relationshipID int64) error {
+	var in common.FederationRelationship
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse federation relationship: %v", err)
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	if in.SpireServerConsent != nil || in.SpireServerFederatedWithConsent != nil {
+		if _, err := h.datastore.GetRelationship(reqCtx, relationshipID); err != nil {
+			return h.handleError(ctx, err)
+		}
+		return httputil.BadRequest(ctx, consentByHarvesters)
+	}
+
+	// Nothing to update, the harvesters are not notified
+	if in.Status == nil {
+		relationship, err := h.datastore.GetRelationship(reqCtx, relationshipID)
+		if err != nil {
+			return h.handleError(ctx, err)
+		}
+		return ctx.JSON(http.StatusOK, relationshipToAPI(relationship))
+	}
+
+	// The status is validated and set in a single transaction, so that the
+	// consents given by the harvesters in the meantime are not overwritten
+	var invalid error
+	relationship, err := h.datastore.UpdateRelationshipFunc(reqCtx, relationshipID, func(relationship *datastore.Relationship) error {
+		if err := common.ValidateStatusTransition(common.FederationRelationshipStatus(relationship.Status), *in.Status); err != nil {
+			if !errors.Is(err, common.ErrInvalidTransition) {
+				invalid = err
+			}
+			return err
+		}
+
+		// Proposing a relationship again requires the consent of both sides
+		if *in.Status == common.FederationRelationshipStatusInvited {
+			relationship.SpireServerConsent = common.ConsentPending
+			relationship.SpireServerFederatedWithConsent = common.ConsentPending
+		}
+		relationship.Status = string(*in.Status)
+
+		return nil
+	})
+	switch {
+	case invalid != nil:
+		return httputil.BadRequest(ctx, "%v", invalid)
+	case err != nil:
+		return h.handleError(ctx, err)
+	}
+	h.recordRelationshipEvents(reqCtx, relationship)
+
+	return ctx.JSON(http.StatusOK, relationshipToAPI(relationship))
+}
+
+// recordRelationshipEvents records the status of a relationship as an event
+// of each side, so that the harvesters pick up the change right away.
+func (h *Handler) recordRelationshipEvents(ctx context.Context, relationship *datastore.Relationship) {
+	sides := [][2]string{
+		{relationship.SpireServerTrustDomain, relationship.SpireServerFederatedWithTrustDomain},
+		{relationship.SpireServerFederatedWithTrustDomain, relationship.SpireServerTrustDomain},
+	}
+	for _, side := range sides {
+		if _, err := h.datastore.CreateEvent(ctx, &datastore.Event{
+			TrustDomain: side[0],
+			Type:        string(common.RelationshipUpdated),
+			Message:     fmt.Sprintf("relationship %d with %s is %s", relationship.ID, side[1], relationship.Status),
+		}); err != nil {
+			h.logger.Warn("Failed to record update of relationship", relationship.ID, "of", side[0]+":", err)
+		}
+	}
 }
 
 // (PUT /trustBundles/{trustBundleId})
-func (server MyDumbServer) UpdateTrustBundle(ctx echo.Context, trustBundleId int64) error {
-	return nil
+func (h *Handler) UpdateTrustBundle(ctx echo.Context, trustBundleId int64) error {
+	var in common.TrustBundle
+	if err := ctx.Bind(&in); err != nil {
+		return httputil.BadRequest(ctx, "failed to parse trust bundle: %v", err)
+	}
+
+	reqCtx := ctx.Request().Context()
+
+	bundle, err := h.datastore.GetTrustBundle(reqCtx, trustBundleId)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+	if in.TrustDomain != nil && *in.TrustDomain != bundle.TrustDomain {
+		return httputil.BadRequest(ctx, "trust bundle %d belongs to trust domain %q", trustBundleId, bundle.TrustDomain)
+	}
+
+	// New contents invalidate the signature of the previous ones
+	updated := in.Bundle != "" && in.Bundle != string(bundle.Bundle)
+	if in.Bundle != "" {
+		td, err := spiffeid.TrustDomainFromString(bundle.TrustDomain)
+		if err != nil {
+			return h.handleError(ctx, fmt.Errorf("invalid trust domain %q: %v", bundle.TrustDomain, err))
+		}
+		if _, err := common.ValidateTrustBundle(td, []byte(in.Bundle), bundle.Bundle); err != nil {
+			if errors.Is(err, common.ErrStaleTrustBundle) {
+				return h.handleError(ctx, err)
+			}
+			return httputil.BadRequest(ctx, "%v", err)
+		}
+		bundle.Bundle = []byte(in.Bundle)
+		bundle.Signature = stringValue(in.Signature)
+		bundle.SigningCertificate = stringValue(in.SigningCertificate)
+	}
+	if in.Status != nil {
+		if err := validateTrustBundleStatus(*in.Status); err != nil {
+			return httputil.BadRequest(ctx, "%v", err)
+		}
+		bundle.Status = string(*in.Status)
+	}
+
+	bundle, err = h.datastore.SetTrustBundle(reqCtx, bundle)
+	if err != nil {
+		return h.handleError(ctx, err)
+	}
+
+	if updated {
+		if _, err := h.datastore.CreateEvent(reqCtx, &datastore.Event{
+			TrustDomain: bundle.TrustDomain,
+			Type:        string(common.TrustBundleUpdated),
+			Message:     "set through the management API",
+		}); err != nil {
+			h.logger.Warn("Failed to record update of the trust bundle of", bundle.TrustDomain+":", err)
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, trustBundleToAPI(bundle))
+}
+
+// groupMember looks up the SPIRE Server with the given trust domain and
+// verifies that it is a member of the given federation group.
+func (h *Handler) groupMember(ctx context.Context, federationGroupID int64, trustDomain string) (*datastore.SpireServer, error) {
+	if _, err := spiffeid.TrustDomainFromString(trustDomain); err != nil {
+		return nil, fmt.Errorf("invalid trust domain %q: %v: %w", trustDomain, err, datastore.ErrInvalidReference)
+	}
+
+	server, err := h.datastore.GetSpireServerByTrustDomain(ctx, trustDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := h.datastore.ListMemberships(ctx, datastore.MembershipFilter{
+		FederationGroupID: federationGroupID,
+		SpireServerID:     server.ID,
+		Status:            string(FederationGroupMembershipStatusActive),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, fmt.Errorf("%q is not an active member of federation group %d: %w", trustDomain, federationGroupID, datastore.ErrInvalidReference)
+	}
+
+	return server, nil
+}
+
+func (h *Handler) handleError(ctx echo.Context, err error) error {
+	if httputil.StatusCode(err) == http.StatusInternalServerError {
+		h.logger.Error(ctx.Request().Method, ctx.Request().URL.Path, "failed:", err)
+	}
+
+	return httputil.HandleError(ctx, err)
+}
+
+func parseID(s *string) (int64, error) {
+	if s == nil || *s == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(*s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("must be a positive number")
+	}
+
+	return id, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
 }
@@ -0,0 +1,410 @@
+package management
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	t      *testing.T
+	router *echo.Echo
+	ds     datastore.Datastore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ds, err := datastore.NewSQLDatastore(context.Background(), datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	router := echo.New()
+	RegisterHandlers(router, NewHandler(ds))
+
+	return &testServer{t: t, router: router, ds: ds}
+}
+
+func (s *testServer) do(method, path, body string, out interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	s.router.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		require.NoError(s.t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+
+	return rec.Code
+}
+
+func TestOrganizations(t *testing.T) {
+	s := newTestServer(t)
+
+	var org Organization
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/organizations", `{"name":"org"}`, &org))
+	assert.Equal(t, Organization{Id: 1, Name: "org"}, org)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusConflict, s.do(http.MethodPost, "/organizations", `{"name":"org"}`, &apiErr))
+	assert.Equal(t, int32(http.StatusConflict), apiErr.Code)
+
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/organizations", `{}`, &apiErr))
+	assert.Equal(t, "organization name is required", apiErr.Message)
+
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/organizations/1", `{"name":"renamed"}`, &org))
+	assert.Equal(t, Organization{Id: 1, Name: "renamed"}, org)
+
+	var orgs []Organization
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/organizations?name=renamed", "", &orgs))
+	assert.Equal(t, []Organization{{Id: 1, Name: "renamed"}}, orgs)
+
+	assert.Equal(t, http.StatusNoContent, s.do(http.MethodDelete, "/organizations/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodGet, "/organizations/1", "", &apiErr))
+	assert.Equal(t, "organization: not found", apiErr.Message)
+}
+
+func TestFederationGroups(t *testing.T) {
+	s := newTestServer(t)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/federationGroups", `{"orgid":1,"name":"group"}`, &apiErr))
+
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/organizations", `{"name":"org"}`, nil))
+
+	var group FederationGroup
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/federationGroups", `{"orgid":1,"name":"group"}`, &group))
+	assert.Equal(t, "group", group.Name)
+	assert.Equal(t, FederationGroupStatusActive, *group.Status)
+
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/federationGroups", `{"orgid":1,"name":"other","status":"unknown"}`, &apiErr))
+	assert.Equal(t, `invalid federation group status "unknown"`, apiErr.Message)
+
+	var groups []FederationGroup
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/federationGroups?orgId=1", "", &groups))
+	assert.Equal(t, []FederationGroup{group}, groups)
+
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodGet, "/federationGroups?orgId=abc", "", &apiErr))
+
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/federationGroups/1", `{"orgid":1,"name":"group","status":"inactive"}`, &group))
+	assert.Equal(t, FederationGroupStatusInactive, *group.Status)
+	group = FederationGroup{}
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/federationGroups/1", "", &group))
+	assert.Equal(t, FederationGroupStatusInactive, *group.Status)
+
+	assert.Equal(t, http.StatusNoContent, s.do(http.MethodDelete, "/federationGroups/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodDelete, "/federationGroups/1", "", nil))
+}
+
+func TestSpireServers(t *testing.T) {
+	s := newTestServer(t)
+
+	var server SpireServer
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"example.org","description":"desc"}`, &server))
+	assert.Equal(t, "example.org", *server.TrustDomain)
+	assert.Equal(t, Invited, server.Status)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"not a trust domain"}`, &apiErr))
+	assert.Equal(t, http.StatusConflict, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"example.org"}`, &apiErr))
+
+	// Onboarding activates SPIRE servers, admins can only deactivate them
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPut, "/spireServers/1", `{"trustDomain":"example.org","status":"active"}`, &apiErr))
+	assert.Equal(t, "spire servers can only be deactivated, they are activated when their harvester onboards", apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPut, "/spireServers/1", `{"trustDomain":"other.org","status":"invited"}`, &apiErr))
+	assert.Equal(t, "the trust domain of a spire server can not be changed", apiErr.Message)
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodPut, "/spireServers/2", `{"trustDomain":"example.org","status":"inactive"}`, &apiErr))
+
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/spireServers/1", `{"trustDomain":"example.org","status":"inactive","description":"updated"}`, &server))
+	assert.Equal(t, Inactive, server.Status)
+	assert.Equal(t, "updated", server.Description)
+
+	server = SpireServer{}
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/spireServers/1", "", &server))
+	assert.Equal(t, int64(1), server.Id)
+	assert.Equal(t, "example.org", *server.TrustDomain)
+	assert.Equal(t, Inactive, server.Status)
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodGet, "/spireServers/2", "", &apiErr))
+
+	var servers []SpireServer
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/spireServers?status=invited", "", &servers))
+	assert.Empty(t, servers)
+
+	assert.Equal(t, http.StatusNoContent, s.do(http.MethodDelete, "/spireServers/1", "", nil))
+}
+
+func TestJoinToken(t *testing.T) {
+	s := newTestServer(t)
+
+	var server SpireServer
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"example.org"}`, &server))
+
+	var token JoinToken
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers/1/joinToken", "", &token))
+	assert.NotEmpty(t, token.Token)
+	assert.Equal(t, int64(1), token.SpireServerId)
+	assert.WithinDuration(t, time.Now().Add(defaultJoinTokenTTL), token.ExpiresAt, time.Minute)
+
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers/1/joinToken?ttl=60", "", &token))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), token.ExpiresAt, time.Minute)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/spireServers/1/joinToken?ttl=0", "", &apiErr))
+	assert.Equal(t, "ttl must be between 1 and 604800 seconds", apiErr.Message)
+
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodPost, "/spireServers/2/joinToken", "", &apiErr))
+}
+
+func TestSpireServerBundleEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected *SpireServer
+		err      string
+	}{
+		{
+			name:     "https_web",
+			body:     `{"trustDomain":"example.org","bundleEndpointUrl":"https://example.org/bundle","bundleEndpointProfile":"https_web"}`,
+			expected: &SpireServer{BundleEndpointUrl: strPtr("https://example.org/bundle"), BundleEndpointProfile: profilePtr(HttpsWeb)},
+		},
+		{
+			name: "https_spiffe",
+			body: `{"trustDomain":"example.org","bundleEndpointUrl":"https://example.org:8443","bundleEndpointProfile":"https_spiffe","bundleEndpointSpiffeId":"spiffe://example.org/spire/server"}`,
+			expected: &SpireServer{
+				BundleEndpointUrl:      strPtr("https://example.org:8443"),
+				BundleEndpointProfile:  profilePtr(HttpsSpiffe),
+				BundleEndpointSpiffeId: strPtr("spiffe://example.org/spire/server"),
+			},
+		},
+		{
+			name:     "no_bundle_endpoint",
+			body:     `{"trustDomain":"example.org"}`,
+			expected: &SpireServer{},
+		},
+		{
+			name: "profile_without_url",
+			body: `{"trustDomain":"example.org","bundleEndpointProfile":"https_web"}`,
+			err:  "spire server bundleEndpointUrl is required by the bundle endpoint profile",
+		},
+		{
+			name: "not_https",
+			body: `{"trustDomain":"example.org","bundleEndpointUrl":"http://example.org/bundle","bundleEndpointProfile":"https_web"}`,
+			err:  `invalid spire server bundleEndpointUrl "http://example.org/bundle": must be an https URL`,
+		},
+		{
+			name: "missing_profile",
+			body: `{"trustDomain":"example.org","bundleEndpointUrl":"https://example.org/bundle"}`,
+			err:  `invalid spire server bundleEndpointProfile ""`,
+		},
+		{
+			name: "https_spiffe_without_spiffe_id",
+			body: `{"trustDomain":"example.org","bundleEndpointUrl":"https://example.org:8443","bundleEndpointProfile":"https_spiffe"}`,
+			err:  "invalid spire server bundleEndpointSpiffeId: cannot be empty",
+		},
+		{
+			name: "https_web_with_spiffe_id",
+			body: `{"trustDomain":"example.org","bundleEndpointUrl":"https://example.org/bundle","bundleEndpointProfile":"https_web","bundleEndpointSpiffeId":"spiffe://example.org/spire/server"}`,
+			err:  "spire server bundleEndpointSpiffeId is only allowed by the https_spiffe profile",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+
+			if tt.err != "" {
+				var apiErr common.Error
+				assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/spireServers", tt.body, &apiErr))
+				assert.Equal(t, tt.err, apiErr.Message)
+				return
+			}
+
+			var server SpireServer
+			require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers", tt.body, &server))
+			assert.Equal(t, tt.expected.BundleEndpointUrl, server.BundleEndpointUrl)
+			assert.Equal(t, tt.expected.BundleEndpointProfile, server.BundleEndpointProfile)
+			assert.Equal(t, tt.expected.BundleEndpointSpiffeId, server.BundleEndpointSpiffeId)
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func profilePtr(p SpireServerBundleEndpointProfile) *SpireServerBundleEndpointProfile {
+	return &p
+}
+
+func TestMembershipsAndRelationships(t *testing.T) {
+	s := newTestServer(t)
+
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/organizations", `{"name":"org"}`, nil))
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/federationGroups", `{"orgid":1,"name":"group"}`, nil))
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"td1.org","status":"active"}`, nil))
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/spireServers", `{"trustDomain":"td2.org","status":"active","bundleEndpointUrl":"https://td2.org/bundle","bundleEndpointProfile":"https_web"}`, nil))
+
+	var membership FederationGroupMembership
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/federationGroupMemberships", `{"spireServerId":1,"federationGroupId":1}`, &membership))
+	assert.Equal(t, FederationGroupMembershipStatusActive, membership.Status)
+
+	membership = FederationGroupMembership{}
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/federationGroupMemberships/1", `{"spireServerId":1,"federationGroupId":1,"status":"active"}`, &membership))
+	assert.Equal(t, int64(1), *membership.Id)
+	assert.Equal(t, FederationGroupMembershipStatusActive, membership.Status)
+
+	// td2.org is not a member of the federation group yet
+	var apiErr common.Error
+	body := `{"federationGroupId":1,"spireServer":"td1.org","spireServerFederatedWith":"td2.org"}`
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/federationRelationships", body, &apiErr))
+	assert.Equal(t, `"td2.org" is not an active member of federation group 1: invalid reference`, apiErr.Message)
+
+	require.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/federationGroupMemberships", `{"spireServerId":2,"federationGroupId":1}`, nil))
+
+	// Admins propose relationships, only harvesters consent
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/federationRelationships", `{"federationGroupId":1,"spireServer":"td1.org","spireServerFederatedWith":"td2.org","spireServerConsent":"accepted"}`, &apiErr))
+	assert.Equal(t, "consent is given by the harvesters of each side", apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPost, "/federationRelationships", `{"federationGroupId":1,"spireServer":"td1.org","spireServerFederatedWith":"td2.org","status":"active"}`, &apiErr))
+	assert.Equal(t, `federation relationships are proposed with status "invited"`, apiErr.Message)
+
+	var relationship common.FederationRelationship
+	assert.Equal(t, http.StatusCreated, s.do(http.MethodPost, "/federationRelationships", body, &relationship))
+	assert.Equal(t, "td1.org", relationship.SpireServer)
+	assert.Equal(t, "td2.org", relationship.SpireServerFederatedWith)
+	assert.Equal(t, common.FederationRelationshipStatusInvited, *relationship.Status)
+	assert.Nil(t, relationship.SpireServerBundleEndpoint)
+	assert.Equal(t, &common.BundleEndpoint{Url: "https://td2.org/bundle", Profile: common.HttpsWeb}, relationship.SpireServerFederatedWithBundleEndpoint)
+
+	assert.Equal(t, http.StatusConflict, s.do(http.MethodPost, "/federationRelationships", body, &apiErr))
+
+	var relationships []common.FederationRelationship
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/federationRelationships?trustDomain=td2.org", "", &relationships))
+	assert.Equal(t, []common.FederationRelationship{relationship}, relationships)
+
+	assert.Equal(t, http.StatusConflict, s.do(http.MethodPut, "/federationRelationships/1", `{"status":"active"}`, &apiErr))
+	assert.Equal(t, "relationship only becomes active when both sides consent: invalid federation relationship transition", apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPut, "/federationRelationships/1", `{"spireServerConsent":"accepted"}`, &apiErr))
+
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/federationRelationships/1", `{"status":"inactive"}`, &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInactive, *relationship.Status)
+	relationship = common.FederationRelationship{}
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/federationRelationships/1", "", &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInactive, *relationship.Status)
+
+	// An update without status changes nothing
+	relationship = common.FederationRelationship{}
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/federationRelationships/1", `{}`, &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInactive, *relationship.Status)
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodPut, "/federationRelationships/2", `{}`, &apiErr))
+
+	// Inactive relationships can be proposed again
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/federationRelationships/1", `{"status":"invited"}`, &relationship))
+	assert.Equal(t, http.StatusOK, s.do(http.MethodGet, "/federationRelationships/1", "", &relationship))
+	assert.Equal(t, common.FederationRelationshipStatusInvited, *relationship.Status)
+	assert.Equal(t, common.ConsentPending, *relationship.SpireServerConsent)
+
+	// Every change is recorded as an event of both sides, for their harvesters
+	events, err := s.ds.ListEvents(context.Background(), datastore.EventFilter{TrustDomains: []string{"td2.org"}})
+	require.NoError(t, err)
+	var messages []string
+	for _, event := range events {
+		assert.Equal(t, string(common.RelationshipUpdated), event.Type)
+		messages = append(messages, event.Message)
+	}
+	assert.Equal(t, []string{
+		"relationship 1 with td1.org is invited",
+		"relationship 1 with td1.org is inactive",
+		"relationship 1 with td1.org is invited",
+	}, messages)
+
+	assert.Equal(t, http.StatusNoContent, s.do(http.MethodDelete, "/federationGroupMemberships/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodGet, "/federationGroupMemberships/1", "", &apiErr))
+}
+
+// bundleContents returns the JWKS document of a SPIFFE bundle of the given
+// trust domain, with the given sequence number and a self-signed authority.
+func bundleContents(t *testing.T, trustDomain string, sequenceNumber uint64) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(trustDomain), []*x509.Certificate{cert})
+	bundle.SetSequenceNumber(sequenceNumber)
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+
+	return string(bundleBytes)
+}
+
+func TestUpdateTrustBundle(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	server, err := s.ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: "example.org", Status: "active"})
+	require.NoError(t, err)
+	contents := bundleContents(t, "example.org", 2)
+	_, err = s.ds.SetTrustBundle(ctx, &datastore.TrustBundle{SpireServerID: server.ID, Bundle: []byte(contents), Status: "active"})
+	require.NoError(t, err)
+
+	var bundle common.TrustBundle
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/trustBundles/1", `{"status":"to_delete"}`, &bundle))
+	assert.Equal(t, contents, bundle.Bundle)
+	assert.Equal(t, uint64(2), *bundle.SequenceNumber)
+	assert.Equal(t, common.TrustBundleStatusToDelete, *bundle.Status)
+
+	var apiErr common.Error
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPut, "/trustBundles/1", `{"trustDomain":"other.org"}`, &apiErr))
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodPut, "/trustBundles/2", `{}`, &apiErr))
+
+	// Uploaded contents are validated
+	body, err := json.Marshal(common.TrustBundle{Bundle: "not a bundle"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, s.do(http.MethodPut, "/trustBundles/1", string(body), &apiErr))
+
+	body, err = json.Marshal(common.TrustBundle{Bundle: bundleContents(t, "example.org", 1)})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, s.do(http.MethodPut, "/trustBundles/1", string(body), &apiErr))
+
+	rotated := bundleContents(t, "example.org", 3)
+	body, err = json.Marshal(common.TrustBundle{Bundle: rotated})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, s.do(http.MethodPut, "/trustBundles/1", string(body), &bundle))
+	assert.Equal(t, rotated, bundle.Bundle)
+
+	// Only the new contents are recorded as an event
+	events, err := s.ds.ListEvents(ctx, datastore.EventFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "example.org", events[0].TrustDomain)
+	assert.Equal(t, string(common.TrustBundleUpdated), events[0].Type)
+}
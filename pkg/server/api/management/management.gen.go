@@ -6,6 +6,7 @@ package management
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/deepmap/oapi-codegen/pkg/runtime"
 	"github.com/labstack/echo/v4"
@@ -23,6 +24,12 @@ const (
 	FederationGroupMembershipStatusInactive FederationGroupMembershipStatus = "inactive"
 )
 
+// Defines values for SpireServerBundleEndpointProfile.
+const (
+	HttpsSpiffe SpireServerBundleEndpointProfile = "https_spiffe"
+	HttpsWeb    SpireServerBundleEndpointProfile = "https_web"
+)
+
 // Defines values for SpireServerStatus.
 const (
 	Active   SpireServerStatus = "active"
@@ -52,6 +59,13 @@ type FederationGroupMembership struct {
 // FederationGroupMembershipStatus defines model for FederationGroupMembership.Status.
 type FederationGroupMembershipStatus string
 
+// JoinToken defines model for JoinToken.
+type JoinToken struct {
+	ExpiresAt     time.Time `json:"expiresAt"`
+	SpireServerId int64     `json:"spireServerId"`
+	Token         string    `json:"token"`
+}
+
 // Organization defines model for Organization.
 type Organization struct {
 	Id   int64  `json:"id"`
@@ -60,12 +74,18 @@ type Organization struct {
 
 // SpireServer defines model for SpireServer.
 type SpireServer struct {
-	Description string            `json:"description"`
-	Id          int64             `json:"id"`
-	Status      SpireServerStatus `json:"status"`
-	TrustDomain *string           `json:"trustDomain,omitempty"`
+	BundleEndpointProfile  *SpireServerBundleEndpointProfile `json:"bundleEndpointProfile,omitempty"`
+	BundleEndpointSpiffeId *string                           `json:"bundleEndpointSpiffeId,omitempty"`
+	BundleEndpointUrl      *string                           `json:"bundleEndpointUrl,omitempty"`
+	Description            string                            `json:"description"`
+	Id                     int64                             `json:"id"`
+	Status                 SpireServerStatus                 `json:"status"`
+	TrustDomain            *string                           `json:"trustDomain,omitempty"`
 }
 
+// SpireServerBundleEndpointProfile defines model for SpireServer.BundleEndpointProfile.
+type SpireServerBundleEndpointProfile string
+
 // SpireServerStatus defines model for SpireServer.Status.
 type SpireServerStatus string
 
@@ -138,6 +158,12 @@ type GetSpireServersParamsStatus string
 // CreateSpireServerJSONBody defines parameters for CreateSpireServer.
 type CreateSpireServerJSONBody = SpireServer
 
+// CreateJoinTokenParams defines parameters for CreateJoinToken.
+type CreateJoinTokenParams struct {
+	// time to live of the join token, in seconds
+	Ttl *int64 `form:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
 // CreateSpireServerJSONRequestBody defines body for CreateSpireServer for application/json ContentType.
 type CreateSpireServerJSONRequestBody = CreateSpireServerJSONBody
 
@@ -210,9 +236,15 @@ type ServerInterface interface {
 	// (DELETE /spireServers/{spireServerId})
 	DeleteSpireServer(ctx echo.Context, spireServerId int64) error
 
+	// (GET /spireServers/{spireServerId})
+	GetSpireServer(ctx echo.Context, spireServerId int64) error
+
 	// (PUT /spireServers/{spireServerId})
 	UpdateSpireServer(ctx echo.Context, spireServerId int64) error
 
+	// (POST /spireServers/{spireServerId}/joinToken)
+	CreateJoinToken(ctx echo.Context, spireServerId int64, params CreateJoinTokenParams) error
+
 	// (PUT /trustBundles/{trustBundleId})
 	UpdateTrustBundle(ctx echo.Context, trustBundleId int64) error
 }
@@ -612,6 +644,22 @@ func (w *ServerInterfaceWrapper) DeleteSpireServer(ctx echo.Context) error {
 	return err
 }
 
+// GetSpireServer converts echo context to params.
+func (w *ServerInterfaceWrapper) GetSpireServer(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "spireServerId" -------------
+	var spireServerId int64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "spireServerId", runtime.ParamLocationPath, ctx.Param("spireServerId"), &spireServerId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServerId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetSpireServer(ctx, spireServerId)
+	return err
+}
+
 // UpdateSpireServer converts echo context to params.
 func (w *ServerInterfaceWrapper) UpdateSpireServer(ctx echo.Context) error {
 	var err error
@@ -628,6 +676,31 @@ func (w *ServerInterfaceWrapper) UpdateSpireServer(ctx echo.Context) error {
 	return err
 }
 
+// CreateJoinToken converts echo context to params.
+func (w *ServerInterfaceWrapper) CreateJoinToken(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "spireServerId" -------------
+	var spireServerId int64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "spireServerId", runtime.ParamLocationPath, ctx.Param("spireServerId"), &spireServerId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spireServerId: %s", err))
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateJoinTokenParams
+	// ------------- Optional query parameter "ttl" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "ttl", ctx.QueryParams(), &params.Ttl)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ttl: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.CreateJoinToken(ctx, spireServerId, params)
+	return err
+}
+
 // UpdateTrustBundle converts echo context to params.
 func (w *ServerInterfaceWrapper) UpdateTrustBundle(ctx echo.Context) error {
 	var err error
@@ -694,7 +767,9 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 	router.GET(baseURL+"/spireServers", wrapper.GetSpireServers)
 	router.POST(baseURL+"/spireServers", wrapper.CreateSpireServer)
 	router.DELETE(baseURL+"/spireServers/:spireServerId", wrapper.DeleteSpireServer)
+	router.GET(baseURL+"/spireServers/:spireServerId", wrapper.GetSpireServer)
 	router.PUT(baseURL+"/spireServers/:spireServerId", wrapper.UpdateSpireServer)
+	router.POST(baseURL+"/spireServers/:spireServerId/joinToken", wrapper.CreateJoinToken)
 	router.PUT(baseURL+"/trustBundles/:trustBundleId", wrapper.UpdateTrustBundle)
 
 }
@@ -3,18 +3,83 @@ package config
 import (
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
 	"github.com/hashicorp/hcl"
 	"github.com/pkg/errors"
 )
 
 type Server struct {
-	ServerConfigSection *ServerConfigSection `hcl:"server"`
+	ServerConfigSection    *ServerConfigSection              `hcl:"server"`
+	DatastoreConfigSection *DatastoreConfigSection           `hcl:"datastore"`
+	TelemetryConfigSection *telemetry.TelemetryConfigSection `hcl:"telemetry"`
 }
 
 type ServerConfigSection struct {
+	ListenAddress           string `hcl:"listen_address"`
+	ManagementListenAddress string `hcl:"management_listen_address"`
+	LogLevel                string `hcl:"log_level"`
+
+	// BundlePruneInterval is the time between two prunings of the expired
+	// authorities of the trust bundles.
+	BundlePruneInterval string `hcl:"bundle_prune_interval"`
+	// BundleDeletionGracePeriod is the time a trust bundle whose authorities
+	// all expired is kept before being deleted.
+	BundleDeletionGracePeriod string `hcl:"bundle_deletion_grace_period"`
+	// EventRetention is the time events are kept for the harvesters to pick
+	// them up before being deleted.
+	EventRetention string `hcl:"event_retention"`
+
+	// TLS configures the TLS listener of the harvester API. The harvester API
+	// is served in plaintext if not set, which requires Insecure.
+	TLS *TLSConfigSection `hcl:"tls"`
+
+	// Insecure lets the harvesters that present neither a client certificate
+	// nor a credential use the harvester API on behalf of the SPIRE Server
+	// named by their requests. Only meant for development.
+	Insecure bool `hcl:"insecure"`
+
+	// BundleEndpoint configures the SPIFFE bundle endpoint serving the trust
+	// bundles of the active members. It is not served if not set.
+	BundleEndpoint *BundleEndpointConfigSection `hcl:"bundle_endpoint"`
+
+	// HealthChecks configures the listener of the liveness and readiness
+	// endpoints. They are not served if not set.
+	HealthChecks *HealthChecksConfigSection `hcl:"health_checks"`
+}
+
+// TLSConfigSection configures the certificate of the Galadriel Server and the
+// authentication of the harvesters.
+type TLSConfigSection struct {
+	CertFile string `hcl:"cert_file"`
+	KeyFile  string `hcl:"key_file"`
+	// CABundleFile is the bundle used to verify harvester client certificates.
+	CABundleFile string `hcl:"ca_bundle_file"`
+	// RequireClientCert rejects the harvesters that do not present a client
+	// certificate signed by the CA bundle.
+	RequireClientCert bool `hcl:"require_client_cert"`
+}
+
+// BundleEndpointConfigSection configures the listener and the profile of the
+// SPIFFE bundle endpoint.
+type BundleEndpointConfigSection struct {
 	ListenAddress string `hcl:"listen_address"`
-	LogLevel      string `hcl:"log_level"`
+	// Profile is either https_web or https_spiffe. The certificate must be
+	// an X509-SVID for the https_spiffe profile.
+	Profile  string `hcl:"profile"`
+	CertFile string `hcl:"cert_file"`
+	KeyFile  string `hcl:"key_file"`
+}
+
+// HealthChecksConfigSection configures the listener of the health endpoints.
+type HealthChecksConfigSection struct {
+	ListenAddress string `hcl:"listen_address"`
+}
+
+type DatastoreConfigSection struct {
+	Driver           string `hcl:"driver"`
+	ConnectionString string `hcl:"connection_string"`
 }
 
 func New(config io.Reader) (*Server, error) {
@@ -42,17 +107,120 @@ func newConfig(configBytes []byte) (*Server, error) {
 		return nil, errors.Wrap(errors.New("configuration file is empty"), "bad configuration")
 	}
 
+	if config.DatastoreConfigSection == nil {
+		config.DatastoreConfigSection = &DatastoreConfigSection{}
+	}
+
 	config.setDefaults()
 
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "bad configuration")
+	}
+
 	return &config, nil
 }
 
+func (c *Server) validate() error {
+	pruneInterval, err := time.ParseDuration(c.ServerConfigSection.BundlePruneInterval)
+	if err != nil {
+		return errors.Wrap(err, "invalid server.bundle_prune_interval")
+	}
+	if pruneInterval <= 0 {
+		return errors.New("server.bundle_prune_interval must be positive")
+	}
+
+	gracePeriod, err := time.ParseDuration(c.ServerConfigSection.BundleDeletionGracePeriod)
+	if err != nil {
+		return errors.Wrap(err, "invalid server.bundle_deletion_grace_period")
+	}
+	if gracePeriod < 0 {
+		return errors.New("server.bundle_deletion_grace_period must not be negative")
+	}
+
+	eventRetention, err := time.ParseDuration(c.ServerConfigSection.EventRetention)
+	if err != nil {
+		return errors.Wrap(err, "invalid server.event_retention")
+	}
+	if eventRetention <= 0 {
+		return errors.New("server.event_retention must be positive")
+	}
+
+	if tls := c.ServerConfigSection.TLS; tls != nil {
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			return errors.New("server.tls.cert_file and server.tls.key_file are required")
+		}
+		if tls.RequireClientCert && tls.CABundleFile == "" {
+			return errors.New("server.tls.ca_bundle_file is required by server.tls.require_client_cert")
+		}
+	}
+
+	if endpoint := c.ServerConfigSection.BundleEndpoint; endpoint != nil {
+		switch endpoint.Profile {
+		case "https_web", "https_spiffe":
+		default:
+			return errors.Errorf("unsupported server.bundle_endpoint.profile %q", endpoint.Profile)
+		}
+		if endpoint.CertFile == "" || endpoint.KeyFile == "" {
+			return errors.New("server.bundle_endpoint.cert_file and server.bundle_endpoint.key_file are required")
+		}
+	}
+
+	if c.TelemetryConfigSection != nil {
+		if err := c.TelemetryConfigSection.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *Server) setDefaults() {
 	if c.ServerConfigSection.ListenAddress == "" {
 		c.ServerConfigSection.ListenAddress = "localhost:8080"
 	}
 
+	if c.ServerConfigSection.ManagementListenAddress == "" {
+		c.ServerConfigSection.ManagementListenAddress = "localhost:8081"
+	}
+
 	if c.ServerConfigSection.LogLevel == "" {
 		c.ServerConfigSection.LogLevel = "INFO"
 	}
+
+	if c.ServerConfigSection.BundlePruneInterval == "" {
+		c.ServerConfigSection.BundlePruneInterval = "1m"
+	}
+
+	if c.ServerConfigSection.BundleDeletionGracePeriod == "" {
+		c.ServerConfigSection.BundleDeletionGracePeriod = "24h"
+	}
+
+	if c.ServerConfigSection.EventRetention == "" {
+		c.ServerConfigSection.EventRetention = "168h"
+	}
+
+	if endpoint := c.ServerConfigSection.BundleEndpoint; endpoint != nil {
+		if endpoint.ListenAddress == "" {
+			endpoint.ListenAddress = "localhost:8443"
+		}
+		if endpoint.Profile == "" {
+			endpoint.Profile = "https_web"
+		}
+	}
+
+	if healthChecks := c.ServerConfigSection.HealthChecks; healthChecks != nil && healthChecks.ListenAddress == "" {
+		healthChecks.ListenAddress = "localhost:8082"
+	}
+
+	if c.DatastoreConfigSection.Driver == "" {
+		c.DatastoreConfigSection.Driver = "sqlite3"
+	}
+
+	if c.DatastoreConfigSection.ConnectionString == "" {
+		c.DatastoreConfigSection.ConnectionString = "./datastore.sqlite3"
+	}
+
+	if c.TelemetryConfigSection != nil {
+		c.TelemetryConfigSection.SetDefaults()
+	}
 }
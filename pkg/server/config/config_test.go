@@ -6,6 +6,7 @@ import (
 	"io"
 	"testing"
 
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,18 +28,255 @@ func TestNew(t *testing.T) {
 			config: bytes.NewBuffer([]byte(`server { listen_address = "listen_address" }`)),
 			expected: &Server{
 				ServerConfigSection: &ServerConfigSection{
-					ListenAddress: "listen_address",
-					LogLevel:      "INFO",
+					ListenAddress:             "listen_address",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "datastore",
+			config: bytes.NewBuffer([]byte(`server { } datastore { driver = "sqlite3" connection_string = "/tmp/galadriel.sqlite3" }`)),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "/tmp/galadriel.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "management_listen_address",
+			config: bytes.NewBuffer([]byte(`server { management_listen_address = "localhost:9090" }`)),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:9090",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
 				},
 			},
 		},
+		{
+			name: "tls",
+			config: bytes.NewBufferString(`server {
+				tls {
+					cert_file = "server.pem"
+					key_file = "server.key"
+					ca_bundle_file = "ca.pem"
+					require_client_cert = true
+				}
+			}`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+					TLS: &TLSConfigSection{
+						CertFile:          "server.pem",
+						KeyFile:           "server.key",
+						CABundleFile:      "ca.pem",
+						RequireClientCert: true,
+					},
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "insecure",
+			config: bytes.NewBufferString(`server { insecure = true }`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+					Insecure:                  true,
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "bundle_expiry",
+			config: bytes.NewBufferString(`server { bundle_prune_interval = "5m" bundle_deletion_grace_period = "1h" event_retention = "72h" }`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "5m",
+					BundleDeletionGracePeriod: "1h",
+					EventRetention:            "72h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name: "bundle_endpoint",
+			config: bytes.NewBufferString(`server {
+				bundle_endpoint {
+					profile = "https_spiffe"
+					cert_file = "svid.pem"
+					key_file = "svid.key"
+				}
+			}`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+					BundleEndpoint: &BundleEndpointConfigSection{
+						ListenAddress: "localhost:8443",
+						Profile:       "https_spiffe",
+						CertFile:      "svid.pem",
+						KeyFile:       "svid.key",
+					},
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "health_checks",
+			config: bytes.NewBufferString(`server { health_checks {} }`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+					HealthChecks: &HealthChecksConfigSection{
+						ListenAddress: "localhost:8082",
+					},
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+			},
+		},
+		{
+			name:   "telemetry",
+			config: bytes.NewBufferString(`server {} telemetry { Prometheus { port = 8888 } }`),
+			expected: &Server{
+				ServerConfigSection: &ServerConfigSection{
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
+				},
+				TelemetryConfigSection: &telemetry.TelemetryConfigSection{
+					Prometheus: &telemetry.PrometheusConfigSection{Host: "localhost", Port: 8888},
+				},
+			},
+		},
+		{
+			name:   "err_telemetry_otlp_export_interval",
+			config: bytes.NewBufferString(`server {} telemetry { OTLP { export_interval = "0s" } }`),
+			err:    "bad configuration: telemetry.OTLP.export_interval must be positive",
+		},
+		{
+			name:   "err_bundle_prune_interval",
+			config: bytes.NewBufferString(`server { bundle_prune_interval = "soon" }`),
+			err:    `bad configuration: invalid server.bundle_prune_interval: time: invalid duration "soon"`,
+		},
+		{
+			name:   "err_bundle_prune_interval_not_positive",
+			config: bytes.NewBufferString(`server { bundle_prune_interval = "0s" }`),
+			err:    "bad configuration: server.bundle_prune_interval must be positive",
+		},
+		{
+			name:   "err_bundle_deletion_grace_period",
+			config: bytes.NewBufferString(`server { bundle_deletion_grace_period = "-1h" }`),
+			err:    "bad configuration: server.bundle_deletion_grace_period must not be negative",
+		},
+		{
+			name:   "err_event_retention",
+			config: bytes.NewBufferString(`server { event_retention = "0s" }`),
+			err:    "bad configuration: server.event_retention must be positive",
+		},
+		{
+			name:   "err_tls_missing_key",
+			config: bytes.NewBufferString(`server { tls { cert_file = "server.pem" } }`),
+			err:    "bad configuration: server.tls.cert_file and server.tls.key_file are required",
+		},
+		{
+			name:   "err_tls_require_client_cert_without_ca_bundle",
+			config: bytes.NewBufferString(`server { tls { cert_file = "server.pem" key_file = "server.key" require_client_cert = true } }`),
+			err:    "bad configuration: server.tls.ca_bundle_file is required by server.tls.require_client_cert",
+		},
+		{
+			name:   "err_bundle_endpoint_profile",
+			config: bytes.NewBufferString(`server { bundle_endpoint { profile = "http" cert_file = "server.pem" key_file = "server.key" } }`),
+			err:    `bad configuration: unsupported server.bundle_endpoint.profile "http"`,
+		},
+		{
+			name:   "err_bundle_endpoint_missing_cert",
+			config: bytes.NewBufferString(`server { bundle_endpoint { listen_address = "0.0.0.0:8443" } }`),
+			err:    "bad configuration: server.bundle_endpoint.cert_file and server.bundle_endpoint.key_file are required",
+		},
 		{
 			name:   "defaults",
 			config: bytes.NewBuffer([]byte(`server { }`)),
 			expected: &Server{
 				ServerConfigSection: &ServerConfigSection{
-					ListenAddress: "localhost:8080",
-					LogLevel:      "INFO",
+					ListenAddress:             "localhost:8080",
+					ManagementListenAddress:   "localhost:8081",
+					LogLevel:                  "INFO",
+					BundlePruneInterval:       "1m",
+					BundleDeletionGracePeriod: "24h",
+					EventRetention:            "168h",
+				},
+				DatastoreConfigSection: &DatastoreConfigSection{
+					Driver:           "sqlite3",
+					ConnectionString: "./datastore.sqlite3",
 				},
 			},
 		},
@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested entity does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when an entity violates a uniqueness constraint.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrInvalidReference is returned when an entity references another entity that does not exist.
+	ErrInvalidReference = errors.New("invalid reference")
+)
+
+// Datastore is the persistence layer of the Galadriel Server.
+type Datastore interface {
+	CreateOrganization(ctx context.Context, org *Organization) (*Organization, error)
+	GetOrganization(ctx context.Context, id int64) (*Organization, error)
+	ListOrganizations(ctx context.Context, filter OrganizationFilter) ([]*Organization, error)
+	UpdateOrganization(ctx context.Context, org *Organization) (*Organization, error)
+	DeleteOrganization(ctx context.Context, id int64) error
+
+	CreateFederationGroup(ctx context.Context, group *FederationGroup) (*FederationGroup, error)
+	GetFederationGroup(ctx context.Context, id int64) (*FederationGroup, error)
+	ListFederationGroups(ctx context.Context, filter FederationGroupFilter) ([]*FederationGroup, error)
+	UpdateFederationGroup(ctx context.Context, group *FederationGroup) (*FederationGroup, error)
+	DeleteFederationGroup(ctx context.Context, id int64) error
+
+	CreateSpireServer(ctx context.Context, server *SpireServer) (*SpireServer, error)
+	GetSpireServer(ctx context.Context, id int64) (*SpireServer, error)
+	GetSpireServerByTrustDomain(ctx context.Context, trustDomain string) (*SpireServer, error)
+	ListSpireServers(ctx context.Context, filter SpireServerFilter) ([]*SpireServer, error)
+	UpdateSpireServer(ctx context.Context, server *SpireServer) (*SpireServer, error)
+	DeleteSpireServer(ctx context.Context, id int64) error
+
+	CreateJoinToken(ctx context.Context, token *JoinToken) (*JoinToken, error)
+	RedeemJoinToken(ctx context.Context, token, credential string) (*SpireServer, error)
+	GetSpireServerByCredential(ctx context.Context, credential string) (*SpireServer, error)
+
+	CreateMembership(ctx context.Context, membership *Membership) (*Membership, error)
+	GetMembership(ctx context.Context, id int64) (*Membership, error)
+	ListMemberships(ctx context.Context, filter MembershipFilter) ([]*Membership, error)
+	UpdateMembership(ctx context.Context, membership *Membership) (*Membership, error)
+	DeleteMembership(ctx context.Context, id int64) error
+
+	CreateRelationship(ctx context.Context, relationship *Relationship) (*Relationship, error)
+	GetRelationship(ctx context.Context, id int64) (*Relationship, error)
+	ListRelationships(ctx context.Context, filter RelationshipFilter) ([]*Relationship, error)
+	UpdateRelationship(ctx context.Context, relationship *Relationship) (*Relationship, error)
+	UpdateRelationshipFunc(ctx context.Context, id int64, update func(*Relationship) error) (*Relationship, error)
+	DeleteRelationship(ctx context.Context, id int64) error
+
+	SetTrustBundle(ctx context.Context, bundle *TrustBundle) (*TrustBundle, error)
+	GetTrustBundle(ctx context.Context, id int64) (*TrustBundle, error)
+	GetTrustBundleBySpireServer(ctx context.Context, spireServerID int64) (*TrustBundle, error)
+	ListTrustBundles(ctx context.Context, filter TrustBundleFilter) ([]*TrustBundle, error)
+	UpdateTrustBundle(ctx context.Context, bundle *TrustBundle) (*TrustBundle, error)
+	DeleteTrustBundle(ctx context.Context, id int64) error
+	DeleteUnchangedTrustBundle(ctx context.Context, bundle *TrustBundle) error
+
+	CreateEvent(ctx context.Context, event *Event) (*Event, error)
+	ListEvents(ctx context.Context, filter EventFilter) ([]*Event, error)
+	FirstEventID(ctx context.Context) (int64, error)
+	DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error)
+	EventsCreated() <-chan struct{}
+
+	// Ping checks that the datastore is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
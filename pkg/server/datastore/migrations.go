@@ -0,0 +1,142 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations holds the schema changes of the datastore. Each entry takes the
+// schema from version i to version i+1. Entries must never be modified once
+// released, new changes are appended to the end of the list.
+var migrations = []string{
+	`
+CREATE TABLE organizations (
+	id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE federation_groups (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	name   TEXT NOT NULL,
+	status TEXT NOT NULL,
+	UNIQUE (org_id, name)
+);
+
+CREATE TABLE spire_servers (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	trust_domain TEXT NOT NULL UNIQUE,
+	description  TEXT NOT NULL,
+	status       TEXT NOT NULL
+);
+
+CREATE TABLE memberships (
+	id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+	spire_server_id     INTEGER NOT NULL REFERENCES spire_servers(id) ON DELETE CASCADE,
+	federation_group_id INTEGER NOT NULL REFERENCES federation_groups(id) ON DELETE CASCADE,
+	status              TEXT NOT NULL,
+	UNIQUE (spire_server_id, federation_group_id)
+);
+
+CREATE TABLE relationships (
+	id                     INTEGER PRIMARY KEY AUTOINCREMENT,
+	federation_group_id    INTEGER NOT NULL REFERENCES federation_groups(id) ON DELETE CASCADE,
+	spire_server_id        INTEGER NOT NULL REFERENCES spire_servers(id) ON DELETE CASCADE,
+	federated_with_id      INTEGER NOT NULL REFERENCES spire_servers(id) ON DELETE CASCADE,
+	spire_server_consent   TEXT NOT NULL,
+	federated_with_consent TEXT NOT NULL,
+	status                 TEXT NOT NULL,
+	UNIQUE (federation_group_id, spire_server_id, federated_with_id),
+	CHECK (spire_server_id <> federated_with_id)
+);
+
+CREATE TABLE trust_bundles (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	spire_server_id INTEGER NOT NULL UNIQUE REFERENCES spire_servers(id) ON DELETE CASCADE,
+	bundle          BLOB NOT NULL,
+	status          TEXT NOT NULL,
+	updated_at      DATETIME NOT NULL
+);
+`,
+	`
+ALTER TABLE spire_servers ADD COLUMN bundle_endpoint_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE spire_servers ADD COLUMN bundle_endpoint_profile TEXT NOT NULL DEFAULT '';
+ALTER TABLE spire_servers ADD COLUMN bundle_endpoint_spiffe_id TEXT NOT NULL DEFAULT '';
+`,
+	`
+CREATE TABLE join_tokens (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	spire_server_id INTEGER NOT NULL REFERENCES spire_servers(id) ON DELETE CASCADE,
+	token_hash      TEXT NOT NULL UNIQUE,
+	expires_at      DATETIME NOT NULL
+);
+
+CREATE TABLE harvester_credentials (
+	spire_server_id INTEGER PRIMARY KEY REFERENCES spire_servers(id) ON DELETE CASCADE,
+	credential_hash TEXT NOT NULL UNIQUE,
+	created_at      DATETIME NOT NULL
+);
+`,
+	`
+CREATE TABLE events (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	trust_domain TEXT NOT NULL,
+	type         TEXT NOT NULL,
+	message      TEXT NOT NULL,
+	created_at   DATETIME NOT NULL
+);
+
+CREATE INDEX events_trust_domain ON events (trust_domain);
+`,
+	`
+ALTER TABLE trust_bundles ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+ALTER TABLE trust_bundles ADD COLUMN signing_certificate TEXT NOT NULL DEFAULT '';
+`,
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create schema version table: %v", err)
+	}
+
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := db.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return fmt.Errorf("failed to initialize schema version: %v", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the supported version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(ctx, db, version); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %v", version+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE schema_version SET version = ?`, version+1); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
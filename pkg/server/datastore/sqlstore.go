@@ -0,0 +1,930 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/mattn/go-sqlite3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// SQLite3 is the name of the SQLite driver.
+const SQLite3 = "sqlite3"
+
+// SQLDatastore is a Datastore backed by a SQL database.
+type SQLDatastore struct {
+	db *sql.DB
+
+	// eventsCreated is closed, and replaced, whenever an event is created.
+	eventsMtx     sync.Mutex
+	eventsCreated chan struct{}
+}
+
+// NewSQLDatastore opens the database identified by the given driver and
+// connection string, and brings its schema up to date.
+func NewSQLDatastore(ctx context.Context, driver, connectionString string) (*SQLDatastore, error) {
+	if driver != SQLite3 {
+		return nil, fmt.Errorf("unsupported datastore driver %q", driver)
+	}
+	if connectionString == "" {
+		return nil, errors.New("datastore connection string is required")
+	}
+
+	// The queries are traced, as part of the traces of the requests
+	db, err := otelsql.Open(driver, withForeignKeys(connectionString),
+		otelsql.WithAttributes(semconv.DBSystemSqlite),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open datastore: %v", err)
+	}
+
+	// SQLite does not support concurrent writers, serialize access through
+	// a single connection.
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to datastore: %v", err)
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLDatastore{db: db, eventsCreated: make(chan struct{})}, nil
+}
+
+func withForeignKeys(connectionString string) string {
+	if strings.Contains(connectionString, "?") {
+		return connectionString + "&_foreign_keys=on"
+	}
+	return connectionString + "?_foreign_keys=on"
+}
+
+// Ping checks that the underlying database is reachable.
+func (d *SQLDatastore) Ping(ctx context.Context) error {
+	if err := d.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach datastore: %v", err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying database.
+func (d *SQLDatastore) Close() error {
+	return d.db.Close()
+}
+
+func (d *SQLDatastore) CreateOrganization(ctx context.Context, org *Organization) (*Organization, error) {
+	res, err := d.db.ExecContext(ctx, `INSERT INTO organizations (name) VALUES (?)`, org.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %v", err)
+	}
+
+	return d.GetOrganization(ctx, id)
+}
+
+func (d *SQLDatastore) GetOrganization(ctx context.Context, id int64) (*Organization, error) {
+	orgs, err := d.listOrganizations(ctx, where{}.raw("id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(orgs, "organization")
+}
+
+func (d *SQLDatastore) ListOrganizations(ctx context.Context, filter OrganizationFilter) ([]*Organization, error) {
+	return d.listOrganizations(ctx, where{}.eq("name", filter.Name))
+}
+
+func (d *SQLDatastore) listOrganizations(ctx context.Context, w where) ([]*Organization, error) {
+	query, args := w.build(`SELECT id, name FROM organizations`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*Organization
+	for rows.Next() {
+		org := &Organization{}
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %v", err)
+		}
+		out = append(out, org)
+	}
+
+	return out, rows.Err()
+}
+
+func (d *SQLDatastore) UpdateOrganization(ctx context.Context, org *Organization) (*Organization, error) {
+	if err := d.update(ctx, "organization", `UPDATE organizations SET name = ? WHERE id = ?`, org.Name, org.ID); err != nil {
+		return nil, err
+	}
+
+	return d.GetOrganization(ctx, org.ID)
+}
+
+func (d *SQLDatastore) DeleteOrganization(ctx context.Context, id int64) error {
+	return d.update(ctx, "organization", `DELETE FROM organizations WHERE id = ?`, id)
+}
+
+func (d *SQLDatastore) CreateFederationGroup(ctx context.Context, group *FederationGroup) (*FederationGroup, error) {
+	res, err := d.db.ExecContext(ctx, `INSERT INTO federation_groups (org_id, name, status) VALUES (?, ?, ?)`,
+		group.OrgID, group.Name, group.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create federation group: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create federation group: %v", err)
+	}
+
+	return d.GetFederationGroup(ctx, id)
+}
+
+func (d *SQLDatastore) GetFederationGroup(ctx context.Context, id int64) (*FederationGroup, error) {
+	groups, err := d.listFederationGroups(ctx, where{}.raw("g.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(groups, "federation group")
+}
+
+func (d *SQLDatastore) ListFederationGroups(ctx context.Context, filter FederationGroupFilter) ([]*FederationGroup, error) {
+	w := where{}.
+		eq("g.org_id", filter.OrgID).
+		eq("o.name", filter.OrgName).
+		eq("g.name", filter.Name)
+
+	return d.listFederationGroups(ctx, w)
+}
+
+func (d *SQLDatastore) listFederationGroups(ctx context.Context, w where) ([]*FederationGroup, error) {
+	query, args := w.build(`
+SELECT g.id, g.org_id, g.name, g.status
+FROM federation_groups g
+JOIN organizations o ON o.id = g.org_id`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY g.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list federation groups: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*FederationGroup
+	for rows.Next() {
+		group := &FederationGroup{}
+		if err := rows.Scan(&group.ID, &group.OrgID, &group.Name, &group.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan federation group: %v", err)
+		}
+		out = append(out, group)
+	}
+
+	return out, rows.Err()
+}
+
+func (d *SQLDatastore) UpdateFederationGroup(ctx context.Context, group *FederationGroup) (*FederationGroup, error) {
+	err := d.update(ctx, "federation group", `UPDATE federation_groups SET org_id = ?, name = ?, status = ? WHERE id = ?`,
+		group.OrgID, group.Name, group.Status, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetFederationGroup(ctx, group.ID)
+}
+
+func (d *SQLDatastore) DeleteFederationGroup(ctx context.Context, id int64) error {
+	return d.update(ctx, "federation group", `DELETE FROM federation_groups WHERE id = ?`, id)
+}
+
+func (d *SQLDatastore) CreateSpireServer(ctx context.Context, server *SpireServer) (*SpireServer, error) {
+	res, err := d.db.ExecContext(ctx, `
+INSERT INTO spire_servers (trust_domain, description, bundle_endpoint_url, bundle_endpoint_profile, bundle_endpoint_spiffe_id, status)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		server.TrustDomain, server.Description, server.BundleEndpoint.URL, server.BundleEndpoint.Profile,
+		server.BundleEndpoint.SpiffeID, server.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spire server: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spire server: %v", err)
+	}
+
+	return d.GetSpireServer(ctx, id)
+}
+
+func (d *SQLDatastore) GetSpireServer(ctx context.Context, id int64) (*SpireServer, error) {
+	servers, err := d.listSpireServers(ctx, where{}.raw("id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(servers, "spire server")
+}
+
+func (d *SQLDatastore) GetSpireServerByTrustDomain(ctx context.Context, trustDomain string) (*SpireServer, error) {
+	if trustDomain == "" {
+		return nil, fmt.Errorf("spire server: %w", ErrNotFound)
+	}
+
+	servers, err := d.listSpireServers(ctx, where{}.eq("trust_domain", trustDomain))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(servers, "spire server")
+}
+
+func (d *SQLDatastore) ListSpireServers(ctx context.Context, filter SpireServerFilter) ([]*SpireServer, error) {
+	w := where{}.
+		eq("trust_domain", filter.TrustDomain).
+		eq("status", filter.Status)
+
+	return d.listSpireServers(ctx, w)
+}
+
+func (d *SQLDatastore) listSpireServers(ctx context.Context, w where) ([]*SpireServer, error) {
+	query, args := w.build(`
+SELECT id, trust_domain, description, bundle_endpoint_url, bundle_endpoint_profile, bundle_endpoint_spiffe_id, status
+FROM spire_servers`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spire servers: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*SpireServer
+	for rows.Next() {
+		server := &SpireServer{}
+		if err := rows.Scan(&server.ID, &server.TrustDomain, &server.Description, &server.BundleEndpoint.URL,
+			&server.BundleEndpoint.Profile, &server.BundleEndpoint.SpiffeID, &server.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan spire server: %v", err)
+		}
+		out = append(out, server)
+	}
+
+	return out, rows.Err()
+}
+
+// UpdateSpireServer updates a SPIRE Server. Its trust domain, which its trust
+// bundle and harvester credential are tied to, can not be changed.
+func (d *SQLDatastore) UpdateSpireServer(ctx context.Context, server *SpireServer) (*SpireServer, error) {
+	err := d.update(ctx, "spire server", `
+UPDATE spire_servers
+SET description = ?, bundle_endpoint_url = ?, bundle_endpoint_profile = ?, bundle_endpoint_spiffe_id = ?, status = ?
+WHERE id = ?`,
+		server.Description, server.BundleEndpoint.URL, server.BundleEndpoint.Profile,
+		server.BundleEndpoint.SpiffeID, server.Status, server.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetSpireServer(ctx, server.ID)
+}
+
+func (d *SQLDatastore) DeleteSpireServer(ctx context.Context, id int64) error {
+	return d.update(ctx, "spire server", `DELETE FROM spire_servers WHERE id = ?`, id)
+}
+
+// CreateJoinToken persists a hash of the given join token. Expired join
+// tokens are pruned.
+func (d *SQLDatastore) CreateJoinToken(ctx context.Context, token *JoinToken) (*JoinToken, error) {
+	if token.Token == "" {
+		return nil, errors.New("failed to create join token: token is empty")
+	}
+
+	if _, err := d.db.ExecContext(ctx, `DELETE FROM join_tokens WHERE expires_at <= ?`, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to prune expired join tokens: %v", err)
+	}
+
+	res, err := d.db.ExecContext(ctx, `INSERT INTO join_tokens (spire_server_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		token.SpireServerID, secretHash(token.Token), token.ExpiresAt.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create join token: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create join token: %v", err)
+	}
+
+	return &JoinToken{
+		ID:            id,
+		SpireServerID: token.SpireServerID,
+		Token:         token.Token,
+		ExpiresAt:     token.ExpiresAt.UTC(),
+	}, nil
+}
+
+// RedeemJoinToken consumes the given join token, sets the credential of the
+// harvester of its SPIRE Server, replacing the previous one, and activates the
+// SPIRE Server. It returns ErrNotFound if the join token does not exist or
+// expired.
+func (d *SQLDatastore) RedeemJoinToken(ctx context.Context, token, credential string) (*SpireServer, error) {
+	if credential == "" {
+		return nil, errors.New("failed to redeem join token: credential is empty")
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem join token: %v", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var id, spireServerID int64
+	err = tx.QueryRowContext(ctx, `SELECT id, spire_server_id FROM join_tokens WHERE token_hash = ? AND expires_at > ?`,
+		secretHash(token), time.Now().UTC()).Scan(&id, &spireServerID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("join token: %w", ErrNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("failed to redeem join token: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM join_tokens WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("failed to redeem join token: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO harvester_credentials (spire_server_id, credential_hash, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (spire_server_id) DO UPDATE SET
+	credential_hash = excluded.credential_hash,
+	created_at = excluded.created_at`,
+		spireServerID, secretHash(credential), time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to set harvester credential: %w", sqlError(err))
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE spire_servers SET status = 'active' WHERE id = ?`, spireServerID); err != nil {
+		return nil, fmt.Errorf("failed to activate spire server: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to redeem join token: %v", err)
+	}
+
+	return d.GetSpireServer(ctx, spireServerID)
+}
+
+// GetSpireServerByCredential returns the SPIRE Server whose harvester was
+// issued the given credential.
+func (d *SQLDatastore) GetSpireServerByCredential(ctx context.Context, credential string) (*SpireServer, error) {
+	if credential == "" {
+		return nil, fmt.Errorf("spire server: %w", ErrNotFound)
+	}
+
+	servers, err := d.listSpireServers(ctx, where{}.raw(
+		"id = (SELECT spire_server_id FROM harvester_credentials WHERE credential_hash = ?)", secretHash(credential)))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(servers, "spire server")
+}
+
+func (d *SQLDatastore) CreateMembership(ctx context.Context, membership *Membership) (*Membership, error) {
+	res, err := d.db.ExecContext(ctx, `INSERT INTO memberships (spire_server_id, federation_group_id, status) VALUES (?, ?, ?)`,
+		membership.SpireServerID, membership.FederationGroupID, membership.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create membership: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create membership: %v", err)
+	}
+
+	return d.GetMembership(ctx, id)
+}
+
+func (d *SQLDatastore) GetMembership(ctx context.Context, id int64) (*Membership, error) {
+	memberships, err := d.listMemberships(ctx, where{}.raw("m.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(memberships, "membership")
+}
+
+func (d *SQLDatastore) ListMemberships(ctx context.Context, filter MembershipFilter) ([]*Membership, error) {
+	w := where{}.
+		eq("g.org_id", filter.OrgID).
+		eq("o.name", filter.OrgName).
+		eq("m.federation_group_id", filter.FederationGroupID).
+		eq("m.spire_server_id", filter.SpireServerID).
+		eq("s.trust_domain", filter.TrustDomain).
+		eq("m.status", filter.Status)
+
+	return d.listMemberships(ctx, w)
+}
+
+func (d *SQLDatastore) listMemberships(ctx context.Context, w where) ([]*Membership, error) {
+	query, args := w.build(`
+SELECT m.id, m.spire_server_id, m.federation_group_id, m.status
+FROM memberships m
+JOIN spire_servers s ON s.id = m.spire_server_id
+JOIN federation_groups g ON g.id = m.federation_group_id
+JOIN organizations o ON o.id = g.org_id`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY m.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*Membership
+	for rows.Next() {
+		m := &Membership{}
+		if err := rows.Scan(&m.ID, &m.SpireServerID, &m.FederationGroupID, &m.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %v", err)
+		}
+		out = append(out, m)
+	}
+
+	return out, rows.Err()
+}
+
+func (d *SQLDatastore) UpdateMembership(ctx context.Context, membership *Membership) (*Membership, error) {
+	err := d.update(ctx, "membership", `UPDATE memberships SET spire_server_id = ?, federation_group_id = ?, status = ? WHERE id = ?`,
+		membership.SpireServerID, membership.FederationGroupID, membership.Status, membership.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.GetMembership(ctx, membership.ID)
+}
+
+func (d *SQLDatastore) DeleteMembership(ctx context.Context, id int64) error {
+	return d.update(ctx, "membership", `DELETE FROM memberships WHERE id = ?`, id)
+}
+
+func (d *SQLDatastore) CreateRelationship(ctx context.Context, relationship *Relationship) (*Relationship, error) {
+	res, err := d.db.ExecContext(ctx, `
+INSERT INTO relationships (federation_group_id, spire_server_id, federated_with_id, spire_server_consent, federated_with_consent, status)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		relationship.FederationGroupID, relationship.SpireServerID, relationship.SpireServerFederatedWithID,
+		relationship.SpireServerConsent, relationship.SpireServerFederatedWithConsent, relationship.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relationship: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relationship: %v", err)
+	}
+
+	return d.GetRelationship(ctx, id)
+}
+
+func (d *SQLDatastore) GetRelationship(ctx context.Context, id int64) (*Relationship, error) {
+	relationships, err := d.listRelationships(ctx, d.db, where{}.raw("r.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(relationships, "relationship")
+}
+
+func (d *SQLDatastore) ListRelationships(ctx context.Context, filter RelationshipFilter) ([]*Relationship, error) {
+	w := where{}.
+		eq("g.org_id", filter.OrgID).
+		eq("o.name", filter.OrgName).
+		eq("r.federation_group_id", filter.FederationGroupID).
+		eq("r.status", filter.Status)
+	if filter.TrustDomain != "" {
+		w = w.raw("(s.trust_domain = ? OR f.trust_domain = ?)", filter.TrustDomain, filter.TrustDomain)
+	}
+
+	return d.listRelationships(ctx, d.db, w)
+}
+
+func (d *SQLDatastore) listRelationships(ctx context.Context, q queryer, w where) ([]*Relationship, error) {
+	query, args := w.build(`
+SELECT r.id, r.federation_group_id, r.spire_server_id, r.federated_with_id,
+	r.spire_server_consent, r.federated_with_consent, r.status,
+	s.trust_domain, f.trust_domain,
+	s.bundle_endpoint_url, s.bundle_endpoint_profile, s.bundle_endpoint_spiffe_id,
+	f.bundle_endpoint_url, f.bundle_endpoint_profile, f.bundle_endpoint_spiffe_id
+FROM relationships r
+JOIN spire_servers s ON s.id = r.spire_server_id
+JOIN spire_servers f ON f.id = r.federated_with_id
+JOIN federation_groups g ON g.id = r.federation_group_id
+JOIN organizations o ON o.id = g.org_id`)
+	rows, err := q.QueryContext(ctx, query+` ORDER BY r.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relationships: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*Relationship
+	for rows.Next() {
+		r := &Relationship{}
+		if err := rows.Scan(&r.ID, &r.FederationGroupID, &r.SpireServerID, &r.SpireServerFederatedWithID,
+			&r.SpireServerConsent, &r.SpireServerFederatedWithConsent, &r.Status,
+			&r.SpireServerTrustDomain, &r.SpireServerFederatedWithTrustDomain,
+			&r.SpireServerBundleEndpoint.URL, &r.SpireServerBundleEndpoint.Profile, &r.SpireServerBundleEndpoint.SpiffeID,
+			&r.SpireServerFederatedWithBundleEndpoint.URL, &r.SpireServerFederatedWithBundleEndpoint.Profile,
+			&r.SpireServerFederatedWithBundleEndpoint.SpiffeID); err != nil {
+			return nil, fmt.Errorf("failed to scan relationship: %v", err)
+		}
+		out = append(out, r)
+	}
+
+	return out, rows.Err()
+}
+
+const updateRelationshipQuery = `
+UPDATE relationships
+SET federation_group_id = ?, spire_server_id = ?, federated_with_id = ?,
+	spire_server_consent = ?, federated_with_consent = ?, status = ?
+WHERE id = ?`
+
+func updateRelationshipArgs(relationship *Relationship) []interface{} {
+	return []interface{}{
+		relationship.FederationGroupID, relationship.SpireServerID, relationship.SpireServerFederatedWithID,
+		relationship.SpireServerConsent, relationship.SpireServerFederatedWithConsent, relationship.Status,
+		relationship.ID,
+	}
+}
+
+func (d *SQLDatastore) UpdateRelationship(ctx context.Context, relationship *Relationship) (*Relationship, error) {
+	if err := d.update(ctx, "relationship", updateRelationshipQuery, updateRelationshipArgs(relationship)...); err != nil {
+		return nil, err
+	}
+
+	return d.GetRelationship(ctx, relationship.ID)
+}
+
+// UpdateRelationshipFunc reads the relationship, modifies it with update and
+// writes it back in a single transaction, so that concurrent updates of the
+// relationship, such as the consents of its two sides, are not lost. Nothing
+// is written if update fails, and its error is returned as is.
+func (d *SQLDatastore) UpdateRelationshipFunc(ctx context.Context, id int64, update func(*Relationship) error) (*Relationship, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update relationship: %v", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	relationships, err := d.listRelationships(ctx, tx, where{}.raw("r.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	relationship, err := firstOf(relationships, "relationship")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := update(relationship); err != nil {
+		return nil, err
+	}
+	relationship.ID = id
+
+	if _, err := tx.ExecContext(ctx, updateRelationshipQuery, updateRelationshipArgs(relationship)...); err != nil {
+		return nil, fmt.Errorf("failed to update relationship: %w", sqlError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update relationship: %v", err)
+	}
+
+	return d.GetRelationship(ctx, id)
+}
+
+func (d *SQLDatastore) DeleteRelationship(ctx context.Context, id int64) error {
+	return d.update(ctx, "relationship", `DELETE FROM relationships WHERE id = ?`, id)
+}
+
+// SetTrustBundle creates the trust bundle of the referenced SPIRE Server, or
+// replaces it if one already exists.
+func (d *SQLDatastore) SetTrustBundle(ctx context.Context, bundle *TrustBundle) (*TrustBundle, error) {
+	_, err := d.db.ExecContext(ctx, `
+INSERT INTO trust_bundles (spire_server_id, bundle, status, signature, signing_certificate, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (spire_server_id) DO UPDATE SET
+	bundle = excluded.bundle,
+	status = excluded.status,
+	signature = excluded.signature,
+	signing_certificate = excluded.signing_certificate,
+	updated_at = excluded.updated_at`,
+		bundle.SpireServerID, bundle.Bundle, bundle.Status, bundle.Signature, bundle.SigningCertificate, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to set trust bundle: %w", sqlError(err))
+	}
+
+	return d.GetTrustBundleBySpireServer(ctx, bundle.SpireServerID)
+}
+
+func (d *SQLDatastore) GetTrustBundle(ctx context.Context, id int64) (*TrustBundle, error) {
+	bundles, err := d.listTrustBundles(ctx, where{}.raw("b.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(bundles, "trust bundle")
+}
+
+func (d *SQLDatastore) GetTrustBundleBySpireServer(ctx context.Context, spireServerID int64) (*TrustBundle, error) {
+	bundles, err := d.listTrustBundles(ctx, where{}.raw("b.spire_server_id = ?", spireServerID))
+	if err != nil {
+		return nil, err
+	}
+
+	return firstOf(bundles, "trust bundle")
+}
+
+func (d *SQLDatastore) ListTrustBundles(ctx context.Context, filter TrustBundleFilter) ([]*TrustBundle, error) {
+	w := where{}.
+		eq("s.trust_domain", filter.TrustDomain).
+		eq("b.status", filter.Status)
+
+	return d.listTrustBundles(ctx, w)
+}
+
+func (d *SQLDatastore) listTrustBundles(ctx context.Context, w where) ([]*TrustBundle, error) {
+	query, args := w.build(`
+SELECT b.id, b.spire_server_id, b.bundle, b.status, b.signature, b.signing_certificate, b.updated_at, s.trust_domain
+FROM trust_bundles b
+JOIN spire_servers s ON s.id = b.spire_server_id`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY b.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trust bundles: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*TrustBundle
+	for rows.Next() {
+		b := &TrustBundle{}
+		if err := rows.Scan(&b.ID, &b.SpireServerID, &b.Bundle, &b.Status, &b.Signature, &b.SigningCertificate, &b.UpdatedAt, &b.TrustDomain); err != nil {
+			return nil, fmt.Errorf("failed to scan trust bundle: %v", err)
+		}
+		out = append(out, b)
+	}
+
+	return out, rows.Err()
+}
+
+// UpdateTrustBundle replaces the trust bundle as it was read, identified by
+// its ID and UpdatedAt. It returns ErrNotFound if the trust bundle was set or
+// deleted since, so that the caller does not overwrite a newer trust bundle.
+func (d *SQLDatastore) UpdateTrustBundle(ctx context.Context, bundle *TrustBundle) (*TrustBundle, error) {
+	if err := d.update(ctx, "trust bundle", `
+UPDATE trust_bundles SET bundle = ?, status = ?, signature = ?, signing_certificate = ?, updated_at = ?
+WHERE id = ? AND updated_at = ?`,
+		bundle.Bundle, bundle.Status, bundle.Signature, bundle.SigningCertificate, time.Now().UTC(),
+		bundle.ID, bundle.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return d.GetTrustBundle(ctx, bundle.ID)
+}
+
+func (d *SQLDatastore) DeleteTrustBundle(ctx context.Context, id int64) error {
+	return d.update(ctx, "trust bundle", `DELETE FROM trust_bundles WHERE id = ?`, id)
+}
+
+// DeleteUnchangedTrustBundle deletes the trust bundle as it was read,
+// identified by its ID and UpdatedAt. It returns ErrNotFound if the trust
+// bundle was set or deleted since.
+func (d *SQLDatastore) DeleteUnchangedTrustBundle(ctx context.Context, bundle *TrustBundle) error {
+	return d.update(ctx, "trust bundle", `DELETE FROM trust_bundles WHERE id = ? AND updated_at = ?`, bundle.ID, bundle.UpdatedAt)
+}
+
+func (d *SQLDatastore) CreateEvent(ctx context.Context, event *Event) (*Event, error) {
+	createdAt := time.Now().UTC()
+	res, err := d.db.ExecContext(ctx, `INSERT INTO events (trust_domain, type, message, created_at) VALUES (?, ?, ?, ?)`,
+		event.TrustDomain, event.Type, event.Message, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", sqlError(err))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %v", err)
+	}
+
+	d.eventsMtx.Lock()
+	close(d.eventsCreated)
+	d.eventsCreated = make(chan struct{})
+	d.eventsMtx.Unlock()
+
+	return &Event{
+		ID:          id,
+		TrustDomain: event.TrustDomain,
+		Type:        event.Type,
+		Message:     event.Message,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+// EventsCreated returns a channel closed once an event is created after the
+// call. Only the events created through this datastore are notified, not the
+// ones created by other processes sharing the database.
+func (d *SQLDatastore) EventsCreated() <-chan struct{} {
+	d.eventsMtx.Lock()
+	defer d.eventsMtx.Unlock()
+
+	return d.eventsCreated
+}
+
+// ListEvents returns the events matching the filter, in the order they
+// happened.
+func (d *SQLDatastore) ListEvents(ctx context.Context, filter EventFilter) ([]*Event, error) {
+	w := where{}.
+		in("trust_domain", filter.TrustDomains).
+		in("type", filter.Types)
+	if filter.AfterID != 0 {
+		w = w.raw("id > ?", filter.AfterID)
+	}
+
+	query, args := w.build(`SELECT id, trust_domain, type, message, created_at FROM events`)
+	rows, err := d.db.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+	defer rows.Close()
+
+	var out []*Event
+	for rows.Next() {
+		e := &Event{}
+		if err := rows.Scan(&e.ID, &e.TrustDomain, &e.Type, &e.Message, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %v", err)
+		}
+		out = append(out, e)
+	}
+
+	return out, rows.Err()
+}
+
+// FirstEventID returns the ID of the oldest event retained, or the ID of the
+// next event if none is. The events with a lower ID were deleted.
+func (d *SQLDatastore) FirstEventID(ctx context.Context) (int64, error) {
+	// Event IDs are never reused, the last one given is kept in the sequence
+	// of the table even when every event is deleted
+	var id int64
+	err := d.db.QueryRowContext(ctx, `
+SELECT COALESCE(
+	(SELECT MIN(id) FROM events),
+	(SELECT seq + 1 FROM sqlite_sequence WHERE name = 'events'),
+	1)`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get first event: %v", err)
+	}
+
+	return id, nil
+}
+
+// DeleteEventsBefore deletes the events created before the given time, and
+// returns the number of events deleted.
+func (d *SQLDatastore) DeleteEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM events WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", sqlError(err))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %v", err)
+	}
+
+	return n, nil
+}
+
+// NewSecret returns a random join token or credential.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// secretHash returns the hash under which a join token or credential is
+// persisted.
+func secretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// queryer is either the database or a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// update runs a statement that is expected to affect exactly one row of the
+// given entity, and returns ErrNotFound when no row was affected.
+func (d *SQLDatastore) update(ctx context.Context, entity, query string, args ...interface{}) error {
+	res, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", entity, sqlError(err))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %v", entity, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", entity, ErrNotFound)
+	}
+
+	return nil
+}
+
+func firstOf[T any](items []*T, entity string) (*T, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s: %w", entity, ErrNotFound)
+	}
+
+	return items[0], nil
+}
+
+// sqlError translates constraint violations into datastore errors.
+func sqlError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return ErrAlreadyExists
+	case sqlite3.ErrConstraintForeignKey, sqlite3.ErrConstraintCheck:
+		return ErrInvalidReference
+	}
+
+	return err
+}
+
+// where accumulates the conditions of a WHERE clause. Conditions with zero
+// values are skipped.
+type where struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w where) eq(column string, value interface{}) where {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return w
+		}
+	case int64:
+		if v == 0 {
+			return w
+		}
+	}
+
+	return w.raw(column+" = ?", value)
+}
+
+// in matches the rows whose column has any of the given values, if any.
+func (w where) in(column string, values []string) where {
+	if len(values) == 0 {
+		return w
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	args := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return w.raw(column+" IN ("+placeholders+")", args...)
+}
+
+func (w where) raw(condition string, args ...interface{}) where {
+	w.conditions = append(w.conditions[:len(w.conditions):len(w.conditions)], condition)
+	w.args = append(w.args[:len(w.args):len(w.args)], args...)
+	return w
+}
+
+func (w where) build(query string) (string, []interface{}) {
+	if len(w.conditions) == 0 {
+		return query, nil
+	}
+
+	return query + " WHERE " + strings.Join(w.conditions, " AND "), w.args
+}
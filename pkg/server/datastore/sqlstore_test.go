@@ -0,0 +1,502 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatastore(t *testing.T) *SQLDatastore {
+	ds, err := NewSQLDatastore(context.Background(), SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	return ds
+}
+
+func TestNewSQLDatastore(t *testing.T) {
+	tests := []struct {
+		name             string
+		driver           string
+		connectionString string
+		err              string
+	}{
+		{
+			name:             "ok",
+			driver:           SQLite3,
+			connectionString: filepath.Join(t.TempDir(), "datastore.sqlite3"),
+		},
+		{
+			name:             "unsupported_driver",
+			driver:           "postgres",
+			connectionString: "postgres://localhost",
+			err:              `unsupported datastore driver "postgres"`,
+		},
+		{
+			name:   "empty_connection_string",
+			driver: SQLite3,
+			err:    "datastore connection string is required",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := NewSQLDatastore(context.Background(), tt.driver, tt.connectionString)
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, ds)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.NoError(t, ds.Ping(context.Background()))
+			assert.NoError(t, ds.Close())
+			assert.EqualError(t, ds.Ping(context.Background()), "failed to reach datastore: sql: database is closed")
+		})
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "datastore.sqlite3")
+
+	ds, err := NewSQLDatastore(ctx, SQLite3, path)
+	require.NoError(t, err)
+	_, err = ds.CreateOrganization(ctx, &Organization{Name: "org"})
+	require.NoError(t, err)
+	require.NoError(t, ds.Close())
+
+	ds, err = NewSQLDatastore(ctx, SQLite3, path)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	orgs, err := ds.ListOrganizations(ctx, OrganizationFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Organization{{ID: 1, Name: "org"}}, orgs)
+}
+
+func TestOrganizations(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	org, err := ds.CreateOrganization(ctx, &Organization{Name: "org1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Organization{ID: 1, Name: "org1"}, org)
+
+	_, err = ds.CreateOrganization(ctx, &Organization{Name: "org1"})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = ds.CreateOrganization(ctx, &Organization{Name: "org2"})
+	require.NoError(t, err)
+
+	orgs, err := ds.ListOrganizations(ctx, OrganizationFilter{Name: "org2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Organization{{ID: 2, Name: "org2"}}, orgs)
+
+	org, err = ds.UpdateOrganization(ctx, &Organization{ID: 1, Name: "renamed"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Organization{ID: 1, Name: "renamed"}, org)
+
+	_, err = ds.UpdateOrganization(ctx, &Organization{ID: 10, Name: "missing"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, ds.DeleteOrganization(ctx, 1))
+	assert.ErrorIs(t, ds.DeleteOrganization(ctx, 1), ErrNotFound)
+
+	_, err = ds.GetOrganization(ctx, 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFederationGroups(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	_, err := ds.CreateFederationGroup(ctx, &FederationGroup{OrgID: 1, Name: "group", Status: "active"})
+	assert.ErrorIs(t, err, ErrInvalidReference)
+
+	org, err := ds.CreateOrganization(ctx, &Organization{Name: "org"})
+	require.NoError(t, err)
+
+	group, err := ds.CreateFederationGroup(ctx, &FederationGroup{OrgID: org.ID, Name: "group", Status: "active"})
+	require.NoError(t, err)
+	assert.Equal(t, &FederationGroup{ID: 1, OrgID: org.ID, Name: "group", Status: "active"}, group)
+
+	_, err = ds.CreateFederationGroup(ctx, &FederationGroup{OrgID: org.ID, Name: "group", Status: "active"})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	groups, err := ds.ListFederationGroups(ctx, FederationGroupFilter{OrgName: "org"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*FederationGroup{group}, groups)
+
+	groups, err = ds.ListFederationGroups(ctx, FederationGroupFilter{OrgName: "other"})
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	// Deleting the organization removes its federation groups
+	require.NoError(t, ds.DeleteOrganization(ctx, org.ID))
+	_, err = ds.GetFederationGroup(ctx, group.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSpireServers(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	server, err := ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "example.org", Description: "desc", Status: "invited"})
+	require.NoError(t, err)
+	assert.Equal(t, &SpireServer{ID: 1, TrustDomain: "example.org", Description: "desc", Status: "invited"}, server)
+
+	_, err = ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "example.org", Status: "invited"})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	got, err := ds.GetSpireServerByTrustDomain(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, server, got)
+
+	_, err = ds.GetSpireServerByTrustDomain(ctx, "other.org")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	server.Status = "active"
+	server.BundleEndpoint = BundleEndpoint{URL: "https://example.org:8443", Profile: "https_spiffe", SpiffeID: "spiffe://example.org/spire/server"}
+	got, err = ds.UpdateSpireServer(ctx, server)
+	assert.NoError(t, err)
+	assert.Equal(t, server, got)
+
+	// The trust domain can not be changed
+	renamed := *server
+	renamed.TrustDomain = "other.org"
+	got, err = ds.UpdateSpireServer(ctx, &renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, server, got)
+
+	servers, err := ds.ListSpireServers(ctx, SpireServerFilter{Status: "invited"})
+	assert.NoError(t, err)
+	assert.Empty(t, servers)
+
+	assert.NoError(t, ds.DeleteSpireServer(ctx, server.ID))
+}
+
+func TestJoinTokens(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	server, err := ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "example.org", Status: "invited"})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	token, err := ds.CreateJoinToken(ctx, &JoinToken{SpireServerID: server.ID, Token: "token", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	assert.Equal(t, &JoinToken{ID: 1, SpireServerID: server.ID, Token: "token", ExpiresAt: expiresAt}, token)
+
+	_, err = ds.CreateJoinToken(ctx, &JoinToken{SpireServerID: 42, Token: "other", ExpiresAt: expiresAt})
+	assert.ErrorIs(t, err, ErrInvalidReference)
+
+	_, err = ds.CreateJoinToken(ctx, &JoinToken{SpireServerID: server.ID, ExpiresAt: expiresAt})
+	assert.EqualError(t, err, "failed to create join token: token is empty")
+
+	_, err = ds.CreateJoinToken(ctx, &JoinToken{SpireServerID: server.ID, Token: "expired", ExpiresAt: time.Now().Add(-time.Second)})
+	require.NoError(t, err)
+
+	_, err = ds.GetSpireServerByCredential(ctx, "credential")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Redeeming a join token activates the SPIRE Server
+	got, err := ds.RedeemJoinToken(ctx, "token", "credential")
+	require.NoError(t, err)
+	server.Status = "active"
+	assert.Equal(t, server, got)
+
+	got, err = ds.GetSpireServerByCredential(ctx, "credential")
+	require.NoError(t, err)
+	assert.Equal(t, server, got)
+
+	// Join tokens are single-use
+	_, err = ds.RedeemJoinToken(ctx, "token", "other credential")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ds.RedeemJoinToken(ctx, "expired", "other credential")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Redeeming a new join token replaces the credential
+	_, err = ds.CreateJoinToken(ctx, &JoinToken{SpireServerID: server.ID, Token: "new token", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	_, err = ds.RedeemJoinToken(ctx, "new token", "new credential")
+	require.NoError(t, err)
+
+	_, err = ds.GetSpireServerByCredential(ctx, "credential")
+	assert.ErrorIs(t, err, ErrNotFound)
+	got, err = ds.GetSpireServerByCredential(ctx, "new credential")
+	require.NoError(t, err)
+	assert.Equal(t, server, got)
+
+	// Credentials are removed along with their SPIRE Server
+	require.NoError(t, ds.DeleteSpireServer(ctx, server.ID))
+	_, err = ds.GetSpireServerByCredential(ctx, "new credential")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMembershipsAndRelationships(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	org, err := ds.CreateOrganization(ctx, &Organization{Name: "org"})
+	require.NoError(t, err)
+	group, err := ds.CreateFederationGroup(ctx, &FederationGroup{OrgID: org.ID, Name: "group", Status: "active"})
+	require.NoError(t, err)
+	td1, err := ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "td1.org", Status: "active"})
+	require.NoError(t, err)
+	td2Endpoint := BundleEndpoint{URL: "https://td2.org/bundle", Profile: "https_web"}
+	td2, err := ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "td2.org", BundleEndpoint: td2Endpoint, Status: "active"})
+	require.NoError(t, err)
+
+	membership, err := ds.CreateMembership(ctx, &Membership{SpireServerID: td1.ID, FederationGroupID: group.ID, Status: "active"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), membership.ID)
+
+	_, err = ds.CreateMembership(ctx, &Membership{SpireServerID: td1.ID, FederationGroupID: group.ID, Status: "active"})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = ds.CreateMembership(ctx, &Membership{SpireServerID: 100, FederationGroupID: group.ID, Status: "active"})
+	assert.ErrorIs(t, err, ErrInvalidReference)
+
+	memberships, err := ds.ListMemberships(ctx, MembershipFilter{TrustDomain: "td1.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Membership{membership}, memberships)
+
+	relationship, err := ds.CreateRelationship(ctx, &Relationship{
+		FederationGroupID:               group.ID,
+		SpireServerID:                   td1.ID,
+		SpireServerFederatedWithID:      td2.ID,
+		SpireServerConsent:              "pending",
+		SpireServerFederatedWithConsent: "pending",
+		Status:                          "invited",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "td1.org", relationship.SpireServerTrustDomain)
+	assert.Equal(t, "td2.org", relationship.SpireServerFederatedWithTrustDomain)
+	assert.Equal(t, BundleEndpoint{}, relationship.SpireServerBundleEndpoint)
+	assert.Equal(t, td2Endpoint, relationship.SpireServerFederatedWithBundleEndpoint)
+
+	_, err = ds.CreateRelationship(ctx, &Relationship{
+		FederationGroupID:          group.ID,
+		SpireServerID:              td1.ID,
+		SpireServerFederatedWithID: td1.ID,
+		Status:                     "invited",
+	})
+	assert.ErrorIs(t, err, ErrInvalidReference)
+
+	relationships, err := ds.ListRelationships(ctx, RelationshipFilter{TrustDomain: "td2.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Relationship{relationship}, relationships)
+
+	relationships, err = ds.ListRelationships(ctx, RelationshipFilter{Status: "active"})
+	assert.NoError(t, err)
+	assert.Empty(t, relationships)
+
+	// Concurrent updates of the two sides are not lost
+	var wg sync.WaitGroup
+	for _, accept := range []func(*Relationship){
+		func(r *Relationship) { r.SpireServerConsent = "accepted" },
+		func(r *Relationship) { r.SpireServerFederatedWithConsent = "accepted" },
+	} {
+		accept := accept
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ds.UpdateRelationshipFunc(ctx, relationship.ID, func(r *Relationship) error {
+				accept(r)
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	updated, err := ds.GetRelationship(ctx, relationship.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "accepted", updated.SpireServerConsent)
+	assert.Equal(t, "accepted", updated.SpireServerFederatedWithConsent)
+
+	// Nothing is written when the update fails
+	errUpdate := errors.New("update failed")
+	_, err = ds.UpdateRelationshipFunc(ctx, relationship.ID, func(r *Relationship) error {
+		r.Status = "active"
+		return errUpdate
+	})
+	assert.Equal(t, errUpdate, err)
+	updated, err = ds.GetRelationship(ctx, relationship.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "invited", updated.Status)
+
+	_, err = ds.UpdateRelationshipFunc(ctx, 100, func(*Relationship) error { return nil })
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a SPIRE Server removes its memberships and relationships
+	require.NoError(t, ds.DeleteSpireServer(ctx, td1.ID))
+	_, err = ds.GetMembership(ctx, membership.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = ds.GetRelationship(ctx, relationship.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTrustBundles(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	_, err := ds.SetTrustBundle(ctx, &TrustBundle{SpireServerID: 1, Bundle: []byte("bundle"), Status: "active"})
+	assert.ErrorIs(t, err, ErrInvalidReference)
+
+	server, err := ds.CreateSpireServer(ctx, &SpireServer{TrustDomain: "example.org", Status: "active"})
+	require.NoError(t, err)
+
+	bundle, err := ds.SetTrustBundle(ctx, &TrustBundle{SpireServerID: server.ID, Bundle: []byte("bundle"), Status: "active"})
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", bundle.TrustDomain)
+	assert.Equal(t, []byte("bundle"), bundle.Bundle)
+	assert.False(t, bundle.UpdatedAt.IsZero())
+
+	updated, err := ds.SetTrustBundle(ctx, &TrustBundle{
+		SpireServerID:      server.ID,
+		Bundle:             []byte("rotated"),
+		Status:             "active",
+		Signature:          "signature",
+		SigningCertificate: "certificate",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, bundle.ID, updated.ID)
+	assert.Equal(t, []byte("rotated"), updated.Bundle)
+	assert.Equal(t, "signature", updated.Signature)
+	assert.Equal(t, "certificate", updated.SigningCertificate)
+
+	bundles, err := ds.ListTrustBundles(ctx, TrustBundleFilter{TrustDomain: "example.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*TrustBundle{updated}, bundles)
+
+	// Trust bundles are only updated or deleted as they were read
+	stale := *bundle
+	stale.Status = "to_delete"
+	_, err = ds.UpdateTrustBundle(ctx, &stale)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, ds.DeleteUnchangedTrustBundle(ctx, &stale), ErrNotFound)
+
+	current := *updated
+	current.Status = "to_delete"
+	marked, err := ds.UpdateTrustBundle(ctx, &current)
+	require.NoError(t, err)
+	assert.Equal(t, "to_delete", marked.Status)
+	assert.Equal(t, []byte("rotated"), marked.Bundle)
+	assert.ErrorIs(t, ds.DeleteUnchangedTrustBundle(ctx, updated), ErrNotFound)
+	assert.NoError(t, ds.DeleteUnchangedTrustBundle(ctx, marked))
+
+	bundle, err = ds.SetTrustBundle(ctx, &TrustBundle{SpireServerID: server.ID, Bundle: []byte("bundle"), Status: "active"})
+	require.NoError(t, err)
+	assert.NoError(t, ds.DeleteTrustBundle(ctx, bundle.ID))
+	_, err = ds.GetTrustBundleBySpireServer(ctx, server.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	pruned, err := ds.CreateEvent(ctx, &Event{TrustDomain: "example.org", Type: "trust_bundle_pruned", Message: "pruned"})
+	require.NoError(t, err)
+	assert.False(t, pruned.CreatedAt.IsZero())
+	other, err := ds.CreateEvent(ctx, &Event{TrustDomain: "other.org", Type: "trust_bundle_pruned"})
+	require.NoError(t, err)
+	deleted, err := ds.CreateEvent(ctx, &Event{TrustDomain: "example.org", Type: "trust_bundle_deleted"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		filter   EventFilter
+		expected []*Event
+	}{
+		{name: "all", expected: []*Event{pruned, other, deleted}},
+		{name: "after", filter: EventFilter{AfterID: pruned.ID}, expected: []*Event{other, deleted}},
+		{name: "trust_domains", filter: EventFilter{TrustDomains: []string{"example.org", "third.org"}}, expected: []*Event{pruned, deleted}},
+		{name: "types", filter: EventFilter{Types: []string{"trust_bundle_deleted", "relationship_updated"}}, expected: []*Event{deleted}},
+		{name: "none", filter: EventFilter{AfterID: deleted.ID}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ds.ListEvents(ctx, tt.filter)
+			require.NoError(t, err)
+			require.Len(t, events, len(tt.expected))
+			for i, event := range events {
+				assert.Equal(t, tt.expected[i].ID, event.ID)
+				assert.Equal(t, tt.expected[i].TrustDomain, event.TrustDomain)
+				assert.Equal(t, tt.expected[i].Type, event.Type)
+				assert.Equal(t, tt.expected[i].Message, event.Message)
+				assert.True(t, tt.expected[i].CreatedAt.Equal(event.CreatedAt))
+			}
+		})
+	}
+
+	// Deleted events are not reused, and the first retained ID follows them
+	first, err := ds.FirstEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, pruned.ID, first)
+
+	n, err := ds.DeleteEventsBefore(ctx, other.CreatedAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	first, err = ds.FirstEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, first)
+
+	n, err = ds.DeleteEventsBefore(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	first, err = ds.FirstEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, deleted.ID+1, first)
+
+	next, err := ds.CreateEvent(ctx, &Event{TrustDomain: "example.org", Type: "trust_bundle_updated"})
+	require.NoError(t, err)
+	assert.Equal(t, deleted.ID+1, next.ID)
+}
+
+func TestFirstEventIDWithoutEvents(t *testing.T) {
+	first, err := newTestDatastore(t).FirstEventID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first)
+}
+
+func TestEventsCreated(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	created := ds.EventsCreated()
+	select {
+	case <-created:
+		t.Fatal("notified before any event was created")
+	default:
+	}
+
+	_, err := ds.CreateEvent(ctx, &Event{TrustDomain: "example.org", Type: "trust_bundle_updated"})
+	require.NoError(t, err)
+
+	select {
+	case <-created:
+	default:
+		t.Fatal("not notified of the created event")
+	}
+
+	// The next event is notified on a new channel
+	select {
+	case <-ds.EventsCreated():
+		t.Fatal("notified of an event created before the call")
+	default:
+	}
+}
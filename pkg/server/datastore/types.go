@@ -0,0 +1,162 @@
+package datastore
+
+import "time"
+
+// Organization is the building block of Federation Groups.
+type Organization struct {
+	ID   int64
+	Name string
+}
+
+// FederationGroup is a group of SPIRE Servers that belongs to an Organization.
+type FederationGroup struct {
+	ID     int64
+	OrgID  int64
+	Name   string
+	Status string
+}
+
+// SpireServer is the representation of a trust domain and its SPIRE Server.
+type SpireServer struct {
+	ID             int64
+	TrustDomain    string
+	Description    string
+	BundleEndpoint BundleEndpoint
+	Status         string
+}
+
+// BundleEndpoint is the SPIFFE bundle endpoint of a SPIRE Server, used by the
+// SPIRE Servers federated with it. An empty URL means that the SPIRE Server
+// does not expose a bundle endpoint.
+type BundleEndpoint struct {
+	URL      string
+	Profile  string
+	SpiffeID string
+}
+
+// Membership is the presence of a SPIRE Server in a Federation Group.
+type Membership struct {
+	ID                int64
+	SpireServerID     int64
+	FederationGroupID int64
+	Status            string
+}
+
+// Relationship is a federation relationship between two SPIRE Servers of the
+// same Federation Group. The trust domain and bundle endpoint fields are
+// read-only and are populated from the referenced SPIRE Servers.
+type Relationship struct {
+	ID                              int64
+	FederationGroupID               int64
+	SpireServerID                   int64
+	SpireServerFederatedWithID      int64
+	SpireServerConsent              string
+	SpireServerFederatedWithConsent string
+	Status                          string
+
+	SpireServerTrustDomain                 string
+	SpireServerFederatedWithTrustDomain    string
+	SpireServerBundleEndpoint              BundleEndpoint
+	SpireServerFederatedWithBundleEndpoint BundleEndpoint
+}
+
+// TrustBundle is the trust bundle of a SPIRE Server. There is at most one
+// trust bundle per SPIRE Server. The trust domain field is read-only and is
+// populated from the referenced SPIRE Server.
+type TrustBundle struct {
+	ID            int64
+	SpireServerID int64
+	Bundle        []byte
+	Status        string
+	UpdatedAt     time.Time
+	// Signature of the bundle by the harvester of the SPIRE Server, and the
+	// certificate chain to verify it with. Both are relayed as-is.
+	Signature          string
+	SigningCertificate string
+
+	TrustDomain string
+}
+
+// JoinToken is a single-use token that onboards the harvester of a SPIRE
+// Server. Only a hash of the token is persisted, so the token can not be read
+// back once created.
+type JoinToken struct {
+	ID            int64
+	SpireServerID int64
+	Token         string
+	ExpiresAt     time.Time
+}
+
+// Event records a change of the trust bundle of a SPIRE Server, such as the
+// upload of a new bundle or the pruning of its expired authorities, or a
+// change of the status of one of its federation relationships. Events
+// are identified by increasing IDs, so that harvesters can pick up the events
+// that happened since the last one they saw. The trust domain is kept as is,
+// so that events outlive the trust bundle and SPIRE Server they refer to.
+type Event struct {
+	ID          int64
+	TrustDomain string
+	Type        string
+	Message     string
+	CreatedAt   time.Time
+}
+
+// OrganizationFilter narrows down the result of ListOrganizations.
+// Empty fields are ignored.
+type OrganizationFilter struct {
+	Name string
+}
+
+// FederationGroupFilter narrows down the result of ListFederationGroups.
+// Empty fields are ignored.
+type FederationGroupFilter struct {
+	OrgID   int64
+	OrgName string
+	Name    string
+}
+
+// SpireServerFilter narrows down the result of ListSpireServers.
+// Empty fields are ignored.
+type SpireServerFilter struct {
+	TrustDomain string
+	Status      string
+}
+
+// MembershipFilter narrows down the result of ListMemberships.
+// Empty fields are ignored.
+type MembershipFilter struct {
+	OrgID             int64
+	OrgName           string
+	FederationGroupID int64
+	SpireServerID     int64
+	TrustDomain       string
+	Status            string
+}
+
+// RelationshipFilter narrows down the result of ListRelationships.
+// Empty fields are ignored. TrustDomain matches relationships where either
+// side has the given trust domain.
+type RelationshipFilter struct {
+	OrgID             int64
+	OrgName           string
+	FederationGroupID int64
+	TrustDomain       string
+	Status            string
+}
+
+// TrustBundleFilter narrows down the result of ListTrustBundles.
+// Empty fields are ignored.
+type TrustBundleFilter struct {
+	TrustDomain string
+	Status      string
+}
+
+// EventFilter narrows down the result of ListEvents.
+// Empty fields are ignored. AfterID only matches the events with a greater
+// ID, TrustDomains the events of any of the given trust domains, and Types
+// the events of any of the given types.
+type EventFilter struct {
+	AfterID      int64
+	TrustDomains []string
+	Types        []string
+}
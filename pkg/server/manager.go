@@ -2,23 +2,38 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/signal"
-	"runtime/debug"
-	"sync"
 	"syscall"
+	"time"
 
 	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/health"
+	"github.com/HewlettPackard/galadriel/pkg/common/supervisor"
 	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/common/tlsutil"
 	"github.com/HewlettPackard/galadriel/pkg/server/api"
+	"github.com/HewlettPackard/galadriel/pkg/server/api/bundle"
 	"github.com/HewlettPackard/galadriel/pkg/server/config"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/HewlettPackard/galadriel/pkg/server/pruner"
 )
 
+// serviceName identifies the Galadriel Server in the exported metrics and
+// spans.
+const serviceName = "galadriel-server"
+
 // Manager is the entity that enables managing the Galadriel Server
 type Manager struct {
-	api    api.HTTPServer
-	config config.Server
-	logger common.Logger
+	api       *api.HTTPServer
+	pruner    *pruner.Pruner
+	health    *health.Server
+	telemetry telemetry.MetricServer
+	tracer    *telemetry.Tracer
+	config    config.Server
+	datastore datastore.Datastore
+	logger    common.Logger
 }
 
 // NewManager returns a new Galadriel Server Manager
@@ -28,7 +43,8 @@ func NewManager() *Manager {
 	}
 }
 
-// Run runs the Galadriel server.
+// Run runs the Galadriel server until it receives SIGINT or SIGTERM, or one
+// of its plugins fails.
 func Run(configPath string) error {
 	m := NewManager()
 	m.logger.Info("Starting the Galadriel Server")
@@ -38,23 +54,26 @@ func Run(configPath string) error {
 		return err
 	}
 
-	m.Start()
+	if err := m.Start(); err != nil {
+		m.logger.Error("Galadriel Server failed:", err)
+		return err
+	}
 
 	return nil
 }
 
-func (m *Manager) Start() {
-	type key string
+func (m *Manager) Start() error {
 	defer m.Stop()
 
-	ctxKey := key(telemetry.PackageName)
-	ctx := context.WithValue(context.Background(), ctxKey, telemetry.Harvester)
-
-	m.run(ctx)
+	return m.run(context.Background())
 }
 
 func (m *Manager) Stop() {
-	// unload and cleanup stuff
+	if m.datastore != nil {
+		if err := m.datastore.Close(); err != nil {
+			m.logger.Error("Error closing datastore:", err)
+		}
+	}
 }
 
 func (m *Manager) load(configPath string) error {
@@ -63,42 +82,101 @@ func (m *Manager) load(configPath string) error {
 		return err
 	}
 	m.config = *c
-	m.api = api.NewHTTPServer()
-	return nil
-}
 
-func (m *Manager) run(ctx context.Context) {
-	m.logger.Info("Starting Server manager")
+	ds, err := datastore.NewSQLDatastore(context.Background(), c.DatastoreConfigSection.Driver, c.DatastoreConfigSection.ConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to load datastore: %v", err)
+	}
+	m.datastore = ds
 
-	var wg sync.WaitGroup
-	_, cancel := context.WithCancel(ctx)
-	ctx, _ = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer func() {
-		wg.Wait()
-		cancel()
-	}()
+	apiConfig := api.Config{
+		ListenAddress:           c.ServerConfigSection.ListenAddress,
+		ManagementListenAddress: c.ServerConfigSection.ManagementListenAddress,
+		Insecure:                c.ServerConfigSection.Insecure,
+	}
+	if tlsConfig := c.ServerConfigSection.TLS; tlsConfig != nil {
+		apiConfig.TLSConfig, err = tlsutil.NewServerConfig(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.CABundleFile, tlsConfig.RequireClientCert)
+		if err != nil {
+			return fmt.Errorf("failed to load tls configuration: %v", err)
+		}
+	} else if !apiConfig.Insecure {
+		return errors.New("the harvester API is served in plaintext: server.tls is required unless server.insecure is set")
+	}
+	if apiConfig.Insecure {
+		m.logger.Warn("Serving the harvester API in insecure mode: harvesters that do not authenticate are trusted to name their SPIRE Server")
+	}
 
-	plugins := []common.RunnablePlugin{
-		api.NewHTTPServer(),
+	if endpoint := c.ServerConfigSection.BundleEndpoint; endpoint != nil {
+		apiConfig.BundleEndpointListenAddress = endpoint.ListenAddress
+		apiConfig.BundleEndpointTLSConfig, err = bundle.NewTLSConfig(endpoint.Profile, endpoint.CertFile, endpoint.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load bundle endpoint configuration: %v", err)
+		}
 	}
-	wg.Add(len(plugins))
 
-	errch := make(chan error, len(plugins))
-	for _, plugin := range plugins {
-		plugin := plugin
-		go func() {
-			errch <- runTask(ctx, &wg, plugin.Run)
-		}()
+	m.api = api.NewHTTPServer(apiConfig, ds)
+
+	// The durations have been validated when loading the configuration
+	pruneInterval, err := time.ParseDuration(c.ServerConfigSection.BundlePruneInterval)
+	if err != nil {
+		return fmt.Errorf("invalid bundle prune interval: %v", err)
 	}
+	gracePeriod, err := time.ParseDuration(c.ServerConfigSection.BundleDeletionGracePeriod)
+	if err != nil {
+		return fmt.Errorf("invalid bundle deletion grace period: %v", err)
+	}
+	eventRetention, err := time.ParseDuration(c.ServerConfigSection.EventRetention)
+	if err != nil {
+		return fmt.Errorf("invalid event retention: %v", err)
+	}
+	m.pruner = pruner.New(ds, pruner.Config{
+		Interval:       pruneInterval,
+		GracePeriod:    gracePeriod,
+		EventRetention: eventRetention,
+	})
+
+	if telemetryConfig := c.TelemetryConfigSection; telemetryConfig.MetricsEnabled() {
+		metricServerConfig, err := telemetryConfig.MetricServerConfig(serviceName)
+		if err != nil {
+			return fmt.Errorf("failed to load telemetry configuration: %v", err)
+		}
+		m.telemetry = telemetry.NewLocalMetricServer(metricServerConfig)
+		telemetry.ObserveRelationships(relationshipsObserver(ds))
+		telemetry.ObserveBundles(bundlesObserver(ds))
+	}
+	if telemetryConfig := c.TelemetryConfigSection; telemetryConfig.TracingEnabled() {
+		m.tracer = telemetry.NewTracer(telemetryConfig.TracerConfig(serviceName))
+	}
+
+	if healthChecks := c.ServerConfigSection.HealthChecks; healthChecks != nil {
+		m.health = health.NewServer(healthChecks.ListenAddress, map[string]health.Check{
+			telemetry.Datastore: ds.Ping,
+			"apis":              m.api.CheckListening,
+		})
+	}
+
+	return nil
 }
 
-func runTask(ctx context.Context, wg *sync.WaitGroup, task func(context.Context) error) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v\n%s", r, string(debug.Stack()))
-		}
-		wg.Done()
-	}()
+func (m *Manager) run(ctx context.Context) error {
+	m.logger.Info("Starting Server manager")
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	plugins := []supervisor.Plugin{
+		{Name: telemetry.HTTPApi, Plugin: m.api},
+		{Name: telemetry.BundlePruner, Plugin: m.pruner},
+	}
+	if m.telemetry != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.MetricsServer, Plugin: m.telemetry})
+	}
+	if m.tracer != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.Tracing, Plugin: m.tracer})
+	}
+	if m.health != nil {
+		plugins = append(plugins, supervisor.Plugin{Name: telemetry.HealthChecks, Plugin: m.health})
+	}
 
-	return task(ctx)
+	return supervisor.Run(ctx, plugins...)
 }
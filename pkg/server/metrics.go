@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// relationshipsObserver returns the observer of the relationships stored in
+// the datastore.
+func relationshipsObserver(ds datastore.Datastore) telemetry.RelationshipsObserver {
+	return func(ctx context.Context) (map[string]int64, error) {
+		relationships, err := ds.ListRelationships(ctx, datastore.RelationshipFilter{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list relationships: %v", err)
+		}
+
+		counts := make(map[string]int64)
+		for _, relationship := range relationships {
+			counts[relationship.Status]++
+		}
+
+		return counts, nil
+	}
+}
+
+// bundlesObserver returns the observer of the trust bundles stored in the
+// datastore. The trust bundles that cannot be parsed are only observed by
+// their age.
+func bundlesObserver(ds datastore.Datastore) telemetry.BundlesObserver {
+	return func(ctx context.Context) ([]telemetry.BundleState, error) {
+		bundles, err := ds.ListTrustBundles(ctx, datastore.TrustBundleFilter{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list trust bundles: %v", err)
+		}
+
+		states := make([]telemetry.BundleState, 0, len(bundles))
+		for _, bundle := range bundles {
+			state := telemetry.BundleState{TrustDomain: bundle.TrustDomain, UpdatedAt: bundle.UpdatedAt}
+			if td, err := spiffeid.TrustDomainFromString(bundle.TrustDomain); err == nil {
+				if parsed, err := spiffebundle.Parse(td, bundle.Bundle); err == nil {
+					state = telemetry.NewBundleState(parsed, bundle.UpdatedAt)
+				}
+			}
+			states = append(states, state)
+		}
+
+		return states, nil
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatastore(t *testing.T) datastore.Datastore {
+	ds, err := datastore.NewSQLDatastore(context.Background(), datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	return ds
+}
+
+func newCA(t *testing.T, notAfter time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func TestRelationshipsObserver(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	org, err := ds.CreateOrganization(ctx, &datastore.Organization{Name: "org"})
+	require.NoError(t, err)
+	group, err := ds.CreateFederationGroup(ctx, &datastore.FederationGroup{OrgID: org.ID, Name: "group", Status: "active"})
+	require.NoError(t, err)
+
+	var ids []int64
+	for _, td := range []string{"td1.org", "td2.org", "td3.org"} {
+		server, err := ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: td, Status: "active"})
+		require.NoError(t, err)
+		ids = append(ids, server.ID)
+	}
+
+	for _, relationship := range []struct {
+		with   int64
+		status common.FederationRelationshipStatus
+	}{
+		{with: ids[1], status: common.FederationRelationshipStatusActive},
+		{with: ids[2], status: common.FederationRelationshipStatusInvited},
+	} {
+		_, err := ds.CreateRelationship(ctx, &datastore.Relationship{
+			FederationGroupID:               group.ID,
+			SpireServerID:                   ids[0],
+			SpireServerFederatedWithID:      relationship.with,
+			SpireServerConsent:              common.ConsentPending,
+			SpireServerFederatedWithConsent: common.ConsentPending,
+			Status:                          string(relationship.status),
+		})
+		require.NoError(t, err)
+	}
+
+	counts, err := relationshipsObserver(ds)(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		string(common.FederationRelationshipStatusActive):  1,
+		string(common.FederationRelationshipStatusInvited): 1,
+	}, counts)
+}
+
+func TestBundlesObserver(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t)
+
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	server, err := ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: "td1.org", Status: "active"})
+	require.NoError(t, err)
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString("td1.org"), []*x509.Certificate{newCA(t, notAfter)})
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+	stored, err := ds.SetTrustBundle(ctx, &datastore.TrustBundle{
+		SpireServerID: server.ID,
+		Bundle:        bundleBytes,
+		Status:        string(common.TrustBundleStatusActive),
+	})
+	require.NoError(t, err)
+
+	states, err := bundlesObserver(ds)(ctx)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "td1.org", states[0].TrustDomain)
+	assert.True(t, stored.UpdatedAt.Equal(states[0].UpdatedAt))
+	assert.True(t, notAfter.Equal(states[0].ExpiresAt))
+}
@@ -0,0 +1,206 @@
+package pruner
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/common/telemetry"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// Config configures the pruning of the trust bundles and events.
+type Config struct {
+	// Interval is the time between two prunings of the trust bundles.
+	Interval time.Duration
+	// GracePeriod is the time a trust bundle marked to_delete is kept before
+	// being deleted, so that operators can notice it.
+	GracePeriod time.Duration
+	// EventRetention is the time events are kept before being deleted.
+	// Harvesters that did not get the events in time must resync.
+	EventRetention time.Duration
+}
+
+// Pruner drops the expired authorities of the trust bundles stored in the
+// datastore. A trust bundle whose X.509 authorities all expired is marked
+// to_delete, and deleted once the grace period is over. Every action is
+// recorded as an event, that harvesters pick up on their next sync. Events
+// older than the retention are deleted.
+//
+// A trust bundle is only written as it was listed: one set by its harvester
+// in the meantime is left as is, and pruned on the next run.
+type Pruner struct {
+	datastore datastore.Datastore
+	config    Config
+	logger    common.Logger
+
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+func New(ds datastore.Datastore, config Config) *Pruner {
+	return &Pruner{
+		datastore: ds,
+		config:    config,
+		logger:    *common.NewLogger(telemetry.BundlePruner),
+		now:       time.Now,
+	}
+}
+
+// Run prunes the trust bundles until the context is done.
+func (p *Pruner) Run(ctx context.Context) error {
+	p.logger.Info("Starting trust bundle pruner")
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		pruneCtx, span := telemetry.StartSpan(ctx, telemetry.BundlePruner+"."+telemetry.Prune)
+		err := p.prune(pruneCtx)
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			p.logger.Error(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// prune prunes every trust bundle, then deletes the expired events. A trust
+// bundle that cannot be pruned does not stop the others from being pruned.
+func (p *Pruner) prune(ctx context.Context) error {
+	bundles, err := p.datastore.ListTrustBundles(ctx, datastore.TrustBundleFilter{})
+	if err != nil {
+		return fmt.Errorf("failed to list trust bundles: %v", err)
+	}
+
+	now := p.now()
+	for _, bundle := range bundles {
+		var err error
+		if bundle.Status == string(common.TrustBundleStatusToDelete) {
+			err = p.deleteAfterGracePeriod(ctx, bundle, now)
+		} else {
+			err = p.pruneBundle(ctx, bundle, now)
+		}
+		if errors.Is(err, datastore.ErrNotFound) {
+			p.logger.Debug("Trust bundle of", bundle.TrustDomain, "changed while being pruned, skipping it")
+			continue
+		}
+		if err != nil {
+			telemetry.CountError(ctx, telemetry.BundlePruner, telemetry.TrustBundle, telemetry.Prune, telemetry.TrustDomainAttr(bundle.TrustDomain))
+			p.logger.Error("Failed to prune trust bundle of", bundle.TrustDomain, ":", err)
+		}
+	}
+
+	deleted, err := p.datastore.DeleteEventsBefore(ctx, now.Add(-p.config.EventRetention))
+	if err != nil {
+		telemetry.CountError(ctx, telemetry.BundlePruner, telemetry.Event, telemetry.Delete)
+		return fmt.Errorf("failed to delete expired events: %v", err)
+	}
+	if deleted > 0 {
+		telemetry.Count(ctx, telemetry.BundlePruner, telemetry.Event, telemetry.Delete)
+		p.logger.Debug("Deleted", deleted, "events older than", p.config.EventRetention)
+	}
+
+	return nil
+}
+
+// pruneBundle drops the expired X.509 authorities of the trust bundle. The
+// SPIFFE bundle format has no expiry for JWT authorities, so they are only
+// retired along with the last X.509 authority, when the whole trust bundle is
+// marked to_delete: SPIRE rotates both keys with its CA, so a trust domain
+// whose X.509 authorities all expired is no longer issuing any of them.
+func (p *Pruner) pruneBundle(ctx context.Context, bundle *datastore.TrustBundle, now time.Time) error {
+	td, err := spiffeid.TrustDomainFromString(bundle.TrustDomain)
+	if err != nil {
+		return fmt.Errorf("invalid trust domain: %v", err)
+	}
+
+	parsed, err := spiffebundle.Parse(td, bundle.Bundle)
+	if err != nil {
+		return fmt.Errorf("failed to parse trust bundle: %v", err)
+	}
+
+	authorities := parsed.X509Authorities()
+	var valid []*x509.Certificate
+	for _, authority := range authorities {
+		if now.Before(authority.NotAfter) {
+			valid = append(valid, authority)
+		}
+	}
+
+	expired := len(authorities) - len(valid)
+	if expired == 0 {
+		return nil
+	}
+
+	if len(valid) == 0 {
+		bundle.Status = string(common.TrustBundleStatusToDelete)
+		if _, err := p.datastore.UpdateTrustBundle(ctx, bundle); err != nil {
+			return err
+		}
+
+		telemetry.Count(ctx, telemetry.BundlePruner, telemetry.TrustBundle, telemetry.MarkToDelete, telemetry.TrustDomainAttr(bundle.TrustDomain))
+		return p.recordEvent(ctx, bundle.TrustDomain, common.TrustBundleToDelete,
+			fmt.Sprintf("all %d X.509 authorities expired, the trust bundle will be deleted after %s", expired, p.config.GracePeriod))
+	}
+
+	// The pruned trust bundle would no longer match the signature of its
+	// harvester, so signed trust bundles are kept whole until they are marked
+	// to_delete. Harvesters drop the expired authorities when receiving them.
+	if bundle.Signature != "" {
+		return nil
+	}
+
+	parsed.SetX509Authorities(valid)
+	bundleBytes, err := parsed.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal trust bundle: %v", err)
+	}
+
+	bundle.Bundle = bundleBytes
+	if _, err := p.datastore.UpdateTrustBundle(ctx, bundle); err != nil {
+		return err
+	}
+
+	telemetry.Count(ctx, telemetry.BundlePruner, telemetry.TrustBundle, telemetry.Prune, telemetry.TrustDomainAttr(bundle.TrustDomain))
+	return p.recordEvent(ctx, bundle.TrustDomain, common.TrustBundlePruned,
+		fmt.Sprintf("dropped %d expired X.509 authorities", expired))
+}
+
+// deleteAfterGracePeriod deletes a trust bundle marked to_delete once the
+// grace period since it was marked is over.
+func (p *Pruner) deleteAfterGracePeriod(ctx context.Context, bundle *datastore.TrustBundle, now time.Time) error {
+	if now.Before(bundle.UpdatedAt.Add(p.config.GracePeriod)) {
+		return nil
+	}
+
+	if err := p.datastore.DeleteUnchangedTrustBundle(ctx, bundle); err != nil {
+		return err
+	}
+
+	telemetry.Count(ctx, telemetry.BundlePruner, telemetry.TrustBundle, telemetry.Delete, telemetry.TrustDomainAttr(bundle.TrustDomain))
+	return p.recordEvent(ctx, bundle.TrustDomain, common.TrustBundleDeleted, "deleted after the grace period")
+}
+
+func (p *Pruner) recordEvent(ctx context.Context, trustDomain string, eventType common.EventType, message string) error {
+	if _, err := p.datastore.CreateEvent(ctx, &datastore.Event{
+		TrustDomain: trustDomain,
+		Type:        string(eventType),
+		Message:     message,
+	}); err != nil {
+		return err
+	}
+
+	p.logger.Info("Trust bundle of", trustDomain, "event", eventType+":", message)
+	return nil
+}
@@ -0,0 +1,230 @@
+package pruner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HewlettPackard/galadriel/pkg/common"
+	"github.com/HewlettPackard/galadriel/pkg/server/datastore"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCA(t *testing.T, notAfter time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func setBundle(t *testing.T, ds datastore.Datastore, trustDomain string, authorities ...*x509.Certificate) *datastore.TrustBundle {
+	return setSignedBundle(t, ds, trustDomain, "", authorities...)
+}
+
+func setSignedBundle(t *testing.T, ds datastore.Datastore, trustDomain, signature string, authorities ...*x509.Certificate) *datastore.TrustBundle {
+	ctx := context.Background()
+
+	server, err := ds.CreateSpireServer(ctx, &datastore.SpireServer{TrustDomain: trustDomain, Status: "active"})
+	require.NoError(t, err)
+
+	bundle := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(trustDomain), authorities)
+	bundleBytes, err := bundle.Marshal()
+	require.NoError(t, err)
+
+	stored, err := ds.SetTrustBundle(ctx, &datastore.TrustBundle{
+		SpireServerID: server.ID,
+		Bundle:        bundleBytes,
+		Status:        string(common.TrustBundleStatusActive),
+		Signature:     signature,
+	})
+	require.NoError(t, err)
+
+	return stored
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	ds, err := datastore.NewSQLDatastore(ctx, datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	now := time.Now()
+	expired := newCA(t, now.Add(-time.Hour))
+	valid := newCA(t, now.Add(time.Hour))
+
+	setBundle(t, ds, "valid.org", valid)
+	setBundle(t, ds, "pruned.org", expired, valid)
+	setBundle(t, ds, "expired.org", expired)
+	signed := setSignedBundle(t, ds, "signed.org", "signature", expired, valid)
+
+	pruner := New(ds, Config{Interval: time.Minute, GracePeriod: time.Hour, EventRetention: 24 * time.Hour})
+	pruner.now = func() time.Time { return now }
+	require.NoError(t, pruner.prune(ctx))
+
+	bundles, err := ds.ListTrustBundles(ctx, datastore.TrustBundleFilter{})
+	require.NoError(t, err)
+	require.Len(t, bundles, 4)
+
+	statuses := make(map[string]string)
+	for _, bundle := range bundles {
+		statuses[bundle.TrustDomain] = bundle.Status
+		if bundle.TrustDomain == "signed.org" {
+			// Pruning would invalidate the signature
+			assert.Equal(t, signed.Bundle, bundle.Bundle)
+			continue
+		}
+
+		parsed, err := spiffebundle.Parse(spiffeid.RequireTrustDomainFromString(bundle.TrustDomain), bundle.Bundle)
+		require.NoError(t, err)
+		if bundle.TrustDomain != "expired.org" {
+			assert.Equal(t, []*x509.Certificate{valid}, parsed.X509Authorities(), bundle.TrustDomain)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"valid.org":   string(common.TrustBundleStatusActive),
+		"pruned.org":  string(common.TrustBundleStatusActive),
+		"expired.org": string(common.TrustBundleStatusToDelete),
+		"signed.org":  string(common.TrustBundleStatusActive),
+	}, statuses)
+
+	events, err := ds.ListEvents(ctx, datastore.EventFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "pruned.org", events[0].TrustDomain)
+	assert.Equal(t, string(common.TrustBundlePruned), events[0].Type)
+	assert.Equal(t, "dropped 1 expired X.509 authorities", events[0].Message)
+	assert.Equal(t, "expired.org", events[1].TrustDomain)
+	assert.Equal(t, string(common.TrustBundleToDelete), events[1].Type)
+
+	// Trust bundles marked to_delete are kept during the grace period
+	require.NoError(t, pruner.prune(ctx))
+	bundles, err = ds.ListTrustBundles(ctx, datastore.TrustBundleFilter{TrustDomain: "expired.org"})
+	require.NoError(t, err)
+	assert.Len(t, bundles, 1)
+
+	pruner.now = func() time.Time { return now.Add(2 * time.Hour) }
+	require.NoError(t, pruner.prune(ctx))
+
+	bundles, err = ds.ListTrustBundles(ctx, datastore.TrustBundleFilter{TrustDomain: "expired.org"})
+	require.NoError(t, err)
+	assert.Empty(t, bundles)
+
+	events, err = ds.ListEvents(ctx, datastore.EventFilter{AfterID: events[1].ID, TrustDomains: []string{"expired.org"}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, string(common.TrustBundleDeleted), events[0].Type)
+}
+
+// racingDatastore runs a callback once the trust bundles are listed, as a
+// harvester setting its trust bundle while it is being pruned.
+type racingDatastore struct {
+	datastore.Datastore
+	listed func()
+}
+
+func (d *racingDatastore) ListTrustBundles(ctx context.Context, filter datastore.TrustBundleFilter) ([]*datastore.TrustBundle, error) {
+	bundles, err := d.Datastore.ListTrustBundles(ctx, filter)
+	d.listed()
+	return bundles, err
+}
+
+func TestPruneSkipsChangedBundles(t *testing.T) {
+	ctx := context.Background()
+	ds, err := datastore.NewSQLDatastore(ctx, datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	now := time.Now()
+	expired := newCA(t, now.Add(-time.Hour))
+	valid := newCA(t, now.Add(time.Hour))
+
+	pruned := setBundle(t, ds, "pruned.org", expired, valid)
+	marked := setBundle(t, ds, "expired.org", expired)
+	deleted := setBundle(t, ds, "deleted.org", expired)
+	deleted.Status = string(common.TrustBundleStatusToDelete)
+	_, err = ds.UpdateTrustBundle(ctx, deleted)
+	require.NoError(t, err)
+
+	uploaded := make(map[int64][]byte)
+	racing := &racingDatastore{Datastore: ds, listed: func() {
+		for _, bundle := range []*datastore.TrustBundle{pruned, marked, deleted} {
+			rotated := spiffebundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString(bundle.TrustDomain), []*x509.Certificate{valid, newCA(t, now.Add(3*time.Hour))})
+			bundleBytes, err := rotated.Marshal()
+			require.NoError(t, err)
+			_, err = ds.SetTrustBundle(ctx, &datastore.TrustBundle{
+				SpireServerID: bundle.SpireServerID,
+				Bundle:        bundleBytes,
+				Status:        string(common.TrustBundleStatusActive),
+			})
+			require.NoError(t, err)
+			uploaded[bundle.ID] = bundleBytes
+		}
+	}}
+
+	pruner := New(racing, Config{Interval: time.Minute, GracePeriod: time.Hour, EventRetention: 24 * time.Hour})
+	pruner.now = func() time.Time { return now.Add(2 * time.Hour) }
+	require.NoError(t, pruner.prune(ctx))
+
+	// The trust bundles uploaded while pruning are kept as uploaded
+	bundles, err := ds.ListTrustBundles(ctx, datastore.TrustBundleFilter{})
+	require.NoError(t, err)
+	require.Len(t, bundles, 3)
+	for _, bundle := range bundles {
+		assert.Equal(t, string(common.TrustBundleStatusActive), bundle.Status, bundle.TrustDomain)
+		assert.Equal(t, uploaded[bundle.ID], bundle.Bundle, bundle.TrustDomain)
+	}
+
+	events, err := ds.ListEvents(ctx, datastore.EventFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestPruneEvents(t *testing.T) {
+	ctx := context.Background()
+	ds, err := datastore.NewSQLDatastore(ctx, datastore.SQLite3, filepath.Join(t.TempDir(), "datastore.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+
+	event, err := ds.CreateEvent(ctx, &datastore.Event{TrustDomain: "example.org", Type: string(common.TrustBundleUpdated)})
+	require.NoError(t, err)
+
+	pruner := New(ds, Config{Interval: time.Minute, GracePeriod: time.Hour, EventRetention: 24 * time.Hour})
+	pruner.now = func() time.Time { return event.CreatedAt.Add(time.Hour) }
+	require.NoError(t, pruner.prune(ctx))
+
+	events, err := ds.ListEvents(ctx, datastore.EventFilter{})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// Events are deleted once the retention is over
+	pruner.now = func() time.Time { return event.CreatedAt.Add(25 * time.Hour) }
+	require.NoError(t, pruner.prune(ctx))
+
+	events, err = ds.ListEvents(ctx, datastore.EventFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}